@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/fakechain"
+)
+
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	if err := newFakeChainCmd(logger).Execute(); err != nil {
+		exitCode := utils.ExitCode(err)
+		logger.Error("error executing command", "err", err, "exit_code", exitCode)
+		os.Exit(exitCode)
+	}
+}
+
+func newFakeChainCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fakechain",
+		Short: "serve a fake Arbitrum chain to run the commands against, without real GRT",
+		Long: "Serve an in-memory Arbitrum chain emulating the GRT, Staking, Curation, EpochManager and RewardsManager contracts, and the Horizon SubgraphService, PaymentsEscrow and GraphTallyCollector, and the TAP v1 Escrow. " +
+			"Point the --rpc-url of sendpayment and receivepayment to it to exercise them end to end. State is lost on exit.",
+		RunE: fakeChainE(logger),
+	}
+
+	cmd.Flags().String("listen", "127.0.0.1:8545", "the address to serve JSON-RPC on")
+	cmd.Flags().Uint64("chain-id", utils.ArbitrumOneChainID, "the chain ID to report, change it to exercise chain mismatches")
+	cmd.Flags().StringSlice("fund", nil, "addresses to fund with --fund-eth ETH and --fund-grt GRT")
+	cmd.Flags().Uint64("fund-eth", 1, "the ETH amount credited to each --fund address")
+	cmd.Flags().Uint64("fund-grt", 1_000_000, "the GRT amount credited to each --fund address")
+	cmd.Flags().StringSlice("indexer", nil, "addresses to stake --stake GRT for, so that they can allocate")
+	cmd.Flags().Uint64("stake", 1_000_000, "the GRT amount staked by each --indexer address")
+	cmd.Flags().Uint64("provision", 0, "the GRT amount each --indexer address provisions to the emulated SubgraphService, for the horizon backend")
+	cmd.Flags().String("horizon-profile", "", "if set, write there the network profile to pass to --network to use the emulated SubgraphService")
+	cmd.Flags().StringSlice("operator", nil, "operators to authorize, on the stake and the provision, as indexer:operator address pairs")
+	cmd.Flags().StringSlice("tally-signer", nil, "signers to authorize on the emulated GraphTallyCollector, as payer:signer address pairs")
+	cmd.Flags().StringSlice("curated", nil, "deployment IPFS hashes to signal 1000 GRT on")
+
+	return cmd
+}
+
+func fakeChainE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		listen, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return err
+		}
+
+		chainID, err := cmd.Flags().GetUint64("chain-id")
+		if err != nil {
+			return err
+		}
+
+		fund, err := cmd.Flags().GetStringSlice("fund")
+		if err != nil {
+			return err
+		}
+
+		fundETH, err := cmd.Flags().GetUint64("fund-eth")
+		if err != nil {
+			return err
+		}
+
+		fundGRT, err := cmd.Flags().GetUint64("fund-grt")
+		if err != nil {
+			return err
+		}
+
+		indexers, err := cmd.Flags().GetStringSlice("indexer")
+		if err != nil {
+			return err
+		}
+
+		stake, err := cmd.Flags().GetUint64("stake")
+		if err != nil {
+			return err
+		}
+
+		provision, err := cmd.Flags().GetUint64("provision")
+		if err != nil {
+			return err
+		}
+
+		horizonProfile, err := cmd.Flags().GetString("horizon-profile")
+		if err != nil {
+			return err
+		}
+
+		operators, err := cmd.Flags().GetStringSlice("operator")
+		if err != nil {
+			return err
+		}
+
+		tallySigners, err := cmd.Flags().GetStringSlice("tally-signer")
+		if err != nil {
+			return err
+		}
+
+		curated, err := cmd.Flags().GetStringSlice("curated")
+		if err != nil {
+			return err
+		}
+
+		chain := fakechain.New()
+		chain.SetChainID(chainID)
+
+		for _, account := range fund {
+			address, err := eth.NewAddress(account)
+			if err != nil {
+				return fmt.Errorf("invalid --fund address %q: %w", account, err)
+			}
+			chain.Fund(address, utils.ConvertToWei(fundETH), utils.ConvertToWei(fundGRT))
+		}
+
+		for _, indexer := range indexers {
+			address, err := eth.NewAddress(indexer)
+			if err != nil {
+				return fmt.Errorf("invalid --indexer address %q: %w", indexer, err)
+			}
+			chain.Stake(address, utils.ConvertToWei(stake))
+			if provision > 0 {
+				chain.Provision(address, utils.ConvertToWei(provision))
+			}
+		}
+
+		for _, pair := range operators {
+			indexer, operator, found := strings.Cut(pair, ":")
+			if !found {
+				return fmt.Errorf("invalid --operator %q, expected indexer:operator", pair)
+			}
+			indexerAddress, err := eth.NewAddress(indexer)
+			if err != nil {
+				return fmt.Errorf("invalid --operator indexer %q: %w", indexer, err)
+			}
+			operatorAddress, err := eth.NewAddress(operator)
+			if err != nil {
+				return fmt.Errorf("invalid --operator operator %q: %w", operator, err)
+			}
+			chain.SetOperator(indexerAddress, operatorAddress, true)
+			chain.SetProvisionOperator(indexerAddress, operatorAddress, true)
+		}
+
+		for _, pair := range tallySigners {
+			payer, signer, found := strings.Cut(pair, ":")
+			if !found {
+				return fmt.Errorf("invalid --tally-signer %q, expected payer:signer", pair)
+			}
+			payerAddress, err := eth.NewAddress(payer)
+			if err != nil {
+				return fmt.Errorf("invalid --tally-signer payer %q: %w", payer, err)
+			}
+			signerAddress, err := eth.NewAddress(signer)
+			if err != nil {
+				return fmt.Errorf("invalid --tally-signer signer %q: %w", signer, err)
+			}
+			chain.AuthorizeTallySigner(payerAddress, signerAddress)
+		}
+
+		for _, deploymentID := range curated {
+			deployment, err := utils.ConvertIPFSHashToByteString(deploymentID)
+			if err != nil {
+				return fmt.Errorf("invalid --curated deployment %q: %w", deploymentID, err)
+			}
+			chain.Signal(deployment, utils.ConvertToWei(1000))
+		}
+
+		if horizonProfile != "" {
+			content, err := json.MarshalIndent(chain.HorizonProfile(), "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(horizonProfile, content, 0644); err != nil {
+				return fmt.Errorf("writing horizon profile: %w", err)
+			}
+		}
+
+		url, stop, err := chain.Start(listen)
+		if err != nil {
+			return err
+		}
+		defer stop()
+
+		logger.Info("serving fake chain", "url", url, "chain_id", chainID)
+
+		ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		<-ctx.Done()
+
+		return nil
+	}
+}
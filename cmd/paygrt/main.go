@@ -3,12 +3,19 @@ package main
 import (
 	"encoding/hex"
 	"fmt"
+	"math/big"
+	"os"
 	"strconv"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	. "github.com/streamingfast/cli"
+	"github.com/streamingfast/cli/sflags"
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
 	"github.com/streamingfast/logging"
 	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/proof"
 )
 
 // Injected at build time
@@ -26,11 +33,30 @@ func main() {
 		Execute(run),
 
 		ExactArgs(3),
+		Flags(func(flags *pflag.FlagSet) {
+			flags.String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url used for preflight checks, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var. When empty, preflight checks are skipped")
+			flags.String("rewards-policy", utils.RewardsPolicyWarn, "what to do when the generated deployment would earn indexing rewards (not deny-listed and signalled), one of: warn, fail")
+			flags.String("reference", "", "a payment reference (invoice number, UUID, or 0x-prefixed 32 bytes hash of an external document) recorded in the allocateFrom _metadata. Text longer than 32 bytes is stored as its keccak256 hash")
+			flags.String("manifest-template", "", "a Go text/template file for the deployment manifest, with fields .UID, .CustomerID, .InvoiceReference, .BillingPeriod and .PayerAddress. If empty, the default payment manifest is used")
+			flags.String("customer-id", "", "the customer ID made available to the manifest template")
+			flags.String("invoice-reference", "", "the invoice reference made available to the manifest template")
+			flags.String("billing-period", "", "the billing period made available to the manifest template, e.g. 2025-07")
+			flags.String("payer-address", "", "the payer (SAFE) address made available to the manifest template")
+			flags.Bool("deterministic", false, "derive the manifest uid from the customer ID, invoice reference, billing period and payer address so the same invoice always maps to the same deployment")
+			flags.String("manifest-dir", ".", "the directory where the uploaded manifest is saved as <deployment-id>.yaml for auditing. Set to empty to disable")
+			flags.String("network", utils.DefaultNetworkProfile(), "the network profile, a built-in name (arbitrum-one) or a JSON profile file. A profile with the horizon backend opens the allocation through SubgraphService and deposits the payment in PaymentsEscrow. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+			flags.String("rpc-record", "", "record every JSON-RPC exchange of the preflight checks as a fixture file in this directory")
+			flags.String("rpc-replay", "", "answer the preflight checks JSON-RPC requests from the fixtures recorded in this directory instead of the rpc url, failing on any request that was not recorded")
+		}),
 		Description(`
 			Write a SAFE multi-transaction JSON snippet for GRT payment on the network.
+
+			When an RPC url is available, the indexer's free stake is checked before
+			writing the batch so that allocateFrom does not revert.
 		`),
 		Example(`
 			paygrt 20 2 0x35917C0eB91d2E21BEF40940D028940484230c06
+			paygrt 20 2 0x35917C0eB91d2E21BEF40940D028940484230c06 --customer-id acme --invoice-reference INV-2025-07 --billing-period 2025-07 --deterministic
 		`),
 
 		ConfigureVersion(version),
@@ -52,18 +78,62 @@ func run(cmd *cobra.Command, args []string) error {
 
 	indexerAddress := args[2]
 
-	allocationIDBytes, proofBytes, err := utils.GenerateAllocationIDAndProof(indexerAddress)
+	metadata, err := utils.EncodeReference(sflags.MustGetString(cmd, "reference"))
+	if err != nil {
+		return err
+	}
+
+	if err := utils.SetRPCFixtures(sflags.MustGetString(cmd, "rpc-record"), sflags.MustGetString(cmd, "rpc-replay")); err != nil {
+		return err
+	}
+
+	profile, err := utils.LoadNetworkProfile(sflags.MustGetString(cmd, "network"))
+	if err != nil {
+		return err
+	}
+	if profile.Horizon() && (profile.PaymentsEscrow == "" || profile.GraphTallyCollector == "") {
+		return fmt.Errorf("network profile %s: horizon payments require payments_escrow and graph_tally_collector", profile.Name)
+	}
+
+	allocationKey, err := utils.NewAllocationKey()
+	if err != nil {
+		return err
+	}
+
+	var allocationIDBytes, proofBytes []byte
+	if profile.Horizon() {
+		allocationIDBytes, proofBytes, err = proof.CreateHorizon(indexerAddress, profile.SubgraphService, new(big.Int).SetUint64(profile.ChainID), allocationKey)
+	} else {
+		allocationIDBytes, proofBytes, err = proof.Create(indexerAddress, allocationKey)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to generate allocation ID and proof: %w", err)
 	}
 	allocationID := "0x" + hex.EncodeToString(allocationIDBytes)
-	proof := "0x" + hex.EncodeToString(proofBytes)
+	proofHex := "0x" + hex.EncodeToString(proofBytes)
 
-	deploymentQM, err := utils.GenerateDeployment()
+	deploymentQM, manifest, err := utils.GenerateManifestDeployment(utils.ManifestOptions{
+		TemplateFile:  sflags.MustGetString(cmd, "manifest-template"),
+		Deterministic: sflags.MustGetBool(cmd, "deterministic"),
+		Params: utils.ManifestParams{
+			CustomerID:       sflags.MustGetString(cmd, "customer-id"),
+			InvoiceReference: sflags.MustGetString(cmd, "invoice-reference"),
+			BillingPeriod:    sflags.MustGetString(cmd, "billing-period"),
+			PayerAddress:     sflags.MustGetString(cmd, "payer-address"),
+		},
+	})
 	if err != nil {
 		return fmt.Errorf("generating deployment ID: %w", err)
 	}
 
+	if manifestDir := sflags.MustGetString(cmd, "manifest-dir"); manifestDir != "" {
+		manifestPath, err := utils.WriteManifest(manifestDir, deploymentQM, manifest)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Manifest of deployment %s written to %s\n", deploymentQM, manifestPath)
+	}
+
 	deploymentBytes, err := utils.ConvertIPFSHashToByteString(deploymentQM)
 	if err != nil {
 		return fmt.Errorf("failed to convert deployment ID to byte string: %w", err)
@@ -71,11 +141,41 @@ func run(cmd *cobra.Command, args []string) error {
 
 	deploymentID := "0x" + hex.EncodeToString(deploymentBytes)
 
+	if rpcUrl := sflags.MustGetString(cmd, "rpc-url"); rpcUrl != "" {
+		if err := preflight(cmd, utils.NewRPCClient(rpcUrl), profile, indexerAddress, deploymentQM, allocAmountGRT); err != nil {
+			return err
+		}
+	} else if profile.Horizon() {
+		fmt.Fprintln(os.Stderr, "No --rpc-url provided, skipping indexer provision capacity and rewards checks")
+	} else {
+		fmt.Fprintln(os.Stderr, "No --rpc-url provided, skipping indexer stake capacity, epoch and rewards checks")
+		fmt.Fprintln(os.Stderr, "Warning: this batch opens and closes the allocation together, but closing an allocation in the epoch it was opened reverts. "+
+			"The Safe executes the batch atomically: when closeAllocation reverts, the whole batch reverts, payment included. "+
+			"Remove the closeAllocation transaction from the batch and close the allocation with `receivepayment close-allocation` in a later epoch.")
+	}
+
+	if profile.Horizon() {
+		if sflags.MustGetString(cmd, "reference") != "" {
+			fmt.Fprintln(os.Stderr, "Warning: Horizon allocations carry no metadata, the reference is not recorded on-chain")
+		}
+
+		batch, err := horizonBatch(profile, indexerAddress, deploymentBytes, allocationID, proofBytes, allocAmountGRT, payAmountGRT)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "The payment is deposited in PaymentsEscrow for the indexer and collected by it against a RAV. "+
+			"Close allocation %s with `receivepayment close-allocation --network %s` once the fees are collected.\n", allocationID, profile.Name)
+
+		fmt.Println(batch)
+		return nil
+	}
+
 	json := generateJSON(
 		indexerAddress,
 		deploymentID,
 		allocationID,
-		proof,
+		"0x"+hex.EncodeToString(metadata),
+		proofHex,
 		allocAmountGRT,
 		payAmountGRT,
 	)
@@ -85,10 +185,89 @@ func run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// preflight checks the indexer capacity, the epoch and the rewards policy of
+// the generated deployment, reading them in a single batch request.
+func preflight(cmd *cobra.Command, rpcClient *ethrpc.Client, profile *utils.NetworkProfile, indexerAddress string, deploymentQM string, allocAmountGRT uint64) error {
+	rewardsPolicy := sflags.MustGetString(cmd, "rewards-policy")
+	if err := utils.ValidateRewardsPolicy(rewardsPolicy); err != nil {
+		return err
+	}
+
+	indexer, err := eth.NewAddress(indexerAddress)
+	if err != nil {
+		return fmt.Errorf("invalid indexer address %q: %w", indexerAddress, err)
+	}
+
+	batch := utils.NewBatch(rpcClient)
+	provision := &utils.ProvisionCapacity{}
+	stake := &utils.IndexerStake{}
+	epoch := &utils.EpochInfo{}
+	if profile.Horizon() {
+		batch.ProvisionCapacity(profile, indexer, provision)
+	} else {
+		batch.IndexerStake(indexer, stake)
+		batch.EpochInfo(epoch)
+	}
+	rewardsCheck := &utils.RewardsCheck{}
+	batch.RewardsCheck(deploymentQM, rewardsCheck)
+	if err := batch.Do(cmd.Context()); err != nil {
+		return fmt.Errorf("failed preflight checks: %w", err)
+	}
+
+	if profile.Horizon() {
+		fmt.Fprintln(os.Stderr, provision)
+		if err := provision.CheckCapacity(utils.ConvertToWei(allocAmountGRT)); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, stake)
+		if err := stake.CheckCapacity(utils.ConvertToWei(allocAmountGRT)); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: this batch opens and closes the allocation together, but closing an allocation in the epoch it was opened reverts. "+
+			"The Safe executes the batch atomically: when closeAllocation reverts, the whole batch reverts, payment included. "+
+			"Remove the closeAllocation transaction from the batch and close the allocation with `receivepayment close-allocation` once epoch %d starts, in about %s (%d blocks).\n", epoch.CurrentEpoch+1, epoch.NextEpochETA(), epoch.BlocksUntilNextEpoch())
+	}
+
+	fmt.Fprintln(os.Stderr, rewardsCheck)
+	return rewardsCheck.ApplyPolicy(rewardsPolicy)
+}
+
+// horizonBatch opens the allocation through SubgraphService startService,
+// then deposits the payment in PaymentsEscrow for the indexer, collectable
+// through GraphTallyCollector.
+func horizonBatch(profile *utils.NetworkProfile, indexerAddress string, deploymentID []byte, allocationID string, proofBytes []byte, allocAmountGRT uint64, payAmountGRT uint64) (string, error) {
+	serviceData, err := utils.EncodeStartServiceData(deploymentID, utils.ConvertToWei(allocAmountGRT), eth.MustNewAddress(allocationID), proofBytes)
+	if err != nil {
+		return "", err
+	}
+
+	payAmount := utils.ConvertToWei(payAmountGRT).String()
+
+	batch := utils.NewSafeBatch(profile.ChainID, "")
+	batch.Add(profile.SubgraphService, "startService",
+		utils.SafeArg{Name: "indexer", Type: "address", Value: eth.MustNewAddress(indexerAddress).Pretty()},
+		utils.SafeArg{Name: "data", Type: "bytes", Value: eth.Hex(serviceData).Pretty()},
+	)
+	batch.Add(utils.GRTTokenContractAddress, "approve",
+		utils.SafeArg{Name: "spender", Type: "address", Value: profile.PaymentsEscrow},
+		utils.SafeArg{Name: "amount", Type: "uint256", Value: payAmount},
+	)
+	batch.Add(profile.PaymentsEscrow, "deposit",
+		utils.SafeArg{Name: "collector", Type: "address", Value: profile.GraphTallyCollector},
+		utils.SafeArg{Name: "receiver", Type: "address", Value: eth.MustNewAddress(indexerAddress).Pretty()},
+		utils.SafeArg{Name: "tokens", Type: "uint256", Value: payAmount},
+	)
+
+	return batch.JSON()
+}
+
 func generateJSON(
 	indexerAddress string,
 	deploymentID string,
 	allocationID string,
+	metadata string,
 	proof string,
 	allocAmountGRT uint64,
 	payAmountGRT uint64,
@@ -100,6 +279,7 @@ func generateJSON(
 		deploymentID,
 		allocAmount,
 		allocationID,
+		metadata,
 		proof,
 		utils.ConvertToWei(allocAmountGRT+payAmountGRT).String(),
 		payAmount,
@@ -108,4 +288,4 @@ func generateJSON(
 	)
 }
 
-var jsonTemplate = `{"version":"1.0","chainId":"42161","createdAt":1754409348371,"meta":{"name":"Transactions Batch","description":"","txBuilderVersion":"1.18.0","createdFromSafeAddress":"","createdFromOwnerAddress":"","checksum":"0x6079306dfaa34e44e083b9218d570236d5d94bed1a6601ab765398db8fe87b8a"},"transactions":[{"to":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"address","name":"_indexer","type":"address"},{"internalType":"bytes32","name":"_subgraphDeploymentID","type":"bytes32"},{"internalType":"uint256","name":"_tokens","type":"uint256"},{"internalType":"address","name":"_allocationID","type":"address"},{"internalType":"bytes32","name":"_metadata","type":"bytes32"},{"internalType":"bytes","name":"_proof","type":"bytes"}],"name":"allocateFrom","payable":false},"contractInputsValues":{"_indexer":"%s","_subgraphDeploymentID":"%s","_tokens":"%s","_allocationID":"%s","_metadata":"0x0000000000000000000000000000000000000000000000000000000000000000","_proof":"%s"}},{"to":"0x9623063377AD1B27544C965cCd7342f7EA7e88C7","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"address","name":"spender","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"}],"name":"approve","payable":false},"contractInputsValues":{"spender":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","amount":"%s"}},{"to":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"uint256","name":"_tokens","type":"uint256"},{"internalType":"address","name":"_allocationID","type":"address"}],"name":"collect","payable":false},"contractInputsValues":{"_tokens":"%s","_allocationID":"%s"}},{"to":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"address","name":"_allocationID","type":"address"},{"internalType":"bytes32","name":"_poi","type":"bytes32"}],"name":"closeAllocation","payable":false},"contractInputsValues":{"_allocationID":"%s","_poi":"0x0"}}]}`
+var jsonTemplate = `{"version":"1.0","chainId":"42161","createdAt":1754409348371,"meta":{"name":"Transactions Batch","description":"","txBuilderVersion":"1.18.0","createdFromSafeAddress":"","createdFromOwnerAddress":"","checksum":"0x6079306dfaa34e44e083b9218d570236d5d94bed1a6601ab765398db8fe87b8a"},"transactions":[{"to":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"address","name":"_indexer","type":"address"},{"internalType":"bytes32","name":"_subgraphDeploymentID","type":"bytes32"},{"internalType":"uint256","name":"_tokens","type":"uint256"},{"internalType":"address","name":"_allocationID","type":"address"},{"internalType":"bytes32","name":"_metadata","type":"bytes32"},{"internalType":"bytes","name":"_proof","type":"bytes"}],"name":"allocateFrom","payable":false},"contractInputsValues":{"_indexer":"%s","_subgraphDeploymentID":"%s","_tokens":"%s","_allocationID":"%s","_metadata":"%s","_proof":"%s"}},{"to":"0x9623063377AD1B27544C965cCd7342f7EA7e88C7","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"address","name":"spender","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"}],"name":"approve","payable":false},"contractInputsValues":{"spender":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","amount":"%s"}},{"to":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"uint256","name":"_tokens","type":"uint256"},{"internalType":"address","name":"_allocationID","type":"address"}],"name":"collect","payable":false},"contractInputsValues":{"_tokens":"%s","_allocationID":"%s"}},{"to":"0x00669A4CF01450B64E8A2A20E9b1FCB71E61eF03","value":"0","data":null,"contractMethod":{"inputs":[{"internalType":"address","name":"_allocationID","type":"address"},{"internalType":"bytes32","name":"_poi","type":"bytes32"}],"name":"closeAllocation","payable":false},"contractInputsValues":{"_allocationID":"%s","_poi":"0x0"}}]}`
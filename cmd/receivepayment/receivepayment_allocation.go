@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+func newAllocationCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "allocation",
+		Short: "inspect allocations",
+	}
+
+	cmd.AddCommand(newAllocationShowCmd(logger))
+	cmd.AddCommand(newAllocationListCmd(logger))
+
+	return cmd
+}
+
+func newAllocationShowCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <allocation-id>",
+		Short: "show the on-chain state of an allocation",
+		Args:  cobra.ExactArgs(1),
+		RunE:  allocationShowE(logger),
+	}
+
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("output", "text", "the output format, one of: text, json")
+	cmd.Flags().Bool("skip-reference", false, "do not look up the AllocationCreated event to decode the allocation payment reference")
+
+	return cmd
+}
+
+type allocationView struct {
+	AllocationID         string `json:"allocationId"`
+	Indexer              string `json:"indexer"`
+	DeploymentID         string `json:"deploymentId"`
+	SubgraphDeploymentID string `json:"subgraphDeploymentId"`
+	Tokens               string `json:"tokens"`
+	CreatedAtEpoch       uint64 `json:"createdAtEpoch"`
+	ClosedAtEpoch        uint64 `json:"closedAtEpoch"`
+	CollectedFees        string `json:"collectedFees"`
+	State                string `json:"state"`
+	Metadata             string `json:"metadata,omitempty"`
+	Reference            string `json:"reference,omitempty"`
+}
+
+func allocationShowE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		rpcUrl, err := cmd.Flags().GetString("rpc-url")
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("invalid output format %q, must be one of: text, json", output)
+		}
+
+		skipReference, err := cmd.Flags().GetBool("skip-reference")
+		if err != nil {
+			return err
+		}
+
+		allocationID, err := eth.NewAddress(args[0])
+		if err != nil {
+			return utils.Usagef("invalid allocation ID %q: %s", args[0], err)
+		}
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		if _, err := utils.NewChain(rpcClient, utils.ArbitrumOneChainID).ChainID(ctx); err != nil {
+			return err
+		}
+
+		allocation, err := utils.GetAllocationCall(ctx, rpcClient, allocationID.Pretty())
+		if err != nil {
+			return fmt.Errorf("failed to fetch allocation: %w", err)
+		}
+
+		state, err := utils.GetAllocationStateCall(ctx, rpcClient, allocationID.Pretty())
+		if err != nil {
+			return fmt.Errorf("failed to fetch allocation state: %w", err)
+		}
+
+		deploymentID, err := utils.ConvertByteStringToIPFSHash(allocation.SubgraphDeploymentID)
+		if err != nil {
+			return fmt.Errorf("failed to convert deployment ID: %w", err)
+		}
+
+		view := &allocationView{
+			AllocationID:         allocationID.Pretty(),
+			Indexer:              allocation.Indexer.Pretty(),
+			DeploymentID:         deploymentID,
+			SubgraphDeploymentID: "0x" + hex.EncodeToString(allocation.SubgraphDeploymentID),
+			Tokens:               allocation.Tokens.String(),
+			CreatedAtEpoch:       allocation.CreatedAtEpoch.Uint64(),
+			ClosedAtEpoch:        allocation.ClosedAtEpoch.Uint64(),
+			CollectedFees:        allocation.CollectedFees.String(),
+			State:                state.String(),
+		}
+
+		if !skipReference && state != utils.AllocationStateNull {
+			created, err := utils.FindAllocationCreatedEvent(ctx, rpcClient, allocationID, allocation.Indexer, allocation.SubgraphDeploymentID, utils.StakingDeploymentBlock)
+			if err != nil {
+				return fmt.Errorf("failed to look up allocation creation: %w", err)
+			}
+			if created != nil {
+				view.Metadata = "0x" + hex.EncodeToString(created.Metadata)
+				view.Reference = utils.DecodeReference(created.Metadata)
+			}
+		}
+
+		if output == "json" {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(view)
+		}
+
+		fmt.Println("Allocation ID:    ", view.AllocationID)
+		fmt.Println("State:            ", view.State)
+		fmt.Println("Indexer:          ", view.Indexer)
+		fmt.Println("Deployment ID:    ", view.DeploymentID)
+		fmt.Println("Tokens:           ", utils.FormatGRT(allocation.Tokens))
+		fmt.Println("Created at epoch: ", view.CreatedAtEpoch)
+		fmt.Println("Closed at epoch:  ", view.ClosedAtEpoch)
+		fmt.Println("Collected fees:   ", utils.FormatGRT(allocation.CollectedFees))
+		if view.Reference != "" {
+			fmt.Println("Reference:        ", view.Reference)
+		}
+
+		return nil
+	}
+}
+
+func newAllocationListCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the allocations of an indexer from the Staking AllocationCreated/AllocationClosed events",
+		RunE:  allocationListE(logger),
+	}
+
+	cmd.Flags().String("indexer", "", "the indexer address to list allocations for")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().Uint64("from-block", utils.StakingDeploymentBlock, "the block to start scanning logs from")
+	cmd.Flags().Uint64("to-block", 0, "the last block to scan logs to. If 0, the latest block is used")
+	cmd.Flags().Uint64("chunk-size", 10_000, "the maximum number of blocks requested per eth_getLogs call")
+	cmd.Flags().String("cache-file", "", "an optional file caching scanned allocations, later scans only fetch blocks after the last scanned one")
+	cmd.Flags().Bool("open-only", false, "only list allocations that are still open")
+	cmd.Flags().String("output", "text", "the output format, one of: text, json")
+
+	return cmd
+}
+
+// allocationListCache is persisted by `allocation list --cache-file` to scan
+// incrementally.
+type allocationListCache struct {
+	Indexer     string              `json:"indexer"`
+	FromBlock   uint64              `json:"fromBlock"`
+	ScannedTo   uint64              `json:"scannedTo"`
+	Allocations utils.AllocationSet `json:"allocations"`
+}
+
+func loadAllocationListCache(path string, indexer string, fromBlock uint64) (*allocationListCache, error) {
+	fresh := &allocationListCache{Indexer: indexer, FromBlock: fromBlock, Allocations: utils.AllocationSet{}}
+	if path == "" {
+		return fresh, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cache file %q: %w", path, err)
+	}
+
+	cache := &allocationListCache{}
+	if err := json.Unmarshal(content, cache); err != nil {
+		return nil, fmt.Errorf("decoding cache file %q: %w", path, err)
+	}
+
+	// A cache built for another indexer or a later start block cannot be reused
+	if !strings.EqualFold(cache.Indexer, indexer) || cache.FromBlock > fromBlock || cache.Allocations == nil {
+		return fresh, nil
+	}
+
+	return cache, nil
+}
+
+func (c *allocationListCache) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, content)
+}
+
+func allocationListE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		rpcUrl, err := cmd.Flags().GetString("rpc-url")
+		if err != nil {
+			return err
+		}
+
+		indexerFlag, err := cmd.Flags().GetString("indexer")
+		if err != nil {
+			return err
+		}
+		indexer, err := utils.ParseAddress("indexer", indexerFlag)
+		if err != nil {
+			return err
+		}
+
+		fromBlock, err := cmd.Flags().GetUint64("from-block")
+		if err != nil {
+			return err
+		}
+
+		toBlock, err := cmd.Flags().GetUint64("to-block")
+		if err != nil {
+			return err
+		}
+
+		chunkSize, err := cmd.Flags().GetUint64("chunk-size")
+		if err != nil {
+			return err
+		}
+
+		cacheFile, err := cmd.Flags().GetString("cache-file")
+		if err != nil {
+			return err
+		}
+
+		openOnly, err := cmd.Flags().GetBool("open-only")
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("invalid output format %q, must be one of: text, json", output)
+		}
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		if _, err := utils.NewChain(rpcClient, utils.ArbitrumOneChainID).ChainID(ctx); err != nil {
+			return err
+		}
+
+		if toBlock == 0 {
+			toBlock, err = rpcClient.LatestBlockNum(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to fetch latest block: %w", err)
+			}
+		}
+
+		cache, err := loadAllocationListCache(cacheFile, indexer.Pretty(), fromBlock)
+		if err != nil {
+			return err
+		}
+
+		scanFrom := fromBlock
+		if cache.ScannedTo >= scanFrom {
+			scanFrom = cache.ScannedTo + 1
+		}
+
+		if scanFrom <= toBlock {
+			logger.Info("scanning allocation events", "indexer", indexer.Pretty(), "from_block", scanFrom, "to_block", toBlock)
+
+			err = utils.ScanAllocationEvents(ctx, rpcClient, utils.AllocationEventFilter{Indexer: indexer}, scanFrom, toBlock, chunkSize, func(created []*utils.AllocationCreatedEvent, closed []*utils.AllocationClosedEvent, scannedTo uint64) error {
+				cache.Allocations.Apply(created, closed)
+				cache.ScannedTo = scannedTo
+
+				return cache.save(cacheFile)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to scan allocation events: %w", err)
+			}
+		}
+
+		var allocations []*utils.AllocationSummary
+		for _, allocation := range cache.Allocations.Sorted() {
+			if openOnly && !allocation.IsOpen() {
+				continue
+			}
+			allocations = append(allocations, allocation)
+		}
+
+		if output == "json" {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(allocations)
+		}
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ALLOCATION ID\tSTATUS\tDEPLOYMENT ID\tTOKENS\tCREATED EPOCH\tCLOSED EPOCH")
+		for _, allocation := range allocations {
+			status, closedAtEpoch := "Active", "-"
+			if !allocation.IsOpen() {
+				status, closedAtEpoch = "Closed", fmt.Sprint(allocation.ClosedAtEpoch)
+			}
+
+			tokens, _ := new(big.Int).SetString(allocation.Tokens, 10)
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\n", allocation.AllocationID, status, allocation.DeploymentID, utils.FormatGRT(tokens), allocation.CreatedAtEpoch, closedAtEpoch)
+		}
+
+		return writer.Flush()
+	}
+}
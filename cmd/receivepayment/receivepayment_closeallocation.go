@@ -1,21 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/streamingfast/eth-go"
-	ethrpc "github.com/streamingfast/eth-go/rpc"
-	"github.com/streamingfast/eth-go/signer/native"
 	"github.com/streamingfast/network-payments-cli/cmd/utils"
-	"go.uber.org/zap"
 )
 
+// epochPollInterval is how often --wait reads the current epoch.
+var epochPollInterval = time.Minute
+
 func newCloseAllocationCmd(logger *slog.Logger) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "close-allocation",
@@ -26,8 +27,11 @@ func newCloseAllocationCmd(logger *slog.Logger) *cobra.Command {
 	cmd.Flags().String("private-key-file", "", "the private key file (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
 	cmd.Flags().String("allocation-id", "", "the allocation ID to close")
 	cmd.Flags().String("deployment-id", "", "the deployment ID of the service being allocated to. Optional, but recommended to ensure that no curation has been applied to the deployment")
-	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a built-in name (arbitrum-one) or a JSON profile file. A profile with the horizon backend closes the allocation through SubgraphService. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
 	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where the transaction is recorded. Set to empty to disable")
+	cmd.Flags().Bool("wait", false, "if the allocation was opened in the current epoch, wait until the next epoch to close it instead of failing")
 
 	return cmd
 }
@@ -44,12 +48,22 @@ func closeAllocationE(logger *slog.Logger) func(cmd *cobra.Command, args []strin
 			return err
 		}
 
-		allocationID, err := cmd.Flags().GetString("allocation-id")
+		network, err := cmd.Flags().GetString("network")
+		if err != nil {
+			return err
+		}
+		profile, err := utils.LoadNetworkProfile(network)
+		if err != nil {
+			return err
+		}
+
+		allocationFlag, err := cmd.Flags().GetString("allocation-id")
 		if err != nil {
 			return err
 		}
-		if allocationID == "" {
-			return fmt.Errorf("allocation ID is required")
+		allocationID, err := utils.ParseAddress("allocation-id", allocationFlag)
+		if err != nil {
+			return err
 		}
 
 		deploymentID, err := cmd.Flags().GetString("deployment-id")
@@ -62,46 +76,96 @@ func closeAllocationE(logger *slog.Logger) func(cmd *cobra.Command, args []strin
 			return err
 		}
 
-		var privateKey *eth.PrivateKey
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			return err
+		}
+
+		ledgerFile, err := cmd.Flags().GetString("ledger-file")
+		if err != nil {
+			return err
+		}
+		ledger := utils.NewLedger(ledgerFile)
+
 		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
 		if err != nil {
 			return err
 		}
-		if privateKeyFile == "" {
-			privateKey, err = eth.NewPrivateKey(os.Getenv("NETWORK_PAYMENT_PRIVATE_KEY"))
-			if err != nil {
-				return fmt.Errorf("import private key: %s", err)
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		ctx = utils.WithPrivateKey(ctx, privateKey)
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		chain := utils.NewChain(rpcClient, profile.ChainID)
+
+		if profile.Horizon() {
+			if _, err := chain.ChainID(ctx); err != nil {
+				return err
 			}
-		} else {
-			pkBytes, err := os.ReadFile(privateKeyFile)
-			if err != nil {
-				return fmt.Errorf("read private key file: %s", err)
+
+			closeTrx, ledgerEntry, err := stopService(ctx, profile, chain, privateKey, allocationID, deploymentID, gasPrice)
+			if ledgerEntry != nil {
+				if recordErr := ledger.Record(ctx, chain, ledgerEntry, closeTrx, err); recordErr != nil {
+					logger.Warn("unable to record allocation close in ledger", "ledger_file", ledgerFile, "err", recordErr)
+				}
 			}
-			pkHex := strings.TrimSpace(string(pkBytes))
-			privateKey, err = eth.NewPrivateKey(pkHex)
 			if err != nil {
-				return fmt.Errorf("import private key: %s", err)
+				return err
 			}
+
+			fmt.Println("Allocation closed successfully")
+			fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", closeTrx)
+
+			return nil
 		}
-		if privateKey == nil || privateKey.String() == "" {
-			return fmt.Errorf("private key is required, either through the NETWORK_PAYMENT_PRIVATE_KEY environment variable or --private-key-file flag")
+
+		// the operator check needs the indexer of the allocation, it is the
+		// only read left out of the batch and costs nothing when the signer
+		// is the indexer
+		preflight := utils.NewBatch(rpcClient)
+		chain.AddChainID(preflight)
+		allocation := &utils.Allocation{}
+		preflight.Allocation(allocationID, allocation)
+		epoch := &utils.EpochInfo{}
+		preflight.EpochInfo(epoch)
+		var isCurated bool
+		if deploymentID != "" {
+			preflight.IsCurated(deploymentID, &isCurated)
+		}
+		if err := preflight.Do(ctx); err != nil {
+			return fmt.Errorf("failed preflight checks: %w", err)
 		}
 
-		ctx = utils.WithPrivateKey(ctx, privateKey)
+		if bytes.Equal(allocation.Indexer, make([]byte, 20)) {
+			return fmt.Errorf("allocation %s does not exist", allocationID.Pretty())
+		}
 
-		rpcClient := ethrpc.NewClient(rpcUrl)
+		if err := utils.CheckOperator(ctx, rpcClient, privateKey.PublicKey().Address(), allocation.Indexer); err != nil {
+			return err
+		}
 
-		if deploymentID != "" {
-			isCurated, err := utils.IsCuratedCall(ctx, rpcClient, deploymentID)
-			if err != nil {
-				return fmt.Errorf("failed to check if curated: %w", err)
+		if isCurated {
+			return fmt.Errorf("deployment has curation and cannot be paid to. please generate a different deployment and open a new allocation")
+		}
+
+		if err := utils.CheckCanCloseAllocation(epoch, allocation); err != nil {
+			if !wait {
+				return fmt.Errorf("%w. use --wait to close it once the epoch advances", err)
 			}
-			if isCurated {
-				return fmt.Errorf("deployment has curation and cannot be paid to. please generate a different deployment and open a new allocation")
+
+			fmt.Println(err)
+			if _, err := utils.WaitForEpoch(ctx, rpcClient, allocation.CreatedAtEpoch.Uint64()+1, epochPollInterval); err != nil {
+				return fmt.Errorf("waiting for next epoch: %w", err)
 			}
 		}
 
-		closeTrx, err := closeAllocationCall(ctx, utils.StakingContractAddress, privateKey.PublicKey().Address().String(), rpcClient, allocationID, gasPrice)
+		closeTrx, err := closeAllocationCall(ctx, eth.MustNewAddress(utils.StakingContractAddress), privateKey.PublicKey().Address(), chain, allocationID, gasPrice)
+		if recordErr := ledger.Record(ctx, chain, closeAllocationLedgerEntry(privateKey.PublicKey().Address().Pretty(), allocationID, allocation), closeTrx, err); recordErr != nil {
+			logger.Warn("unable to record allocation close in ledger", "ledger_file", ledgerFile, "err", recordErr)
+		}
 		if err != nil {
 			return err
 		}
@@ -113,38 +177,75 @@ func closeAllocationE(logger *slog.Logger) func(cmd *cobra.Command, args []strin
 	}
 }
 
-func closeAllocationCall(ctx context.Context, to string, from string, cli *ethrpc.Client, allocationID string, gasPrice int64) (string, error) {
-	methodDef, err := eth.NewMethodDef("closeAllocation(address,bytes32)")
+// stopService is the Horizon counterpart of the legacy close, there is no
+// epoch to wait for. The ledger entry is nil when the transaction was not
+// sent.
+func stopService(ctx context.Context, profile *utils.NetworkProfile, chain *utils.Chain, privateKey *eth.PrivateKey, allocationID eth.Address, deploymentID string, gasPrice int64) (string, *utils.LedgerEntry, error) {
+	allocation, err := utils.GetServiceAllocationCall(ctx, chain.Client(), profile, allocationID.Pretty())
 	if err != nil {
-		return "", fmt.Errorf("creating method definition: %w", err)
+		return "", nil, fmt.Errorf("failed to fetch allocation: %w", err)
+	}
+	if !allocation.Exists() {
+		return "", nil, fmt.Errorf("allocation %s does not exist on SubgraphService", allocationID.Pretty())
+	}
+	if !allocation.IsOpen() {
+		return "", nil, fmt.Errorf("allocation %s is already closed", allocationID.Pretty())
 	}
 
-	allocationIDAddress := eth.MustNewAddress(allocationID)
+	if err := utils.CheckProvisionOperator(ctx, chain.Client(), profile, privateKey.PublicKey().Address().String(), allocation.Indexer.String()); err != nil {
+		return "", nil, err
+	}
 
-	methodCall := methodDef.NewCall()
-	methodCall.AppendArg(allocationIDAddress)
-	methodCall.AppendArg(make([]byte, 32)) // empty poi
+	if deploymentID != "" {
+		isCurated, err := utils.IsCuratedCall(ctx, chain.Client(), deploymentID)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to check if curated: %w", err)
+		}
+		if isCurated {
+			return "", nil, fmt.Errorf("deployment has curation and cannot be paid to. please generate a different deployment and open a new allocation")
+		}
+	}
 
-	data, err := methodCall.Encode()
+	from := privateKey.PublicKey().Address()
+	ledgerEntry := closeAllocationLedgerEntry(from.Pretty(), allocationID, &utils.Allocation{Indexer: allocation.Indexer, SubgraphDeploymentID: allocation.SubgraphDeploymentID})
+
+	closeTrx, err := stopServiceCall(ctx, profile, from.String(), chain, allocation.Indexer, allocationID, gasPrice)
+	return closeTrx, ledgerEntry, err
+}
+
+func closeAllocationLedgerEntry(from string, allocationID eth.Address, allocation *utils.Allocation) *utils.LedgerEntry {
+	entry := &utils.LedgerEntry{
+		Action:       utils.LedgerActionCloseAllocation,
+		Sender:       from,
+		Indexer:      allocation.Indexer.Pretty(),
+		AllocationID: allocationID.Pretty(),
+	}
+	if deploymentID, err := utils.ConvertByteStringToIPFSHash(allocation.SubgraphDeploymentID); err == nil {
+		entry.DeploymentID = deploymentID
+	}
+
+	return entry
+}
+
+func closeAllocationCall(ctx context.Context, to eth.Address, from eth.Address, chain *utils.Chain, allocationID eth.Address, gasPrice int64) (string, error) {
+	data, err := utils.EncodeCloseAllocationCall(allocationID)
 	if err != nil {
-		return "", fmt.Errorf("encoding method call: %w", err)
+		return "", err
 	}
 
-	signer, err := native.NewPrivateKeySigner(zap.NewNop(), utils.MustGetChainID(ctx, cli), utils.MustGetPrivateKey(ctx))
+	signer, err := chain.Signer(ctx)
 	if err != nil {
-		return "", fmt.Errorf("unable to create signer: %w", err)
+		return "", err
 	}
 
-	var gasPriceBigInt *big.Int
-	if gasPrice == 0 {
-		gasPriceBigInt = utils.MustGetGasPrice(ctx, cli)
-	} else {
-		gasPriceBigInt = big.NewInt(gasPrice)
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", err
 	}
 
 	signedTx, err := signer.SignTransaction(
-		utils.MustGetAccountNonce(ctx, eth.MustNewAddress(from), cli),
-		eth.MustNewAddress(to),
+		nonce,
+		to,
 		big.NewInt(0),
 		big.NewInt(7_000_000).Uint64(),
 		gasPriceBigInt,
@@ -154,22 +255,75 @@ func closeAllocationCall(ctx context.Context, to string, from string, cli *ethrp
 		return "", err
 	}
 
-	resp, err := cli.SendRaw(ctx, signedTx)
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
+	if err != nil {
+		return resp, err
+	}
+
+	if receipt == nil {
+		return "", fmt.Errorf("failed to close allocation. no receipt found for transaction %s", resp)
+	}
+
+	if len(receipt.Logs) == 0 {
+		return "", fmt.Errorf("failed to close allocation. no logs found for transaction %s", resp)
+	}
+
+	return resp, nil
+}
+
+func stopServiceCall(ctx context.Context, profile *utils.NetworkProfile, from string, chain *utils.Chain, indexer eth.Address, allocationID eth.Address, gasPrice int64) (string, error) {
+	methodDef, err := eth.NewMethodDef("stopService(address,bytes)")
+	if err != nil {
+		return "", fmt.Errorf("creating method definition: %w", err)
+	}
+
+	serviceData, err := utils.EncodeStopServiceData(allocationID)
+	if err != nil {
+		return "", err
+	}
+
+	methodCall := methodDef.NewCall()
+	methodCall.AppendArg(indexer)
+	methodCall.AppendArg(serviceData)
+
+	data, err := methodCall.Encode()
+	if err != nil {
+		return "", fmt.Errorf("encoding method call: %w", err)
+	}
+
+	signer, err := chain.Signer(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	receipt, err := utils.FetchReceiptWithProgress(ctx, cli, eth.MustNewHash(resp))
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, eth.MustNewAddress(from), gasPrice)
 	if err != nil {
 		return "", err
 	}
 
+	signedTx, err := signer.SignTransaction(
+		nonce,
+		eth.MustNewAddress(profile.SubgraphService),
+		big.NewInt(0),
+		big.NewInt(7_000_000).Uint64(),
+		gasPriceBigInt,
+		data,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
+	if err != nil {
+		return resp, err
+	}
+
 	if receipt == nil {
-		return "", fmt.Errorf("failed to close allocation. no receipt found for transaction %s", resp)
+		return "", fmt.Errorf("failed to stop service. no receipt found for transaction %s", resp)
 	}
 
 	if len(receipt.Logs) == 0 {
-		return "", fmt.Errorf("failed to close allocation. no logs found for transaction %s", resp)
+		return "", fmt.Errorf("failed to stop service. no logs found for transaction %s", resp)
 	}
 
 	return resp, nil
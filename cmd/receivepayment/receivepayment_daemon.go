@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/tap"
+)
+
+func newDaemonCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "automatically close allocations opened by open-allocation once they have been paid",
+		Long: "Run a long-lived process that watches the allocations tracked in the state file by open-allocation. " +
+			"Each allocation is closed once its payment has been collected and the configured number of epochs has passed. " +
+			"Failed closes are retried with an exponential backoff. " +
+			"With a horizon network profile, allocations are closed through SubgraphService and a payment is the tokens GraphTallyCollector paid for the allocation collection.",
+		RunE: daemonE(logger),
+	}
+
+	cmd.Flags().String("private-key-file", "", "the private key file (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a built-in name (arbitrum-one) or a JSON profile file, the one the allocations were opened with. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network")
+	cmd.Flags().String("state-file", defaultAllocationStateFile(), "the file where opened allocations are tracked")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where close transactions are recorded. Set to empty to disable")
+	cmd.Flags().Duration("poll-interval", time.Minute, "how often tracked allocations are checked")
+	cmd.Flags().Uint64("min-epochs", 1, "the number of epochs that must pass after the allocation was opened before closing it (at least 1)")
+	cmd.Flags().Bool("require-payment", true, "only close allocations that have collected a payment")
+	cmd.Flags().Duration("retry-backoff", 30*time.Second, "the initial delay before retrying a failed close, doubled on each failure")
+	cmd.Flags().Duration("max-retry-backoff", time.Hour, "the maximum delay between retries of a failed close")
+
+	return cmd
+}
+
+func daemonE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		rpcUrl, err := cmd.Flags().GetString("rpc-url")
+		if err != nil {
+			return err
+		}
+
+		network, err := cmd.Flags().GetString("network")
+		if err != nil {
+			return err
+		}
+		profile, err := utils.LoadNetworkProfile(network)
+		if err != nil {
+			return err
+		}
+
+		gasPrice, err := cmd.Flags().GetInt64("gas-price")
+		if err != nil {
+			return err
+		}
+
+		stateFile, err := cmd.Flags().GetString("state-file")
+		if err != nil {
+			return err
+		}
+		if stateFile == "" {
+			return fmt.Errorf("state file is required")
+		}
+
+		ledgerFile, err := cmd.Flags().GetString("ledger-file")
+		if err != nil {
+			return err
+		}
+
+		config := daemonConfig{}
+		if config.PollInterval, err = cmd.Flags().GetDuration("poll-interval"); err != nil {
+			return err
+		}
+		if config.MinEpochs, err = cmd.Flags().GetUint64("min-epochs"); err != nil {
+			return err
+		}
+		if config.MinEpochs < 1 {
+			return fmt.Errorf("min-epochs must be at least 1, closing an allocation in the epoch it was opened reverts")
+		}
+		if config.RequirePayment, err = cmd.Flags().GetBool("require-payment"); err != nil {
+			return err
+		}
+		if config.RequirePayment && profile.Horizon() && profile.GraphTallyCollector == "" {
+			return utils.Usagef("network profile %s has no graph_tally_collector to check payments against, add it or use --require-payment=false", profile.Name)
+		}
+		if config.RetryBackoff, err = cmd.Flags().GetDuration("retry-backoff"); err != nil {
+			return err
+		}
+		if config.MaxRetryBackoff, err = cmd.Flags().GetDuration("max-retry-backoff"); err != nil {
+			return err
+		}
+
+		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+		if err != nil {
+			return err
+		}
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		ctx = utils.WithPrivateKey(ctx, privateKey)
+
+		chain := &rpcDaemonChain{
+			chain:      utils.NewChain(utils.NewRPCClient(rpcUrl), profile.ChainID),
+			profile:    profile,
+			privateKey: privateKey,
+			gasPrice:   gasPrice,
+			ledger:     utils.NewLedger(ledgerFile),
+			logger:     logger,
+		}
+		if _, err := chain.chain.ChainID(ctx); err != nil {
+			return err
+		}
+
+		daemon := newAllocationDaemon(chain, newAllocationStateFile(stateFile), config, logger)
+
+		logger.Info("starting allocation daemon", "network", profile.Name, "state_file", stateFile, "poll_interval", config.PollInterval, "min_epochs", config.MinEpochs)
+		err = daemon.Run(ctx)
+		logger.Info("allocation daemon stopped")
+
+		return err
+	}
+}
+
+// daemonChain is the subset of on-chain operations the daemon relies on.
+type daemonChain interface {
+	GetAllocation(ctx context.Context, allocationID string) (*daemonAllocation, error)
+	GetEpochInfo(ctx context.Context) (*utils.EpochInfo, error)
+	CloseAllocation(ctx context.Context, allocationID string) (string, error)
+}
+
+// daemonAllocation is what the daemon needs to know of an allocation,
+// whichever backend it was opened on. CollectedFees and CreatedAtEpoch are
+// only set on an active allocation, CreatedAtEpoch is nil when the backend
+// does not restrict closing by epoch.
+type daemonAllocation struct {
+	State          utils.AllocationState
+	CollectedFees  *big.Int
+	CreatedAtEpoch *uint64
+}
+
+type rpcDaemonChain struct {
+	chain      *utils.Chain
+	profile    *utils.NetworkProfile
+	privateKey *eth.PrivateKey
+	gasPrice   int64
+	ledger     *utils.Ledger
+	logger     *slog.Logger
+}
+
+func (c *rpcDaemonChain) GetAllocation(ctx context.Context, allocationID string) (*daemonAllocation, error) {
+	if c.profile.Horizon() {
+		return c.getServiceAllocation(ctx, allocationID)
+	}
+
+	state, err := utils.GetAllocationStateCall(ctx, c.chain.Client(), allocationID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching allocation state: %w", err)
+	}
+	if state != utils.AllocationStateActive {
+		return &daemonAllocation{State: state}, nil
+	}
+
+	allocation, err := utils.GetAllocationCall(ctx, c.chain.Client(), allocationID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching allocation: %w", err)
+	}
+
+	createdAtEpoch := allocation.CreatedAtEpoch.Uint64()
+	return &daemonAllocation{State: state, CollectedFees: allocation.CollectedFees, CreatedAtEpoch: &createdAtEpoch}, nil
+}
+
+// getServiceAllocation reads the allocation on SubgraphService, its payment
+// is what GraphTallyCollector paid the indexer from our escrow for the
+// allocation collection.
+func (c *rpcDaemonChain) getServiceAllocation(ctx context.Context, allocationID string) (*daemonAllocation, error) {
+	allocation, err := utils.GetServiceAllocationCall(ctx, c.chain.Client(), c.profile, allocationID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching allocation: %w", err)
+	}
+
+	switch {
+	case !allocation.Exists():
+		return &daemonAllocation{State: utils.AllocationStateNull}, nil
+	case !allocation.IsOpen():
+		return &daemonAllocation{State: utils.AllocationStateClosed}, nil
+	}
+
+	out := &daemonAllocation{State: utils.AllocationStateActive, CollectedFees: big.NewInt(0)}
+	if c.profile.GraphTallyCollector != "" {
+		collectionID := tap.CollectionID(common.BytesToAddress(eth.MustNewAddress(allocationID)))
+		collected, err := utils.GetTokensCollectedCall(ctx, c.chain.Client(), c.profile, eth.MustNewAddress(c.profile.SubgraphService), collectionID.Bytes(), allocation.Indexer, c.privateKey.PublicKey().Address())
+		if err != nil {
+			return nil, fmt.Errorf("fetching collected tokens: %w", err)
+		}
+		out.CollectedFees = collected
+	}
+
+	return out, nil
+}
+
+func (c *rpcDaemonChain) GetEpochInfo(ctx context.Context) (*utils.EpochInfo, error) {
+	return utils.GetEpochInfoCall(ctx, c.chain.Client())
+}
+
+func (c *rpcDaemonChain) CloseAllocation(ctx context.Context, allocationID string) (string, error) {
+	from := c.privateKey.PublicKey().Address()
+
+	allocation, err := eth.NewAddress(allocationID)
+	if err != nil {
+		return "", fmt.Errorf("invalid allocation ID %q: %w", allocationID, err)
+	}
+
+	if c.profile.Horizon() {
+		trx, ledgerEntry, err := stopService(ctx, c.profile, c.chain, c.privateKey, allocation, "", c.gasPrice)
+		if ledgerEntry != nil {
+			c.recordEntry(ctx, ledgerEntry, trx, err)
+		}
+
+		return trx, err
+	}
+
+	trx, err := closeAllocationCall(ctx, eth.MustNewAddress(utils.StakingContractAddress), from, c.chain, allocation, c.gasPrice)
+	c.record(ctx, allocation, trx, err)
+
+	return trx, err
+}
+
+func (c *rpcDaemonChain) record(ctx context.Context, allocationID eth.Address, trx string, callErr error) {
+	if c.ledger == nil {
+		return
+	}
+
+	allocation, err := utils.GetAllocationCall(ctx, c.chain.Client(), allocationID.Pretty())
+	if err != nil {
+		c.logger.Warn("unable to record allocation close in ledger", "allocation_id", allocationID.Pretty(), "err", err)
+		return
+	}
+
+	c.recordEntry(ctx, closeAllocationLedgerEntry(c.privateKey.PublicKey().Address().Pretty(), allocationID, allocation), trx, callErr)
+}
+
+func (c *rpcDaemonChain) recordEntry(ctx context.Context, entry *utils.LedgerEntry, trx string, callErr error) {
+	if c.ledger == nil {
+		return
+	}
+
+	if err := c.ledger.Record(ctx, c.chain, entry, trx, callErr); err != nil {
+		c.logger.Warn("unable to record allocation close in ledger", "allocation_id", entry.AllocationID, "err", err)
+	}
+}
+
+type daemonConfig struct {
+	PollInterval    time.Duration
+	MinEpochs       uint64
+	RequirePayment  bool
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+type allocationDaemon struct {
+	chain     daemonChain
+	stateFile *allocationStateFile
+	config    daemonConfig
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+func newAllocationDaemon(chain daemonChain, stateFile *allocationStateFile, config daemonConfig, logger *slog.Logger) *allocationDaemon {
+	return &allocationDaemon{
+		chain:     chain,
+		stateFile: stateFile,
+		config:    config,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// Run checks the tracked allocations every poll interval until ctx is
+// cancelled. A close already in flight when ctx is cancelled is allowed to
+// complete so that its outcome is recorded in the state file.
+func (d *allocationDaemon) Run(ctx context.Context) error {
+	for {
+		if err := d.Tick(ctx); err != nil {
+			d.logger.Warn("allocation daemon tick failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.config.PollInterval):
+		}
+	}
+}
+
+// Tick runs a single pass over the tracked allocations.
+func (d *allocationDaemon) Tick(ctx context.Context) error {
+	allocations, err := d.stateFile.Load()
+	if err != nil {
+		return err
+	}
+
+	var open []*trackedAllocation
+	for _, allocation := range allocations {
+		if allocation.Status == trackedAllocationOpen {
+			open = append(open, allocation)
+		}
+	}
+	if len(open) == 0 {
+		return nil
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].OpenedAt.Before(open[j].OpenedAt) })
+
+	epoch, err := d.chain.GetEpochInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching current epoch: %w", err)
+	}
+
+	for _, allocation := range open {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if d.now().Before(allocation.NextAttemptAt) {
+			continue
+		}
+
+		if err := d.process(ctx, epoch, allocation); err != nil {
+			d.logger.Warn("unable to process allocation", "allocation_id", allocation.AllocationID, "err", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *allocationDaemon) process(ctx context.Context, epoch *utils.EpochInfo, tracked *trackedAllocation) error {
+	logger := d.logger.With("allocation_id", tracked.AllocationID)
+
+	allocation, err := d.chain.GetAllocation(ctx, tracked.AllocationID)
+	if err != nil {
+		return d.recordFailure(tracked, err)
+	}
+
+	switch allocation.State {
+	case utils.AllocationStateClosed:
+		logger.Info("allocation was closed outside of the daemon")
+		return d.stateFile.Update(tracked.AllocationID, func(allocation *trackedAllocation) {
+			allocation.Status = trackedAllocationClosed
+			allocation.ClosedAt = d.now().UTC()
+		})
+	case utils.AllocationStateNull:
+		return d.recordFailure(tracked, fmt.Errorf("allocation not found on chain, is --network the profile it was opened with?"))
+	}
+
+	if d.config.RequirePayment && allocation.CollectedFees.Sign() == 0 {
+		logger.Debug("allocation has not collected a payment yet")
+		return nil
+	}
+
+	if allocation.CreatedAtEpoch != nil {
+		closableAtEpoch := *allocation.CreatedAtEpoch + d.config.MinEpochs
+		if epoch.CurrentEpoch < closableAtEpoch {
+			logger.Debug("allocation is too recent to be closed", "current_epoch", epoch.CurrentEpoch, "closable_at_epoch", closableAtEpoch)
+			return nil
+		}
+	}
+
+	logger.Info("closing allocation", "collected_fees", utils.FormatGRT(allocation.CollectedFees), "current_epoch", epoch.CurrentEpoch)
+
+	// A close already submitted must be allowed to finish even if we are asked to shut down
+	closeTrx, err := d.chain.CloseAllocation(context.WithoutCancel(ctx), tracked.AllocationID)
+	if err != nil {
+		return d.recordFailure(tracked, err)
+	}
+
+	logger.Info("allocation closed", "trx", closeTrx)
+
+	return d.stateFile.Update(tracked.AllocationID, func(allocation *trackedAllocation) {
+		allocation.Status = trackedAllocationClosed
+		allocation.CloseTrx = closeTrx
+		allocation.ClosedAt = d.now().UTC()
+		allocation.LastError = ""
+		allocation.NextAttemptAt = time.Time{}
+	})
+}
+
+func (d *allocationDaemon) recordFailure(tracked *trackedAllocation, cause error) error {
+	attempts := tracked.Attempts + 1
+	nextAttemptAt := d.now().Add(d.retryBackoff(attempts))
+
+	err := d.stateFile.Update(tracked.AllocationID, func(allocation *trackedAllocation) {
+		allocation.Attempts = attempts
+		allocation.NextAttemptAt = nextAttemptAt.UTC()
+		allocation.LastError = cause.Error()
+	})
+	if err != nil {
+		return fmt.Errorf("%w (and recording the failure failed: %s)", cause, err)
+	}
+
+	return fmt.Errorf("%w (attempt %d, retrying at %s)", cause, attempts, nextAttemptAt.Format(time.RFC3339))
+}
+
+func (d *allocationDaemon) retryBackoff(attempts int) time.Duration {
+	backoff := d.config.RetryBackoff
+	for i := 1; i < attempts && backoff < d.config.MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > d.config.MaxRetryBackoff {
+		return d.config.MaxRetryBackoff
+	}
+
+	return backoff
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+const daemonTestAllocation = "0xa110ca7e0000000000000000000000000000a110"
+
+type fakeDaemonChain struct {
+	epoch       uint64
+	allocations map[string]*daemonAllocation
+	closeErr    error
+	closed      []string
+}
+
+func (c *fakeDaemonChain) GetAllocation(ctx context.Context, allocationID string) (*daemonAllocation, error) {
+	allocation, found := c.allocations[allocationID]
+	if !found {
+		return &daemonAllocation{State: utils.AllocationStateNull}, nil
+	}
+
+	return allocation, nil
+}
+
+func (c *fakeDaemonChain) GetEpochInfo(ctx context.Context) (*utils.EpochInfo, error) {
+	return &utils.EpochInfo{CurrentEpoch: c.epoch}, nil
+}
+
+func (c *fakeDaemonChain) CloseAllocation(ctx context.Context, allocationID string) (string, error) {
+	if c.closeErr != nil {
+		return "", c.closeErr
+	}
+
+	c.closed = append(c.closed, allocationID)
+	c.allocations[allocationID].State = utils.AllocationStateClosed
+
+	return "0xc105e", nil
+}
+
+type daemonTest struct {
+	chain     *fakeDaemonChain
+	stateFile *allocationStateFile
+	daemon    *allocationDaemon
+	now       time.Time
+}
+
+// newDaemonTest tracks a single open allocation created at epoch 10, paid
+// when paid is set.
+func newDaemonTest(t *testing.T, paid bool) *daemonTest {
+	t.Helper()
+
+	createdAtEpoch := uint64(10)
+	collectedFees := big.NewInt(0)
+	if paid {
+		collectedFees = utils.ConvertToWei(100)
+	}
+
+	test := &daemonTest{
+		chain: &fakeDaemonChain{
+			epoch: 11,
+			allocations: map[string]*daemonAllocation{
+				daemonTestAllocation: {State: utils.AllocationStateActive, CollectedFees: collectedFees, CreatedAtEpoch: &createdAtEpoch},
+			},
+		},
+		stateFile: newAllocationStateFile(filepath.Join(t.TempDir(), "allocations.json")),
+		now:       time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	err := test.stateFile.Update(daemonTestAllocation, func(allocation *trackedAllocation) {
+		allocation.OpenedAt = test.now.Add(-time.Hour)
+		allocation.Status = trackedAllocationOpen
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := daemonConfig{MinEpochs: 1, RequirePayment: true, RetryBackoff: time.Minute, MaxRetryBackoff: 5 * time.Minute}
+	test.daemon = newAllocationDaemon(test.chain, test.stateFile, config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	test.daemon.now = func() time.Time { return test.now }
+
+	return test
+}
+
+func (d *daemonTest) tick(t *testing.T) *trackedAllocation {
+	t.Helper()
+
+	if err := d.daemon.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	allocations, err := d.stateFile.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return allocations[daemonTestAllocation]
+}
+
+func TestDaemonClosesPaidAllocation(t *testing.T) {
+	test := newDaemonTest(t, true)
+
+	tracked := test.tick(t)
+	if tracked.Status != trackedAllocationClosed || tracked.CloseTrx != "0xc105e" || !tracked.ClosedAt.Equal(test.now) {
+		t.Fatalf("allocation %+v, want closed by 0xc105e at %s", tracked, test.now)
+	}
+
+	// closed allocations are no longer looked at
+	test.tick(t)
+	if len(test.chain.closed) != 1 {
+		t.Errorf("%d closes, want 1", len(test.chain.closed))
+	}
+}
+
+func TestDaemonWaitsForPayment(t *testing.T) {
+	test := newDaemonTest(t, false)
+
+	if tracked := test.tick(t); tracked.Status != trackedAllocationOpen || tracked.Attempts != 0 {
+		t.Fatalf("allocation %+v, want left open without a failed attempt", tracked)
+	}
+
+	test.daemon.config.RequirePayment = false
+	if tracked := test.tick(t); tracked.Status != trackedAllocationClosed {
+		t.Fatalf("allocation %s, want closed once payment is not required", tracked.Status)
+	}
+}
+
+func TestDaemonWaitsForMinEpochs(t *testing.T) {
+	test := newDaemonTest(t, true)
+	test.daemon.config.MinEpochs = 3
+
+	for _, epoch := range []uint64{10, 11, 12} {
+		test.chain.epoch = epoch
+		if tracked := test.tick(t); tracked.Status != trackedAllocationOpen {
+			t.Fatalf("allocation closed at epoch %d, want it kept until epoch 13", epoch)
+		}
+	}
+
+	test.chain.epoch = 13
+	if tracked := test.tick(t); tracked.Status != trackedAllocationClosed {
+		t.Fatalf("allocation %s at epoch 13, want closed", tracked.Status)
+	}
+}
+
+func TestDaemonClosesWithoutEpochRestriction(t *testing.T) {
+	test := newDaemonTest(t, true)
+	test.chain.allocations[daemonTestAllocation].CreatedAtEpoch = nil
+	test.chain.epoch = 0
+
+	if tracked := test.tick(t); tracked.Status != trackedAllocationClosed {
+		t.Fatalf("allocation %s, want closed when the backend has no epoch restriction", tracked.Status)
+	}
+}
+
+func TestDaemonAllocationClosedElsewhere(t *testing.T) {
+	test := newDaemonTest(t, true)
+	test.chain.allocations[daemonTestAllocation].State = utils.AllocationStateClosed
+
+	tracked := test.tick(t)
+	if tracked.Status != trackedAllocationClosed || tracked.CloseTrx != "" {
+		t.Fatalf("allocation %+v, want closed without a close transaction", tracked)
+	}
+	if len(test.chain.closed) != 0 {
+		t.Errorf("%d closes, want none", len(test.chain.closed))
+	}
+}
+
+func TestDaemonRetriesFailedClose(t *testing.T) {
+	test := newDaemonTest(t, true)
+	test.chain.closeErr = errors.New("execution reverted")
+
+	tracked := test.tick(t)
+	if tracked.Status != trackedAllocationOpen || tracked.Attempts != 1 || tracked.LastError != "execution reverted" {
+		t.Fatalf("allocation %+v, want open after 1 failed attempt", tracked)
+	}
+	if want := test.now.Add(time.Minute); !tracked.NextAttemptAt.Equal(want) {
+		t.Fatalf("next attempt at %s, want %s", tracked.NextAttemptAt, want)
+	}
+
+	// not retried before the backoff elapses
+	test.now = test.now.Add(30 * time.Second)
+	if tracked := test.tick(t); tracked.Attempts != 1 {
+		t.Fatalf("%d attempts before the backoff elapsed, want 1", tracked.Attempts)
+	}
+
+	test.now = test.now.Add(30 * time.Second)
+	tracked = test.tick(t)
+	if want := test.now.Add(2 * time.Minute); tracked.Attempts != 2 || !tracked.NextAttemptAt.Equal(want) {
+		t.Fatalf("attempt %d retrying at %s, want attempt 2 retrying at %s", tracked.Attempts, tracked.NextAttemptAt, want)
+	}
+
+	test.chain.closeErr = nil
+	test.now = tracked.NextAttemptAt
+	tracked = test.tick(t)
+	if tracked.Status != trackedAllocationClosed || tracked.LastError != "" || !tracked.NextAttemptAt.IsZero() {
+		t.Fatalf("allocation %+v, want closed with the failure cleared", tracked)
+	}
+}
+
+func TestDaemonAllocationNotFound(t *testing.T) {
+	test := newDaemonTest(t, true)
+	delete(test.chain.allocations, daemonTestAllocation)
+
+	tracked := test.tick(t)
+	if tracked.Status != trackedAllocationOpen || tracked.Attempts != 1 || tracked.LastError == "" {
+		t.Fatalf("allocation %+v, want a failed attempt", tracked)
+	}
+}
+
+func TestDaemonRetryBackoff(t *testing.T) {
+	daemon := newAllocationDaemon(nil, nil, daemonConfig{RetryBackoff: time.Minute, MaxRetryBackoff: 5 * time.Minute}, nil)
+
+	for attempts, want := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		4:  5 * time.Minute,
+		40: 5 * time.Minute,
+	} {
+		if got := daemon.retryBackoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+func newLedgerCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ledger",
+		Short: "inspect the local ledger of payments and allocation actions",
+	}
+
+	cmd.AddCommand(newLedgerReportCmd(logger))
+
+	return cmd
+}
+
+func newLedgerReportCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "summarize the ledger by indexer or by month",
+		Long: "Summarize the actions recorded in the local ledger by sendpayment, open-allocation, close-allocation and daemon. " +
+			"Amounts are reported in wei in json and csv outputs.",
+		Args: cobra.NoArgs,
+		RunE: ledgerReportE(logger),
+	}
+
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger to report on")
+	cmd.Flags().String("from", "", "only report actions from this date (YYYY-MM-DD or RFC3339, UTC), inclusive")
+	cmd.Flags().String("to", "", "only report actions up to this date (YYYY-MM-DD or RFC3339, UTC), a date is inclusive of the whole day")
+	cmd.Flags().String("group-by", utils.LedgerGroupByIndexer, "how to group actions, one of: indexer, month")
+	cmd.Flags().String("output", "table", "the output format, one of: table, json, csv")
+
+	return cmd
+}
+
+type ledgerReportView struct {
+	Group             string `json:"group"`
+	Payments          int    `json:"payments"`
+	Paid              string `json:"paid"`
+	AllocationsOpened int    `json:"allocationsOpened"`
+	AllocationsClosed int    `json:"allocationsClosed"`
+	Transactions      int    `json:"transactions"`
+	Failed            int    `json:"failed"`
+	GasUsed           uint64 `json:"gasUsed"`
+	Fees              string `json:"fees"`
+}
+
+func ledgerReportE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ledgerFile, err := cmd.Flags().GetString("ledger-file")
+		if err != nil {
+			return err
+		}
+		if ledgerFile == "" {
+			return fmt.Errorf("ledger file is required")
+		}
+
+		fromFlag, err := cmd.Flags().GetString("from")
+		if err != nil {
+			return err
+		}
+		from, err := parseLedgerDate(fromFlag, false)
+		if err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+
+		toFlag, err := cmd.Flags().GetString("to")
+		if err != nil {
+			return err
+		}
+		to, err := parseLedgerDate(toFlag, true)
+		if err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+
+		groupBy, err := cmd.Flags().GetString("group-by")
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "table" && output != "json" && output != "csv" {
+			return fmt.Errorf("invalid output format %q, must be one of: table, json, csv", output)
+		}
+
+		entries, err := utils.NewLedger(ledgerFile).Entries(from, to)
+		if err != nil {
+			return fmt.Errorf("failed to read ledger: %w", err)
+		}
+		logger.Debug("read ledger", "ledger_file", ledgerFile, "entries", len(entries))
+
+		rows, err := utils.BuildLedgerReport(entries, groupBy)
+		if err != nil {
+			return err
+		}
+
+		switch output {
+		case "json":
+			views := make([]*ledgerReportView, 0, len(rows))
+			for _, row := range rows {
+				views = append(views, &ledgerReportView{
+					Group:             row.Group,
+					Payments:          row.Payments,
+					Paid:              row.Paid.String(),
+					AllocationsOpened: row.AllocationsOpened,
+					AllocationsClosed: row.AllocationsClosed,
+					Transactions:      row.Transactions,
+					Failed:            row.Failed,
+					GasUsed:           row.GasUsed,
+					Fees:              row.Fees.String(),
+				})
+			}
+
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(views)
+
+		case "csv":
+			writer := csv.NewWriter(cmd.OutOrStdout())
+			writer.Write([]string{groupBy, "payments", "paid_wei", "allocations_opened", "allocations_closed", "transactions", "failed", "gas_used", "fees_wei"})
+			for _, row := range rows {
+				writer.Write([]string{
+					row.Group,
+					strconv.Itoa(row.Payments),
+					row.Paid.String(),
+					strconv.Itoa(row.AllocationsOpened),
+					strconv.Itoa(row.AllocationsClosed),
+					strconv.Itoa(row.Transactions),
+					strconv.Itoa(row.Failed),
+					strconv.FormatUint(row.GasUsed, 10),
+					row.Fees.String(),
+				})
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+
+		if len(rows) == 0 {
+			fmt.Println("No ledger entries in the requested period")
+			return nil
+		}
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "GROUP\tPAYMENTS\tPAID\tOPENED\tCLOSED\tTRANSACTIONS\tFAILED\tFEES")
+		for _, row := range rows {
+			fmt.Fprintf(writer, "%s\t%d\t%s\t%d\t%d\t%d\t%d\t%s\n", row.Group, row.Payments, utils.FormatGRT(row.Paid), row.AllocationsOpened, row.AllocationsClosed, row.Transactions, row.Failed, utils.FormatETH(row.Fees))
+		}
+
+		return writer.Flush()
+	}
+}
+
+// parseLedgerDate accepts a date or an RFC3339 timestamp. When endOfDay is
+// set, a date is moved to the start of the next day so that it is included.
+func parseLedgerDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a YYYY-MM-DD date nor an RFC3339 timestamp", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
@@ -3,21 +3,17 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/cobra"
 	"github.com/streamingfast/eth-go"
-	ethrpc "github.com/streamingfast/eth-go/rpc"
-	"github.com/streamingfast/eth-go/signer/native"
 	"github.com/streamingfast/network-payments-cli/cmd/utils"
-	"go.uber.org/zap"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/proof"
 )
 
 func newOpenAllocationCmd(logger *slog.Logger) *cobra.Command {
@@ -28,11 +24,24 @@ func newOpenAllocationCmd(logger *slog.Logger) *cobra.Command {
 	}
 
 	cmd.Flags().String("private-key-file", "", "the private key file (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
-	cmd.Flags().String("indexer-address", "", "the indexer address (note: NOT the operator address)")
+	cmd.Flags().String("indexer-address", "", "the indexer address to allocate on behalf of. The signing key must be the indexer itself or one of its authorized operators")
 	cmd.Flags().String("deployment-id", "", "the deployment ID of the service being allocated to. If left empty, a random deployment ID will be generated")
+	cmd.Flags().String("manifest-template", "", "a Go text/template file for the generated deployment manifest, with fields .UID, .CustomerID, .InvoiceReference, .BillingPeriod and .PayerAddress. If empty, the default payment manifest is used")
+	cmd.Flags().String("customer-id", "", "the customer ID made available to the manifest template")
+	cmd.Flags().String("invoice-reference", "", "the invoice reference made available to the manifest template")
+	cmd.Flags().String("billing-period", "", "the billing period made available to the manifest template, e.g. 2025-07")
+	cmd.Flags().String("payer-address", "", "the payer address made available to the manifest template")
+	cmd.Flags().Bool("deterministic", false, "derive the generated manifest uid from the customer ID, invoice reference, billing period and payer address so the same invoice always maps to the same deployment")
+	cmd.Flags().String("manifest-dir", filepath.Join(utils.DefaultDataDir(), "manifests"), "the directory where the generated manifest is saved as <deployment-id>.yaml for auditing. Set to empty to disable")
 	cmd.Flags().Uint64("allocation-amount", 0, "the allocation amount in GRT")
-	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("reference", "", "a payment reference (invoice number, UUID, or 0x-prefixed 32 bytes hash of an external document) recorded in the allocation metadata. Text longer than 32 bytes is stored as its keccak256 hash")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a built-in name (arbitrum-one) or a JSON profile file. A profile with the horizon backend allocates through the indexer provision to SubgraphService. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
 	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network")
+	cmd.Flags().String("rewards-policy", utils.RewardsPolicyWarn, "what to do when the deployment would earn indexing rewards (not deny-listed and signalled), one of: warn, fail")
+	cmd.Flags().String("network-subgraph-url", os.Getenv("NETWORK_SUBGRAPH_URL"), "the network subgraph query url used to look up existing allocations on a provided --deployment-id. if not provided, will check the NETWORK_SUBGRAPH_URL env var. When empty, Staking logs are scanned instead")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where the transaction is recorded. Set to empty to disable")
+	cmd.Flags().String("state-file", defaultAllocationStateFile(), "the file where opened allocations are tracked for the receivepayment daemon. Set to empty to disable tracking")
 
 	return cmd
 }
@@ -49,17 +58,60 @@ func openAllocationE(logger *slog.Logger) func(cmd *cobra.Command, args []string
 			return err
 		}
 
+		network, err := cmd.Flags().GetString("network")
+		if err != nil {
+			return err
+		}
+		profile, err := utils.LoadNetworkProfile(network)
+		if err != nil {
+			return err
+		}
+
+		indexer, err := utils.ParseAddress("indexer-address", cmd.Flag("indexer-address").Value.String())
+		if err != nil {
+			return err
+		}
+		indexerAddress := indexer.Pretty()
+
 		var deploymentID string
 		deploymentID, err = cmd.Flags().GetString("deployment-id")
 		if err != nil {
 			return err
 		}
-		if deploymentID == "" {
-			fmt.Println("No deployment ID provided, generating a random one")
-			deploymentID, err = utils.GenerateDeployment()
+		generatedDeployment := deploymentID == ""
+		if generatedDeployment {
+			manifestOptions, err := manifestOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			if manifestOptions.Deterministic {
+				fmt.Println("No deployment ID provided, generating one from the invoice fields")
+			} else {
+				fmt.Println("No deployment ID provided, generating a random one")
+			}
+
+			var manifest []byte
+			deploymentID, manifest, err = utils.GenerateManifestDeployment(manifestOptions)
 			if err != nil {
 				return fmt.Errorf("generating deployment ID: %w", err)
 			}
+
+			manifestDir, err := cmd.Flags().GetString("manifest-dir")
+			if err != nil {
+				return err
+			}
+			if manifestDir != "" {
+				manifestPath, err := utils.WriteManifest(manifestDir, deploymentID, manifest)
+				if err != nil {
+					return err
+				}
+				fmt.Println("Manifest written to", manifestPath)
+			}
+
+			// a deterministic deployment is reused by design, look it up like
+			// a provided one
+			generatedDeployment = !manifestOptions.Deterministic
 		}
 
 		amount, err := cmd.Flags().GetUint64("allocation-amount")
@@ -70,123 +122,225 @@ func openAllocationE(logger *slog.Logger) func(cmd *cobra.Command, args []string
 			return fmt.Errorf("amount must be greater than 0")
 		}
 
-		indexerAddress := cmd.Flag("indexer-address").Value.String()
-		if indexerAddress == "" {
-			return fmt.Errorf("indexer address is required")
+		gasPrice, err := cmd.Flags().GetInt64("gas-price")
+		if err != nil {
+			return err
 		}
 
-		gasPrice, err := cmd.Flags().GetInt64("gas-price")
+		stateFile, err := cmd.Flags().GetString("state-file")
+		if err != nil {
+			return err
+		}
+
+		rewardsPolicy, err := cmd.Flags().GetString("rewards-policy")
+		if err != nil {
+			return err
+		}
+		if err := utils.ValidateRewardsPolicy(rewardsPolicy); err != nil {
+			return utils.Usagef("%w", err)
+		}
+
+		reference, err := cmd.Flags().GetString("reference")
+		if err != nil {
+			return err
+		}
+		metadata, err := utils.EncodeReference(reference)
+		if err != nil {
+			return err
+		}
+
+		networkSubgraphURL, err := cmd.Flags().GetString("network-subgraph-url")
+		if err != nil {
+			return err
+		}
+
+		ledgerFile, err := cmd.Flags().GetString("ledger-file")
 		if err != nil {
 			return err
 		}
+		ledger := utils.NewLedger(ledgerFile)
 
-		var privateKey *eth.PrivateKey
 		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
 		if err != nil {
 			return err
 		}
-		if privateKeyFile == "" {
-			privateKey, err = eth.NewPrivateKey(os.Getenv("NETWORK_PAYMENT_PRIVATE_KEY"))
-			if err != nil {
-				return fmt.Errorf("import private key: %s", err)
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		ctx = utils.WithPrivateKey(ctx, privateKey)
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		chain := utils.NewChain(rpcClient, profile.ChainID)
+		signer := privateKey.PublicKey().Address()
+
+		// independent preflight reads, sent in a single batch request
+		preflight := utils.NewBatch(rpcClient)
+		chain.AddChainID(preflight)
+		isOperator := bytes.Equal(signer, indexer)
+		stake := &utils.IndexerStake{}
+		provision := &utils.ProvisionCapacity{}
+		if profile.Horizon() {
+			if !isOperator {
+				preflight.IsProvisionOperator(profile, signer, indexer, &isOperator)
 			}
+			preflight.ProvisionCapacity(profile, indexer, provision)
 		} else {
-			pkBytes, err := os.ReadFile(privateKeyFile)
-			if err != nil {
-				return fmt.Errorf("read private key file: %s", err)
-			}
-			pkHex := strings.TrimSpace(string(pkBytes))
-			privateKey, err = eth.NewPrivateKey(pkHex)
-			if err != nil {
-				return fmt.Errorf("import private key: %s", err)
+			if !isOperator {
+				preflight.IsOperator(signer, indexer, &isOperator)
 			}
+			preflight.IndexerStake(indexer, stake)
+		}
+		var isCurated bool
+		if deploymentID != "" {
+			preflight.IsCurated(deploymentID, &isCurated)
 		}
-		if privateKey == nil || privateKey.String() == "" {
-			return fmt.Errorf("private key is required, either through the NETWORK_PAYMENT_PRIVATE_KEY environment variable or --private-key-file flag")
+		rewardsCheck := &utils.RewardsCheck{}
+		preflight.RewardsCheck(deploymentID, rewardsCheck)
+		var latestBlock uint64
+		if !generatedDeployment {
+			preflight.BlockNumber(&latestBlock)
+		}
+		if err := preflight.Do(ctx); err != nil {
+			return fmt.Errorf("failed preflight checks: %w", err)
 		}
 
-		ctx = utils.WithPrivateKey(ctx, privateKey)
+		if profile.Horizon() {
+			if !isOperator {
+				return utils.NotProvisionOperatorError(signer, indexer)
+			}
 
-		rpcClient := ethrpc.NewClient(rpcUrl)
+			fmt.Println(provision)
+			if err := provision.CheckCapacity(utils.ConvertToWei(amount)); err != nil {
+				return err
+			}
 
-		if deploymentID != "" {
-			isCurated, err := utils.IsCuratedCall(ctx, rpcClient, deploymentID)
+			if reference != "" {
+				fmt.Println("Warning: Horizon allocations carry no metadata, the reference is only recorded in the local ledger")
+			}
+		} else {
+			if !isOperator {
+				return utils.NotOperatorError(signer, indexer)
+			}
+
+			fmt.Println(stake)
+			if err := stake.CheckCapacity(utils.ConvertToWei(amount)); err != nil {
+				return err
+			}
+		}
+
+		if isCurated {
+			return fmt.Errorf("deployment has curation and cannot be paid to. please generate a different deployment and open a new allocation")
+		}
+
+		fmt.Println(rewardsCheck)
+		if err := rewardsCheck.ApplyPolicy(rewardsPolicy); err != nil {
+			return err
+		}
+
+		if !generatedDeployment {
+			usage, err := utils.GetDeploymentUsage(ctx, rpcClient, networkSubgraphURL, deploymentID, latestBlock)
 			if err != nil {
-				return fmt.Errorf("failed to check if curated: %w", err)
+				return fmt.Errorf("failed to look up existing allocations on deployment: %w", err)
 			}
-			if isCurated {
-				return fmt.Errorf("deployment has curation and cannot be paid to. please generate a different deployment and open a new allocation")
+			for _, warning := range usage.Warnings(indexerAddress, true) {
+				fmt.Println("Warning:", warning)
 			}
 		}
 
-		allocateTrx, allocationID, err := allocateCall(ctx, utils.StakingContractAddress, privateKey.PublicKey().Address().String(), rpcClient, indexerAddress, deploymentID, amount, gasPrice)
+		var allocateTrx string
+		var allocationID eth.Address
+		if profile.Horizon() {
+			allocateTrx, allocationID, err = startServiceCall(ctx, profile, privateKey.PublicKey().Address(), chain, indexer, deploymentID, isCurated, amount, gasPrice)
+		} else {
+			allocateTrx, allocationID, err = allocateCall(ctx, utils.StakingContractAddress, privateKey.PublicKey().Address(), chain, indexer, deploymentID, isCurated, amount, metadata, gasPrice)
+		}
+		ledgerEntry := &utils.LedgerEntry{
+			Action:       utils.LedgerActionOpenAllocation,
+			Sender:       privateKey.PublicKey().Address().Pretty(),
+			Indexer:      indexerAddress,
+			DeploymentID: deploymentID,
+			Amount:       utils.ConvertToWei(amount).String(),
+			Reference:    reference,
+		}
+		if allocationID != nil {
+			ledgerEntry.AllocationID = allocationID.Pretty()
+		}
+		if recordErr := ledger.Record(ctx, chain, ledgerEntry, allocateTrx, err); recordErr != nil {
+			logger.Warn("unable to record allocation opening in ledger", "ledger_file", ledgerFile, "err", recordErr)
+		}
 		if err != nil {
 			return err
 		}
 
-		fmt.Println("Allocation created with ID: ", eth.MustNewAddress(allocationID).Pretty())
+		if stateFile != "" {
+			err := newAllocationStateFile(stateFile).Update(allocationID.Pretty(), func(allocation *trackedAllocation) {
+				allocation.Indexer = indexerAddress
+				allocation.DeploymentID = deploymentID
+				allocation.Tokens = utils.ConvertToWei(amount).String()
+				allocation.Reference = reference
+				allocation.OpenedAt = time.Now().UTC()
+				allocation.OpenTrx = allocateTrx
+				allocation.Status = trackedAllocationOpen
+			})
+			if err != nil {
+				logger.Warn("unable to track allocation in state file", "state_file", stateFile, "err", err)
+			}
+		}
+
+		fmt.Println("Allocation created with ID: ", allocationID.Pretty())
 		fmt.Println("Deployment ID: ", deploymentID)
+		if reference != "" {
+			fmt.Println("Reference: ", reference)
+		}
 		fmt.Printf("See transaction on arbiscan: %s\n", fmt.Sprintf("https://arbiscan.io/tx/%s", allocateTrx))
 
 		return nil
 	}
 }
 
-func allocateCall(ctx context.Context, to string, from string, cli *ethrpc.Client, indexerAddress string, deploymentID string, amt uint64, gasPrice int64) (string, string, error) {
-	isCurated, err := utils.IsCuratedCall(ctx, cli, deploymentID)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to check if curated: %w", err)
-	}
+// allocateCall opens the allocation through Staking `allocateFrom`.
+// isCurated is the curation of deploymentID read in the preflight batch.
+func allocateCall(ctx context.Context, to string, from eth.Address, chain *utils.Chain, indexer eth.Address, deploymentID string, isCurated bool, amt uint64, metadata []byte, gasPrice int64) (string, eth.Address, error) {
 	if isCurated {
-		return "", "", fmt.Errorf("deployment has curation and cannot be paid to. please use a different deployment and open a new allocation")
+		return "", nil, fmt.Errorf("deployment has curation and cannot be paid to. please use a different deployment and open a new allocation")
 	}
 
-	methodDef, err := eth.NewMethodDef("allocateFrom(address,bytes32,uint256,address,bytes32,bytes)")
+	amount := utils.ConvertToWei(amt)
+	allocationKey, err := utils.NewAllocationKey()
 	if err != nil {
-		return "", "", fmt.Errorf("creating method definition: %w", err)
+		return "", nil, err
 	}
-
-	amount := utils.ConvertToWei(amt)
-	allocationIDBytes, proofBytes, err := generateAllocationIDAndProof(indexerAddress)
+	allocationIDBytes, proofBytes, err := proof.Create(indexer.Pretty(), allocationKey)
 	if err != nil {
-		return "", "", fmt.Errorf("generating proof: %w", err)
+		return "", nil, fmt.Errorf("generating proof: %w", err)
 	}
 
 	qm, err := utils.ConvertIPFSHashToByteString(deploymentID)
 	if err != nil {
-		return "", "", fmt.Errorf("converting IPFS hash to byte string: %w", err)
+		return "", nil, fmt.Errorf("converting IPFS hash to byte string: %w", err)
 	}
 
-	allocationID := hex.EncodeToString(allocationIDBytes)
-	allocationIDAddress := eth.MustNewAddress(allocationID)
-
-	methodCall := methodDef.NewCall()
-	methodCall.AppendArg(eth.MustNewAddress(indexerAddress))
-	methodCall.AppendArg(qm)
-	methodCall.AppendArg(amount)
-	methodCall.AppendArg(allocationIDAddress)
-	methodCall.AppendArg(make([]byte, 32))
-	methodCall.AppendArg(proofBytes)
+	allocationID := eth.Address(allocationIDBytes)
 
-	data, err := methodCall.Encode()
+	data, err := utils.EncodeAllocateFromCall(indexer, qm, amount, allocationID, metadata, proofBytes)
 	if err != nil {
-		return "", "", fmt.Errorf("encoding method call: %w", err)
+		return "", nil, err
 	}
 
-	signer, err := native.NewPrivateKeySigner(zap.NewNop(), utils.MustGetChainID(ctx, cli), utils.MustGetPrivateKey(ctx))
+	signer, err := chain.Signer(ctx)
 	if err != nil {
-		return "", "", fmt.Errorf("unable to create signer: %w", err)
+		return "", nil, err
 	}
 
-	var gasPriceBigInt *big.Int
-	if gasPrice == 0 {
-		gasPriceBigInt = utils.MustGetGasPrice(ctx, cli)
-	} else {
-		gasPriceBigInt = big.NewInt(gasPrice)
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", nil, err
 	}
 
 	signedTx, err := signer.SignTransaction(
-		utils.MustGetAccountNonce(ctx, eth.MustNewAddress(from), cli),
+		nonce,
 		eth.MustNewAddress(to),
 		big.NewInt(0),
 		big.NewInt(7_000_000).Uint64(),
@@ -194,64 +348,133 @@ func allocateCall(ctx context.Context, to string, from string, cli *ethrpc.Clien
 		data,
 	)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
 
-	resp, err := cli.SendRaw(ctx, signedTx)
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
 	if err != nil {
-		return "", "", err
-	}
-
-	receipt, err := utils.FetchReceiptWithProgress(ctx, cli, eth.MustNewHash(resp))
-	if err != nil {
-		return "", "", err
+		return resp, allocationID, err
 	}
 
 	if receipt == nil {
-		return "", "", fmt.Errorf("failed to allocate. no receipt found for transaction %s", resp)
+		return resp, allocationID, fmt.Errorf("failed to allocate. no receipt found for transaction %s", resp)
 	}
 
 	if len(receipt.Logs) == 0 {
-		return "", "", fmt.Errorf("failed to allocate. no logs found for transaction %s", resp)
+		return resp, allocationID, fmt.Errorf("failed to allocate. no logs found for transaction %s", resp)
 	}
 
 	return resp, allocationID, nil
 }
 
-func generateAllocationIDAndProof(address string) ([]byte, []byte, error) { //returns allocationID, proof, err
-	indexerAddress := common.HexToAddress(address)
+// startServiceCall is the Horizon counterpart of allocateCall, opening the
+// allocation through SubgraphService `startService`.
+func startServiceCall(ctx context.Context, profile *utils.NetworkProfile, from eth.Address, chain *utils.Chain, indexer eth.Address, deploymentID string, isCurated bool, amt uint64, gasPrice int64) (string, eth.Address, error) {
+	if isCurated {
+		return "", nil, fmt.Errorf("deployment has curation and cannot be paid to. please use a different deployment and open a new allocation")
+	}
 
-	// Create a new ECDSA key, to generate a new allocation ID.
-	key, err := crypto.GenerateKey()
+	methodDef, err := eth.NewMethodDef("startService(address,bytes)")
 	if err != nil {
-		return nil, nil, fmt.Errorf("error generating key: %w", err)
+		return "", nil, fmt.Errorf("creating method definition: %w", err)
 	}
-	allocationIDAddress := crypto.PubkeyToAddress(key.PublicKey)
 
-	pk, err := eth.NewPrivateKey(hex.EncodeToString(crypto.FromECDSA(key)))
+	chainID, err := chain.ChainID(ctx)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating private key: %w", err)
+		return "", nil, err
 	}
 
-	messageHash := crypto.Keccak256Hash(bytes.Join([][]byte{indexerAddress.Bytes(), allocationIDAddress.Bytes()}, nil))
+	amount := utils.ConvertToWei(amt)
+	allocationKey, err := utils.NewAllocationKey()
+	if err != nil {
+		return "", nil, err
+	}
+	allocationIDBytes, proofBytes, err := proof.CreateHorizon(indexer.Pretty(), profile.SubgraphService, chainID, allocationKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("generating proof: %w", err)
+	}
 
-	// Sign the message hash
-	signature, err := pk.SignPersonal(messageHash.Bytes())
+	qm, err := utils.ConvertIPFSHashToByteString(deploymentID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error signing message: %w", err)
+		return "", nil, fmt.Errorf("converting IPFS hash to byte string: %w", err)
 	}
 
-	invertedSignature := signature.ToInverted()
+	allocationID := eth.Address(allocationIDBytes)
 
-	// Verify signature
-	recoveredAddress, err := invertedSignature.RecoverPersonal(messageHash.Bytes())
+	serviceData, err := utils.EncodeStartServiceData(qm, amount, allocationID, proofBytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error recovering address: %w", err)
+		return "", nil, err
 	}
 
-	if !bytes.Equal(recoveredAddress.Bytes(), allocationIDAddress.Bytes()) {
-		return nil, nil, fmt.Errorf("recovered address does not match allocation ID")
+	methodCall := methodDef.NewCall()
+	methodCall.AppendArg(indexer)
+	methodCall.AppendArg(serviceData)
+
+	data, err := methodCall.Encode()
+	if err != nil {
+		return "", nil, fmt.Errorf("encoding method call: %w", err)
+	}
+
+	signer, err := chain.Signer(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", nil, err
+	}
+
+	signedTx, err := signer.SignTransaction(
+		nonce,
+		eth.MustNewAddress(profile.SubgraphService),
+		big.NewInt(0),
+		big.NewInt(7_000_000).Uint64(),
+		gasPriceBigInt,
+		data,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
+	if err != nil {
+		return resp, allocationID, err
+	}
+
+	if receipt == nil {
+		return resp, allocationID, fmt.Errorf("failed to start service. no receipt found for transaction %s", resp)
+	}
+
+	if len(receipt.Logs) == 0 {
+		return resp, allocationID, fmt.Errorf("failed to start service. no logs found for transaction %s", resp)
+	}
+
+	return resp, allocationID, nil
+}
+
+func manifestOptionsFromFlags(cmd *cobra.Command) (utils.ManifestOptions, error) {
+	var opts utils.ManifestOptions
+	var err error
+
+	if opts.TemplateFile, err = cmd.Flags().GetString("manifest-template"); err != nil {
+		return opts, err
+	}
+	if opts.Deterministic, err = cmd.Flags().GetBool("deterministic"); err != nil {
+		return opts, err
+	}
+	if opts.Params.CustomerID, err = cmd.Flags().GetString("customer-id"); err != nil {
+		return opts, err
+	}
+	if opts.Params.InvoiceReference, err = cmd.Flags().GetString("invoice-reference"); err != nil {
+		return opts, err
+	}
+	if opts.Params.BillingPeriod, err = cmd.Flags().GetString("billing-period"); err != nil {
+		return opts, err
+	}
+	if opts.Params.PayerAddress, err = cmd.Flags().GetString("payer-address"); err != nil {
+		return opts, err
 	}
 
-	return allocationIDAddress.Bytes(), invertedSignature[:], nil
+	return opts, nil
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/proof"
+)
+
+func newProofCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "proof",
+		Short: "create and verify allocation proofs offline",
+	}
+
+	cmd.AddCommand(newProofVerifyCmd(logger))
+	cmd.AddCommand(newProofCreateCmd(logger))
+
+	return cmd
+}
+
+func newProofVerifyCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "verify that an allocation proof was signed by the allocation ID for the given indexer",
+		RunE:  proofVerifyE(logger),
+	}
+
+	cmd.Flags().String("indexer", "", "the indexer address the proof was created for")
+	cmd.Flags().String("allocation-id", "", "the allocation ID the proof should recover to")
+	cmd.Flags().String("proof", "", "the allocation proof, as hex")
+
+	return cmd
+}
+
+func proofVerifyE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		indexer, err := cmd.Flags().GetString("indexer")
+		if err != nil {
+			return err
+		}
+		if indexer == "" {
+			return fmt.Errorf("indexer address is required")
+		}
+
+		allocationID, err := cmd.Flags().GetString("allocation-id")
+		if err != nil {
+			return err
+		}
+		if allocationID == "" {
+			return fmt.Errorf("allocation ID is required")
+		}
+
+		proofHex, err := cmd.Flags().GetString("proof")
+		if err != nil {
+			return err
+		}
+		proofBytes, err := proof.DecodeHex(proofHex)
+		if err != nil {
+			return err
+		}
+
+		recovered, err := proof.Recover(indexer, allocationID, proofBytes)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Recovered signer:", recovered.Pretty())
+
+		if err := proof.Verify(indexer, allocationID, proofBytes); err != nil {
+			return err
+		}
+
+		fmt.Println("Proof is valid")
+
+		return nil
+	}
+}
+
+func newProofCreateCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "create an allocation proof from an existing allocation key",
+		RunE:  proofCreateE(logger),
+	}
+
+	cmd.Flags().String("indexer", "", "the indexer address the allocation will be opened for")
+	cmd.Flags().String("allocation-key", "", "the allocation private key, as hex (if not provided, ALLOCATION_PRIVATE_KEY env var will be used)")
+
+	return cmd
+}
+
+func proofCreateE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		indexer, err := cmd.Flags().GetString("indexer")
+		if err != nil {
+			return err
+		}
+		if indexer == "" {
+			return fmt.Errorf("indexer address is required")
+		}
+
+		allocationKeyHex, err := cmd.Flags().GetString("allocation-key")
+		if err != nil {
+			return err
+		}
+		if allocationKeyHex == "" {
+			allocationKeyHex = os.Getenv("ALLOCATION_PRIVATE_KEY")
+		}
+		if allocationKeyHex == "" {
+			return fmt.Errorf("allocation key is required, either through the ALLOCATION_PRIVATE_KEY environment variable or --allocation-key flag")
+		}
+
+		allocationKey, err := eth.NewPrivateKey(strings.TrimSpace(allocationKeyHex))
+		if err != nil {
+			return fmt.Errorf("import allocation key: %s", err)
+		}
+
+		allocationIDBytes, proofBytes, err := proof.Create(indexer, allocationKey)
+		if err != nil {
+			return fmt.Errorf("creating proof: %w", err)
+		}
+
+		fmt.Println("Allocation ID: ", eth.Address(allocationIDBytes).Pretty())
+		fmt.Println("Proof: ", "0x"+hex.EncodeToString(proofBytes))
+
+		return nil
+	}
+}
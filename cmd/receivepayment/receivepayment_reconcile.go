@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+func newReconcileCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "reconcile our payment records against on-chain payments",
+		Long: "Match expected payments (the local ledger, or a CSV with a date,indexer,allocation,amount,tx header and amounts in wei) " +
+			"against the payments found on chain: GRT transfers from the payer addresses to the Staking contract and the collects of " +
+			"their transactions. Reports unrecorded on-chain payments, expected transactions that reverted or are missing (reorged out), " +
+			"and amount or indexer mismatches. Exits with an error when any discrepancy is found.",
+		RunE: reconcileE(logger),
+	}
+
+	cmd.Flags().String("expected", utils.DefaultLedgerFile(), "the expected payments, either a JSONL ledger or a .csv file")
+	cmd.Flags().StringSlice("payer", nil, "a payer address whose payments are scanned, can be repeated")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().Uint64("from-block", utils.StakingDeploymentBlock, "the block to start scanning logs from")
+	cmd.Flags().Uint64("to-block", 0, "the last block to scan logs to. If 0, the latest block is used")
+	cmd.Flags().Uint64("chunk-size", 10_000, "the maximum number of blocks requested per eth_getLogs call")
+	cmd.Flags().Bool("show-matched", false, "also list the payments that reconcile")
+	cmd.Flags().String("output", "text", "the output format, one of: text, json")
+
+	return cmd
+}
+
+type reconcileView struct {
+	Status       string `json:"status"`
+	Trx          string `json:"trx,omitempty"`
+	Indexer      string `json:"indexer,omitempty"`
+	AllocationID string `json:"allocationId"`
+	Expected     string `json:"expectedAmount,omitempty"`
+	OnChain      string `json:"onChainAmount,omitempty"`
+	BlockNumber  uint64 `json:"blockNumber,omitempty"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+func newReconcileView(item *utils.ReconcileItem) *reconcileView {
+	view := &reconcileView{Status: item.Status, Detail: item.Detail}
+	if exp := item.Expected; exp != nil {
+		view.Trx = exp.Trx
+		view.Indexer = exp.Indexer
+		view.AllocationID = exp.AllocationID
+		view.Expected = exp.Amount.String()
+	}
+	if payment := item.OnChain; payment != nil {
+		view.Trx = payment.Trx
+		view.Indexer = payment.Indexer
+		view.AllocationID = payment.AllocationID
+		view.OnChain = payment.Amount.String()
+		view.BlockNumber = payment.BlockNumber
+	}
+
+	return view
+}
+
+func reconcileE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		rpcUrl, err := cmd.Flags().GetString("rpc-url")
+		if err != nil {
+			return err
+		}
+
+		expectedFile, err := cmd.Flags().GetString("expected")
+		if err != nil {
+			return err
+		}
+
+		payerFlags, err := cmd.Flags().GetStringSlice("payer")
+		if err != nil {
+			return err
+		}
+		if len(payerFlags) == 0 {
+			return fmt.Errorf("at least one --payer address is required")
+		}
+		payers := make([]eth.Address, len(payerFlags))
+		for i, payer := range payerFlags {
+			if payers[i], err = eth.NewAddress(payer); err != nil {
+				return fmt.Errorf("invalid payer address %q: %w", payer, err)
+			}
+		}
+
+		fromBlock, err := cmd.Flags().GetUint64("from-block")
+		if err != nil {
+			return err
+		}
+
+		toBlock, err := cmd.Flags().GetUint64("to-block")
+		if err != nil {
+			return err
+		}
+
+		chunkSize, err := cmd.Flags().GetUint64("chunk-size")
+		if err != nil {
+			return err
+		}
+
+		showMatched, err := cmd.Flags().GetBool("show-matched")
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("invalid output format %q, must be one of: text, json", output)
+		}
+
+		expected, err := utils.ReadExpectedPayments(expectedFile)
+		if err != nil {
+			return fmt.Errorf("failed to read expected payments: %w", err)
+		}
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		if _, err := utils.NewChain(rpcClient, utils.ArbitrumOneChainID).ChainID(ctx); err != nil {
+			return err
+		}
+
+		if toBlock == 0 {
+			toBlock, err = rpcClient.LatestBlockNum(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to fetch latest block: %w", err)
+			}
+		}
+
+		logger.Debug("scanning payments", "payers", len(payers), "from_block", fromBlock, "to_block", toBlock)
+		onChain, err := utils.ScanPayments(ctx, rpcClient, payers, fromBlock, toBlock, chunkSize)
+		if err != nil {
+			return fmt.Errorf("failed to scan on-chain payments: %w", err)
+		}
+
+		items, err := utils.Reconcile(ctx, rpcClient, expected, onChain)
+		if err != nil {
+			return fmt.Errorf("failed to reconcile: %w", err)
+		}
+
+		discrepancies := 0
+		views := make([]*reconcileView, 0, len(items))
+		for _, item := range items {
+			if item.Status != utils.ReconcileMatched {
+				discrepancies++
+			} else if !showMatched {
+				continue
+			}
+			views = append(views, newReconcileView(item))
+		}
+
+		if output == "json" {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(views); err != nil {
+				return err
+			}
+		} else {
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(writer, "STATUS\tALLOCATION ID\tTRX\tEXPECTED\tON CHAIN\tDETAIL")
+			for _, view := range views {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", view.Status, view.AllocationID, orDash(view.Trx), formatWeiString(view.Expected), formatWeiString(view.OnChain), view.Detail)
+			}
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			fmt.Printf("\n%d expected payments, %d on-chain payments in blocks %d-%d, %d discrepancies\n", len(expected), len(onChain), fromBlock, toBlock, discrepancies)
+		}
+
+		if discrepancies > 0 {
+			return fmt.Errorf("found %d discrepancies", discrepancies)
+		}
+
+		return nil
+	}
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func formatWeiString(wei string) string {
+	if wei == "" {
+		return "-"
+	}
+
+	value, ok := new(big.Int).SetString(wei, 10)
+	if !ok {
+		return wei
+	}
+	return utils.FormatGRT(value)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+func newSetOperatorCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-operator",
+		Short: "grant or revoke operator rights of an address (usually the payer) over the indexer",
+		Long: "Grant or revoke operator rights of an address over the indexer. This must be signed with the indexer key, " +
+			"and is required before a payer can open or close allocations on behalf of the indexer. " +
+			"With a horizon network profile, the rights are granted on the indexer provision to SubgraphService.",
+		RunE: setOperatorE(logger),
+	}
+
+	cmd.Flags().String("private-key-file", "", "the indexer private key file (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().String("operator", "", "the address to grant or revoke operator rights for")
+	cmd.Flags().Bool("revoke", false, "revoke the operator rights instead of granting them")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a built-in name (arbitrum-one) or a JSON profile file. A profile with the horizon backend sets the operator on the indexer provision to SubgraphService. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network")
+
+	return cmd
+}
+
+func setOperatorE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		rpcUrl, err := cmd.Flags().GetString("rpc-url")
+		if err != nil {
+			return err
+		}
+
+		network, err := cmd.Flags().GetString("network")
+		if err != nil {
+			return err
+		}
+		profile, err := utils.LoadNetworkProfile(network)
+		if err != nil {
+			return err
+		}
+
+		operatorFlag, err := cmd.Flags().GetString("operator")
+		if err != nil {
+			return err
+		}
+		operator, err := utils.ParseAddress("operator", operatorFlag)
+		if err != nil {
+			return err
+		}
+
+		revoke, err := cmd.Flags().GetBool("revoke")
+		if err != nil {
+			return err
+		}
+
+		gasPrice, err := cmd.Flags().GetInt64("gas-price")
+		if err != nil {
+			return err
+		}
+
+		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+		if err != nil {
+			return err
+		}
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		ctx = utils.WithPrivateKey(ctx, privateKey)
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		chain := utils.NewChain(rpcClient, profile.ChainID)
+		if _, err := chain.ChainID(ctx); err != nil {
+			return err
+		}
+
+		indexer := privateKey.PublicKey().Address()
+		indexerAddress := indexer.Pretty()
+
+		var isOperator bool
+		if profile.Horizon() {
+			isOperator, err = utils.IsProvisionOperatorCall(ctx, rpcClient, profile, operator, indexer)
+		} else {
+			isOperator, err = utils.IsOperatorCall(ctx, rpcClient, operator, indexer)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check operator authorization: %w", err)
+		}
+		if isOperator == !revoke {
+			fmt.Printf("Operator %s is already in the requested state for indexer %s, nothing to do\n", operator.Pretty(), indexerAddress)
+			return nil
+		}
+
+		var setOperatorTrx string
+		if profile.Horizon() {
+			setOperatorTrx, err = setProvisionOperatorCall(ctx, profile, indexer, chain, operator, !revoke, gasPrice)
+		} else {
+			setOperatorTrx, err = setOperatorCall(ctx, utils.StakingContractAddress, indexer, chain, operator, !revoke, gasPrice)
+		}
+		if err != nil {
+			return err
+		}
+
+		if revoke {
+			fmt.Printf("Operator %s revoked for indexer %s\n", operator.Pretty(), indexerAddress)
+		} else {
+			fmt.Printf("Operator %s authorized for indexer %s\n", operator.Pretty(), indexerAddress)
+		}
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", setOperatorTrx)
+
+		return nil
+	}
+}
+
+func setOperatorCall(ctx context.Context, to string, from eth.Address, chain *utils.Chain, operator eth.Address, allowed bool, gasPrice int64) (string, error) {
+	methodDef, err := eth.NewMethodDef("setOperator(address,bool)")
+	if err != nil {
+		return "", fmt.Errorf("creating method definition: %w", err)
+	}
+
+	methodCall := methodDef.NewCall()
+	methodCall.AppendArg(operator)
+	methodCall.AppendArg(allowed)
+
+	data, err := methodCall.Encode()
+	if err != nil {
+		return "", fmt.Errorf("encoding method call: %w", err)
+	}
+
+	signer, err := chain.Signer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", err
+	}
+
+	signedTx, err := signer.SignTransaction(
+		nonce,
+		eth.MustNewAddress(to),
+		big.NewInt(0),
+		big.NewInt(1_000_000).Uint64(),
+		gasPriceBigInt,
+		data,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
+	if err != nil {
+		return resp, err
+	}
+
+	if receipt == nil {
+		return "", fmt.Errorf("failed to set operator. no receipt found for transaction %s", resp)
+	}
+
+	if len(receipt.Logs) == 0 {
+		return "", fmt.Errorf("failed to set operator. no logs found for transaction %s", resp)
+	}
+
+	return resp, nil
+}
+
+// setProvisionOperatorCall is the Horizon counterpart of setOperatorCall:
+// HorizonStaking `setOperator(verifier, operator, allowed)` with
+// SubgraphService as the verifier.
+func setProvisionOperatorCall(ctx context.Context, profile *utils.NetworkProfile, from eth.Address, chain *utils.Chain, operator eth.Address, allowed bool, gasPrice int64) (string, error) {
+	methodDef, err := eth.NewMethodDef("setOperator(address,address,bool)")
+	if err != nil {
+		return "", fmt.Errorf("creating method definition: %w", err)
+	}
+
+	methodCall := methodDef.NewCall()
+	methodCall.AppendArg(eth.MustNewAddress(profile.SubgraphService))
+	methodCall.AppendArg(operator)
+	methodCall.AppendArg(allowed)
+
+	data, err := methodCall.Encode()
+	if err != nil {
+		return "", fmt.Errorf("encoding method call: %w", err)
+	}
+
+	signer, err := chain.Signer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", err
+	}
+
+	signedTx, err := signer.SignTransaction(
+		nonce,
+		eth.MustNewAddress(profile.HorizonStaking),
+		big.NewInt(0),
+		big.NewInt(1_000_000).Uint64(),
+		gasPriceBigInt,
+		data,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
+	if err != nil {
+		return resp, err
+	}
+
+	if receipt == nil {
+		return "", fmt.Errorf("failed to set operator. no receipt found for transaction %s", resp)
+	}
+
+	if len(receipt.Logs) == 0 {
+		return "", fmt.Errorf("failed to set operator. no logs found for transaction %s", resp)
+	}
+
+	return resp, nil
+}
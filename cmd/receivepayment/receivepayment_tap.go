@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/tap"
+)
+
+func newTapCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tap",
+		Short: "verify and redeem TAP receipt aggregate vouchers (Horizon)",
+		Long: "Verify and redeem the Receipt Aggregate Vouchers (RAVs) a payer signed with `sendpayment tap aggregate`. " +
+			"Redeeming collects the RAV through SubgraphService, paying the indexer from the payer escrow account. " +
+			"These commands are for TAP v2 RAVs and require a --network profile with the horizon backend, " +
+			"TAP v1 RAVs are redeemed from the TAP v1 Escrow by indexer-agent, which holds the allocation keys.",
+	}
+
+	cmd.AddCommand(newTapVerifyCmd(logger))
+	cmd.AddCommand(newTapRedeemCmd(logger))
+
+	return cmd
+}
+
+func newTapVerifyCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "verify the signature of a RAV offline",
+		RunE:  tapVerifyE(logger),
+	}
+
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a JSON profile file with the horizon backend and graph_tally_collector. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().String("rav", "", "the signed RAV file")
+	cmd.Flags().String("signer", "", "the address the RAV must be signed by. If not provided, the RAV payer")
+
+	return cmd
+}
+
+func tapVerifyE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		profile, domain, rav, err := tapRAVFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		signer, err := cmd.Flags().GetString("signer")
+		if err != nil {
+			return err
+		}
+
+		expected := rav.Message.Payer
+		if signer != "" {
+			if !common.IsHexAddress(signer) {
+				return fmt.Errorf("invalid signer address %q", signer)
+			}
+			expected = common.HexToAddress(signer)
+		}
+
+		printRAV(rav)
+
+		if err := rav.Verify(domain, expected); err != nil {
+			return err
+		}
+		if rav.Message.DataService != common.HexToAddress(profile.SubgraphService) {
+			return fmt.Errorf("RAV data service %s is not the %s SubgraphService %s", rav.Message.DataService.Hex(), profile.Name, profile.SubgraphService)
+		}
+
+		fmt.Printf("RAV signature is valid, signed by %s\n", eth.Address(expected.Bytes()).Pretty())
+		return nil
+	}
+}
+
+func newTapRedeemCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "redeem",
+		Short: "redeem a RAV, collecting its value from the payer escrow",
+		Long: "Redeem a signed RAV through SubgraphService `collect`. The transaction must be sent by the indexer, or an operator of its provision to SubgraphService. " +
+			"Only what was not collected yet from the allocation RAVs is paid, so redeeming the latest RAV of an allocation is enough.",
+		RunE: tapRedeemE(logger),
+	}
+
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a JSON profile file with the horizon backend and graph_tally_collector. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().String("rav", "", "the signed RAV file")
+	cmd.Flags().String("tokens", "", "the amount of GRT to collect, decimals allowed. If not provided, everything the RAV still owes")
+	cmd.Flags().String("private-key-file", "", "the private key file (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where the transaction is recorded. Set to empty to disable")
+
+	return cmd
+}
+
+func tapRedeemE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		profile, domain, rav, err := tapRAVFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		tokensGRT, err := cmd.Flags().GetString("tokens")
+		if err != nil {
+			return err
+		}
+
+		rpcUrl, err := cmd.Flags().GetString("rpc-url")
+		if err != nil {
+			return err
+		}
+
+		gasPrice, err := cmd.Flags().GetInt64("gas-price")
+		if err != nil {
+			return err
+		}
+
+		ledgerFile, err := cmd.Flags().GetString("ledger-file")
+		if err != nil {
+			return err
+		}
+		ledger := utils.NewLedger(ledgerFile)
+
+		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+		if err != nil {
+			return err
+		}
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		ctx = utils.WithPrivateKey(ctx, privateKey)
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		chain := utils.NewChain(rpcClient, profile.ChainID)
+		if _, err := chain.ChainID(ctx); err != nil {
+			return err
+		}
+
+		message := rav.Message
+		payer := eth.Address(message.Payer.Bytes())
+		indexer := eth.Address(message.ServiceProvider.Bytes())
+		allocationID := eth.Address(message.AllocationID().Bytes())
+
+		if message.DataService != common.HexToAddress(profile.SubgraphService) {
+			return fmt.Errorf("RAV data service %s is not the %s SubgraphService %s", message.DataService.Hex(), profile.Name, profile.SubgraphService)
+		}
+
+		signer, err := rav.Recover(domain)
+		if err != nil {
+			return err
+		}
+		authorized, err := utils.IsTallySignerAuthorizedCall(ctx, rpcClient, profile, payer, eth.Address(signer.Bytes()))
+		if err != nil {
+			return fmt.Errorf("failed to check signer authorization: %w", err)
+		}
+		if !authorized {
+			return fmt.Errorf("RAV signer %s is not authorized by payer %s. the payer must first authorize it on GraphTallyCollector %s", eth.Address(signer.Bytes()).Pretty(), payer.Pretty(), profile.GraphTallyCollector)
+		}
+
+		allocation, err := utils.GetServiceAllocationCall(ctx, rpcClient, profile, allocationID.String())
+		if err != nil {
+			return fmt.Errorf("failed to fetch allocation: %w", err)
+		}
+		if !allocation.Exists() {
+			return fmt.Errorf("allocation %s does not exist on SubgraphService", allocationID.Pretty())
+		}
+		if allocation.Indexer.String() != indexer.String() {
+			return fmt.Errorf("allocation %s belongs to indexer %s, not to the RAV service provider %s", allocationID.Pretty(), allocation.Indexer.Pretty(), indexer.Pretty())
+		}
+
+		from := privateKey.PublicKey().Address()
+		if err := utils.CheckProvisionOperator(ctx, rpcClient, profile, from.String(), indexer.String()); err != nil {
+			return err
+		}
+
+		collected, err := utils.GetTokensCollectedCall(ctx, rpcClient, profile, eth.Address(message.DataService.Bytes()), message.CollectionID.Bytes(), indexer, payer)
+		if err != nil {
+			return fmt.Errorf("failed to fetch collected tokens: %w", err)
+		}
+		due := new(big.Int).Sub(message.ValueAggregate, collected)
+		if due.Sign() <= 0 {
+			return fmt.Errorf("nothing to redeem, the %s of the RAV were already collected", utils.FormatGRT(collected))
+		}
+
+		tokens := due
+		if tokensGRT != "" {
+			if tokens, err = utils.ParseGRT(tokensGRT); err != nil {
+				return err
+			}
+			if tokens.Cmp(due) > 0 {
+				return fmt.Errorf("cannot collect %s, the RAV only owes %s", utils.FormatGRT(tokens), utils.FormatGRT(due))
+			}
+		}
+
+		escrow, err := utils.GetEscrowAccountCall(ctx, rpcClient, profile, payer, eth.MustNewAddress(profile.GraphTallyCollector), indexer)
+		if err != nil {
+			return fmt.Errorf("failed to fetch escrow account: %w", err)
+		}
+		if escrow.Available().Cmp(tokens) < 0 {
+			return fmt.Errorf("payer %s escrow for indexer %s only has %s available, cannot collect %s", payer.Pretty(), indexer.Pretty(), utils.FormatGRT(escrow.Available()), utils.FormatGRT(tokens))
+		}
+
+		collectData, err := tap.EncodeCollectData(rav, tokens)
+		if err != nil {
+			return err
+		}
+
+		redeemTrx, err := collectCall(ctx, profile, from.String(), chain, indexer, collectData, gasPrice)
+		ledgerEntry := &utils.LedgerEntry{
+			Action:       utils.LedgerActionTapRedeem,
+			Sender:       from.Pretty(),
+			Indexer:      indexer.Pretty(),
+			AllocationID: allocationID.Pretty(),
+			Amount:       tokens.String(),
+		}
+		if deploymentID, err := utils.ConvertByteStringToIPFSHash(allocation.SubgraphDeploymentID); err == nil {
+			ledgerEntry.DeploymentID = deploymentID
+		}
+		if recordErr := ledger.Record(ctx, chain, ledgerEntry, redeemTrx, err); recordErr != nil {
+			logger.Warn("unable to record RAV redeem in ledger", "ledger_file", ledgerFile, "err", recordErr)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Redeemed %s from payer %s\n", utils.FormatGRT(tokens), payer.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", redeemTrx)
+
+		return nil
+	}
+}
+
+// tapRAVFlags loads the --network profile and the --rav signed RAV, with the
+// domain it is signed in.
+func tapRAVFlags(cmd *cobra.Command) (*utils.NetworkProfile, *tap.Domain, *tap.SignedRAV, error) {
+	network, err := cmd.Flags().GetString("network")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	profile, err := utils.LoadNetworkProfile(network)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := profile.RequireTally(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	ravFile, err := cmd.Flags().GetString("rav")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ravFile == "" {
+		return nil, nil, nil, fmt.Errorf("RAV file is required")
+	}
+	rav, err := tap.ReadRAV(ravFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	domain, err := tap.NewDomain(profile.ChainID, profile.GraphTallyCollector)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return profile, domain, rav, nil
+}
+
+func printRAV(rav *tap.SignedRAV) {
+	message := rav.Message
+	fmt.Printf("RAV for allocation %s:\n", eth.Address(message.AllocationID().Bytes()).Pretty())
+	fmt.Printf("  Payer:             %s\n", eth.Address(message.Payer.Bytes()).Pretty())
+	fmt.Printf("  Service provider:  %s\n", eth.Address(message.ServiceProvider.Bytes()).Pretty())
+	fmt.Printf("  Data service:      %s\n", eth.Address(message.DataService.Bytes()).Pretty())
+	fmt.Printf("  Value aggregate:   %s\n", utils.FormatGRT(message.ValueAggregate))
+	fmt.Printf("  Last receipt:      %d ns\n", message.TimestampNs)
+}
+
+func collectCall(ctx context.Context, profile *utils.NetworkProfile, from string, chain *utils.Chain, indexer eth.Address, collectData []byte, gasPrice int64) (string, error) {
+	methodDef, err := eth.NewMethodDef("collect(address,uint8,bytes)")
+	if err != nil {
+		return "", fmt.Errorf("creating method definition: %w", err)
+	}
+
+	methodCall := methodDef.NewCall()
+	methodCall.AppendArg(indexer)
+	methodCall.AppendArg(tap.QueryFeePaymentType)
+	methodCall.AppendArg(collectData)
+
+	data, err := methodCall.Encode()
+	if err != nil {
+		return "", fmt.Errorf("encoding method call: %w", err)
+	}
+
+	signer, err := chain.Signer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, eth.MustNewAddress(from), gasPrice)
+	if err != nil {
+		return "", err
+	}
+
+	signedTx, err := signer.SignTransaction(
+		nonce,
+		eth.MustNewAddress(profile.SubgraphService),
+		big.NewInt(0),
+		big.NewInt(7_000_000).Uint64(),
+		gasPriceBigInt,
+		data,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
+	if err != nil {
+		return resp, err
+	}
+
+	if receipt == nil {
+		return "", fmt.Errorf("failed to redeem RAV. no receipt found for transaction %s", resp)
+	}
+
+	if len(receipt.Logs) == 0 {
+		return "", fmt.Errorf("failed to redeem RAV. no logs found for transaction %s", resp)
+	}
+
+	return resp, nil
+}
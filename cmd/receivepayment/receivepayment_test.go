@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/fakechain"
+)
+
+var testDeployment = eth.MustNewHash("0xe4ca0b3bd66d4b49cfe4c5ed3a0e97e2e2c4e8aa4fb1ee5c1a01c3a5a4e0b101")
+
+type receiveTest struct {
+	chain      *fakechain.Chain
+	url        string
+	indexerKey *eth.PrivateKey
+	indexer    eth.Address
+	keyFile    string
+	ledgerFile string
+	stop       func() error
+}
+
+// newReceiveTest serves a fake chain with a funded indexer whose key signs
+// the commands.
+func newReceiveTest(t *testing.T) *receiveTest {
+	t.Helper()
+
+	chain := fakechain.New()
+	url, stop, err := chain.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stop() })
+
+	indexerKey, err := eth.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "indexer.key")
+	if err := os.WriteFile(keyFile, []byte(indexerKey.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	test := &receiveTest{
+		chain:      chain,
+		url:        url,
+		indexerKey: indexerKey,
+		indexer:    indexerKey.PublicKey().Address(),
+		keyFile:    keyFile,
+		ledgerFile: filepath.Join(t.TempDir(), "ledger.jsonl"),
+		stop:       stop,
+	}
+	chain.Fund(test.indexer, utils.ConvertToWei(1), utils.ConvertToWei(0))
+
+	return test
+}
+
+// horizonProfile writes the horizon network profile of the chain and
+// returns its path, for --network.
+func (r *receiveTest) horizonProfile(t *testing.T) string {
+	t.Helper()
+
+	content, err := json.Marshal(r.chain.HorizonProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "horizon.json")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func (r *receiveTest) run(t *testing.T, args ...string) error {
+	t.Helper()
+
+	cmd := newRootCmd(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	cmd.SetArgs(append(args, "--rpc-url", r.url, "--private-key-file", r.keyFile))
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return cmd.ExecuteContext(ctx)
+}
+
+// recordReplay runs args recording the RPC exchanges, then runs them again
+// from the recording with the chain stopped.
+func (r *receiveTest) recordReplay(t *testing.T, args ...string) {
+	t.Helper()
+	t.Cleanup(func() { utils.SetRPCFixtures("", "") })
+
+	dir := t.TempDir()
+	if err := r.run(t, append(args, "--rpc-record", dir)...); err != nil {
+		t.Fatalf("recording: %s", err)
+	}
+
+	r.stop()
+	if err := r.run(t, append(args, "--rpc-replay", dir)...); err != nil {
+		t.Fatalf("replaying: %s", err)
+	}
+}
+
+// replayedEntry returns the ledger entry recorded by recordReplay, checking
+// that the replay sent the same transaction.
+func (r *receiveTest) replayedEntry(t *testing.T) *utils.LedgerEntry {
+	t.Helper()
+
+	entries, err := utils.NewLedger(r.ledgerFile).Entries(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d ledger entries, want the recorded and the replayed one", len(entries))
+	}
+	if entries[0].Trx == "" || entries[0].Trx != entries[1].Trx || entries[0].AllocationID != entries[1].AllocationID {
+		t.Fatalf("replayed %s on allocation %s, recorded %s on %s", entries[1].Trx, entries[1].AllocationID, entries[0].Trx, entries[0].AllocationID)
+	}
+
+	return entries[0]
+}
+
+func TestRecordReplay(t *testing.T) {
+	deploymentID, err := utils.ConvertByteStringToIPFSHash(testDeployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("open-allocation", func(t *testing.T) {
+		test := newReceiveTest(t)
+		test.chain.Stake(test.indexer, utils.ConvertToWei(10_000))
+
+		test.recordReplay(t, "open-allocation", "--indexer-address", test.indexer.Pretty(), "--deployment-id", deploymentID, "--allocation-amount", "100", "--state-file", "", "--ledger-file", test.ledgerFile)
+		if entry := test.replayedEntry(t); entry.AllocationID == "" {
+			t.Error("no allocation opened")
+		}
+	})
+
+	t.Run("open-allocation horizon", func(t *testing.T) {
+		test := newReceiveTest(t)
+		test.chain.Provision(test.indexer, utils.ConvertToWei(10_000))
+
+		test.recordReplay(t, "open-allocation", "--network", test.horizonProfile(t), "--indexer-address", test.indexer.Pretty(), "--deployment-id", deploymentID, "--allocation-amount", "100", "--state-file", "", "--ledger-file", test.ledgerFile)
+		if entry := test.replayedEntry(t); entry.AllocationID == "" {
+			t.Error("no allocation opened")
+		}
+	})
+
+	t.Run("close-allocation", func(t *testing.T) {
+		test := newReceiveTest(t)
+		allocationID := eth.MustNewAddress("0xa110ca7e0000000000000000000000000000a110")
+		test.chain.Stake(test.indexer, utils.ConvertToWei(10_000))
+		test.chain.Allocate(test.indexer, testDeployment, allocationID, utils.ConvertToWei(100))
+		test.chain.AdvanceEpochs(1)
+
+		test.recordReplay(t, "close-allocation", "--allocation-id", allocationID.Pretty(), "--deployment-id", deploymentID, "--ledger-file", test.ledgerFile)
+		test.replayedEntry(t)
+	})
+
+	t.Run("set-operator", func(t *testing.T) {
+		test := newReceiveTest(t)
+
+		test.recordReplay(t, "set-operator", "--operator", "0x0fe1a70e0000000000000000000000000000fe1a")
+	})
+}
+
+func TestSetOperator(t *testing.T) {
+	test := newReceiveTest(t)
+	operator := eth.MustNewAddress("0x0fe1a70e0000000000000000000000000000fe1a")
+	cli := utils.NewRPCClient(test.url)
+
+	if err := test.run(t, "set-operator", "--operator", operator.Pretty()); err != nil {
+		t.Fatal(err)
+	}
+	if isOperator, err := utils.IsOperatorCall(context.Background(), cli, operator, test.indexer); err != nil || !isOperator {
+		t.Fatalf("operator on Staking %t (%v), want authorized", isOperator, err)
+	}
+
+	if err := test.run(t, "set-operator", "--operator", operator.Pretty(), "--revoke"); err != nil {
+		t.Fatal(err)
+	}
+	if isOperator, err := utils.IsOperatorCall(context.Background(), cli, operator, test.indexer); err != nil || isOperator {
+		t.Fatalf("operator on Staking %t (%v), want revoked", isOperator, err)
+	}
+}
+
+func TestSetOperatorHorizon(t *testing.T) {
+	test := newReceiveTest(t)
+	operator := eth.MustNewAddress("0x0fe1a70e0000000000000000000000000000fe1a")
+	cli := utils.NewRPCClient(test.url)
+	network := test.horizonProfile(t)
+	profile := test.chain.HorizonProfile()
+
+	if err := test.run(t, "set-operator", "--network", network, "--operator", operator.Pretty()); err != nil {
+		t.Fatal(err)
+	}
+	if isOperator, err := utils.IsProvisionOperatorCall(context.Background(), cli, profile, operator, test.indexer); err != nil || !isOperator {
+		t.Fatalf("operator on the SubgraphService provision %t (%v), want authorized", isOperator, err)
+	}
+	if isOperator, err := utils.IsOperatorCall(context.Background(), cli, operator, test.indexer); err != nil || isOperator {
+		t.Fatalf("operator on legacy Staking %t (%v), want untouched", isOperator, err)
+	}
+
+	if err := test.run(t, "set-operator", "--network", network, "--operator", operator.Pretty(), "--revoke"); err != nil {
+		t.Fatal(err)
+	}
+	if isOperator, err := utils.IsProvisionOperatorCall(context.Background(), cli, profile, operator, test.indexer); err != nil || isOperator {
+		t.Fatalf("operator on the SubgraphService provision %t (%v), want revoked", isOperator, err)
+	}
+}
+
+func TestDaemonClosesHorizonAllocation(t *testing.T) {
+	test := newReceiveTest(t)
+	test.chain.Provision(test.indexer, utils.ConvertToWei(10_000))
+	network := test.horizonProfile(t)
+	stateFile := filepath.Join(t.TempDir(), "allocations.json")
+	deploymentID, err := utils.ConvertByteStringToIPFSHash(testDeployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := test.run(t, "open-allocation", "--network", network, "--indexer-address", test.indexer.Pretty(), "--deployment-id", deploymentID, "--allocation-amount", "100", "--state-file", stateFile, "--ledger-file", test.ledgerFile); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := utils.LoadNetworkProfile(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &rpcDaemonChain{
+		chain:      utils.NewChain(utils.NewRPCClient(test.url), profile.ChainID),
+		profile:    profile,
+		privateKey: test.indexerKey,
+		ledger:     utils.NewLedger(test.ledgerFile),
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	daemon := newAllocationDaemon(chain, newAllocationStateFile(stateFile), daemonConfig{MinEpochs: 1, RetryBackoff: time.Minute, MaxRetryBackoff: time.Hour}, chain.logger)
+
+	// stopService has no epoch restriction, the allocation closes right away
+	if err := daemon.Tick(utils.WithPrivateKey(context.Background(), test.indexerKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	allocations, err := newAllocationStateFile(stateFile).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allocations) != 1 {
+		t.Fatalf("%d tracked allocations, want 1", len(allocations))
+	}
+	for id, tracked := range allocations {
+		if tracked.Status != trackedAllocationClosed || tracked.CloseTrx == "" || tracked.Attempts != 0 {
+			t.Fatalf("allocation %s is %s after %d attempts (%s), want closed on the first", id, tracked.Status, tracked.Attempts, tracked.LastError)
+		}
+
+		allocation, err := utils.GetServiceAllocationCall(context.Background(), chain.chain.Client(), profile, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allocation.IsOpen() {
+			t.Errorf("allocation %s still open on SubgraphService", id)
+		}
+	}
+}
+
+func TestAllocationUsageErrors(t *testing.T) {
+	test := newReceiveTest(t)
+
+	for name, args := range map[string][]string{
+		"show malformed allocation": {"allocation", "show", "nope", "--rpc-url", test.url},
+		"list malformed indexer":    {"allocation", "list", "--indexer", "nope", "--rpc-url", test.url},
+		"list missing indexer":      {"allocation", "list", "--rpc-url", test.url},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := newRootCmd(slog.New(slog.NewTextHandler(io.Discard, nil)))
+			cmd.SetArgs(args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			err := cmd.ExecuteContext(context.Background())
+			if code := utils.ExitCode(err); code != utils.ExitCodeUsage {
+				t.Errorf("exit code %d (%v), want %d", code, err, utils.ExitCodeUsage)
+			}
+		})
+	}
+}
+
+func TestOpenAllocationNotOperator(t *testing.T) {
+	test := newReceiveTest(t)
+	indexer := eth.MustNewAddress("0x1de7e0000000000000000000000000000001de7e")
+	test.chain.Stake(indexer, utils.ConvertToWei(10_000))
+	deploymentID, err := utils.ConvertByteStringToIPFSHash(testDeployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = test.run(t, "open-allocation", "--indexer-address", indexer.Pretty(), "--deployment-id", deploymentID, "--allocation-amount", "100", "--state-file", "", "--ledger-file", test.ledgerFile)
+	if err == nil || !strings.Contains(err.Error(), "is not an authorized operator of indexer "+indexer.Pretty()) {
+		t.Fatalf("error %v, want the signer refused as operator", err)
+	}
+	if code := utils.ExitCode(err); code != utils.ExitCodeError {
+		t.Errorf("exit code %d, want %d", code, utils.ExitCodeError)
+	}
+	test.assertNoLedgerEntries(t)
+}
+
+func TestOpenAllocationCapacity(t *testing.T) {
+	deploymentID, err := utils.ConvertByteStringToIPFSHash(testDeployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 GRT staked and 10,000 delegated, of which the ratio of 16 lets the
+	// indexer use 1,600
+	newTest := func(t *testing.T) *receiveTest {
+		test := newReceiveTest(t)
+		test.chain.Stake(test.indexer, utils.ConvertToWei(100))
+		test.chain.SetDelegation(test.indexer, 0, utils.ConvertToWei(10_000))
+		return test
+	}
+
+	t.Run("at capacity", func(t *testing.T) {
+		test := newTest(t)
+
+		if err := test.run(t, "open-allocation", "--indexer-address", test.indexer.Pretty(), "--deployment-id", deploymentID, "--allocation-amount", "1700", "--state-file", "", "--ledger-file", test.ledgerFile); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("over capacity", func(t *testing.T) {
+		test := newTest(t)
+
+		err := test.run(t, "open-allocation", "--indexer-address", test.indexer.Pretty(), "--deployment-id", deploymentID, "--allocation-amount", "1701", "--state-file", "", "--ledger-file", test.ledgerFile)
+		if err == nil || !strings.Contains(err.Error(), "maximum possible allocation amount is 1700 GRT") {
+			t.Fatalf("error %v, want the allocation refused over the 1700 GRT capacity", err)
+		}
+		if code := utils.ExitCode(err); code != utils.ExitCodeError {
+			t.Errorf("exit code %d, want %d", code, utils.ExitCodeError)
+		}
+		test.assertNoLedgerEntries(t)
+	})
+}
+
+func TestCloseAllocationSameEpoch(t *testing.T) {
+	test := newReceiveTest(t)
+	allocationID := eth.MustNewAddress("0xa110ca7e0000000000000000000000000000a110")
+	test.chain.Stake(test.indexer, utils.ConvertToWei(10_000))
+	test.chain.Allocate(test.indexer, testDeployment, allocationID, utils.ConvertToWei(100))
+
+	err := test.run(t, "close-allocation", "--allocation-id", allocationID.Pretty(), "--ledger-file", test.ledgerFile)
+	if err == nil || !strings.Contains(err.Error(), "still the current epoch") || !strings.Contains(err.Error(), "use --wait") {
+		t.Fatalf("error %v, want the close refused until the next epoch", err)
+	}
+	if code := utils.ExitCode(err); code != utils.ExitCodeError {
+		t.Errorf("exit code %d, want %d", code, utils.ExitCodeError)
+	}
+	test.assertNoLedgerEntries(t)
+	test.assertAllocationState(t, allocationID, utils.AllocationStateActive)
+}
+
+func TestCloseAllocationWaitsForEpoch(t *testing.T) {
+	defer func(interval time.Duration) { epochPollInterval = interval }(epochPollInterval)
+	epochPollInterval = 50 * time.Millisecond
+
+	test := newReceiveTest(t)
+	allocationID := eth.MustNewAddress("0xa110ca7e0000000000000000000000000000a110")
+	test.chain.Stake(test.indexer, utils.ConvertToWei(10_000))
+	test.chain.Allocate(test.indexer, testDeployment, allocationID, utils.ConvertToWei(100))
+	time.AfterFunc(300*time.Millisecond, func() { test.chain.AdvanceEpochs(1) })
+
+	if err := test.run(t, "close-allocation", "--allocation-id", allocationID.Pretty(), "--wait", "--ledger-file", test.ledgerFile); err != nil {
+		t.Fatal(err)
+	}
+	test.assertAllocationState(t, allocationID, utils.AllocationStateClosed)
+}
+
+func (r *receiveTest) assertNoLedgerEntries(t *testing.T) {
+	t.Helper()
+
+	entries, err := utils.NewLedger(r.ledgerFile).Entries(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d ledger entries, want no transaction sent", len(entries))
+	}
+}
+
+func (r *receiveTest) assertAllocationState(t *testing.T, allocationID eth.Address, want utils.AllocationState) {
+	t.Helper()
+
+	state, err := utils.GetAllocationStateCall(context.Background(), utils.NewRPCClient(r.url), allocationID.Pretty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != want {
+		t.Errorf("allocation %s is %s, want %s", allocationID.Pretty(), state, want)
+	}
+}
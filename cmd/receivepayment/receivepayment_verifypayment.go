@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+func newVerifyPaymentCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-payment",
+		Short: "verify a payment transaction sent to one of our allocations",
+		Long: "Fetch the receipt of a payment transaction, check that it succeeded and decode the GRT transfers and " +
+			"Staking rebates it produced, reporting how the payment was split and what the indexer actually received.",
+		RunE: verifyPaymentE(logger),
+	}
+
+	cmd.Flags().String("tx", "", "the payment transaction hash")
+	cmd.Flags().String("indexer", "", "the indexer address the payment is expected to go to")
+	cmd.Flags().String("allocation-id", "", "the allocation the payment is expected to be collected on. Optional, if empty all collected rebates are reported")
+	cmd.Flags().String("reference", "", "the payment reference the allocation is expected to carry in its metadata. Optional")
+	cmd.Flags().Bool("skip-reference", false, "do not look up the AllocationCreated event to decode the allocation payment reference")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+
+	return cmd
+}
+
+func verifyPaymentE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		rpcUrl, err := cmd.Flags().GetString("rpc-url")
+		if err != nil {
+			return err
+		}
+
+		trx, err := cmd.Flags().GetString("tx")
+		if err != nil {
+			return err
+		}
+		trxHash, err := eth.NewHash(trx)
+		if err != nil || len(trxHash) != 32 {
+			return fmt.Errorf("a valid transaction hash is required")
+		}
+
+		indexerFlag, err := cmd.Flags().GetString("indexer")
+		if err != nil {
+			return err
+		}
+		indexer, err := eth.NewAddress(indexerFlag)
+		if err != nil || len(indexer) == 0 {
+			return fmt.Errorf("a valid indexer address is required")
+		}
+
+		allocationFlag, err := cmd.Flags().GetString("allocation-id")
+		if err != nil {
+			return err
+		}
+		var allocationID eth.Address
+		if allocationFlag != "" {
+			allocationID, err = eth.NewAddress(allocationFlag)
+			if err != nil {
+				return fmt.Errorf("invalid allocation ID %q: %w", allocationFlag, err)
+			}
+		}
+
+		expectedReference, err := cmd.Flags().GetString("reference")
+		if err != nil {
+			return err
+		}
+
+		skipReference, err := cmd.Flags().GetBool("skip-reference")
+		if err != nil {
+			return err
+		}
+		if skipReference && expectedReference != "" {
+			return fmt.Errorf("--reference cannot be checked with --skip-reference")
+		}
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		if _, err := utils.NewChain(rpcClient, utils.ArbitrumOneChainID).ChainID(ctx); err != nil {
+			return err
+		}
+
+		receipt, err := rpcClient.TransactionReceipt(ctx, trxHash)
+		if err != nil {
+			return fmt.Errorf("failed to fetch receipt: %w", err)
+		}
+		if receipt == nil {
+			return fmt.Errorf("no receipt found for transaction %s, it is either pending or unknown", trxHash.Pretty())
+		}
+		if receipt.Status == nil || *receipt.Status != 1 {
+			return fmt.Errorf("transaction %s reverted in block %d", trxHash.Pretty(), receipt.BlockNumber)
+		}
+
+		paymentLogs, err := utils.DecodePaymentLogs(receipt)
+		if err != nil {
+			return fmt.Errorf("failed to decode payment logs: %w", err)
+		}
+
+		var rebates []*utils.RebateCollectedEvent
+		for _, rebate := range paymentLogs.Rebates {
+			if allocationID != nil && rebate.AllocationID.Pretty() != allocationID.Pretty() {
+				continue
+			}
+			rebates = append(rebates, rebate)
+		}
+
+		if len(rebates) == 0 {
+			if allocationID != nil {
+				return fmt.Errorf("transaction %s did not collect any payment on allocation %s", trxHash.Pretty(), allocationID.Pretty())
+			}
+			return fmt.Errorf("transaction %s did not collect any payment", trxHash.Pretty())
+		}
+
+		fmt.Println("Transaction:   ", trxHash.Pretty())
+		fmt.Println("Block:         ", uint64(receipt.BlockNumber))
+		fmt.Println("Payer:         ", receipt.From.Pretty())
+
+		for _, transfer := range paymentLogs.Transfers {
+			fmt.Printf("GRT transfer:   %s from %s to %s\n", utils.FormatGRT(transfer.Value), transfer.From.Pretty(), transfer.To.Pretty())
+		}
+
+		indexerTotal := big.NewInt(0)
+		for _, rebate := range rebates {
+			deploymentID, err := utils.ConvertByteStringToIPFSHash(rebate.SubgraphDeploymentID)
+			if err != nil {
+				return fmt.Errorf("failed to convert deployment ID: %w", err)
+			}
+
+			fmt.Println()
+			fmt.Println("Allocation:        ", rebate.AllocationID.Pretty())
+			fmt.Println("Indexer:           ", rebate.Indexer.Pretty())
+			fmt.Println("Deployment ID:     ", deploymentID)
+			fmt.Println("Epoch:             ", rebate.Epoch)
+			fmt.Println("Gross amount:      ", utils.FormatGRT(rebate.Tokens))
+			fmt.Println("Protocol tax:      ", utils.FormatGRT(rebate.ProtocolTax))
+			fmt.Println("Curation fees:     ", utils.FormatGRT(rebate.CurationFees))
+			fmt.Println("Query fees:        ", utils.FormatGRT(rebate.QueryFees))
+			fmt.Println("Delegation rewards:", utils.FormatGRT(rebate.DelegationRewards))
+			fmt.Println("Retained:          ", utils.FormatGRT(rebate.Retained()))
+			fmt.Println("Indexer receives:  ", utils.FormatGRT(rebate.QueryRebates))
+
+			if !skipReference {
+				metadata, err := allocationMetadata(ctx, rpcClient, paymentLogs, rebate)
+				if err != nil {
+					return fmt.Errorf("failed to look up allocation %s metadata: %w", rebate.AllocationID.Pretty(), err)
+				}
+				if metadata == nil {
+					fmt.Println("Reference:          unknown, AllocationCreated event not found")
+				} else {
+					fmt.Println("Reference:         ", displayReference(metadata))
+				}
+
+				if expectedReference != "" && (metadata == nil || !utils.ReferenceMatches(metadata, expectedReference)) {
+					return fmt.Errorf("allocation %s does not carry the expected reference %q", rebate.AllocationID.Pretty(), expectedReference)
+				}
+			}
+
+			if rebate.Indexer.Pretty() != indexer.Pretty() {
+				return fmt.Errorf("allocation %s belongs to indexer %s, not the expected indexer %s", rebate.AllocationID.Pretty(), rebate.Indexer.Pretty(), indexer.Pretty())
+			}
+
+			indexerTotal.Add(indexerTotal, rebate.QueryRebates)
+		}
+
+		fmt.Println()
+		fmt.Printf("Payment verified, indexer %s receives %s\n", indexer.Pretty(), utils.FormatGRT(indexerTotal))
+
+		return nil
+	}
+}
+
+// allocationMetadata returns the metadata the allocation was created with,
+// taken from the receipt when the payment was batched with allocateFrom and
+// from the Staking logs otherwise. It is nil when the event cannot be found.
+func allocationMetadata(ctx context.Context, cli *ethrpc.Client, paymentLogs *utils.PaymentLogs, rebate *utils.RebateCollectedEvent) ([]byte, error) {
+	for _, created := range paymentLogs.Allocations {
+		if created.AllocationID.Pretty() == rebate.AllocationID.Pretty() {
+			return created.Metadata, nil
+		}
+	}
+
+	created, err := utils.FindAllocationCreatedEvent(ctx, cli, rebate.AllocationID, rebate.Indexer, rebate.SubgraphDeploymentID, utils.StakingDeploymentBlock)
+	if err != nil || created == nil {
+		return nil, err
+	}
+
+	return created.Metadata, nil
+}
+
+func displayReference(metadata []byte) string {
+	if reference := utils.DecodeReference(metadata); reference != "" {
+		return reference
+	}
+	return "none"
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+const (
+	trackedAllocationOpen   = "open"
+	trackedAllocationClosed = "closed"
+)
+
+// trackedAllocation is an allocation opened by our key that the daemon is
+// responsible for closing.
+type trackedAllocation struct {
+	AllocationID  string    `json:"allocationId"`
+	Indexer       string    `json:"indexer"`
+	DeploymentID  string    `json:"deploymentId"`
+	Tokens        string    `json:"tokens"`
+	Reference     string    `json:"reference,omitempty"`
+	OpenedAt      time.Time `json:"openedAt"`
+	OpenTrx       string    `json:"openTrx"`
+	Status        string    `json:"status"`
+	CloseTrx      string    `json:"closeTrx,omitempty"`
+	ClosedAt      time.Time `json:"closedAt,omitzero"`
+	Attempts      int       `json:"attempts,omitempty"`
+	NextAttemptAt time.Time `json:"nextAttemptAt,omitzero"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+type allocationStateFile struct {
+	path string
+}
+
+func defaultAllocationStateFile() string {
+	return filepath.Join(utils.DefaultDataDir(), "allocations.json")
+}
+
+func newAllocationStateFile(path string) *allocationStateFile {
+	return &allocationStateFile{path: path}
+}
+
+func (f *allocationStateFile) Load() (map[string]*trackedAllocation, error) {
+	out := map[string]*trackedAllocation{}
+
+	content, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file %q: %w", f.path, err)
+	}
+
+	var allocations []*trackedAllocation
+	if err := json.Unmarshal(content, &allocations); err != nil {
+		return nil, fmt.Errorf("decoding state file %q: %w", f.path, err)
+	}
+
+	for _, allocation := range allocations {
+		out[strings.ToLower(allocation.AllocationID)] = allocation
+	}
+
+	return out, nil
+}
+
+func (f *allocationStateFile) Save(allocations map[string]*trackedAllocation) error {
+	list := make([]*trackedAllocation, 0, len(allocations))
+	for _, allocation := range allocations {
+		list = append(list, allocation)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].OpenedAt.Before(list[j].OpenedAt) })
+
+	content, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileAtomic(f.path, content); err != nil {
+		return fmt.Errorf("writing state file %q: %w", f.path, err)
+	}
+
+	return nil
+}
+
+// Update loads the state file, applies fn to the allocation with the given
+// ID (creating it when missing) and saves the result.
+func (f *allocationStateFile) Update(allocationID string, fn func(allocation *trackedAllocation)) error {
+	allocations, err := f.Load()
+	if err != nil {
+		return err
+	}
+
+	key := strings.ToLower(allocationID)
+	allocation, found := allocations[key]
+	if !found {
+		allocation = &trackedAllocation{AllocationID: allocationID, Status: trackedAllocationOpen}
+		allocations[key] = allocation
+	}
+	fn(allocation)
+
+	return f.Save(allocations)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
 )
 
 var rootCmd *cobra.Command
@@ -12,17 +13,45 @@ var rootCmd *cobra.Command
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-	//recover any panics from "must" functions
+	//recover any panics so that they are logged, a panic never exits with status 0
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Error("panic executing command", "err", r)
+			os.Exit(utils.ExitCodePanic)
 		}
 	}()
 
-	rootCmd = newSendPaymentCmd(logger)
+	rootCmd = newRootCmd(logger)
 
 	if err := rootCmd.Execute(); err != nil {
-		logger.Error("error executing command", "err", err)
-		os.Exit(1)
+		exitCode := utils.ExitCode(err)
+		logger.Error("error executing command", "err", err, "exit_code", exitCode)
+		os.Exit(exitCode)
 	}
 }
+
+// newRootCmd is the command tree with the persistent RPC fixture flags.
+func newRootCmd(logger *slog.Logger) *cobra.Command {
+	cmd := newSendPaymentCmd(logger)
+	cmd.AddCommand(newEscrowCmd(logger))
+	cmd.AddCommand(newTapCmd(logger))
+	cmd.AddCommand(newTapEscrowCmd(logger))
+
+	cmd.PersistentFlags().String("rpc-record", "", "record every JSON-RPC exchange as a fixture file in this directory")
+	cmd.PersistentFlags().String("rpc-replay", "", "answer JSON-RPC requests from the fixtures recorded in this directory instead of the rpc url, failing on any request that was not recorded")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		recordDir, err := cmd.Flags().GetString("rpc-record")
+		if err != nil {
+			return err
+		}
+
+		replayDir, err := cmd.Flags().GetString("rpc-replay")
+		if err != nil {
+			return err
+		}
+
+		return utils.SetRPCFixtures(recordDir, replayDir)
+	}
+
+	return cmd
+}
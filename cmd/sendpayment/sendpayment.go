@@ -1,19 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/streamingfast/eth-go"
-	ethrpc "github.com/streamingfast/eth-go/rpc"
-	"github.com/streamingfast/eth-go/signer/native"
 	"github.com/streamingfast/network-payments-cli/cmd/utils"
-	"go.uber.org/zap"
 )
 
 func newSendPaymentCmd(logger *slog.Logger) *cobra.Command {
@@ -25,9 +22,14 @@ func newSendPaymentCmd(logger *slog.Logger) *cobra.Command {
 
 	cmd.Flags().String("private-key-file", "", "the sender private key file. (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
 	cmd.Flags().String("allocation-id", "", "the allocation ID to pay to")
-	cmd.Flags().String("deployment-id", "", "the deployment ID of the service being allocated to. Optional, but recommended to ensure that no curation has been applied to the deployment")
-	cmd.Flags().Uint64("amount", 0, "the amount to pay")
-	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url. if not provided, will check the ARBITRUM_RPC_URL env var")
+	cmd.Flags().String("deployment-id", "", "the deployment ID of the service being allocated to. Optional, when provided the payment fails unless the allocation is on this deployment. A curated allocation deployment always fails the payment")
+	cmd.Flags().Uint64("amount", 0, "the gross amount to pay in GRT")
+	cmd.Flags().Uint64("net-amount", 0, "the amount in GRT the indexer should end up with. The gross amount is computed from the protocol tax, curation and delegation cuts, before the exponential rebate cap which may pay the indexer less. Mutually exclusive with --amount")
+	cmd.Flags().String("rewards-policy", utils.RewardsPolicyWarn, "what to do when the allocation deployment would earn indexing rewards (not deny-listed and signalled), one of: warn, fail")
+	cmd.Flags().String("network-subgraph-url", os.Getenv("NETWORK_SUBGRAPH_URL"), "the network subgraph query url used to look up other allocations on the allocation deployment. if not provided, will check the NETWORK_SUBGRAPH_URL env var. When empty, Staking logs are scanned instead")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where the approve and collect transactions are recorded. Set to empty to disable")
+	cmd.Flags().Bool("yes", false, "do not ask for confirmation before sending the payment. Required when stdin is not a terminal (scripts, CI), the command fails with a usage error otherwise")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
 	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network, +300000")
 
 	return cmd
@@ -42,17 +44,59 @@ func sendPaymentE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (
 		if err != nil {
 			return err
 		}
+		allocationID, err := utils.ParseAddress("allocation-id", allocation)
+		if err != nil {
+			return err
+		}
 
 		deploymentID, err := cmd.Flags().GetString("deployment-id")
 		if err != nil {
 			return err
 		}
+		var expectedDeployment []byte
+		if deploymentID != "" {
+			if expectedDeployment, err = utils.ConvertIPFSHashToByteString(deploymentID); err != nil {
+				return utils.Usagef("invalid --deployment-id %q: %w", deploymentID, err)
+			}
+		}
 
 		amount, err := cmd.Flags().GetUint64("amount")
 		if err != nil {
 			return err
 		}
 
+		netAmount, err := cmd.Flags().GetUint64("net-amount")
+		if err != nil {
+			return err
+		}
+		if (amount == 0) == (netAmount == 0) {
+			return fmt.Errorf("exactly one of --amount or --net-amount must be provided")
+		}
+
+		skipConfirm, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+
+		rewardsPolicy, err := cmd.Flags().GetString("rewards-policy")
+		if err != nil {
+			return err
+		}
+		if err := utils.ValidateRewardsPolicy(rewardsPolicy); err != nil {
+			return utils.Usagef("%w", err)
+		}
+
+		networkSubgraphURL, err := cmd.Flags().GetString("network-subgraph-url")
+		if err != nil {
+			return err
+		}
+
+		ledgerFile, err := cmd.Flags().GetString("ledger-file")
+		if err != nil {
+			return err
+		}
+		ledger := utils.NewLedger(ledgerFile)
+
 		rpcUrl, err := cmd.Flags().GetString("rpc-url")
 		if err != nil {
 			return err
@@ -63,53 +107,133 @@ func sendPaymentE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (
 			return err
 		}
 
-		var privateKey *eth.PrivateKey
 		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
 		if err != nil {
 			return err
 		}
-		if privateKeyFile == "" {
-			privateKey, err = eth.NewPrivateKey(os.Getenv("NETWORK_PAYMENT_PRIVATE_KEY"))
-			if err != nil {
-				return fmt.Errorf("import private key: %s", err)
-			}
-		} else {
-			pkBytes, err := os.ReadFile(privateKeyFile)
-			if err != nil {
-				return fmt.Errorf("read private key file: %s", err)
-			}
-			pkHex := strings.TrimSpace(string(pkBytes))
-			privateKey, err = eth.NewPrivateKey(pkHex)
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+		ctx = utils.WithPrivateKey(ctx, privateKey)
+
+		rpcClient := utils.NewRPCClient(rpcUrl)
+		chain := utils.NewChain(rpcClient, utils.ArbitrumOneChainID)
+
+		senderAddress := privateKey.PublicKey().Address()
+
+		// independent preflight reads, sent in a single batch request
+		preflight := utils.NewBatch(rpcClient)
+		chain.AddChainID(preflight)
+		onChainAllocation := &utils.Allocation{}
+		preflight.Allocation(allocationID, onChainAllocation)
+		var allocationState utils.AllocationState
+		preflight.AllocationState(allocationID, &allocationState)
+		grtBalance := new(big.Int)
+		preflight.TokenBalance(utils.GRTTokenContractAddress, privateKey.PublicKey().Address(), grtBalance)
+		ethBalance := new(big.Int)
+		preflight.Balance(privateKey.PublicKey().Address(), ethBalance)
+		if err := preflight.Do(ctx); err != nil {
+			return fmt.Errorf("failed preflight checks: %w", err)
+		}
+
+		if allocationState == utils.AllocationStateNull || bytes.Equal(onChainAllocation.Indexer, make([]byte, 20)) {
+			return fmt.Errorf("allocation %s does not exist", allocationID.Pretty())
+		}
+		if allocationState != utils.AllocationStateActive {
+			return fmt.Errorf("allocation %s is %s, only active allocations can be paid to", allocationID.Pretty(), allocationState)
+		}
+		if ethBalance.Sign() == 0 {
+			return fmt.Errorf("sender %s has no ETH to pay for gas", privateKey.PublicKey().Address().Pretty())
+		}
+
+		allocationDeploymentID, err := utils.ConvertByteStringToIPFSHash(onChainAllocation.SubgraphDeploymentID)
+		if err != nil {
+			return fmt.Errorf("failed to convert allocation deployment ID: %w", err)
+		}
+		if expectedDeployment != nil && !bytes.Equal(expectedDeployment, onChainAllocation.SubgraphDeploymentID) {
+			return fmt.Errorf("allocation %s is on deployment %s, not on --deployment-id %s", allocationID.Pretty(), allocationDeploymentID, deploymentID)
+		}
+
+		// reads depending on the allocation, sent in a second batch
+		allocationReads := utils.NewBatch(rpcClient)
+		feeParameters := &utils.FeeParameters{}
+		allocationReads.FeeParameters(onChainAllocation.Indexer, allocationDeploymentID, feeParameters)
+		rewardsCheck := &utils.RewardsCheck{}
+		allocationReads.RewardsCheck(allocationDeploymentID, rewardsCheck)
+		var latestBlock uint64
+		allocationReads.BlockNumber(&latestBlock)
+		if err := allocationReads.Do(ctx); err != nil {
+			return fmt.Errorf("failed to fetch fee parameters: %w", err)
+		}
+		if feeParameters.Curated {
+			return fmt.Errorf("deployment %s of allocation %s has curation and cannot be paid to. please generate a different deployment and open a new allocation", allocationDeploymentID, allocationID.Pretty())
+		}
+
+		grossAmount := utils.ConvertToWei(amount)
+		if netAmount != 0 {
+			grossAmount, err = feeParameters.GrossForNet(utils.ConvertToWei(netAmount))
 			if err != nil {
-				return fmt.Errorf("import private key: %s", err)
+				return err
 			}
 		}
-		ctx = utils.WithPrivateKey(ctx, privateKey)
 
-		rpcClient := ethrpc.NewClient(rpcUrl)
+		if grtBalance.Cmp(grossAmount) < 0 {
+			return fmt.Errorf("sender %s only holds %s, the payment needs %s", privateKey.PublicKey().Address().Pretty(), utils.FormatGRT(grtBalance), utils.FormatGRT(grossAmount))
+		}
 
-		senderAddress := privateKey.PublicKey().Address().String()
+		if err := rewardsCheck.ApplyPolicy(rewardsPolicy); err != nil {
+			return err
+		}
 
-		approvedTrx, err := approveCall(ctx, utils.GRTTokenContractAddress, senderAddress, rpcClient, utils.StakingContractAddress, amount, gasPrice)
+		usage, err := utils.GetDeploymentUsage(ctx, rpcClient, networkSubgraphURL, allocationDeploymentID, latestBlock)
 		if err != nil {
-			return fmt.Errorf("failed to approve: %w", err)
+			return fmt.Errorf("failed to look up other allocations on deployment: %w", err)
 		}
 
-		if approvedTrx == "" {
-			return fmt.Errorf("failed to approve. trx is empty")
+		fmt.Printf("Paying allocation %s of indexer %s\n", allocationID.Pretty(), onChainAllocation.Indexer.Pretty())
+		fmt.Println(rewardsCheck)
+		for _, warning := range usage.Warnings(onChainAllocation.Indexer.Pretty(), false) {
+			fmt.Println("Warning:", warning)
 		}
+		fmt.Println(feeParameters.Breakdown(grossAmount))
 
-		if deploymentID != "" {
-			isCurated, err := utils.IsCuratedCall(ctx, rpcClient, deploymentID)
+		if !skipConfirm {
+			confirmed, err := utils.Confirm("Send this payment?")
 			if err != nil {
-				return fmt.Errorf("failed to check if curated: %w", err)
+				return err
 			}
-			if isCurated {
-				return fmt.Errorf("deployment has curation and cannot be paid to. please geneate a different deployment and open a new allocation")
+			if !confirmed {
+				return fmt.Errorf("payment cancelled")
 			}
 		}
 
-		collectedTrx, err := collectCall(ctx, utils.StakingContractAddress, senderAddress, rpcClient, allocation, amount)
+		record := func(action string, trx string, callErr error) {
+			entry := &utils.LedgerEntry{
+				Action:       action,
+				Sender:       senderAddress.Pretty(),
+				Indexer:      onChainAllocation.Indexer.Pretty(),
+				AllocationID: allocationID.Pretty(),
+				DeploymentID: allocationDeploymentID,
+				Amount:       grossAmount.String(),
+			}
+			if err := ledger.Record(ctx, chain, entry, trx, callErr); err != nil {
+				logger.Warn("unable to record payment in ledger", "ledger_file", ledgerFile, "action", action, "err", err)
+			}
+		}
+
+		approvedTrx, err := approveCall(ctx, utils.GRTTokenContractAddress, senderAddress, chain, eth.MustNewAddress(utils.StakingContractAddress), grossAmount, gasPrice)
+		record(utils.LedgerActionApprove, approvedTrx, err)
+		if err != nil {
+			return fmt.Errorf("failed to approve: %w", err)
+		}
+
+		if approvedTrx == "" {
+			return fmt.Errorf("failed to approve. trx is empty")
+		}
+
+		collectedTrx, err := collectCall(ctx, utils.StakingContractAddress, senderAddress, chain, allocationID, grossAmount)
+		record(utils.LedgerActionCollect, collectedTrx, err)
 		if err != nil {
 			return fmt.Errorf("failed to collect: %w", err)
 		}
@@ -119,24 +243,21 @@ func sendPaymentE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (
 		}
 
 		fmt.Println("Payment sent")
-		fmt.Printf("%d sent to allocation %s\n", amount, allocation)
+		fmt.Printf("%s sent to allocation %s\n", utils.FormatGRT(grossAmount), allocationID.Pretty())
 		fmt.Printf("See transaction on arbiscan: %s\n", fmt.Sprintf("https://arbiscan.io/tx/%s", collectedTrx))
 
 		return nil
 	}
 }
 
-func approveCall(ctx context.Context, to string, from string, cli *ethrpc.Client, addr string, amt uint64, gasPrice int64) (string, error) {
+func approveCall(ctx context.Context, to string, from eth.Address, chain *utils.Chain, spender eth.Address, amount *big.Int, gasPrice int64) (string, error) {
 	methodDef, err := eth.NewMethodDef("approve(address,uint256)")
 	if err != nil {
 		return "", err
 	}
 
-	address := eth.MustNewAddress(addr)
-	amount := utils.ConvertToWei(amt)
-
 	methodCall := methodDef.NewCall()
-	methodCall.AppendArg(address)
+	methodCall.AppendArg(spender)
 	methodCall.AppendArg(amount)
 
 	data, err := methodCall.Encode()
@@ -144,20 +265,18 @@ func approveCall(ctx context.Context, to string, from string, cli *ethrpc.Client
 		return "", err
 	}
 
-	signer, err := native.NewPrivateKeySigner(zap.NewNop(), utils.MustGetChainID(ctx, cli), utils.MustGetPrivateKey(ctx))
+	signer, err := chain.Signer(ctx)
 	if err != nil {
-		return "", fmt.Errorf("unable to create signer: %w", err)
+		return "", err
 	}
 
-	var gasPriceBigInt *big.Int
-	if gasPrice == 0 {
-		gasPriceBigInt = utils.MustGetGasPrice(ctx, cli)
-	} else {
-		gasPriceBigInt = big.NewInt(gasPrice)
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", err
 	}
 
 	signedTx, err := signer.SignTransaction(
-		utils.MustGetAccountNonce(ctx, eth.MustNewAddress(from), cli),
+		nonce,
 		eth.MustNewAddress(to),
 		big.NewInt(0), //,
 		big.NewInt(7_000_000).Uint64(),
@@ -168,14 +287,9 @@ func approveCall(ctx context.Context, to string, from string, cli *ethrpc.Client
 		return "", err
 	}
 
-	resp, err := cli.SendRaw(ctx, signedTx)
-	if err != nil {
-		return "", err
-	}
-
-	receipt, err := utils.FetchReceiptWithProgress(ctx, cli, eth.MustNewHash(resp))
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
 	if err != nil {
-		return "", err
+		return resp, err
 	}
 
 	if receipt == nil {
@@ -185,52 +299,41 @@ func approveCall(ctx context.Context, to string, from string, cli *ethrpc.Client
 	return resp, nil
 }
 
-func collectCall(ctx context.Context, to string, from string, cli *ethrpc.Client, allocation string, amt uint64) (string, error) {
-	methodDef, err := eth.NewMethodDef("collect(uint256,address)")
+func collectCall(ctx context.Context, to string, from eth.Address, chain *utils.Chain, allocationID eth.Address, amount *big.Int) (string, error) {
+	data, err := utils.EncodeCollectCall(amount, allocationID)
 	if err != nil {
 		return "", err
 	}
 
-	allocationID := eth.MustNewAddress(allocation)
-	amount := utils.ConvertToWei(amt)
-
-	methodCall := methodDef.NewCall()
-	methodCall.AppendArg(amount)
-	methodCall.AppendArg(allocationID)
-
-	data, err := methodCall.Encode()
+	signer, err := chain.Signer(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	signer, err := native.NewPrivateKeySigner(zap.NewNop(), utils.MustGetChainID(ctx, cli), utils.MustGetPrivateKey(ctx))
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, 0)
 	if err != nil {
-		return "", fmt.Errorf("unable to create signer: %w", err)
+		return "", err
 	}
+
 	signedTx, err := signer.SignTransaction(
-		utils.MustGetAccountNonce(ctx, eth.MustNewAddress(from), cli),
+		nonce,
 		eth.MustNewAddress(to),
 		big.NewInt(0),
 		big.NewInt(5000000).Uint64(),
-		utils.MustGetGasPrice(ctx, cli),
+		gasPriceBigInt,
 		data,
 	)
 	if err != nil {
 		return "", err
 	}
 
-	resp, err := cli.SendRaw(ctx, signedTx)
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
 	if err != nil {
-		return "", err
-	}
-
-	receipt, err := utils.FetchReceiptWithProgress(ctx, cli, eth.MustNewHash(resp))
-	if err != nil {
-		return "", err
+		return resp, err
 	}
 
 	if receipt == nil {
-		return "", fmt.Errorf("failed to approve. receipt is nil")
+		return "", fmt.Errorf("failed to collect. receipt is nil")
 	}
 
 	return resp, nil
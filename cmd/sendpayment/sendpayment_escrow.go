@@ -0,0 +1,680 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+func newEscrowCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "escrow",
+		Short: "manage the PaymentsEscrow account funding a receiver (Horizon)",
+		Long: "Under Horizon, payers fund a PaymentsEscrow account per (collector, receiver) pair instead of paying allocations directly. " +
+			"The receiver collects from it through the collector. Tokens are taken back by thawing them, then withdrawing once the thawing period is over. " +
+			"These commands require a --network profile with the horizon backend.",
+	}
+
+	cmd.AddCommand(newEscrowDepositCmd(logger))
+	cmd.AddCommand(newEscrowThawCmd(logger))
+	cmd.AddCommand(newEscrowCancelThawCmd(logger))
+	cmd.AddCommand(newEscrowWithdrawCmd(logger))
+	cmd.AddCommand(newEscrowBalanceCmd(logger))
+
+	return cmd
+}
+
+func addEscrowAccountFlags(cmd *cobra.Command) {
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a JSON profile file with the horizon backend and payments_escrow. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().String("receiver", "", "the receiver (indexer) address the escrow account pays")
+	cmd.Flags().String("collector", "", "the collector address allowed to draw from the escrow account. If not provided, the graph_tally_collector of the network profile")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+}
+
+func addEscrowTransactionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("private-key-file", "", "the payer private key file. (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transactions. If 0, the gas price will be fetched from the network")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where the transactions are recorded. Set to empty to disable")
+	cmd.Flags().Bool("safe-batch", false, "print a Safe Transaction Builder batch for a treasury wallet to execute instead of signing and sending the transactions. No private key nor rpc url is needed")
+}
+
+// escrowAccountFlags identifies the escrow account of a command, the payer
+// being the signer or the Safe executing the batch. escrow is the
+// PaymentsEscrow, or the TAP v1 Escrow whose accounts have no collector.
+type escrowAccountFlags struct {
+	profile   *utils.NetworkProfile
+	escrow    string
+	collector eth.Address
+	receiver  eth.Address
+	rpcURL    string
+}
+
+func readEscrowAccountFlags(cmd *cobra.Command) (*escrowAccountFlags, error) {
+	network, err := cmd.Flags().GetString("network")
+	if err != nil {
+		return nil, err
+	}
+	profile, err := utils.LoadNetworkProfile(network)
+	if err != nil {
+		return nil, err
+	}
+	if err := profile.RequireEscrow(); err != nil {
+		return nil, err
+	}
+
+	receiver, err := cmd.Flags().GetString("receiver")
+	if err != nil {
+		return nil, err
+	}
+	if receiver == "" {
+		return nil, fmt.Errorf("receiver address is required")
+	}
+	receiverAddress, err := eth.NewAddress(receiver)
+	if err != nil {
+		return nil, fmt.Errorf("invalid receiver address %q: %w", receiver, err)
+	}
+
+	collector, err := cmd.Flags().GetString("collector")
+	if err != nil {
+		return nil, err
+	}
+	if collector == "" {
+		collector = profile.GraphTallyCollector
+	}
+	if collector == "" {
+		return nil, fmt.Errorf("collector address is required, the network profile %s has no graph_tally_collector", profile.Name)
+	}
+	collectorAddress, err := eth.NewAddress(collector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collector address %q: %w", collector, err)
+	}
+
+	rpcURL, err := cmd.Flags().GetString("rpc-url")
+	if err != nil {
+		return nil, err
+	}
+
+	return &escrowAccountFlags{profile: profile, escrow: profile.PaymentsEscrow, collector: collectorAddress, receiver: receiverAddress, rpcURL: rpcURL}, nil
+}
+
+// escrowSender signs and sends the escrow transactions of a payer.
+type escrowSender struct {
+	*escrowAccountFlags
+	logger     *slog.Logger
+	payer      eth.Address
+	chain      *utils.Chain
+	gasPrice   int64
+	ledger     *utils.Ledger
+	ledgerFile string
+}
+
+func newEscrowSender(ctx context.Context, cmd *cobra.Command, logger *slog.Logger, account *escrowAccountFlags) (context.Context, *escrowSender, error) {
+	gasPrice, err := cmd.Flags().GetInt64("gas-price")
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	ledgerFile, err := cmd.Flags().GetString("ledger-file")
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+	if err != nil {
+		return ctx, nil, err
+	}
+	privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+	if err != nil {
+		return ctx, nil, err
+	}
+	ctx = utils.WithPrivateKey(ctx, privateKey)
+
+	chain := utils.NewChain(utils.NewRPCClient(account.rpcURL), account.profile.ChainID)
+	if _, err := chain.ChainID(ctx); err != nil {
+		return ctx, nil, err
+	}
+
+	return ctx, &escrowSender{
+		escrowAccountFlags: account,
+		logger:             logger,
+		payer:              privateKey.PublicKey().Address(),
+		chain:              chain,
+		gasPrice:           gasPrice,
+		ledger:             utils.NewLedger(ledgerFile),
+		ledgerFile:         ledgerFile,
+	}, nil
+}
+
+func (s *escrowSender) account(ctx context.Context) (*utils.EscrowAccount, error) {
+	var account *utils.EscrowAccount
+	var err error
+	if s.collector == nil {
+		account, err = utils.GetTapEscrowAccountCall(ctx, s.chain.Client(), s.profile, s.payer, s.receiver)
+	} else {
+		account, err = utils.GetEscrowAccountCall(ctx, s.chain.Client(), s.profile, s.payer, s.collector, s.receiver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch escrow account: %w", err)
+	}
+
+	return account, nil
+}
+
+// send calls the escrow method and records it in the ledger.
+func (s *escrowSender) send(ctx context.Context, action string, amount *big.Int, signature string, args ...interface{}) (string, error) {
+	trx, err := escrowCall(ctx, s.escrow, s.payer, s.chain, signature, s.gasPrice, args...)
+	s.record(ctx, action, amount, trx, err)
+
+	return trx, err
+}
+
+func (s *escrowSender) record(ctx context.Context, action string, amount *big.Int, trx string, callErr error) {
+	entry := &utils.LedgerEntry{
+		Action: action,
+		Sender: s.payer.Pretty(),
+	}
+	if s.receiver != nil {
+		entry.Indexer = s.receiver.Pretty()
+	}
+	if amount != nil {
+		entry.Amount = amount.String()
+	}
+	if err := s.ledger.Record(ctx, s.chain, entry, trx, callErr); err != nil {
+		s.logger.Warn("unable to record escrow transaction in ledger", "ledger_file", s.ledgerFile, "action", action, "err", err)
+	}
+}
+
+func (s *escrowSender) printAccount(ctx context.Context) error {
+	account, err := s.account(ctx)
+	if err != nil {
+		return err
+	}
+
+	now, err := utils.LatestBlockTime(ctx, s.chain.Client())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(account.Describe(now))
+	return nil
+}
+
+// deposit approves the escrow to pull amount when needed, then calls its
+// deposit method, after preflight checks and a confirmation unless
+// skipConfirm.
+func (s *escrowSender) deposit(ctx context.Context, amount *big.Int, skipConfirm bool, action string, signature string, args ...interface{}) (string, error) {
+	preflight := utils.NewBatch(s.chain.Client())
+	grtBalance := new(big.Int)
+	preflight.TokenBalance(utils.GRTTokenContractAddress, s.payer, grtBalance)
+	allowance := new(big.Int)
+	preflight.Allowance(utils.GRTTokenContractAddress, s.payer, eth.MustNewAddress(s.escrow), allowance)
+	ethBalance := new(big.Int)
+	preflight.Balance(s.payer, ethBalance)
+	if err := preflight.Do(ctx); err != nil {
+		return "", fmt.Errorf("failed preflight checks: %w", err)
+	}
+
+	if ethBalance.Sign() == 0 {
+		return "", fmt.Errorf("payer %s has no ETH to pay for gas", s.payer.Pretty())
+	}
+	if grtBalance.Cmp(amount) < 0 {
+		return "", fmt.Errorf("payer %s only holds %s, the deposit needs %s", s.payer.Pretty(), utils.FormatGRT(grtBalance), utils.FormatGRT(amount))
+	}
+
+	if err := s.printAccount(ctx); err != nil {
+		return "", err
+	}
+	fmt.Printf("Depositing %s for receiver %s\n", utils.FormatGRT(amount), s.receiver.Pretty())
+
+	if !skipConfirm {
+		confirmed, err := utils.Confirm("Deposit in escrow?")
+		if err != nil {
+			return "", err
+		}
+		if !confirmed {
+			return "", fmt.Errorf("deposit cancelled")
+		}
+	}
+
+	if allowance.Cmp(amount) < 0 {
+		approvedTrx, err := approveCall(ctx, utils.GRTTokenContractAddress, s.payer, s.chain, eth.MustNewAddress(s.escrow), amount, s.gasPrice)
+		s.record(ctx, utils.LedgerActionApprove, amount, approvedTrx, err)
+		if err != nil {
+			return "", fmt.Errorf("failed to approve: %w", err)
+		}
+	}
+
+	depositTrx, err := s.send(ctx, action, amount, signature, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to deposit: %w", err)
+	}
+
+	return depositTrx, nil
+}
+
+// printSafeBatch prints a batch calling the escrow method, preceded by the
+// given GRT approval when approve is non-nil.
+func printSafeBatch(account *escrowAccountFlags, description string, approve *big.Int, method string, args ...utils.SafeArg) error {
+	batch := utils.NewSafeBatch(account.profile.ChainID, description)
+	if approve != nil {
+		batch.Add(utils.GRTTokenContractAddress, "approve",
+			utils.SafeArg{Name: "spender", Type: "address", Value: eth.MustNewAddress(account.escrow).Pretty()},
+			utils.SafeArg{Name: "amount", Type: "uint256", Value: approve.String()},
+		)
+	}
+	batch.Add(eth.MustNewAddress(account.escrow).Pretty(), method, args...)
+
+	out, err := batch.JSON()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(out)
+	return nil
+}
+
+func escrowPairArgs(account *escrowAccountFlags) []utils.SafeArg {
+	return []utils.SafeArg{
+		{Name: "collector", Type: "address", Value: account.collector.Pretty()},
+		{Name: "receiver", Type: "address", Value: account.receiver.Pretty()},
+	}
+}
+
+func newEscrowDepositCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deposit",
+		Short: "approve and deposit GRT in the escrow account of a receiver",
+		RunE:  escrowDepositE(logger),
+	}
+
+	addEscrowAccountFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+	cmd.Flags().Uint64("amount", 0, "the amount to deposit in GRT")
+	cmd.Flags().Bool("yes", false, "do not ask for confirmation before depositing. Required when stdin is not a terminal (scripts, CI), the command fails with a usage error otherwise")
+
+	return cmd
+}
+
+func escrowDepositE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readEscrowAccountFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		amountGRT, err := cmd.Flags().GetUint64("amount")
+		if err != nil {
+			return err
+		}
+		if amountGRT == 0 {
+			return fmt.Errorf("amount is required")
+		}
+		amount := utils.ConvertToWei(amountGRT)
+
+		skipConfirm, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Deposit %s in PaymentsEscrow for receiver %s", utils.FormatGRT(amount), account.receiver.Pretty())
+			return printSafeBatch(account, description, amount, "deposit", append(escrowPairArgs(account), utils.SafeArg{Name: "tokens", Type: "uint256", Value: amount.String()})...)
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		depositTrx, err := sender.deposit(ctx, amount, skipConfirm, utils.LedgerActionEscrowDeposit, "deposit(address,address,uint256)", account.collector, account.receiver, amount)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s deposited in escrow for receiver %s\n", utils.FormatGRT(amount), account.receiver.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", depositTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newEscrowThawCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "thaw",
+		Short: "start thawing GRT of the escrow account, to withdraw them after the thawing period",
+		Long: "Start thawing GRT of the escrow account. Thawing tokens can no longer be collected, they can be withdrawn once the thawing period is over. " +
+			"Thawing again replaces the thawing amount and restarts the thawing period.",
+		RunE: escrowThawE(logger),
+	}
+
+	addEscrowAccountFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+	cmd.Flags().Uint64("amount", 0, "the amount to thaw in GRT")
+
+	return cmd
+}
+
+func escrowThawE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readEscrowAccountFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		amountGRT, err := cmd.Flags().GetUint64("amount")
+		if err != nil {
+			return err
+		}
+		if amountGRT == 0 {
+			return fmt.Errorf("amount is required")
+		}
+		amount := utils.ConvertToWei(amountGRT)
+
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Thaw %s of the PaymentsEscrow account of receiver %s", utils.FormatGRT(amount), account.receiver.Pretty())
+			return printSafeBatch(account, description, nil, "thaw", append(escrowPairArgs(account), utils.SafeArg{Name: "tokens", Type: "uint256", Value: amount.String()})...)
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		escrowAccount, err := sender.account(ctx)
+		if err != nil {
+			return err
+		}
+		if escrowAccount.Balance.Cmp(amount) < 0 {
+			return fmt.Errorf("cannot thaw %s, the escrow account only holds %s", utils.FormatGRT(amount), utils.FormatGRT(escrowAccount.Balance))
+		}
+		if escrowAccount.TokensThawing.Sign() > 0 {
+			fmt.Printf("Warning: %s already thawing, they are replaced by %s and the thawing period restarts\n", utils.FormatGRT(escrowAccount.TokensThawing), utils.FormatGRT(amount))
+		}
+
+		thawingPeriod, err := utils.GetEscrowThawingPeriodCall(ctx, sender.chain.Client(), account.profile)
+		if err != nil {
+			return fmt.Errorf("failed to fetch thawing period: %w", err)
+		}
+
+		thawTrx, err := sender.send(ctx, utils.LedgerActionEscrowThaw, amount, "thaw(address,address,uint256)", account.collector, account.receiver, amount)
+		if err != nil {
+			return fmt.Errorf("failed to thaw: %w", err)
+		}
+
+		fmt.Printf("%s thawing, withdraw them in %s\n", utils.FormatGRT(amount), thawingPeriod)
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", thawTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newEscrowCancelThawCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel-thaw",
+		Short: "stop thawing GRT of the escrow account, making them collectable again",
+		RunE:  escrowCancelThawE(logger),
+	}
+
+	addEscrowAccountFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+
+	return cmd
+}
+
+func escrowCancelThawE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readEscrowAccountFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Cancel the thawing of the PaymentsEscrow account of receiver %s", account.receiver.Pretty())
+			return printSafeBatch(account, description, nil, "cancelThaw", escrowPairArgs(account)...)
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		escrowAccount, err := sender.account(ctx)
+		if err != nil {
+			return err
+		}
+		if escrowAccount.TokensThawing.Sign() == 0 {
+			fmt.Println("Nothing is thawing, nothing to do")
+			return nil
+		}
+
+		cancelTrx, err := sender.send(ctx, utils.LedgerActionEscrowCancelThaw, escrowAccount.TokensThawing, "cancelThaw(address,address)", account.collector, account.receiver)
+		if err != nil {
+			return fmt.Errorf("failed to cancel thaw: %w", err)
+		}
+
+		fmt.Printf("Thawing of %s cancelled\n", utils.FormatGRT(escrowAccount.TokensThawing))
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", cancelTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newEscrowWithdrawCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "withdraw",
+		Short: "withdraw the thawed GRT of the escrow account back to the payer, once the thawing period is over",
+		RunE:  escrowWithdrawE(logger),
+	}
+
+	addEscrowAccountFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+
+	return cmd
+}
+
+func escrowWithdrawE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readEscrowAccountFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Withdraw the thawed tokens of the PaymentsEscrow account of receiver %s", account.receiver.Pretty())
+			return printSafeBatch(account, description, nil, "withdraw", escrowPairArgs(account)...)
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		escrowAccount, err := sender.account(ctx)
+		if err != nil {
+			return err
+		}
+		if escrowAccount.TokensThawing.Sign() == 0 {
+			return fmt.Errorf("nothing is thawing, thaw tokens first and withdraw them after the thawing period")
+		}
+
+		now, err := utils.LatestBlockTime(ctx, sender.chain.Client())
+		if err != nil {
+			return err
+		}
+		withdrawable := escrowAccount.Withdrawable(now)
+		if withdrawable.Sign() == 0 {
+			return fmt.Errorf("the thawing period is not over, %s can be withdrawn at %s (in %s)", utils.FormatGRT(escrowAccount.TokensThawing), escrowAccount.ThawEnd().Format(time.RFC3339), escrowAccount.ThawEnd().Sub(now).Round(time.Second))
+		}
+
+		withdrawTrx, err := sender.send(ctx, utils.LedgerActionEscrowWithdraw, withdrawable, "withdraw(address,address)", account.collector, account.receiver)
+		if err != nil {
+			return fmt.Errorf("failed to withdraw: %w", err)
+		}
+
+		fmt.Printf("%s withdrawn to %s\n", utils.FormatGRT(withdrawable), sender.payer.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", withdrawTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newEscrowBalanceCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "balance",
+		Short: "show the deposited, thawing and withdrawable GRT of an escrow account",
+		RunE:  escrowBalanceE(logger),
+	}
+
+	addEscrowAccountFlags(cmd)
+	cmd.Flags().String("payer", "", "the payer address. If not provided, the address of the NETWORK_PAYMENT_PRIVATE_KEY env var or --private-key-file key")
+	cmd.Flags().String("private-key-file", "", "the payer private key file, only used to derive the payer address when --payer is not provided")
+
+	return cmd
+}
+
+func escrowBalanceE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readEscrowAccountFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		payer, err := cmd.Flags().GetString("payer")
+		if err != nil {
+			return err
+		}
+		var payerAddress eth.Address
+		if payer != "" {
+			payerAddress, err = eth.NewAddress(payer)
+			if err != nil {
+				return fmt.Errorf("invalid payer address %q: %w", payer, err)
+			}
+		} else {
+			privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+			if err != nil {
+				return err
+			}
+			privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+			if err != nil {
+				return fmt.Errorf("payer address is required: %w", err)
+			}
+			payerAddress = privateKey.PublicKey().Address()
+		}
+
+		rpcClient := utils.NewRPCClient(account.rpcURL)
+		chain := utils.NewChain(rpcClient, account.profile.ChainID)
+		if _, err := chain.ChainID(ctx); err != nil {
+			return err
+		}
+
+		escrowAccount, err := utils.GetEscrowAccountCall(ctx, rpcClient, account.profile, payerAddress, account.collector, account.receiver)
+		if err != nil {
+			return fmt.Errorf("failed to fetch escrow account: %w", err)
+		}
+
+		now, err := utils.LatestBlockTime(ctx, rpcClient)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(escrowAccount.Describe(now))
+		return nil
+	}
+}
+
+func escrowCall(ctx context.Context, to string, from eth.Address, chain *utils.Chain, signature string, gasPrice int64, args ...interface{}) (string, error) {
+	methodDef, err := eth.NewMethodDef(signature)
+	if err != nil {
+		return "", fmt.Errorf("creating method definition: %w", err)
+	}
+
+	data, err := methodDef.NewCall(args...).Encode()
+	if err != nil {
+		return "", fmt.Errorf("encoding method call: %w", err)
+	}
+
+	signer, err := chain.Signer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", err
+	}
+
+	signedTx, err := signer.SignTransaction(
+		nonce,
+		eth.MustNewAddress(to),
+		big.NewInt(0),
+		big.NewInt(1_000_000).Uint64(),
+		gasPriceBigInt,
+		data,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
+	if err != nil {
+		return resp, err
+	}
+
+	if receipt == nil {
+		return "", fmt.Errorf("failed to %s. no receipt found for transaction %s", methodDef.Name, resp)
+	}
+
+	if len(receipt.Logs) == 0 {
+		return "", fmt.Errorf("failed to %s. no logs found for transaction %s", methodDef.Name, resp)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/fakechain"
+)
+
+// TestEscrowDeposit runs the deposit flow escrow and tap-escrow share, the
+// approval then the deposit in their own escrow contract.
+func TestEscrowDeposit(t *testing.T) {
+	for _, c := range []struct {
+		command string
+		escrow  string
+		action  string
+	}{
+		{"escrow", fakechain.PaymentsEscrowAddress, utils.LedgerActionEscrowDeposit},
+		{"tap-escrow", fakechain.TapEscrowAddress, utils.LedgerActionTapEscrowDeposit},
+	} {
+		t.Run(c.command, func(t *testing.T) {
+			test := newPaymentTest(t)
+
+			content, err := json.Marshal(test.chain.HorizonProfile())
+			if err != nil {
+				t.Fatal(err)
+			}
+			network := filepath.Join(t.TempDir(), "horizon.json")
+			if err := os.WriteFile(network, content, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := test.run(t, c.command, "deposit", "--network", network, "--receiver", test.indexer.Pretty(), "--amount", "100", "--yes"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := test.chain.GRTBalance(test.payer), utils.ConvertToWei(900); got.Cmp(want) != 0 {
+				t.Errorf("payer GRT balance %s, want %s", got, want)
+			}
+			if got, want := test.chain.GRTBalance(eth.MustNewAddress(c.escrow)), utils.ConvertToWei(100); got.Cmp(want) != 0 {
+				t.Errorf("%s GRT balance %s, want %s", c.escrow, got, want)
+			}
+
+			entries := test.ledger(t)
+			if len(entries) != 2 || entries[0].Action != utils.LedgerActionApprove || entries[1].Action != c.action {
+				t.Fatalf("ledger %+v, want approve then %s", entries, c.action)
+			}
+			for _, entry := range entries {
+				if entry.Status != utils.LedgerStatusSuccess || entry.Indexer != test.indexer.Pretty() {
+					t.Errorf("%s recorded as %s for indexer %q, want %s for %s", entry.Action, entry.Status, entry.Indexer, utils.LedgerStatusSuccess, test.indexer.Pretty())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/tap"
+)
+
+func newTapCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tap",
+		Short: "sign TAP receipts and aggregate them into RAVs",
+		Long: "Pay an indexer for its queries with TAP (Timeline Aggregation Protocol) instead of an allocation per invoice. " +
+			"Receipts are signed per query fee for an allocation of the indexer, then aggregated into a Receipt Aggregate Voucher (RAV). " +
+			"TAP v2 (--tap-version 2, the default with a horizon --network profile) signs for GraphTallyCollector: the indexer redeems RAVs " +
+			"with `receivepayment tap redeem`, drawing from the payer escrow account (see `sendpayment escrow`), and the signing key must be " +
+			"the payer or a signer the payer authorized on GraphTallyCollector. " +
+			"TAP v1 (--tap-version 1, the default with a legacy profile) signs for the TAPVerifier of a profile with tap_escrow and tap_verifier: " +
+			"indexer-agent redeems RAVs from the TAP v1 Escrow (see `sendpayment tap-escrow`), and the signing key must be a signer " +
+			"authorized there with `sendpayment tap-escrow authorize-signer`. These commands work offline.",
+	}
+
+	cmd.AddCommand(newTapReceiptCmd(logger))
+	cmd.AddCommand(newTapAggregateCmd(logger))
+
+	return cmd
+}
+
+func newTapReceiptCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "receipt",
+		Short: "sign a TAP receipt for an allocation",
+		RunE:  tapReceiptE(logger),
+	}
+
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a JSON profile file with graph_tally_collector for TAP v2, or tap_escrow and tap_verifier for TAP v1. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().Int("tap-version", 0, "the TAP version to sign for, 1 or 2. If not provided, 2 with a horizon profile and 1 otherwise")
+	cmd.Flags().String("private-key-file", "", "the signer private key file. (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().String("allocation-id", "", "the allocation ID the receipt pays for")
+	cmd.Flags().String("indexer", "", "the indexer (service provider) address of the allocation, TAP v2 only")
+	cmd.Flags().String("payer", "", "the payer address whose escrow account pays the receipt, TAP v2 only. If not provided, the signer address")
+	cmd.Flags().String("value", "", "the receipt value in GRT, decimals allowed")
+	cmd.Flags().String("output", "", "append the signed receipt as a JSON line to this file instead of printing it")
+
+	return cmd
+}
+
+func tapReceiptE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		profile, domain, err := tapDomain(cmd)
+		if err != nil {
+			return err
+		}
+
+		allocationID, err := addressFlag(cmd, "allocation-id")
+		if err != nil {
+			return err
+		}
+
+		valueGRT, err := cmd.Flags().GetString("value")
+		if err != nil {
+			return err
+		}
+		if valueGRT == "" {
+			return fmt.Errorf("value is required")
+		}
+		value, err := utils.ParseGRT(valueGRT)
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+
+		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+		if err != nil {
+			return err
+		}
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		var signed any
+		if domain.Version == tap.V1 {
+			if cmd.Flags().Changed("indexer") || cmd.Flags().Changed("payer") {
+				return utils.Usagef("--indexer and --payer are TAP v2 only, a TAP v1 receipt is only for an allocation")
+			}
+
+			receipt, err := tap.NewReceiptV1(allocationID, value)
+			if err != nil {
+				return err
+			}
+			if signed, err = tap.SignReceiptV1(domain, receipt, privateKey); err != nil {
+				return err
+			}
+		} else {
+			indexer, err := addressFlag(cmd, "indexer")
+			if err != nil {
+				return err
+			}
+
+			payer := common.BytesToAddress(privateKey.PublicKey().Address().Bytes())
+			if cmd.Flags().Changed("payer") {
+				if payer, err = addressFlag(cmd, "payer"); err != nil {
+					return err
+				}
+			}
+
+			receipt, err := tap.NewReceipt(allocationID, payer, common.HexToAddress(profile.SubgraphService), indexer, value)
+			if err != nil {
+				return err
+			}
+			if signed, err = tap.SignReceipt(domain, receipt, privateKey); err != nil {
+				return err
+			}
+		}
+
+		line, err := json.Marshal(signed)
+		if err != nil {
+			return err
+		}
+
+		if output == "" {
+			fmt.Println(string(line))
+			return nil
+		}
+
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("opening receipts file: %w", err)
+		}
+		defer file.Close()
+
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("writing receipt: %w", err)
+		}
+
+		fmt.Printf("Receipt of %s for allocation %s appended to %s\n", utils.FormatGRT(value), eth.Address(allocationID.Bytes()).Pretty(), output)
+		return nil
+	}
+}
+
+func newTapAggregateCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "aggregate",
+		Short: "aggregate signed TAP receipts into a signed RAV",
+		Long: "Aggregate signed TAP receipts into a signed Receipt Aggregate Voucher (RAV). The receipts must all be signed by the signing key " +
+			"for the same allocation, payer and indexer, and of the same TAP version. Given the previous RAV of the allocation, the new RAV adds " +
+			"the receipts to it, and receipts it already covers are rejected.",
+		RunE: tapAggregateE(logger),
+	}
+
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a JSON profile file with graph_tally_collector for TAP v2, or tap_escrow and tap_verifier for TAP v1. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().Int("tap-version", 0, "the TAP version to sign for, 1 or 2. If not provided, 2 with a horizon profile and 1 otherwise")
+	cmd.Flags().String("private-key-file", "", "the signer private key file. (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().String("receipts", "", "the signed receipts file, a JSON array or JSON lines")
+	cmd.Flags().String("previous-rav", "", "the previous signed RAV of the allocation to aggregate the receipts on top of")
+	cmd.Flags().String("output", "", "write the signed RAV to this file instead of printing it")
+
+	return cmd
+}
+
+func tapAggregateE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		_, domain, err := tapDomain(cmd)
+		if err != nil {
+			return err
+		}
+
+		receiptsFile, err := cmd.Flags().GetString("receipts")
+		if err != nil {
+			return err
+		}
+		if receiptsFile == "" {
+			return fmt.Errorf("receipts file is required")
+		}
+
+		previousFile, err := cmd.Flags().GetString("previous-rav")
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+
+		privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+		if err != nil {
+			return err
+		}
+		privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		var rav any
+		var count int
+		var allocationID common.Address
+		var valueAggregate *big.Int
+		if domain.Version == tap.V1 {
+			receipts, err := tap.ReadReceiptsV1(receiptsFile)
+			if err != nil {
+				return err
+			}
+
+			var previous *tap.SignedRAVV1
+			if previousFile != "" {
+				if previous, err = tap.ReadRAVV1(previousFile); err != nil {
+					return err
+				}
+			}
+
+			signed, err := tap.AggregateV1(domain, receipts, previous, privateKey)
+			if err != nil {
+				return fmt.Errorf("failed to aggregate receipts: %w", err)
+			}
+			rav, count, allocationID, valueAggregate = signed, len(receipts), signed.Message.AllocationID, signed.Message.ValueAggregate
+		} else {
+			receipts, err := tap.ReadReceipts(receiptsFile)
+			if err != nil {
+				return err
+			}
+
+			var previous *tap.SignedRAV
+			if previousFile != "" {
+				if previous, err = tap.ReadRAV(previousFile); err != nil {
+					return err
+				}
+			}
+
+			signed, err := tap.Aggregate(domain, receipts, previous, privateKey)
+			if err != nil {
+				return fmt.Errorf("failed to aggregate receipts: %w", err)
+			}
+			rav, count, allocationID, valueAggregate = signed, len(receipts), signed.Message.AllocationID(), signed.Message.ValueAggregate
+		}
+
+		content, err := json.MarshalIndent(rav, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Aggregated %d receipt(s) for allocation %s, RAV value %s\n", count, eth.Address(allocationID.Bytes()).Pretty(), utils.FormatGRT(valueAggregate))
+
+		if output == "" {
+			fmt.Println(string(content))
+			return nil
+		}
+
+		if err := os.WriteFile(output, append(content, '\n'), 0o644); err != nil {
+			return fmt.Errorf("writing RAV: %w", err)
+		}
+		fmt.Printf("RAV written to %s\n", output)
+
+		return nil
+	}
+}
+
+// tapDomain is the domain of the --tap-version receipts are signed for: the
+// GraphTallyCollector for TAP v2, the TAPVerifier for TAP v1.
+func tapDomain(cmd *cobra.Command) (*utils.NetworkProfile, *tap.Domain, error) {
+	network, err := cmd.Flags().GetString("network")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version, err := cmd.Flags().GetInt("tap-version")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile, err := utils.LoadNetworkProfile(network)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if version == 0 {
+		version = int(tap.V1)
+		if profile.Horizon() {
+			version = int(tap.V2)
+		}
+	}
+
+	var domain *tap.Domain
+	switch tap.Version(version) {
+	case tap.V1:
+		if err := profile.RequireTapVerifier(); err != nil {
+			return nil, nil, err
+		}
+		domain, err = tap.NewV1Domain(profile.ChainID, profile.TapVerifier)
+	case tap.V2:
+		if err := profile.RequireTally(); err != nil {
+			return nil, nil, err
+		}
+		domain, err = tap.NewDomain(profile.ChainID, profile.GraphTallyCollector)
+	default:
+		return nil, nil, utils.Usagef("invalid --tap-version %d, expected 1 or 2", version)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return profile, domain, nil
+}
+
+func addressFlag(cmd *cobra.Command, name string) (common.Address, error) {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if value == "" {
+		return common.Address{}, fmt.Errorf("--%s is required", name)
+	}
+	if !common.IsHexAddress(value) {
+		return common.Address{}, fmt.Errorf("invalid --%s address %q", name, value)
+	}
+
+	return common.HexToAddress(value), nil
+}
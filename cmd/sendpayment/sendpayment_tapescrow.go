@@ -0,0 +1,730 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/tap"
+)
+
+func newTapEscrowCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tap-escrow",
+		Short: "manage the TAP v1 Escrow account indexer-service requires of senders",
+		Long: "Indexers running indexer-service only serve senders that funded the TAP v1 Escrow for them, and whose receipts are signed by an authorized signer. " +
+			"Deposits are per receiver (indexer). Tokens are taken back by thawing them, then withdrawing once the thawing period is over, " +
+			"and signers are revoked by thawing them, then revoking them once the signer thawing period is over. " +
+			"These commands require a --network profile file with tap_escrow.",
+	}
+
+	cmd.AddCommand(newTapEscrowDepositCmd(logger))
+	cmd.AddCommand(newTapEscrowThawCmd(logger))
+	cmd.AddCommand(newTapEscrowCancelThawCmd(logger))
+	cmd.AddCommand(newTapEscrowWithdrawCmd(logger))
+	cmd.AddCommand(newTapEscrowBalanceCmd(logger))
+	cmd.AddCommand(newTapEscrowAuthorizeSignerCmd(logger))
+	cmd.AddCommand(newTapEscrowThawSignerCmd(logger))
+	cmd.AddCommand(newTapEscrowCancelThawSignerCmd(logger))
+	cmd.AddCommand(newTapEscrowRevokeSignerCmd(logger))
+
+	return cmd
+}
+
+func addTapEscrowFlags(cmd *cobra.Command) {
+	cmd.Flags().String("network", utils.DefaultNetworkProfile(), "the network profile, a JSON profile file with tap_escrow. if not provided, will check the NETWORK_PAYMENT_NETWORK env var")
+	cmd.Flags().String("rpc-url", os.Getenv("ARBITRUM_RPC_URL"), "the rpc url, or a comma-separated list of rpc urls to fail over between. if not provided, will check the ARBITRUM_RPC_URL env var")
+}
+
+func addTapSignerFlags(cmd *cobra.Command) {
+	addTapEscrowFlags(cmd)
+	cmd.Flags().String("signer", "", "the signer address")
+	cmd.Flags().String("private-key-file", "", "the sender private key file. (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where the transaction is recorded. Set to empty to disable")
+}
+
+// readTapEscrowFlags identifies the TAP v1 Escrow account of a command, the
+// receiver being left nil unless withReceiver.
+func readTapEscrowFlags(cmd *cobra.Command, withReceiver bool) (*escrowAccountFlags, error) {
+	network, err := cmd.Flags().GetString("network")
+	if err != nil {
+		return nil, err
+	}
+	profile, err := utils.LoadNetworkProfile(network)
+	if err != nil {
+		return nil, err
+	}
+	if err := profile.RequireTapEscrow(); err != nil {
+		return nil, err
+	}
+
+	rpcURL, err := cmd.Flags().GetString("rpc-url")
+	if err != nil {
+		return nil, err
+	}
+
+	account := &escrowAccountFlags{profile: profile, escrow: profile.TapEscrow, rpcURL: rpcURL}
+	if !withReceiver {
+		return account, nil
+	}
+
+	receiver, err := cmd.Flags().GetString("receiver")
+	if err != nil {
+		return nil, err
+	}
+	if receiver == "" {
+		return nil, fmt.Errorf("receiver address is required")
+	}
+	if account.receiver, err = eth.NewAddress(receiver); err != nil {
+		return nil, fmt.Errorf("invalid receiver address %q: %w", receiver, err)
+	}
+
+	return account, nil
+}
+
+func tapReceiverArg(account *escrowAccountFlags) utils.SafeArg {
+	return utils.SafeArg{Name: "receiver", Type: "address", Value: account.receiver.Pretty()}
+}
+
+func newTapEscrowDepositCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deposit",
+		Short: "approve and deposit GRT in the TAP escrow account of a receiver",
+		RunE:  tapEscrowDepositE(logger),
+	}
+
+	addTapEscrowFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+	cmd.Flags().String("receiver", "", "the receiver (indexer) address the escrow account pays")
+	cmd.Flags().Uint64("amount", 0, "the amount to deposit in GRT")
+	cmd.Flags().Bool("yes", false, "do not ask for confirmation before depositing. Required when stdin is not a terminal (scripts, CI), the command fails with a usage error otherwise")
+
+	return cmd
+}
+
+func tapEscrowDepositE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readTapEscrowFlags(cmd, true)
+		if err != nil {
+			return err
+		}
+
+		amountGRT, err := cmd.Flags().GetUint64("amount")
+		if err != nil {
+			return err
+		}
+		if amountGRT == 0 {
+			return fmt.Errorf("amount is required")
+		}
+		amount := utils.ConvertToWei(amountGRT)
+
+		skipConfirm, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Deposit %s in the TAP escrow for receiver %s", utils.FormatGRT(amount), account.receiver.Pretty())
+			return printSafeBatch(account, description, amount, "deposit", tapReceiverArg(account), utils.SafeArg{Name: "amount", Type: "uint256", Value: amount.String()})
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		depositTrx, err := sender.deposit(ctx, amount, skipConfirm, utils.LedgerActionTapEscrowDeposit, "deposit(address,uint256)", account.receiver, amount)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s deposited in the TAP escrow for receiver %s\n", utils.FormatGRT(amount), account.receiver.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", depositTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newTapEscrowThawCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "thaw",
+		Short: "start thawing GRT of the TAP escrow account, to withdraw them after the thawing period",
+		Long: "Start thawing GRT of the TAP escrow account. Thawing tokens no longer back receipts, they can be withdrawn once the thawing period is over. " +
+			"Thawing again adds to the thawing amount and restarts the thawing period.",
+		RunE: tapEscrowThawE(logger),
+	}
+
+	addTapEscrowFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+	cmd.Flags().String("receiver", "", "the receiver (indexer) address the escrow account pays")
+	cmd.Flags().Uint64("amount", 0, "the amount to thaw in GRT")
+
+	return cmd
+}
+
+func tapEscrowThawE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readTapEscrowFlags(cmd, true)
+		if err != nil {
+			return err
+		}
+
+		amountGRT, err := cmd.Flags().GetUint64("amount")
+		if err != nil {
+			return err
+		}
+		if amountGRT == 0 {
+			return fmt.Errorf("amount is required")
+		}
+		amount := utils.ConvertToWei(amountGRT)
+
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Thaw %s of the TAP escrow account of receiver %s", utils.FormatGRT(amount), account.receiver.Pretty())
+			return printSafeBatch(account, description, nil, "thaw", tapReceiverArg(account), utils.SafeArg{Name: "amount", Type: "uint256", Value: amount.String()})
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		escrowAccount, err := sender.account(ctx)
+		if err != nil {
+			return err
+		}
+		if escrowAccount.Available().Cmp(amount) < 0 {
+			return fmt.Errorf("cannot thaw %s, the escrow account only has %s available", utils.FormatGRT(amount), utils.FormatGRT(escrowAccount.Available()))
+		}
+		if escrowAccount.TokensThawing.Sign() > 0 {
+			fmt.Printf("Warning: %s already thawing, %s is added to them and the thawing period restarts\n", utils.FormatGRT(escrowAccount.TokensThawing), utils.FormatGRT(amount))
+		}
+
+		thawingPeriod, err := utils.GetTapEscrowThawingPeriodCall(ctx, sender.chain.Client(), account.profile)
+		if err != nil {
+			return fmt.Errorf("failed to fetch thawing period: %w", err)
+		}
+
+		thawTrx, err := sender.send(ctx, utils.LedgerActionTapEscrowThaw, amount, "thaw(address,uint256)", account.receiver, amount)
+		if err != nil {
+			return fmt.Errorf("failed to thaw: %w", err)
+		}
+
+		fmt.Printf("%s thawing, withdraw them in %s\n", utils.FormatGRT(amount), thawingPeriod)
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", thawTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newTapEscrowCancelThawCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel-thaw",
+		Short: "stop thawing GRT of the TAP escrow account, making them back receipts again",
+		RunE:  tapEscrowCancelThawE(logger),
+	}
+
+	addTapEscrowFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+	cmd.Flags().String("receiver", "", "the receiver (indexer) address the escrow account pays")
+
+	return cmd
+}
+
+func tapEscrowCancelThawE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readTapEscrowFlags(cmd, true)
+		if err != nil {
+			return err
+		}
+
+		// thawing zero tokens is how the TAP v1 Escrow cancels a thaw
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Cancel the thawing of the TAP escrow account of receiver %s", account.receiver.Pretty())
+			return printSafeBatch(account, description, nil, "thaw", tapReceiverArg(account), utils.SafeArg{Name: "amount", Type: "uint256", Value: "0"})
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		escrowAccount, err := sender.account(ctx)
+		if err != nil {
+			return err
+		}
+		if escrowAccount.TokensThawing.Sign() == 0 {
+			fmt.Println("Nothing is thawing, nothing to do")
+			return nil
+		}
+
+		cancelTrx, err := sender.send(ctx, utils.LedgerActionTapEscrowCancelThaw, escrowAccount.TokensThawing, "thaw(address,uint256)", account.receiver, big.NewInt(0))
+		if err != nil {
+			return fmt.Errorf("failed to cancel thaw: %w", err)
+		}
+
+		fmt.Printf("Thawing of %s cancelled\n", utils.FormatGRT(escrowAccount.TokensThawing))
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", cancelTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newTapEscrowWithdrawCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "withdraw",
+		Short: "withdraw the thawed GRT of the TAP escrow account back to the sender, once the thawing period is over",
+		RunE:  tapEscrowWithdrawE(logger),
+	}
+
+	addTapEscrowFlags(cmd)
+	addEscrowTransactionFlags(cmd)
+	cmd.Flags().String("receiver", "", "the receiver (indexer) address the escrow account pays")
+
+	return cmd
+}
+
+func tapEscrowWithdrawE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readTapEscrowFlags(cmd, true)
+		if err != nil {
+			return err
+		}
+
+		safeBatch, err := cmd.Flags().GetBool("safe-batch")
+		if err != nil {
+			return err
+		}
+		if safeBatch {
+			description := fmt.Sprintf("Withdraw the thawed tokens of the TAP escrow account of receiver %s", account.receiver.Pretty())
+			return printSafeBatch(account, description, nil, "withdraw", tapReceiverArg(account))
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		escrowAccount, err := sender.account(ctx)
+		if err != nil {
+			return err
+		}
+		if escrowAccount.TokensThawing.Sign() == 0 {
+			return fmt.Errorf("nothing is thawing, thaw tokens first and withdraw them after the thawing period")
+		}
+
+		now, err := utils.LatestBlockTime(ctx, sender.chain.Client())
+		if err != nil {
+			return err
+		}
+		withdrawable := escrowAccount.Withdrawable(now)
+		if withdrawable.Sign() == 0 {
+			return fmt.Errorf("the thawing period is not over, %s can be withdrawn at %s (in %s)", utils.FormatGRT(escrowAccount.TokensThawing), escrowAccount.ThawEnd().Format(time.RFC3339), escrowAccount.ThawEnd().Sub(now).Round(time.Second))
+		}
+
+		withdrawTrx, err := sender.send(ctx, utils.LedgerActionTapEscrowWithdraw, withdrawable, "withdraw(address)", account.receiver)
+		if err != nil {
+			return fmt.Errorf("failed to withdraw: %w", err)
+		}
+
+		fmt.Printf("%s withdrawn to %s\n", utils.FormatGRT(withdrawable), sender.payer.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", withdrawTrx)
+
+		return sender.printAccount(ctx)
+	}
+}
+
+func newTapEscrowBalanceCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "balance",
+		Short: "show the deposited, thawing and withdrawable GRT of the TAP escrow accounts of a sender, per receiver",
+		RunE:  tapEscrowBalanceE(logger),
+	}
+
+	addTapEscrowFlags(cmd)
+	cmd.Flags().StringSlice("receiver", nil, "the receiver (indexer) addresses to show the escrow account of, comma-separated or repeated")
+	cmd.Flags().String("sender", "", "the sender address. If not provided, the address of the NETWORK_PAYMENT_PRIVATE_KEY env var or --private-key-file key")
+	cmd.Flags().String("private-key-file", "", "the sender private key file, only used to derive the sender address when --sender is not provided")
+
+	return cmd
+}
+
+func tapEscrowBalanceE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readTapEscrowFlags(cmd, false)
+		if err != nil {
+			return err
+		}
+
+		receivers, err := cmd.Flags().GetStringSlice("receiver")
+		if err != nil {
+			return err
+		}
+		if len(receivers) == 0 {
+			return fmt.Errorf("at least one receiver address is required")
+		}
+		receiverAddresses := make([]eth.Address, 0, len(receivers))
+		for _, receiver := range receivers {
+			address, err := eth.NewAddress(receiver)
+			if err != nil {
+				return fmt.Errorf("invalid receiver address %q: %w", receiver, err)
+			}
+			receiverAddresses = append(receiverAddresses, address)
+		}
+
+		sender, err := cmd.Flags().GetString("sender")
+		if err != nil {
+			return err
+		}
+		var senderAddress eth.Address
+		if sender != "" {
+			senderAddress, err = eth.NewAddress(sender)
+			if err != nil {
+				return fmt.Errorf("invalid sender address %q: %w", sender, err)
+			}
+		} else {
+			privateKeyFile, err := cmd.Flags().GetString("private-key-file")
+			if err != nil {
+				return err
+			}
+			privateKey, err := utils.ReadPrivateKey(privateKeyFile)
+			if err != nil {
+				return fmt.Errorf("sender address is required: %w", err)
+			}
+			senderAddress = privateKey.PublicKey().Address()
+		}
+
+		rpcClient := utils.NewRPCClient(account.rpcURL)
+		chain := utils.NewChain(rpcClient, account.profile.ChainID)
+		if _, err := chain.ChainID(ctx); err != nil {
+			return err
+		}
+
+		now, err := utils.LatestBlockTime(ctx, rpcClient)
+		if err != nil {
+			return err
+		}
+
+		totalAvailable := big.NewInt(0)
+		for _, receiver := range receiverAddresses {
+			escrowAccount, err := utils.GetTapEscrowAccountCall(ctx, rpcClient, account.profile, senderAddress, receiver)
+			if err != nil {
+				return fmt.Errorf("failed to fetch escrow account of receiver %s: %w", receiver.Pretty(), err)
+			}
+
+			fmt.Println(escrowAccount.Describe(now))
+			totalAvailable.Add(totalAvailable, escrowAccount.Available())
+		}
+
+		if len(receiverAddresses) > 1 {
+			fmt.Printf("Available across %d receivers: %s\n", len(receiverAddresses), utils.FormatGRT(totalAvailable))
+		}
+
+		return nil
+	}
+}
+
+func newTapEscrowAuthorizeSignerCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "authorize-signer",
+		Short: "authorize a key to sign TAP receipts on behalf of the sender",
+		Long: "Authorize a key to sign TAP receipts on behalf of the sender. The signer key proves it agrees to sign for the sender, " +
+			"so it must be provided, the sender key authorizing itself when no signer key is given.",
+		RunE: tapEscrowAuthorizeSignerE(logger),
+	}
+
+	addTapEscrowFlags(cmd)
+	cmd.Flags().String("private-key-file", "", "the sender private key file. (if not provided, NETWORK_PAYMENT_PRIVATE_KEY env var will be used for the private key value directly)")
+	cmd.Flags().String("signer-key-file", "", "the private key file of the signer to authorize. If not provided, the sender key is authorized")
+	cmd.Flags().Duration("proof-validity", time.Hour, "how long the signer proof remains valid, from the latest block time")
+	cmd.Flags().Int64("gas-price", 0, "the gas price to use for the transaction. If 0, the gas price will be fetched from the network")
+	cmd.Flags().String("ledger-file", utils.DefaultLedgerFile(), "the local ledger where the transaction is recorded. Set to empty to disable")
+
+	return cmd
+}
+
+func tapEscrowAuthorizeSignerE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		account, err := readTapEscrowFlags(cmd, false)
+		if err != nil {
+			return err
+		}
+
+		proofValidity, err := cmd.Flags().GetDuration("proof-validity")
+		if err != nil {
+			return err
+		}
+		if proofValidity <= 0 {
+			return fmt.Errorf("proof validity must be positive")
+		}
+
+		ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+		if err != nil {
+			return err
+		}
+
+		signerKey, err := utils.GetPrivateKey(ctx)
+		if err != nil {
+			return err
+		}
+		signerKeyFile, err := cmd.Flags().GetString("signer-key-file")
+		if err != nil {
+			return err
+		}
+		if signerKeyFile != "" {
+			if signerKey, err = utils.ReadPrivateKey(signerKeyFile); err != nil {
+				return fmt.Errorf("signer key: %w", err)
+			}
+		}
+		signerAddress := signerKey.PublicKey().Address()
+
+		signer, err := utils.GetTapSignerCall(ctx, sender.chain.Client(), account.profile, signerAddress)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signer: %w", err)
+		}
+		if signer.Authorized() {
+			if signer.Sender.String() != sender.payer.String() {
+				return fmt.Errorf("signer %s is already authorized for sender %s, a signer only signs for one sender", signerAddress.Pretty(), signer.Sender.Pretty())
+			}
+			fmt.Printf("Signer %s is already authorized, nothing to do\n", signerAddress.Pretty())
+			return nil
+		}
+
+		now, err := utils.LatestBlockTime(ctx, sender.chain.Client())
+		if err != nil {
+			return err
+		}
+		proofDeadline := uint64(now.Add(proofValidity).Unix())
+
+		proof, err := tap.SignerProof(account.profile.ChainID, proofDeadline, common.BytesToAddress(sender.payer.Bytes()), signerKey)
+		if err != nil {
+			return fmt.Errorf("failed to sign the signer proof: %w", err)
+		}
+
+		authorizeTrx, err := sender.send(ctx, utils.LedgerActionTapAuthorizeSigner, nil, "authorizeSigner(address,uint256,bytes)", signerAddress, new(big.Int).SetUint64(proofDeadline), []byte(proof))
+		if err != nil {
+			return fmt.Errorf("failed to authorize signer: %w", err)
+		}
+
+		fmt.Printf("Signer %s authorized for sender %s\n", signerAddress.Pretty(), sender.payer.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", authorizeTrx)
+
+		return nil
+	}
+}
+
+func newTapEscrowThawSignerCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "thaw-signer",
+		Short: "start thawing a signer, to revoke it after the signer thawing period",
+		RunE:  tapEscrowThawSignerE(logger),
+	}
+
+	addTapSignerFlags(cmd)
+
+	return cmd
+}
+
+func tapEscrowThawSignerE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		ctx, sender, signer, err := newTapSignerSender(ctx, cmd, logger)
+		if err != nil {
+			return err
+		}
+		if signer.ThawEndTimestamp != 0 {
+			fmt.Printf("Warning: signer %s is already thawing until %s, the signer thawing period restarts\n", signer.Signer.Pretty(), signer.ThawEnd().Format(time.RFC3339))
+		}
+
+		thawingPeriod, err := utils.GetTapRevokeSignerThawingPeriodCall(ctx, sender.chain.Client(), sender.profile)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signer thawing period: %w", err)
+		}
+
+		thawTrx, err := sender.send(ctx, utils.LedgerActionTapThawSigner, nil, "thawSigner(address)", signer.Signer)
+		if err != nil {
+			return fmt.Errorf("failed to thaw signer: %w", err)
+		}
+
+		fmt.Printf("Signer %s thawing, revoke it in %s\n", signer.Signer.Pretty(), thawingPeriod)
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", thawTrx)
+
+		return nil
+	}
+}
+
+func newTapEscrowCancelThawSignerCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel-thaw-signer",
+		Short: "stop thawing a signer, keeping it authorized",
+		RunE:  tapEscrowCancelThawSignerE(logger),
+	}
+
+	addTapSignerFlags(cmd)
+
+	return cmd
+}
+
+func tapEscrowCancelThawSignerE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		ctx, sender, signer, err := newTapSignerSender(ctx, cmd, logger)
+		if err != nil {
+			return err
+		}
+		if signer.ThawEndTimestamp == 0 {
+			fmt.Printf("Signer %s is not thawing, nothing to do\n", signer.Signer.Pretty())
+			return nil
+		}
+
+		cancelTrx, err := sender.send(ctx, utils.LedgerActionTapCancelThawSigner, nil, "cancelThawSigner(address)", signer.Signer)
+		if err != nil {
+			return fmt.Errorf("failed to cancel signer thaw: %w", err)
+		}
+
+		fmt.Printf("Thawing of signer %s cancelled\n", signer.Signer.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", cancelTrx)
+
+		return nil
+	}
+}
+
+func newTapEscrowRevokeSignerCmd(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke-signer",
+		Short: "revoke a thawed signer, once the signer thawing period is over",
+		RunE:  tapEscrowRevokeSignerE(logger),
+	}
+
+	addTapSignerFlags(cmd)
+
+	return cmd
+}
+
+func tapEscrowRevokeSignerE(logger *slog.Logger) func(cmd *cobra.Command, args []string) (err error) {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		ctx = utils.WithLogger(ctx, logger)
+
+		ctx, sender, signer, err := newTapSignerSender(ctx, cmd, logger)
+		if err != nil {
+			return err
+		}
+		if signer.ThawEndTimestamp == 0 {
+			return fmt.Errorf("signer %s is not thawing, thaw it first with `tap-escrow thaw-signer` and revoke it after the signer thawing period", signer.Signer.Pretty())
+		}
+
+		now, err := utils.LatestBlockTime(ctx, sender.chain.Client())
+		if err != nil {
+			return err
+		}
+		if now.Before(signer.ThawEnd()) {
+			return fmt.Errorf("the signer thawing period is not over, signer %s can be revoked at %s (in %s)", signer.Signer.Pretty(), signer.ThawEnd().Format(time.RFC3339), signer.ThawEnd().Sub(now).Round(time.Second))
+		}
+
+		revokeTrx, err := sender.send(ctx, utils.LedgerActionTapRevokeSigner, nil, "revokeAuthorizedSigner(address)", signer.Signer)
+		if err != nil {
+			return fmt.Errorf("failed to revoke signer: %w", err)
+		}
+
+		fmt.Printf("Signer %s revoked\n", signer.Signer.Pretty())
+		fmt.Printf("See transaction on arbiscan: https://arbiscan.io/tx/%s\n", revokeTrx)
+
+		return nil
+	}
+}
+
+// newTapSignerSender is the sender of a --signer command, checking that the
+// signer is authorized for it.
+func newTapSignerSender(ctx context.Context, cmd *cobra.Command, logger *slog.Logger) (context.Context, *escrowSender, *utils.TapSigner, error) {
+	account, err := readTapEscrowFlags(cmd, false)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+
+	signer, err := cmd.Flags().GetString("signer")
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+	if signer == "" {
+		return ctx, nil, nil, fmt.Errorf("signer address is required")
+	}
+	signerAddress, err := eth.NewAddress(signer)
+	if err != nil {
+		return ctx, nil, nil, fmt.Errorf("invalid signer address %q: %w", signer, err)
+	}
+
+	ctx, sender, err := newEscrowSender(ctx, cmd, logger, account)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+
+	authorized, err := utils.GetTapSignerCall(ctx, sender.chain.Client(), account.profile, signerAddress)
+	if err != nil {
+		return ctx, nil, nil, fmt.Errorf("failed to fetch signer: %w", err)
+	}
+	if !authorized.Authorized() || authorized.Sender.String() != sender.payer.String() {
+		return ctx, nil, nil, fmt.Errorf("signer %s is not authorized for sender %s", signerAddress.Pretty(), sender.payer.Pretty())
+	}
+
+	return ctx, sender, authorized, nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/fakechain"
+)
+
+var testDeployment = eth.MustNewHash("0xe4ca0b3bd66d4b49cfe4c5ed3a0e97e2e2c4e8aa4fb1ee5c1a01c3a5a4e0b101")
+
+type paymentTest struct {
+	chain        *fakechain.Chain
+	url          string
+	payer        eth.Address
+	keyFile      string
+	ledgerFile   string
+	indexer      eth.Address
+	allocationID eth.Address
+	stop         func() error
+}
+
+// newPaymentTest serves a fake chain with a funded payer and an active
+// allocation of an indexer with delegators keeping a third of the query fees.
+func newPaymentTest(t *testing.T) *paymentTest {
+	t.Helper()
+
+	chain := fakechain.New()
+	url, stop, err := chain.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stop() })
+
+	payerKey, err := eth.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "payer.key")
+	if err := os.WriteFile(keyFile, []byte(payerKey.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	test := &paymentTest{
+		chain:        chain,
+		url:          url,
+		payer:        payerKey.PublicKey().Address(),
+		keyFile:      keyFile,
+		ledgerFile:   filepath.Join(t.TempDir(), "ledger.jsonl"),
+		indexer:      eth.MustNewAddress("0x0658b87e4826cc9072d4cb3ec82b6c2762cb6ab2"),
+		allocationID: eth.MustNewAddress("0xa110ca7e0000000000000000000000000000a110"),
+		stop:         stop,
+	}
+
+	chain.Fund(test.payer, utils.ConvertToWei(1), utils.ConvertToWei(1000))
+	chain.Stake(test.indexer, utils.ConvertToWei(100_000))
+	chain.SetDelegation(test.indexer, 333_333, utils.ConvertToWei(50_000))
+	chain.Allocate(test.indexer, testDeployment, test.allocationID, utils.ConvertToWei(10_000))
+
+	return test
+}
+
+func (p *paymentTest) run(t *testing.T, args ...string) error {
+	t.Helper()
+
+	cmd := newRootCmd(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	cmd.SetArgs(append([]string{"--rpc-url", p.url, "--private-key-file", p.keyFile, "--ledger-file", p.ledgerFile}, args...))
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return cmd.ExecuteContext(ctx)
+}
+
+func (p *paymentTest) ledger(t *testing.T) []*utils.LedgerEntry {
+	t.Helper()
+
+	entries, err := utils.NewLedger(p.ledgerFile).Entries(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return entries
+}
+
+// rebate is the RebateCollected event of the collect transaction trx.
+func (p *paymentTest) rebate(t *testing.T, trx string) *utils.RebateCollectedEvent {
+	t.Helper()
+
+	receipt, err := ethrpc.NewClient(p.url).TransactionReceipt(context.Background(), eth.MustNewHash(trx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := utils.DecodePaymentLogs(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs.Rebates) != 1 {
+		t.Fatalf("%d RebateCollected events in %s, want 1", len(logs.Rebates), trx)
+	}
+
+	return logs.Rebates[0]
+}
+
+func wei(t *testing.T, amount string) *big.Int {
+	t.Helper()
+
+	out, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		t.Fatalf("invalid amount %q", amount)
+	}
+
+	return out
+}
+
+func TestSendPayment(t *testing.T) {
+	test := newPaymentTest(t)
+
+	if err := test.run(t, "--allocation-id", test.allocationID.Pretty(), "--amount", "100", "--yes"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := test.chain.GRTBalance(test.payer), utils.ConvertToWei(900); got.Cmp(want) != 0 {
+		t.Errorf("payer GRT balance %s, want %s", got, want)
+	}
+
+	entries := test.ledger(t)
+	if len(entries) != 2 {
+		t.Fatalf("%d ledger entries, want approve and collect", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Status != utils.LedgerStatusSuccess {
+			t.Errorf("%s recorded as %s, want %s", entry.Action, entry.Status, utils.LedgerStatusSuccess)
+		}
+	}
+
+	// 1% protocol tax, then the indexer keeps 33.3333% of the rest rounded
+	// down and delegators get the remainder
+	rebate := test.rebate(t, entries[1].Trx)
+	for name, got := range map[string]*big.Int{
+		"protocol tax":       rebate.ProtocolTax,
+		"curation fees":      rebate.CurationFees,
+		"query fees":         rebate.QueryFees,
+		"query rebates":      rebate.QueryRebates,
+		"delegation rewards": rebate.DelegationRewards,
+	} {
+		want := map[string]string{
+			"protocol tax":       "1000000000000000000",
+			"curation fees":      "0",
+			"query fees":         "99000000000000000000",
+			"query rebates":      "32999967000000000000",
+			"delegation rewards": "66000033000000000000",
+		}[name]
+		if got.Cmp(wei(t, want)) != 0 {
+			t.Errorf("%s %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSendPaymentNetAmount(t *testing.T) {
+	test := newPaymentTest(t)
+
+	if err := test.run(t, "--allocation-id", test.allocationID.Pretty(), "--net-amount", "50", "--yes"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the smallest gross for which the contract split leaves 50 GRT to the
+	// indexer
+	gross := wei(t, "151515303030454545607")
+	if got, want := test.chain.GRTBalance(test.payer), new(big.Int).Sub(utils.ConvertToWei(1000), gross); got.Cmp(want) != 0 {
+		t.Errorf("payer GRT balance %s, want %s", got, want)
+	}
+
+	entries := test.ledger(t)
+	if got := test.rebate(t, entries[len(entries)-1].Trx).QueryRebates; got.Cmp(utils.ConvertToWei(50)) != 0 {
+		t.Errorf("indexer rebate %s, want 50 GRT", got)
+	}
+}
+
+func TestSendPaymentCollectReverted(t *testing.T) {
+	test := newPaymentTest(t)
+	test.chain.RevertNext("collect", "!collect")
+
+	err := test.run(t, "--allocation-id", test.allocationID.Pretty(), "--amount", "100", "--yes")
+	if !errors.Is(err, utils.ErrReverted) {
+		t.Fatalf("error %v, want a reverted transaction", err)
+	}
+	if code := utils.ExitCode(err); code != utils.ExitCodeReverted {
+		t.Errorf("exit code %d, want %d", code, utils.ExitCodeReverted)
+	}
+
+	entries := test.ledger(t)
+	if len(entries) != 2 {
+		t.Fatalf("%d ledger entries, want approve and collect", len(entries))
+	}
+	collect := entries[1]
+	if collect.Status != utils.LedgerStatusReverted || collect.Trx == "" {
+		t.Errorf("collect recorded as %s with trx %q, want %s with its trx", collect.Status, collect.Trx, utils.LedgerStatusReverted)
+	}
+	if reason := test.chain.Revert(collect.Trx); reason == "" {
+		t.Errorf("collect %s did not revert on chain", collect.Trx)
+	}
+	if got, want := test.chain.GRTBalance(test.payer), utils.ConvertToWei(1000); got.Cmp(want) != 0 {
+		t.Errorf("payer GRT balance %s, want %s untouched", got, want)
+	}
+}
+
+func TestSendPaymentApproveReverted(t *testing.T) {
+	test := newPaymentTest(t)
+	test.chain.RevertNext("approve", "paused")
+
+	err := test.run(t, "--allocation-id", test.allocationID.Pretty(), "--amount", "100", "--yes")
+	if !errors.Is(err, utils.ErrReverted) {
+		t.Fatalf("error %v, want a reverted transaction", err)
+	}
+
+	entries := test.ledger(t)
+	if len(entries) != 1 || entries[0].Status != utils.LedgerStatusReverted {
+		t.Fatalf("ledger %+v, want a single reverted approve", entries)
+	}
+}
+
+func TestSendPaymentUnknownAllocation(t *testing.T) {
+	test := newPaymentTest(t)
+
+	err := test.run(t, "--allocation-id", "0x1111111111111111111111111111111111111111", "--amount", "100", "--yes")
+	if err == nil {
+		t.Fatal("paying an allocation that does not exist succeeded")
+	}
+	if entries := test.ledger(t); len(entries) != 0 {
+		t.Errorf("%d ledger entries, want none: nothing must be sent", len(entries))
+	}
+}
+
+func TestSendPaymentDeploymentChecks(t *testing.T) {
+	otherDeployment, err := utils.ConvertByteStringToIPFSHash(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocationDeployment, err := utils.ConvertByteStringToIPFSHash(testDeployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]struct {
+		signal *big.Int
+		args   []string
+		want   string
+	}{
+		"curated allocation deployment":     {utils.ConvertToWei(1), nil, "has curation"},
+		"curated, matching --deployment-id": {utils.ConvertToWei(1), []string{"--deployment-id", allocationDeployment}, "has curation"},
+		"other deployment":                  {nil, []string{"--deployment-id", otherDeployment}, "not on --deployment-id"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			test := newPaymentTest(t)
+			if c.signal != nil {
+				test.chain.Signal(testDeployment, c.signal)
+			}
+
+			err := test.run(t, append([]string{"--allocation-id", test.allocationID.Pretty(), "--amount", "100", "--yes"}, c.args...)...)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("error %v, want one saying %q", err, c.want)
+			}
+			if code := utils.ExitCode(err); code != utils.ExitCodeError {
+				t.Errorf("exit code %d, want %d", code, utils.ExitCodeError)
+			}
+			if entries := test.ledger(t); len(entries) != 0 {
+				t.Errorf("%d ledger entries, want none: nothing must be sent", len(entries))
+			}
+		})
+	}
+}
+
+func TestSendPaymentUsageErrors(t *testing.T) {
+	test := newPaymentTest(t)
+
+	for name, args := range map[string][]string{
+		"malformed allocation": {"--allocation-id", "nope", "--amount", "100", "--yes"},
+		"missing allocation":   {"--amount", "100", "--yes"},
+		"malformed deployment": {"--allocation-id", test.allocationID.Pretty(), "--deployment-id", "Qmnope", "--amount", "100", "--yes"},
+		// stdin is not a terminal under go test
+		"no confirmation": {"--allocation-id", test.allocationID.Pretty(), "--amount", "100"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := test.run(t, args...)
+			if code := utils.ExitCode(err); code != utils.ExitCodeUsage {
+				t.Errorf("exit code %d (%v), want %d", code, err, utils.ExitCodeUsage)
+			}
+		})
+	}
+
+	if entries := test.ledger(t); len(entries) != 0 {
+		t.Errorf("%d ledger entries, want none", len(entries))
+	}
+}
+
+func TestSendPaymentRecordReplay(t *testing.T) {
+	test := newPaymentTest(t)
+	t.Cleanup(func() { utils.SetRPCFixtures("", "") })
+	args := []string{"--allocation-id", test.allocationID.Pretty(), "--amount", "100", "--yes"}
+
+	dir := t.TempDir()
+	if err := test.run(t, append(args, "--rpc-record", dir)...); err != nil {
+		t.Fatalf("recording: %s", err)
+	}
+
+	test.stop()
+	if err := test.run(t, append(args, "--rpc-replay", dir)...); err != nil {
+		t.Fatalf("replaying: %s", err)
+	}
+
+	// approve and collect, recorded then replayed
+	entries := test.ledger(t)
+	if len(entries) != 4 {
+		t.Fatalf("%d ledger entries, want 4", len(entries))
+	}
+	for i := 0; i < 2; i++ {
+		if entries[i].Trx == "" || entries[i].Trx != entries[i+2].Trx {
+			t.Errorf("replayed %s %s, recorded %s", entries[i+2].Action, entries[i+2].Trx, entries[i].Trx)
+		}
+	}
+}
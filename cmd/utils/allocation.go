@@ -1,49 +1,80 @@
 package utils
 
 import (
-	"bytes"
-	"encoding/hex"
+	"context"
 	"fmt"
+	"math/big"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
 )
 
-func GenerateAllocationIDAndProof(address string) ([]byte, []byte, error) { //returns allocationID, proof, err
-	indexerAddress := common.HexToAddress(address)
+// Allocation mirrors the Staking contract `Allocation` struct as returned by
+// `getAllocation(address)`.
+type Allocation struct {
+	Indexer                     eth.Address
+	SubgraphDeploymentID        []byte
+	Tokens                      *big.Int
+	CreatedAtEpoch              *big.Int
+	ClosedAtEpoch               *big.Int
+	CollectedFees               *big.Int
+	EffectiveAllocation         *big.Int
+	AccRewardsPerAllocatedToken *big.Int
+	DistributedRebates          *big.Int
+}
 
-	// Create a new ECDSA key, to generate a new allocation ID.
-	key, err := crypto.GenerateKey()
-	if err != nil {
-		return nil, nil, fmt.Errorf("error generating key: %w", err)
-	}
-	allocationIDAddress := crypto.PubkeyToAddress(key.PublicKey)
+const getAllocationSignature = "getAllocation(address) (address,bytes32,uint256,uint256,uint256,uint256,uint256,uint256,uint256)"
 
-	pk, err := eth.NewPrivateKey(hex.EncodeToString(crypto.FromECDSA(key)))
+func GetAllocationCall(ctx context.Context, cli *ethrpc.Client, allocationID string) (*Allocation, error) {
+	out, err := contractCall(ctx, cli, StakingContractAddress, getAllocationSignature, eth.MustNewAddress(allocationID))
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating private key: %w", err)
+		return nil, err
 	}
 
-	messageHash := crypto.Keccak256Hash(bytes.Join([][]byte{indexerAddress.Bytes(), allocationIDAddress.Bytes()}, nil))
+	return decodeAllocation(out), nil
+}
 
-	// Sign the message hash
-	signature, err := pk.SignPersonal(messageHash.Bytes())
-	if err != nil {
-		return nil, nil, fmt.Errorf("error signing message: %w", err)
+func decodeAllocation(out []interface{}) *Allocation {
+	return &Allocation{
+		Indexer:                     out[0].(eth.Address),
+		SubgraphDeploymentID:        out[1].([]byte),
+		Tokens:                      out[2].(*big.Int),
+		CreatedAtEpoch:              out[3].(*big.Int),
+		ClosedAtEpoch:               out[4].(*big.Int),
+		CollectedFees:               out[5].(*big.Int),
+		EffectiveAllocation:         out[6].(*big.Int),
+		AccRewardsPerAllocatedToken: out[7].(*big.Int),
+		DistributedRebates:          out[8].(*big.Int),
 	}
+}
 
-	invertedSignature := signature.ToInverted()
+// AllocationState mirrors the Staking contract `AllocationState` enum.
+type AllocationState uint8
 
-	// Verify signature
-	recoveredAddress, err := invertedSignature.RecoverPersonal(messageHash.Bytes())
-	if err != nil {
-		return nil, nil, fmt.Errorf("error recovering address: %w", err)
+const (
+	AllocationStateNull AllocationState = iota
+	AllocationStateActive
+	AllocationStateClosed
+)
+
+func (s AllocationState) String() string {
+	switch s {
+	case AllocationStateNull:
+		return "Null"
+	case AllocationStateActive:
+		return "Active"
+	case AllocationStateClosed:
+		return "Closed"
 	}
 
-	if !bytes.Equal(recoveredAddress.Bytes(), allocationIDAddress.Bytes()) {
-		return nil, nil, fmt.Errorf("recovered address does not match allocation ID")
+	return fmt.Sprintf("Unknown(%d)", uint8(s))
+}
+
+func GetAllocationStateCall(ctx context.Context, cli *ethrpc.Client, allocationID string) (AllocationState, error) {
+	out, err := contractCall(ctx, cli, StakingContractAddress, "getAllocationState(address) (uint8)", eth.MustNewAddress(allocationID))
+	if err != nil {
+		return AllocationStateNull, err
 	}
 
-	return allocationIDAddress.Bytes(), invertedSignature[:], nil
+	return AllocationState(out[0].(uint8)), nil
 }
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// StakingDeploymentBlock is the Arbitrum block the L2 Staking contract was
+// deployed at, scanning logs before it is pointless.
+const StakingDeploymentBlock = 42_440_000
+
+var (
+	AllocationCreatedEventTopic = EventTopic("AllocationCreated(address,bytes32,uint256,uint256,address,bytes32)")
+	AllocationClosedEventTopic  = EventTopic("AllocationClosed(address,bytes32,uint256,uint256,address,address,bytes32,bool)")
+)
+
+type AllocationCreatedEvent struct {
+	Indexer              eth.Address
+	SubgraphDeploymentID []byte
+	Epoch                *big.Int
+	Tokens               *big.Int
+	AllocationID         eth.Address
+	Metadata             []byte
+	BlockNumber          uint64
+	TransactionHash      eth.Hash
+}
+
+type AllocationClosedEvent struct {
+	Indexer              eth.Address
+	SubgraphDeploymentID []byte
+	Epoch                *big.Int
+	Tokens               *big.Int
+	AllocationID         eth.Address
+	Sender               eth.Address
+	POI                  []byte
+	IsPublic             bool
+	BlockNumber          uint64
+	TransactionHash      eth.Hash
+}
+
+func DecodeAllocationCreatedEvent(log *ethrpc.LogEntry) (*AllocationCreatedEvent, error) {
+	if len(log.Topics) != 4 || !eventTopicIs(log, AllocationCreatedEventTopic) {
+		return nil, fmt.Errorf("log is not an AllocationCreated event")
+	}
+
+	data, err := decodeLogData(log, "uint256", "uint256", "bytes32")
+	if err != nil {
+		return nil, fmt.Errorf("decoding AllocationCreated data: %w", err)
+	}
+
+	return &AllocationCreatedEvent{
+		Indexer:              eth.Address(log.Topics[1][12:]),
+		SubgraphDeploymentID: log.Topics[2],
+		Epoch:                data[0].(*big.Int),
+		Tokens:               data[1].(*big.Int),
+		AllocationID:         eth.Address(log.Topics[3][12:]),
+		Metadata:             data[2].([]byte),
+		BlockNumber:          uint64(log.BlockNumber),
+		TransactionHash:      log.TransactionHash,
+	}, nil
+}
+
+func DecodeAllocationClosedEvent(log *ethrpc.LogEntry) (*AllocationClosedEvent, error) {
+	if len(log.Topics) != 4 || !eventTopicIs(log, AllocationClosedEventTopic) {
+		return nil, fmt.Errorf("log is not an AllocationClosed event")
+	}
+
+	data, err := decodeLogData(log, "uint256", "uint256", "address", "bytes32", "bool")
+	if err != nil {
+		return nil, fmt.Errorf("decoding AllocationClosed data: %w", err)
+	}
+
+	return &AllocationClosedEvent{
+		Indexer:              eth.Address(log.Topics[1][12:]),
+		SubgraphDeploymentID: log.Topics[2],
+		Epoch:                data[0].(*big.Int),
+		Tokens:               data[1].(*big.Int),
+		AllocationID:         eth.Address(log.Topics[3][12:]),
+		Sender:               data[2].(eth.Address),
+		POI:                  data[3].([]byte),
+		IsPublic:             data[4].(bool),
+		BlockNumber:          uint64(log.BlockNumber),
+		TransactionHash:      log.TransactionHash,
+	}, nil
+}
+
+// AllocationEventFilter restricts an allocation event scan to an indexer
+// and/or a deployment. Empty fields match everything.
+type AllocationEventFilter struct {
+	Indexer      eth.Address
+	DeploymentID []byte
+}
+
+func (f AllocationEventFilter) topics() *ethrpc.TopicFilter {
+	var indexer, deployment interface{} = ethrpc.AnyTopic(), ethrpc.AnyTopic()
+	if len(f.Indexer) > 0 {
+		indexer = f.Indexer
+	}
+	if len(f.DeploymentID) > 0 {
+		deployment = f.DeploymentID
+	}
+
+	return ethrpc.NewTopicFilter(ethrpc.OneOfTopic(AllocationCreatedEventTopic, AllocationClosedEventTopic), indexer, deployment)
+}
+
+// ScanAllocationEvents collects the Staking AllocationCreated and
+// AllocationClosed events matching filter, see ScanLogs for paging.
+func ScanAllocationEvents(ctx context.Context, cli *ethrpc.Client, filter AllocationEventFilter, fromBlock, toBlock, chunkSize uint64, onChunk func(created []*AllocationCreatedEvent, closed []*AllocationClosedEvent, scannedTo uint64) error) error {
+	return ScanLogs(ctx, cli, StakingContractAddress, filter.topics(), fromBlock, toBlock, chunkSize, func(logs []*ethrpc.LogEntry, scannedTo uint64) error {
+		var created []*AllocationCreatedEvent
+		var closed []*AllocationClosedEvent
+		for _, log := range logs {
+			if log.Removed {
+				continue
+			}
+
+			switch {
+			case eventTopicIs(log, AllocationCreatedEventTopic):
+				event, err := DecodeAllocationCreatedEvent(log)
+				if err != nil {
+					return err
+				}
+				created = append(created, event)
+			case eventTopicIs(log, AllocationClosedEventTopic):
+				event, err := DecodeAllocationClosedEvent(log)
+				if err != nil {
+					return err
+				}
+				closed = append(closed, event)
+			}
+		}
+
+		return onChunk(created, closed, scannedTo)
+	})
+}
+
+// FindAllocationCreatedEvent looks up the AllocationCreated event of
+// allocationID, narrowing the scan on its indexer and deployment. It returns
+// nil when no such event exists from fromBlock on.
+func FindAllocationCreatedEvent(ctx context.Context, cli *ethrpc.Client, allocationID eth.Address, indexer eth.Address, deploymentID []byte, fromBlock uint64) (*AllocationCreatedEvent, error) {
+	toBlock, err := cli.LatestBlockNum(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching latest block: %w", err)
+	}
+
+	var found *AllocationCreatedEvent
+	errFound := errors.New("found")
+	err = ScanAllocationEvents(ctx, cli, AllocationEventFilter{Indexer: indexer, DeploymentID: deploymentID}, fromBlock, toBlock, filteredScanChunkSize, func(created []*AllocationCreatedEvent, _ []*AllocationClosedEvent, _ uint64) error {
+		for _, event := range created {
+			if event.AllocationID.Pretty() == allocationID.Pretty() {
+				found = event
+				return errFound
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// AllocationSummary is the state of an allocation rebuilt from its events.
+type AllocationSummary struct {
+	AllocationID   string `json:"allocationId"`
+	Indexer        string `json:"indexer"`
+	DeploymentID   string `json:"deploymentId"`
+	Tokens         string `json:"tokens"`
+	Metadata       string `json:"metadata"`
+	Reference      string `json:"reference,omitempty"`
+	CreatedAtEpoch uint64 `json:"createdAtEpoch"`
+	CreatedAtBlock uint64 `json:"createdAtBlock"`
+	CreatedTrx     string `json:"createdTrx"`
+	ClosedAtEpoch  uint64 `json:"closedAtEpoch,omitempty"`
+	ClosedAtBlock  uint64 `json:"closedAtBlock,omitempty"`
+	ClosedTrx      string `json:"closedTrx,omitempty"`
+}
+
+func (s *AllocationSummary) IsOpen() bool {
+	return s.ClosedAtBlock == 0
+}
+
+// AllocationSet accumulates allocation events into summaries keyed by
+// allocation ID.
+type AllocationSet map[string]*AllocationSummary
+
+func (s AllocationSet) Apply(created []*AllocationCreatedEvent, closed []*AllocationClosedEvent) {
+	for _, event := range created {
+		deploymentID, err := ConvertByteStringToIPFSHash(event.SubgraphDeploymentID)
+		if err != nil {
+			deploymentID = eth.Hash(event.SubgraphDeploymentID).Pretty()
+		}
+
+		summary := s.get(event.AllocationID)
+		summary.Indexer = event.Indexer.Pretty()
+		summary.DeploymentID = deploymentID
+		summary.Tokens = event.Tokens.String()
+		summary.Metadata = eth.Hash(event.Metadata).Pretty()
+		summary.Reference = DecodeReference(event.Metadata)
+		summary.CreatedAtEpoch = event.Epoch.Uint64()
+		summary.CreatedAtBlock = event.BlockNumber
+		summary.CreatedTrx = event.TransactionHash.Pretty()
+	}
+
+	for _, event := range closed {
+		summary := s.get(event.AllocationID)
+		summary.ClosedAtEpoch = event.Epoch.Uint64()
+		summary.ClosedAtBlock = event.BlockNumber
+		summary.ClosedTrx = event.TransactionHash.Pretty()
+	}
+}
+
+// Sorted returns the summaries ordered by creation block.
+func (s AllocationSet) Sorted() []*AllocationSummary {
+	out := make([]*AllocationSummary, 0, len(s))
+	for _, summary := range s {
+		out = append(out, summary)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAtBlock == out[j].CreatedAtBlock {
+			return out[i].AllocationID < out[j].AllocationID
+		}
+		return out[i].CreatedAtBlock < out[j].CreatedAtBlock
+	})
+
+	return out
+}
+
+func (s AllocationSet) get(allocationID eth.Address) *AllocationSummary {
+	key := strings.ToLower(allocationID.Pretty())
+	summary, found := s[key]
+	if !found {
+		summary = &AllocationSummary{AllocationID: allocationID.Pretty()}
+		s[key] = summary
+	}
+
+	return summary
+}
+
+func eventTopicIs(log *ethrpc.LogEntry, topic eth.Hash) bool {
+	return len(log.Topics) > 0 && strings.EqualFold(log.Topics[0].String(), topic.String())
+}
+
+func decodeLogData(log *ethrpc.LogEntry, typeNames ...string) ([]interface{}, error) {
+	decoder := eth.NewDecoder(log.Data)
+
+	out := make([]interface{}, len(typeNames))
+	for i, typeName := range typeNames {
+		value, err := decoder.Read(typeName)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s at position %d: %w", typeName, i, err)
+		}
+		out[i] = value
+	}
+
+	return out, nil
+}
@@ -6,22 +6,19 @@ import (
 	"math/big"
 
 	"github.com/streamingfast/eth-go"
-	ethrpc "github.com/streamingfast/eth-go/rpc"
-	"github.com/streamingfast/eth-go/signer/native"
-	"go.uber.org/zap"
 )
 
-func ApproveCall(ctx context.Context, to string, from string, cli *ethrpc.Client, addr string, amt uint64, gasPrice int64) (string, error) {
+// ApproveCall approves spender to move amt GRT of from on the token at to.
+func ApproveCall(ctx context.Context, to eth.Address, from eth.Address, chain *Chain, spender eth.Address, amt uint64, gasPrice int64) (string, error) {
 	methodDef, err := eth.NewMethodDef("approve(address,uint256)")
 	if err != nil {
 		return "", err
 	}
 
-	address := eth.MustNewAddress(addr)
 	amount := ConvertToWei(amt)
 
 	methodCall := methodDef.NewCall()
-	methodCall.AppendArg(address)
+	methodCall.AppendArg(spender)
 	methodCall.AppendArg(amount)
 
 	data, err := methodCall.Encode()
@@ -29,21 +26,19 @@ func ApproveCall(ctx context.Context, to string, from string, cli *ethrpc.Client
 		return "", err
 	}
 
-	signer, err := native.NewPrivateKeySigner(zap.NewNop(), MustGetChainID(ctx, cli), MustGetPrivateKey(ctx))
+	signer, err := chain.Signer(ctx)
 	if err != nil {
-		return "", fmt.Errorf("unable to create signer: %w", err)
+		return "", err
 	}
 
-	var gasPriceBigInt *big.Int
-	if gasPrice == 0 {
-		gasPriceBigInt = MustGetGasPrice(ctx, cli)
-	} else {
-		gasPriceBigInt = big.NewInt(gasPrice)
+	gasPriceBigInt, nonce, err := chain.TransactionParams(ctx, from, gasPrice)
+	if err != nil {
+		return "", err
 	}
 
 	signedTx, err := signer.SignTransaction(
-		MustGetAccountNonce(ctx, eth.MustNewAddress(from), cli),
-		eth.MustNewAddress(to),
+		nonce,
+		to,
 		big.NewInt(0), //,
 		big.NewInt(7_000_000).Uint64(),
 		gasPriceBigInt,
@@ -53,14 +48,9 @@ func ApproveCall(ctx context.Context, to string, from string, cli *ethrpc.Client
 		return "", err
 	}
 
-	resp, err := cli.SendRaw(ctx, signedTx)
-	if err != nil {
-		return "", err
-	}
-
-	receipt, err := FetchReceiptWithProgress(ctx, cli, eth.MustNewHash(resp))
+	resp, receipt, err := chain.SendRaw(ctx, signedTx)
 	if err != nil {
-		return "", err
+		return resp, err
 	}
 
 	if receipt == nil {
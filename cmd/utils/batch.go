@@ -0,0 +1,412 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// batchUnsupported remembers the clients whose endpoint rejected a batch, so
+// that their next batches go straight to individual calls.
+var batchUnsupported sync.Map
+
+// Batch collects independent reads and sends them in a single JSON-RPC batch
+// request. When the endpoint does not support batching, the reads are sent
+// one by one. Each read decodes its result in its destination once Do
+// returns without error.
+type Batch struct {
+	cli   *ethrpc.Client
+	reads []*batchRead
+}
+
+type batchRead struct {
+	name   string
+	method string
+	params []interface{}
+	decode func(result string) error
+	err    error
+}
+
+func NewBatch(cli *ethrpc.Client) *Batch {
+	return &Batch{cli: cli}
+}
+
+func (b *Batch) Len() int {
+	return len(b.reads)
+}
+
+// Add queues a JSON-RPC request, decode receives its raw result.
+func (b *Batch) Add(method string, params []interface{}, decode func(result string) error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	b.reads = append(b.reads, &batchRead{name: method, method: method, params: params, decode: decode})
+}
+
+// Call queues a read-only call of signature against the contract at `to`,
+// decode receives the decoded return values.
+func (b *Batch) Call(to string, signature string, args []interface{}, decode func(out []interface{}) error) {
+	read := &batchRead{name: signature, method: "eth_call"}
+	b.reads = append(b.reads, read)
+
+	methodDef, err := eth.NewMethodDef(signature)
+	if err != nil {
+		read.err = err
+		return
+	}
+
+	data, err := methodDef.NewCall(args...).Encode()
+	if err != nil {
+		read.err = err
+		return
+	}
+
+	read.params = []interface{}{ethrpc.CallParams{To: eth.MustNewAddress(to), Data: data}, ethrpc.LatestBlock}
+	read.decode = func(result string) error {
+		out, err := methodDef.DecodeOutputFromString(result)
+		if err != nil {
+			return fmt.Errorf("decoding %s response %q: %w", methodDef.Name, result, err)
+		}
+		return decode(out)
+	}
+}
+
+// Do sends the queued reads and decodes their results. The errors of every
+// failed read are joined.
+func (b *Batch) Do(ctx context.Context) error {
+	var errs []error
+	var pending []*batchRead
+	for _, read := range b.reads {
+		if read.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", read.name, read.err))
+			continue
+		}
+		pending = append(pending, read)
+	}
+	b.reads = nil
+
+	if len(pending) == 0 {
+		return errors.Join(errs...)
+	}
+
+	if _, unsupported := batchUnsupported.Load(b.cli); unsupported || len(pending) == 1 {
+		return errors.Join(append(errs, b.doEach(ctx, pending)...)...)
+	}
+
+	reqs := make([]*ethrpc.RPCRequest, len(pending))
+	for i, read := range pending {
+		reqs[i] = &ethrpc.RPCRequest{Method: read.method, Params: read.params}
+	}
+
+	responses, err := b.cli.DoRequests(ctx, reqs)
+	if err != nil {
+		if ctx.Err() != nil || errorKind(err) != nil {
+			return errors.Join(append(errs, wrapChainError("batch request", err))...)
+		}
+
+		if logger, lerr := GetLogger(ctx); lerr == nil {
+			logger.Debug("rpc endpoint does not support batch requests, sending them individually", "endpoint", b.cli.String(), "err", err)
+		}
+		batchUnsupported.Store(b.cli, true)
+
+		return errors.Join(append(errs, b.doEach(ctx, pending)...)...)
+	}
+
+	// DoRequests numbers the requests from 1, responses may come in any order
+	byID := make(map[int]*ethrpc.RPCResponse, len(responses))
+	for _, response := range responses {
+		byID[response.ID] = response
+	}
+
+	for i, read := range pending {
+		response, found := byID[i+1]
+		if !found {
+			errs = append(errs, fmt.Errorf("%s: no response in batch", read.name))
+			continue
+		}
+		if err := read.finish(response.Content, response.Err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *Batch) doEach(ctx context.Context, reads []*batchRead) []error {
+	var errs []error
+	for _, read := range reads {
+		result, err := b.cli.DoRequest(ctx, read.method, read.params)
+		if err := read.finish(result, err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func (r *batchRead) finish(result string, err error) error {
+	if err != nil {
+		return wrapChainError(r.name, err)
+	}
+
+	if err := r.decode(result); err != nil {
+		return fmt.Errorf("%s: %w", r.name, err)
+	}
+
+	return nil
+}
+
+func (b *Batch) ChainID(dst *big.Int) {
+	b.Add("eth_chainId", nil, bigIntDecoder(dst))
+}
+
+// GasPrice reads the network gas price, without the bump of Chain.GasPrice.
+func (b *Batch) GasPrice(dst *big.Int) {
+	b.Add("eth_gasPrice", nil, bigIntDecoder(dst))
+}
+
+func (b *Batch) Nonce(account eth.Address, dst *uint64) {
+	b.Add("eth_getTransactionCount", []interface{}{account.Pretty(), ethrpc.LatestBlock}, func(result string) error {
+		nonce, err := strconv.ParseUint(result, 0, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse nonce %q: %w", result, err)
+		}
+		*dst = nonce
+		return nil
+	})
+}
+
+// Balance reads the ETH balance of account.
+func (b *Batch) Balance(account eth.Address, dst *big.Int) {
+	b.Add("eth_getBalance", []interface{}{account.Pretty(), ethrpc.LatestBlock}, bigIntDecoder(dst))
+}
+
+// TokenBalance reads the ERC20 balance of owner.
+func (b *Batch) TokenBalance(token string, owner eth.Address, dst *big.Int) {
+	b.Call(token, "balanceOf(address) (uint256)", []interface{}{owner}, func(out []interface{}) error {
+		dst.Set(out[0].(*big.Int))
+		return nil
+	})
+}
+
+// Allowance reads the ERC20 amount spender may transfer from owner.
+func (b *Batch) Allowance(token string, owner eth.Address, spender eth.Address, dst *big.Int) {
+	b.Call(token, "allowance(address,address) (uint256)", []interface{}{owner, spender}, func(out []interface{}) error {
+		dst.Set(out[0].(*big.Int))
+		return nil
+	})
+}
+
+func (b *Batch) IsCurated(deploymentID string, dst *bool) {
+	deployment, err := ConvertIPFSHashToByteString(deploymentID)
+	if err != nil {
+		b.reads = append(b.reads, &batchRead{name: "isCurated(bytes32)", err: err})
+		return
+	}
+
+	b.Call(L2CurationContractAddress, "isCurated(bytes32) (bool)", []interface{}{deployment}, func(out []interface{}) error {
+		*dst = out[0].(bool)
+		return nil
+	})
+}
+
+func (b *Batch) IsOperator(operator eth.Address, indexer eth.Address, dst *bool) {
+	b.Call(StakingContractAddress, "isOperator(address,address) (bool)", []interface{}{operator, indexer}, func(out []interface{}) error {
+		*dst = out[0].(bool)
+		return nil
+	})
+}
+
+func (b *Batch) Allocation(allocationID eth.Address, dst *Allocation) {
+	b.Call(StakingContractAddress, getAllocationSignature, []interface{}{allocationID}, func(out []interface{}) error {
+		*dst = *decodeAllocation(out)
+		return nil
+	})
+}
+
+func (b *Batch) AllocationState(allocationID eth.Address, dst *AllocationState) {
+	b.Call(StakingContractAddress, "getAllocationState(address) (uint8)", []interface{}{allocationID}, func(out []interface{}) error {
+		*dst = AllocationState(out[0].(uint8))
+		return nil
+	})
+}
+
+func (b *Batch) CurrentEpoch(dst *uint64) {
+	b.Call(EpochManagerContractAddress, "currentEpoch() (uint256)", nil, func(out []interface{}) error {
+		*dst = out[0].(*big.Int).Uint64()
+		return nil
+	})
+}
+
+// BlockNumber reads the latest block number.
+func (b *Batch) BlockNumber(dst *uint64) {
+	b.Add("eth_blockNumber", nil, func(result string) error {
+		number, err := strconv.ParseUint(result, 0, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse block number %q: %w", result, err)
+		}
+		*dst = number
+		return nil
+	})
+}
+
+func (b *Batch) EpochInfo(dst *EpochInfo) {
+	b.CurrentEpoch(&dst.CurrentEpoch)
+	b.Call(EpochManagerContractAddress, "epochLength() (uint256)", nil, func(out []interface{}) error {
+		dst.EpochLength = out[0].(*big.Int).Uint64()
+		return nil
+	})
+	b.Call(EpochManagerContractAddress, "currentEpochBlockSinceStart() (uint256)", nil, func(out []interface{}) error {
+		dst.BlocksSinceStart = out[0].(*big.Int).Uint64()
+		return nil
+	})
+}
+
+const delegationPoolsSignature = "delegationPools(address) (uint32,uint32,uint32,uint256,uint256,uint256)"
+
+func (b *Batch) IndexerStake(indexer eth.Address, dst *IndexerStake) {
+	dst.Indexer = indexer
+	b.Call(StakingContractAddress, "stakes(address) (uint256,uint256,uint256,uint256)", []interface{}{indexer}, func(out []interface{}) error {
+		dst.TokensStaked = out[0].(*big.Int)
+		dst.TokensAllocated = out[1].(*big.Int)
+		dst.TokensLocked = out[2].(*big.Int)
+		return nil
+	})
+	b.Call(StakingContractAddress, delegationPoolsSignature, []interface{}{indexer}, func(out []interface{}) error {
+		dst.DelegatedTokens = out[4].(*big.Int)
+		return nil
+	})
+	b.Call(StakingContractAddress, "delegationRatio() (uint32)", nil, func(out []interface{}) error {
+		dst.DelegationRatio = out[0].(uint32)
+		return nil
+	})
+}
+
+func (b *Batch) FeeParameters(indexer eth.Address, deploymentID string, dst *FeeParameters) {
+	b.Call(StakingContractAddress, "protocolPercentage() (uint32)", nil, func(out []interface{}) error {
+		dst.ProtocolPercentage = out[0].(uint32)
+		return nil
+	})
+	b.Call(StakingContractAddress, "curationPercentage() (uint32)", nil, func(out []interface{}) error {
+		dst.CurationPercentage = out[0].(uint32)
+		return nil
+	})
+	b.Call(StakingContractAddress, delegationPoolsSignature, []interface{}{indexer}, func(out []interface{}) error {
+		dst.QueryFeeCut = out[2].(uint32)
+		dst.HasDelegation = out[4].(*big.Int).Sign() > 0
+		return nil
+	})
+	b.IsCurated(deploymentID, &dst.Curated)
+}
+
+func (b *Batch) RewardsCheck(deploymentID string, dst *RewardsCheck) {
+	dst.DeploymentID = deploymentID
+	deployment, err := ConvertIPFSHashToByteString(deploymentID)
+	if err != nil {
+		b.reads = append(b.reads, &batchRead{name: "isDenied(bytes32)", err: err})
+		return
+	}
+
+	b.Call(RewardsManagerContractAddress, "isDenied(bytes32) (bool)", []interface{}{deployment}, func(out []interface{}) error {
+		dst.Denied = out[0].(bool)
+		return nil
+	})
+	b.Call(L2CurationContractAddress, "getCurationPoolTokens(bytes32) (uint256)", []interface{}{deployment}, func(out []interface{}) error {
+		dst.SignalTokens = out[0].(*big.Int)
+		return nil
+	})
+}
+
+// ProvisionCapacity reads the indexer provision to the profile
+// SubgraphService and the tokens it already allocated there.
+func (b *Batch) ProvisionCapacity(profile *NetworkProfile, indexer eth.Address, dst *ProvisionCapacity) {
+	dst.Indexer = indexer
+	dst.SubgraphService = eth.MustNewAddress(profile.SubgraphService)
+	b.Call(profile.HorizonStaking, "getProvision(address,address) (uint256,uint256,uint256,uint32,uint64,uint64)", []interface{}{indexer, dst.SubgraphService}, func(out []interface{}) error {
+		dst.Provision = &Provision{
+			Tokens:         out[0].(*big.Int),
+			TokensThawing:  out[1].(*big.Int),
+			SharesThawing:  out[2].(*big.Int),
+			MaxVerifierCut: out[3].(uint32),
+			ThawingPeriod:  out[4].(uint64),
+			CreatedAt:      out[5].(uint64),
+		}
+		return nil
+	})
+	b.Call(profile.SubgraphService, "allocationProvisionTracker(address) (uint256)", []interface{}{indexer}, func(out []interface{}) error {
+		dst.Allocated = out[0].(*big.Int)
+		return nil
+	})
+}
+
+func (b *Batch) IsProvisionOperator(profile *NetworkProfile, operator eth.Address, indexer eth.Address, dst *bool) {
+	b.Call(profile.HorizonStaking, "isAuthorized(address,address,address) (bool)", []interface{}{indexer, eth.MustNewAddress(profile.SubgraphService), operator}, func(out []interface{}) error {
+		*dst = out[0].(bool)
+		return nil
+	})
+}
+
+// FeeHistory is the `eth_feeHistory` answer, BaseFeePerGas has one more
+// entry than GasUsedRatio: the base fee of the next block.
+type FeeHistory struct {
+	OldestBlock   uint64
+	BaseFeePerGas []*big.Int
+	GasUsedRatio  []float64
+}
+
+// NextBaseFee is the base fee of the block after the newest one.
+func (h *FeeHistory) NextBaseFee() *big.Int {
+	if len(h.BaseFeePerGas) == 0 {
+		return nil
+	}
+
+	return h.BaseFeePerGas[len(h.BaseFeePerGas)-1]
+}
+
+// FeeHistory reads the base fees of the last blockCount blocks.
+func (b *Batch) FeeHistory(blockCount uint64, dst *FeeHistory) {
+	b.Add("eth_feeHistory", []interface{}{fmt.Sprintf("0x%x", blockCount), ethrpc.LatestBlock, []float64{}}, func(result string) error {
+		var raw struct {
+			OldestBlock   string    `json:"oldestBlock"`
+			BaseFeePerGas []string  `json:"baseFeePerGas"`
+			GasUsedRatio  []float64 `json:"gasUsedRatio"`
+		}
+		if err := json.Unmarshal([]byte(result), &raw); err != nil {
+			return fmt.Errorf("unable to decode fee history: %w", err)
+		}
+
+		oldestBlock, err := strconv.ParseUint(raw.OldestBlock, 0, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse oldest block %q: %w", raw.OldestBlock, err)
+		}
+
+		history := FeeHistory{OldestBlock: oldestBlock, GasUsedRatio: raw.GasUsedRatio}
+		for _, fee := range raw.BaseFeePerGas {
+			value, ok := new(big.Int).SetString(fee, 0)
+			if !ok {
+				return fmt.Errorf("unable to parse base fee %q", fee)
+			}
+			history.BaseFeePerGas = append(history.BaseFeePerGas, value)
+		}
+
+		*dst = history
+		return nil
+	})
+}
+
+func bigIntDecoder(dst *big.Int) func(result string) error {
+	return func(result string) error {
+		if _, ok := dst.SetString(result, 0); !ok {
+			return fmt.Errorf("unable to parse %q as a number", result)
+		}
+		return nil
+	}
+}
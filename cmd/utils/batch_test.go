@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// batchTestEndpoint answers single and batch JSON-RPC requests, each request
+// getting the "result" or "error" member returned by answer. Batch responses
+// come in reverse order.
+type batchTestEndpoint struct {
+	mu            sync.Mutex
+	rejectBatches bool
+	batches       int
+	singles       int
+	answer        func(method string) string
+}
+
+func (e *batchTestEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	requests, err := parseRPCRequests(body)
+	if err != nil || len(requests) == 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		e.batches++
+		if e.rejectBatches {
+			fmt.Fprint(w, rpcError(-32600, "batch requests are not supported"))
+			return
+		}
+
+		responses := make([]string, len(requests))
+		for i, request := range requests {
+			responses[len(requests)-1-i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,%s}`, request.ID, e.answer(request.Method))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(responses, ","))
+		return
+	}
+
+	e.singles++
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,%s}`, requests[0].ID, e.answer(requests[0].Method))
+}
+
+func newBatchTestClient(t *testing.T, endpoint *batchTestEndpoint) *ethrpc.Client {
+	t.Helper()
+
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+
+	return ethrpc.NewClient(server.URL)
+}
+
+// mixedAnswer answers the chain ID, block number and a uint256 eth_call.
+func mixedAnswer(method string) string {
+	switch method {
+	case "eth_chainId":
+		return `"result":"0xa4b1"`
+	case "eth_blockNumber":
+		return `"result":"0x10"`
+	case "eth_call":
+		return fmt.Sprintf(`"result":"0x%064x"`, 42)
+	}
+	return `"error":{"code":-32601,"message":"method not found"}`
+}
+
+func TestBatchMixedReads(t *testing.T) {
+	endpoint := &batchTestEndpoint{answer: mixedAnswer}
+	batch := NewBatch(newBatchTestClient(t, endpoint))
+
+	chainID := new(big.Int)
+	batch.ChainID(chainID)
+	var blockNumber uint64
+	batch.BlockNumber(&blockNumber)
+	var epoch uint64
+	batch.CurrentEpoch(&epoch)
+
+	if err := batch.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if chainID.Int64() != 42161 || blockNumber != 16 || epoch != 42 {
+		t.Errorf("chain ID %s, block %d, epoch %d, want 42161, 16 and 42", chainID, blockNumber, epoch)
+	}
+	if endpoint.batches != 1 || endpoint.singles != 0 {
+		t.Errorf("%d batch and %d single requests, want the reads in one batch", endpoint.batches, endpoint.singles)
+	}
+}
+
+func TestBatchElementErrors(t *testing.T) {
+	endpoint := &batchTestEndpoint{answer: func(method string) string {
+		if method == "eth_blockNumber" {
+			return `"error":{"code":-32000,"message":"header not found"}`
+		}
+		return mixedAnswer(method)
+	}}
+	batch := NewBatch(newBatchTestClient(t, endpoint))
+
+	chainID := new(big.Int)
+	batch.ChainID(chainID)
+	var blockNumber uint64
+	batch.BlockNumber(&blockNumber)
+	var isCurated bool
+	batch.IsCurated("not a deployment", &isCurated)
+
+	err := batch.Do(context.Background())
+	if err == nil {
+		t.Fatal("no error, want the failed reads")
+	}
+	for _, want := range []string{"eth_blockNumber", "header not found", "isCurated(bytes32)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	if chainID.Int64() != 42161 {
+		t.Errorf("chain ID %s, want the successful read decoded despite the others failing", chainID)
+	}
+	if endpoint.batches != 1 {
+		t.Errorf("%d batch requests, want 1 since the malformed read is never sent", endpoint.batches)
+	}
+}
+
+func TestBatchFallsBackToSingleRequests(t *testing.T) {
+	endpoint := &batchTestEndpoint{rejectBatches: true, answer: mixedAnswer}
+	cli := newBatchTestClient(t, endpoint)
+
+	for i := 0; i < 2; i++ {
+		batch := NewBatch(cli)
+		chainID := new(big.Int)
+		batch.ChainID(chainID)
+		var epoch uint64
+		batch.CurrentEpoch(&epoch)
+
+		if err := batch.Do(context.Background()); err != nil {
+			t.Fatalf("batch %d: %s", i, err)
+		}
+		if chainID.Int64() != 42161 || epoch != 42 {
+			t.Errorf("batch %d: chain ID %s and epoch %d, want 42161 and 42", i, chainID, epoch)
+		}
+	}
+
+	// the rejection is remembered, the second batch goes straight to
+	// single requests
+	if endpoint.batches != 1 || endpoint.singles != 4 {
+		t.Errorf("%d batch and %d single requests, want 1 rejected batch then 4 single requests", endpoint.batches, endpoint.singles)
+	}
+}
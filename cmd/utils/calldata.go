@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/streamingfast/eth-go"
+)
+
+// EncodeAllocateFromCall is the call data of Staking `allocateFrom(indexer,
+// deploymentID, tokens, allocationID, metadata, proof)`.
+func EncodeAllocateFromCall(indexer eth.Address, deploymentID []byte, tokens *big.Int, allocationID eth.Address, metadata []byte, proof []byte) ([]byte, error) {
+	return encodeCall("allocateFrom(address,bytes32,uint256,address,bytes32,bytes)", indexer, deploymentID, tokens, allocationID, metadata, proof)
+}
+
+// EncodeCloseAllocationCall is the call data of Staking
+// `closeAllocation(allocationID, poi)` with an empty POI, there is nothing
+// indexed to prove.
+func EncodeCloseAllocationCall(allocationID eth.Address) ([]byte, error) {
+	return encodeCall("closeAllocation(address,bytes32)", allocationID, make([]byte, 32))
+}
+
+// EncodeCollectCall is the call data of Staking `collect(tokens,
+// allocationID)`.
+func EncodeCollectCall(tokens *big.Int, allocationID eth.Address) ([]byte, error) {
+	return encodeCall("collect(uint256,address)", tokens, allocationID)
+}
+
+// encodeCall is the call data of signature, selector included. The values
+// are checked against their types first: eth-go truncates a bytes32 longer
+// than 32 bytes and panics on an address or uint256 that does not fit in
+// 32.
+func encodeCall(signature string, values ...interface{}) ([]byte, error) {
+	methodDef, err := eth.NewMethodDef(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != len(methodDef.Parameters) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", methodDef.Name, len(methodDef.Parameters), len(values))
+	}
+	for i, parameter := range methodDef.Parameters {
+		if err := checkABIValue(parameter.TypeName, values[i]); err != nil {
+			return nil, fmt.Errorf("%s argument %d: %w", methodDef.Name, i, err)
+		}
+	}
+
+	data, err := methodDef.NewCall(values...).Encode()
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", methodDef.Name, err)
+	}
+
+	return data, nil
+}
+
+// abiEncode is the Solidity abi.encode of values of the comma-separated
+// types, the encoding of a call without its selector.
+func abiEncode(types string, values ...interface{}) ([]byte, error) {
+	data, err := encodeCall(fmt.Sprintf("encode(%s)", types), values...)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[4:], nil
+}
+
+func checkABIValue(typeName string, value interface{}) error {
+	switch typeName {
+	case "address":
+		if address, ok := value.(eth.Address); ok && len(address) != 20 {
+			return fmt.Errorf("address is %d bytes, want 20", len(address))
+		}
+	case "bytes32":
+		if data, ok := value.([]byte); ok && len(data) != 32 {
+			return fmt.Errorf("bytes32 is %d bytes, want 32", len(data))
+		}
+	case "uint256":
+		if number, ok := value.(*big.Int); ok && (number == nil || number.Sign() < 0 || number.BitLen() > 256) {
+			return fmt.Errorf("%v does not fit in a uint256", number)
+		}
+	}
+
+	return nil
+}
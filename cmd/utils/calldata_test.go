@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/streamingfast/eth-go"
+)
+
+// unpackCall decodes the arguments of data with go-ethereum, apart from the
+// eth-go encoder under test. An empty signature is abi.encode, without a
+// selector.
+func unpackCall(t *testing.T, signature string, types []string, data []byte) []interface{} {
+	t.Helper()
+
+	if signature != "" {
+		if len(data) < 4 || !bytes.Equal(data[:4], crypto.Keccak256([]byte(signature))[:4]) {
+			t.Fatalf("call data %x does not start with the %s selector", data, signature)
+		}
+		data = data[4:]
+	}
+
+	var arguments abi.Arguments
+	for _, typeName := range types {
+		typ, err := abi.NewType(typeName, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arguments = append(arguments, abi.Argument{Type: typ})
+	}
+
+	values, err := arguments.Unpack(data)
+	if err != nil {
+		t.Fatalf("decoding %x: %s", data, err)
+	}
+
+	return values
+}
+
+// fuzzUint256 is the signed integer of magnitude and sign, which is a
+// uint256 only when non-negative and at most 32 bytes.
+func fuzzUint256(magnitude []byte, negative bool) (*big.Int, bool) {
+	number := new(big.Int).SetBytes(magnitude)
+	if negative {
+		number.Neg(number)
+	}
+
+	return number, number.Sign() >= 0 && number.BitLen() <= 256
+}
+
+func checkAddress(t *testing.T, name string, got interface{}, want []byte) {
+	t.Helper()
+
+	if address := got.(common.Address); !bytes.Equal(address.Bytes(), want) {
+		t.Fatalf("%s decoded to %s, want %x", name, address.Hex(), want)
+	}
+}
+
+func checkBytes32(t *testing.T, name string, got interface{}, want []byte) {
+	t.Helper()
+
+	if data := got.([32]byte); !bytes.Equal(data[:], want) {
+		t.Fatalf("%s decoded to %x, want %x", name, data, want)
+	}
+}
+
+func checkUint256(t *testing.T, name string, got interface{}, want *big.Int) {
+	t.Helper()
+
+	if number := got.(*big.Int); number.Cmp(want) != 0 {
+		t.Fatalf("%s decoded to %s, want %s", name, number, want)
+	}
+}
+
+func FuzzEncodeAllocateFromCall(f *testing.F) {
+	f.Add(make([]byte, 20), make([]byte, 32), []byte{0x01}, false, make([]byte, 20), make([]byte, 32), make([]byte, 65))
+	f.Add(make([]byte, 20), make([]byte, 34), []byte{0x01}, false, make([]byte, 20), make([]byte, 32), []byte{})
+	f.Add(make([]byte, 33), make([]byte, 32), bytes.Repeat([]byte{0xff}, 33), true, make([]byte, 21), make([]byte, 31), []byte{})
+
+	f.Fuzz(func(t *testing.T, indexer []byte, deploymentID []byte, magnitude []byte, negative bool, allocationID []byte, metadata []byte, proof []byte) {
+		tokens, validTokens := fuzzUint256(magnitude, negative)
+		valid := validTokens && len(indexer) == 20 && len(deploymentID) == 32 && len(allocationID) == 20 && len(metadata) == 32
+
+		data, err := EncodeAllocateFromCall(indexer, deploymentID, tokens, allocationID, metadata, proof)
+		if !valid {
+			if err == nil {
+				t.Fatalf("invalid arguments encoded to %x", data)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := unpackCall(t, "allocateFrom(address,bytes32,uint256,address,bytes32,bytes)", []string{"address", "bytes32", "uint256", "address", "bytes32", "bytes"}, data)
+		checkAddress(t, "indexer", values[0], indexer)
+		checkBytes32(t, "deployment ID", values[1], deploymentID)
+		checkUint256(t, "tokens", values[2], tokens)
+		checkAddress(t, "allocation ID", values[3], allocationID)
+		checkBytes32(t, "metadata", values[4], metadata)
+		if got := values[5].([]byte); !bytes.Equal(got, proof) {
+			t.Fatalf("proof decoded to %x, want %x", got, proof)
+		}
+	})
+}
+
+func FuzzEncodeCollectCall(f *testing.F) {
+	f.Add([]byte{0x01}, false, make([]byte, 20))
+	f.Add(bytes.Repeat([]byte{0xff}, 32), false, make([]byte, 20))
+	f.Add(bytes.Repeat([]byte{0xff}, 33), false, make([]byte, 20))
+	f.Add([]byte{0x01}, true, make([]byte, 33))
+
+	f.Fuzz(func(t *testing.T, magnitude []byte, negative bool, allocationID []byte) {
+		tokens, validTokens := fuzzUint256(magnitude, negative)
+		valid := validTokens && len(allocationID) == 20
+
+		data, err := EncodeCollectCall(tokens, allocationID)
+		if !valid {
+			if err == nil {
+				t.Fatalf("invalid arguments encoded to %x", data)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := unpackCall(t, "collect(uint256,address)", []string{"uint256", "address"}, data)
+		checkUint256(t, "tokens", values[0], tokens)
+		checkAddress(t, "allocation ID", values[1], allocationID)
+	})
+}
+
+func FuzzEncodeCloseAllocationCall(f *testing.F) {
+	f.Add(make([]byte, 20))
+	f.Add(make([]byte, 19))
+	f.Add(make([]byte, 40))
+
+	f.Fuzz(func(t *testing.T, allocationID []byte) {
+		data, err := EncodeCloseAllocationCall(allocationID)
+		if len(allocationID) != 20 {
+			if err == nil {
+				t.Fatalf("%d bytes allocation ID encoded to %x", len(allocationID), data)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := unpackCall(t, "closeAllocation(address,bytes32)", []string{"address", "bytes32"}, data)
+		checkAddress(t, "allocation ID", values[0], allocationID)
+		checkBytes32(t, "poi", values[1], make([]byte, 32))
+	})
+}
+
+func FuzzEncodeStartServiceData(f *testing.F) {
+	f.Add(make([]byte, 32), []byte{0x01}, false, make([]byte, 20), make([]byte, 65))
+	f.Add(make([]byte, 34), []byte{0x01}, false, make([]byte, 20), []byte{})
+	f.Add(make([]byte, 32), bytes.Repeat([]byte{0xff}, 40), false, make([]byte, 64), []byte{})
+
+	f.Fuzz(func(t *testing.T, deploymentID []byte, magnitude []byte, negative bool, allocationID []byte, proof []byte) {
+		tokens, validTokens := fuzzUint256(magnitude, negative)
+		valid := validTokens && len(deploymentID) == 32 && len(allocationID) == 20
+
+		data, err := EncodeStartServiceData(deploymentID, tokens, eth.Address(allocationID), proof)
+		if !valid {
+			if err == nil {
+				t.Fatalf("invalid arguments encoded to %x", data)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := unpackCall(t, "", []string{"bytes32", "uint256", "address", "bytes"}, data)
+		checkBytes32(t, "deployment ID", values[0], deploymentID)
+		checkUint256(t, "tokens", values[1], tokens)
+		checkAddress(t, "allocation ID", values[2], allocationID)
+		if got := values[3].([]byte); !bytes.Equal(got, proof) {
+			t.Fatalf("proof decoded to %x, want %x", got, proof)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+	"github.com/streamingfast/eth-go/signer/native"
+	"go.uber.org/zap"
+)
+
+// ArbitrumOneChainID is the chain the contract addresses are deployed on.
+const ArbitrumOneChainID = 42161
+
+// gasPriceBump is added to the network gas price so that transactions are not
+// stuck when the base fee goes up.
+var gasPriceBump = big.NewInt(300000)
+
+// Chain answers the chain queries needed to sign and send transactions. The
+// chain ID is fetched once and checked against the expected one, every error
+// is categorized, see ErrNetwork, ErrRateLimited and ErrChainMismatch.
+type Chain struct {
+	cli             *ethrpc.Client
+	expectedChainID *big.Int
+
+	mu      sync.Mutex
+	chainID *big.Int
+}
+
+// NewChain returns a Chain on cli expecting the chain ID expectedChainID, 0
+// accepts any chain.
+func NewChain(cli *ethrpc.Client, expectedChainID uint64) *Chain {
+	chain := &Chain{cli: cli}
+	if expectedChainID != 0 {
+		chain.expectedChainID = new(big.Int).SetUint64(expectedChainID)
+	}
+
+	return chain
+}
+
+func (c *Chain) Client() *ethrpc.Client {
+	return c.cli
+}
+
+func (c *Chain) ChainID(ctx context.Context) (*big.Int, error) {
+	c.mu.Lock()
+	chainID := c.chainID
+	c.mu.Unlock()
+
+	if chainID != nil {
+		return chainID, nil
+	}
+
+	chainID, err := c.cli.ChainID(ctx)
+	if err != nil {
+		return nil, wrapChainError("unable to retrieve chain id", err)
+	}
+
+	if err := c.setChainID(chainID); err != nil {
+		return nil, err
+	}
+
+	return chainID, nil
+}
+
+// AddChainID queues the chain ID read in b, so that the chain check of a
+// command is part of its preflight batch. b.Do fails on a chain mismatch.
+func (c *Chain) AddChainID(b *Batch) {
+	chainID := new(big.Int)
+	b.Add("eth_chainId", nil, func(result string) error {
+		if err := bigIntDecoder(chainID)(result); err != nil {
+			return err
+		}
+		return c.setChainID(chainID)
+	})
+}
+
+func (c *Chain) setChainID(chainID *big.Int) error {
+	if c.expectedChainID != nil && chainID.Cmp(c.expectedChainID) != 0 {
+		return &ChainMismatchError{Expected: c.expectedChainID, Actual: chainID}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.chainID = chainID
+	return nil
+}
+
+// GasPrice is the network gas price, +300000.
+func (c *Chain) GasPrice(ctx context.Context) (*big.Int, error) {
+	gasPrice, err := c.cli.GasPrice(ctx)
+	if err != nil {
+		return nil, wrapChainError("unable to retrieve gas price", err)
+	}
+
+	return new(big.Int).Add(gasPrice, gasPriceBump), nil
+}
+
+// TransactionParams fetches the gas price, unless gasPrice is set, and the
+// nonce of from in a single batch.
+func (c *Chain) TransactionParams(ctx context.Context, from eth.Address, gasPrice int64) (*big.Int, uint64, error) {
+	batch := NewBatch(c.cli)
+
+	price := big.NewInt(gasPrice)
+	if gasPrice == 0 {
+		batch.GasPrice(price)
+	}
+
+	var nonce uint64
+	batch.Nonce(from, &nonce)
+
+	if err := batch.Do(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	if gasPrice == 0 {
+		price.Add(price, gasPriceBump)
+	}
+
+	return price, nonce, nil
+}
+
+func (c *Chain) Nonce(ctx context.Context, account eth.Address) (uint64, error) {
+	nonce, err := c.cli.Nonce(ctx, account, ethrpc.LatestBlock)
+	if err != nil {
+		return 0, wrapChainError(fmt.Sprintf("unable to retrieve nonce for account %q", account), err)
+	}
+
+	return nonce, nil
+}
+
+// Signer signs with the private key of the context for this chain.
+func (c *Chain) Signer(ctx context.Context) (*native.PrivateKeySigner, error) {
+	privateKey, err := GetPrivateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := c.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := native.NewPrivateKeySigner(zap.NewNop(), chainID, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create signer: %w", err)
+	}
+
+	return signer, nil
+}
+
+// SendRaw broadcasts a signed transaction and waits for its receipt. A
+// transaction that reverted is a *RevertedError, one that is not mined in
+// time a *ReceiptNotFoundError, its hash is still returned so that it can be
+// recorded.
+func (c *Chain) SendRaw(ctx context.Context, signedTx []byte) (string, *ethrpc.TransactionReceipt, error) {
+	trx, err := c.cli.SendRaw(ctx, signedTx)
+	if err != nil {
+		return "", nil, wrapChainError("unable to send transaction", err)
+	}
+
+	hash, err := eth.NewHash(trx)
+	if err != nil {
+		return trx, nil, fmt.Errorf("invalid transaction hash %q returned by rpc endpoint: %w", trx, err)
+	}
+
+	receipt, err := FetchReceiptWithProgress(ctx, c.cli, hash)
+	if err != nil {
+		if errors.Is(err, ErrReceiptNotFound) {
+			return trx, nil, err
+		}
+		return trx, nil, wrapChainError(fmt.Sprintf("unable to fetch receipt of %s", trx), err)
+	}
+
+	if receipt.Status == nil || *receipt.Status != 1 {
+		return trx, receipt, &RevertedError{Trx: trx, BlockNumber: uint64(receipt.BlockNumber)}
+	}
+
+	return trx, receipt, nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+const testTrx = "0x1111111111111111111111111111111111111111111111111111111111111111"
+
+// pendingEndpoint accepts transactions that are never mined.
+func pendingEndpoint(t *testing.T) *ethrpc.Client {
+	t.Helper()
+
+	endpoint := &rpcTestEndpoint{handle: func(method string, _ int) (int, string) {
+		if method == "eth_sendRawTransaction" {
+			return http.StatusOK, rpcResult(`"` + testTrx + `"`)
+		}
+		return http.StatusOK, rpcResult("null")
+	}}
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+
+	return ethrpc.NewClient(server.URL)
+}
+
+func TestFetchReceiptTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { receiptWaitTimeout = timeout }(receiptWaitTimeout)
+	receiptWaitTimeout = 100 * time.Millisecond
+
+	trx, receipt, err := NewChain(pendingEndpoint(t), 0).SendRaw(context.Background(), []byte{0x01})
+	if receipt != nil {
+		t.Fatalf("receipt %+v of a transaction that was never mined", receipt)
+	}
+
+	var notFound *ReceiptNotFoundError
+	if !errors.As(err, &notFound) || notFound.Trx != testTrx {
+		t.Fatalf("error %v, want a receipt not found error for %s", err, testTrx)
+	}
+	if trx != testTrx {
+		t.Errorf("returned trx %q, want %s so that it can be recorded", trx, testTrx)
+	}
+	if code := ExitCode(err); code != ExitCodeReceiptNotFound {
+		t.Errorf("exit code %d, want %d", code, ExitCodeReceiptNotFound)
+	}
+}
+
+func TestFetchReceiptCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := FetchReceiptWithProgress(ctx, pendingEndpoint(t), eth.MustNewHash(testTrx))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want the context cancellation", err)
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("returned %s after the cancellation, want right away", waited)
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Confirm asks a yes/no question on the terminal. When stdin is not a
+// terminal (scripts, pipes), there is nobody to ask and it is a UsageError:
+// scripts must pass --yes.
+func Confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, Usagef("cannot ask %q, stdin is not a terminal. pass --yes to proceed without confirmation", question)
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, nil
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -26,16 +26,6 @@ func GetPrivateKey(ctx context.Context) (*eth.PrivateKey, error) {
 	return privateKey, nil
 }
 
-func MustGetPrivateKey(ctx context.Context) *eth.PrivateKey {
-	privateKey, err := GetPrivateKey(ctx)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return privateKey
-}
-
 type loggerContextKeyType string
 
 const loggerContextKey = loggerContextKeyType("logger")
@@ -53,13 +43,3 @@ func GetLogger(ctx context.Context) (*slog.Logger, error) {
 
 	return logger, nil
 }
-
-func MustGetLogger(ctx context.Context) *slog.Logger {
-	logger, err := GetLogger(ctx)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return logger
-}
@@ -1,5 +1,44 @@
 package utils
 
+import (
+	"context"
+	"fmt"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
 const GRTTokenContractAddress = "0x9623063377ad1b27544c965ccd7342f7ea7e88c7"
 const StakingContractAddress = "0x00669a4cf01450b64e8a2a20e9b1fcb71e61ef03"
 const L2CurationContractAddress = "0x22d78fb4bc72e191C765807f8891B5e1785C8014"
+const EpochManagerContractAddress = "0x5A843145c43d328B9bB7a4401d94918f131bB281"
+const RewardsManagerContractAddress = "0x971B9d3d0Ae3ECa029CAB5eA1fB0F72c85e6a525"
+
+// contractCall performs a read-only call of signature against the contract at
+// `to` and decodes its return values.
+func contractCall(ctx context.Context, cli *ethrpc.Client, to string, signature string, args ...interface{}) ([]interface{}, error) {
+	methodDef, err := eth.NewMethodDef(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := methodDef.NewCall(args...).Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cli.Call(ctx, ethrpc.CallParams{
+		To:   eth.MustNewAddress(to),
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := methodDef.DecodeOutputFromString(resp)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s response %q: %w", methodDef.Name, resp, err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DefaultDataDir is where local state (tracked allocations, ledger, caches)
+// is kept when no explicit path is given. It can be overridden with the
+// NETWORK_PAYMENT_DATA_DIR env var.
+func DefaultDataDir() string {
+	if dir := os.Getenv("NETWORK_PAYMENT_DATA_DIR"); dir != "" {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".network-payments"
+	}
+
+	return filepath.Join(home, ".network-payments")
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// over path, creating the parent directory if needed.
+func WriteFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
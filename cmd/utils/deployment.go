@@ -7,27 +7,137 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
 
 	"github.com/google/uuid"
 )
 
-func GenerateDeployment() (string, error) {
-	uniqueId, err := uuid.NewUUID()
-	if err != nil {
-		panic(err)
-	}
-	template := fmt.Sprintf(`specVersion: 0.0.5
+// DefaultManifestTemplate is the manifest uploaded for payment deployments.
+// Without any customer field set it renders the historical manifest.
+const DefaultManifestTemplate = `specVersion: 0.0.5
 description: "thegraph.market Payment Gateway usage"
 usage:
-  uid: %s
-`, uniqueId.String())
+  uid: {{ .UID }}
+{{- with .CustomerID }}
+  customerId: {{ printf "%q" . }}
+{{- end }}
+{{- with .InvoiceReference }}
+  invoiceReference: {{ printf "%q" . }}
+{{- end }}
+{{- with .BillingPeriod }}
+  billingPeriod: {{ printf "%q" . }}
+{{- end }}
+{{- with .PayerAddress }}
+  payer: {{ printf "%q" . }}
+{{- end }}
+`
+
+// manifestUIDNamespace namespaces the name-based UIDs of deterministic
+// manifests, changing it changes every deterministic deployment hash.
+var manifestUIDNamespace = uuid.MustParse("4f0d6b8e-3c1a-4e55-9a57-2b8f6d1c7e90")
+
+// ManifestParams are the values available to a manifest template.
+type ManifestParams struct {
+	UID              string
+	CustomerID       string
+	InvoiceReference string
+	BillingPeriod    string
+	PayerAddress     string
+}
+
+// ManifestOptions describe how the manifest of a payment deployment is
+// built. An empty TemplateFile uses DefaultManifestTemplate. When
+// Deterministic is set, the UID is derived from the customer fields so that
+// the same invoice always maps to the same deployment.
+type ManifestOptions struct {
+	TemplateFile  string
+	Deterministic bool
+	Params        ManifestParams
+}
+
+// DeterministicUID derives a UUIDv5 from the customer fields of p.
+func (p ManifestParams) DeterministicUID() (string, error) {
+	if p.CustomerID == "" && p.InvoiceReference == "" {
+		return "", fmt.Errorf("a deterministic manifest requires at least a customer ID or an invoice reference")
+	}
 
-	hash, err := uploadFile([]byte(template))
+	name := strings.Join([]string{p.CustomerID, p.InvoiceReference, p.BillingPeriod, strings.ToLower(p.PayerAddress)}, "\n")
+	return uuid.NewSHA1(manifestUIDNamespace, []byte(name)).String(), nil
+}
+
+// RenderManifest renders the manifest for opts, filling in the UID.
+func RenderManifest(opts ManifestOptions) ([]byte, error) {
+	templateText := DefaultManifestTemplate
+	if opts.TemplateFile != "" {
+		content, err := os.ReadFile(opts.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest template: %w", err)
+		}
+		templateText = string(content)
+	}
+
+	tmpl, err := template.New("manifest").Option("missingkey=error").Parse(templateText)
 	if err != nil {
-		return "", fmt.Errorf("error uploading file: %w", err)
+		return nil, fmt.Errorf("parsing manifest template: %w", err)
+	}
+
+	params := opts.Params
+	if opts.Deterministic {
+		params.UID, err = params.DeterministicUID()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		params.UID, err = fixtureRandom("manifest-uid", func() (string, error) {
+			uniqueId, err := uuid.NewUUID()
+			return uniqueId.String(), err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("generating uid: %w", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, params); err != nil {
+		return nil, fmt.Errorf("rendering manifest template: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// GenerateManifestDeployment renders the manifest for opts, uploads it and
+// returns the deployment ID along with the uploaded manifest.
+func GenerateManifestDeployment(opts ManifestOptions) (string, []byte, error) {
+	manifest, err := RenderManifest(opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	hash, err := uploadFile(manifest)
+	if err != nil {
+		return "", nil, fmt.Errorf("error uploading file: %w", err)
+	}
+
+	return hash, manifest, nil
+}
+
+func GenerateDeployment() (string, error) {
+	hash, _, err := GenerateManifestDeployment(ManifestOptions{})
+	return hash, err
+}
+
+// WriteManifest saves the manifest of deploymentID as <dir>/<deploymentID>.yaml
+// for auditing and returns the written path.
+func WriteManifest(dir string, deploymentID string, manifest []byte) (string, error) {
+	path := filepath.Join(dir, deploymentID+".yaml")
+	if err := WriteFileAtomic(path, manifest); err != nil {
+		return "", fmt.Errorf("writing manifest: %w", err)
 	}
 
-	return hash, nil
+	return path, nil
 }
 
 // uploadFile uploads a file using its byte contents and returns only the IPFS Hash.
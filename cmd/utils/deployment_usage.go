@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// filteredScanChunkSize is large on purpose: filtered on the deployment
+// topic, a scan matches a handful of logs and ScanLogs shrinks the range
+// when the endpoint refuses it.
+const filteredScanChunkSize = 5_000_000
+
+// DeploymentUsage lists every allocation ever opened on a deployment.
+type DeploymentUsage struct {
+	DeploymentID string
+	Allocations  []*AllocationSummary
+}
+
+// Warnings reports what makes the deployment unfit as a payment deployment
+// for indexer: allocations from other indexers, or more than one active
+// allocation of indexer once opening (when true) a new one is accounted for.
+func (u *DeploymentUsage) Warnings(indexer string, opening bool) []string {
+	var warnings []string
+	var active []string
+	for _, allocation := range u.Allocations {
+		if !strings.EqualFold(allocation.Indexer, indexer) {
+			warnings = append(warnings, fmt.Sprintf("deployment %s has an allocation %s from another indexer %s (open=%t)", u.DeploymentID, allocation.AllocationID, allocation.Indexer, allocation.IsOpen()))
+			continue
+		}
+		if allocation.IsOpen() {
+			active = append(active, allocation.AllocationID)
+		}
+	}
+
+	switch {
+	case opening && len(active) > 0:
+		warnings = append(warnings, fmt.Sprintf("indexer %s already has %d active allocation(s) on deployment %s (%s), opening another one makes it ambiguous which allocation a payment is for", indexer, len(active), u.DeploymentID, strings.Join(active, ", ")))
+	case !opening && len(active) > 1:
+		warnings = append(warnings, fmt.Sprintf("indexer %s has %d active allocations on deployment %s (%s)", indexer, len(active), u.DeploymentID, strings.Join(active, ", ")))
+	}
+
+	return warnings
+}
+
+// GetDeploymentUsage finds the allocations of a deployment, from the network
+// subgraph when subgraphURL is set, from the Staking AllocationCreated and
+// AllocationClosed logs up to toBlock otherwise. Callers read toBlock in
+// their preflight Batch.
+func GetDeploymentUsage(ctx context.Context, cli *ethrpc.Client, subgraphURL string, deploymentID string, toBlock uint64) (*DeploymentUsage, error) {
+	deployment, err := ConvertIPFSHashToByteString(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &DeploymentUsage{DeploymentID: deploymentID}
+	if subgraphURL != "" {
+		usage.Allocations, err = querySubgraphDeploymentAllocations(ctx, subgraphURL, deploymentID, deployment)
+		if err != nil {
+			return nil, fmt.Errorf("querying network subgraph: %w", err)
+		}
+		return usage, nil
+	}
+
+	allocations := AllocationSet{}
+	err = ScanAllocationEvents(ctx, cli, AllocationEventFilter{DeploymentID: deployment}, StakingDeploymentBlock, toBlock, filteredScanChunkSize, func(created []*AllocationCreatedEvent, closed []*AllocationClosedEvent, _ uint64) error {
+		allocations.Apply(created, closed)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning allocation events: %w", err)
+	}
+	usage.Allocations = allocations.Sorted()
+
+	return usage, nil
+}
+
+const deploymentAllocationsQuery = `query($deployment: String!) {
+  allocations(first: 1000, where: { subgraphDeployment: $deployment }, orderBy: createdAtBlockNumber) {
+    id
+    indexer { id }
+    allocatedTokens
+    createdAtEpoch
+    createdAtBlockNumber
+    closedAtEpoch
+    closedAtBlockNumber
+  }
+}`
+
+func querySubgraphDeploymentAllocations(ctx context.Context, subgraphURL string, deploymentID string, deployment []byte) ([]*AllocationSummary, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     deploymentAllocationsQuery,
+		"variables": map[string]string{"deployment": "0x" + hex.EncodeToString(deployment)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subgraphURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, string(payload))
+	}
+
+	var result struct {
+		Data struct {
+			Allocations []struct {
+				ID      string `json:"id"`
+				Indexer struct {
+					ID string `json:"id"`
+				} `json:"indexer"`
+				AllocatedTokens      string `json:"allocatedTokens"`
+				CreatedAtEpoch       int64  `json:"createdAtEpoch"`
+				CreatedAtBlockNumber int64  `json:"createdAtBlockNumber"`
+				ClosedAtEpoch        int64  `json:"closedAtEpoch"`
+				ClosedAtBlockNumber  *int64 `json:"closedAtBlockNumber"`
+			} `json:"allocations"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("subgraph error: %s", result.Errors[0].Message)
+	}
+
+	out := make([]*AllocationSummary, 0, len(result.Data.Allocations))
+	for _, allocation := range result.Data.Allocations {
+		summary := &AllocationSummary{
+			AllocationID:   allocation.ID,
+			Indexer:        allocation.Indexer.ID,
+			DeploymentID:   deploymentID,
+			Tokens:         allocation.AllocatedTokens,
+			CreatedAtEpoch: uint64(allocation.CreatedAtEpoch),
+			CreatedAtBlock: uint64(allocation.CreatedAtBlockNumber),
+		}
+		if allocation.ClosedAtBlockNumber != nil && *allocation.ClosedAtBlockNumber > 0 {
+			summary.ClosedAtEpoch = uint64(allocation.ClosedAtEpoch)
+			summary.ClosedAtBlock = uint64(*allocation.ClosedAtBlockNumber)
+		}
+		out = append(out, summary)
+	}
+
+	return out, nil
+}
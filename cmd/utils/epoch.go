@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// EpochManagerBlockTime is the average time between the blocks the
+// EpochManager counts epochs in. On Arbitrum these are L1 blocks.
+const EpochManagerBlockTime = 12 * time.Second
+
+type EpochInfo struct {
+	CurrentEpoch     uint64
+	EpochLength      uint64
+	BlocksSinceStart uint64
+}
+
+// BlocksUntilNextEpoch is the number of blocks left before the epoch advances.
+func (e *EpochInfo) BlocksUntilNextEpoch() uint64 {
+	if e.BlocksSinceStart >= e.EpochLength {
+		return 0
+	}
+
+	return e.EpochLength - e.BlocksSinceStart
+}
+
+// NextEpochETA is an estimate of the time left before the epoch advances.
+func (e *EpochInfo) NextEpochETA() time.Duration {
+	return time.Duration(e.BlocksUntilNextEpoch()) * EpochManagerBlockTime
+}
+
+func GetEpochInfoCall(ctx context.Context, cli *ethrpc.Client) (*EpochInfo, error) {
+	epoch := &EpochInfo{}
+	batch := NewBatch(cli)
+	batch.EpochInfo(epoch)
+	if err := batch.Do(ctx); err != nil {
+		return nil, fmt.Errorf("fetching epoch info: %w", err)
+	}
+
+	return epoch, nil
+}
+
+// CheckCanCloseAllocation returns an error giving the ETA of the next epoch
+// when the allocation was created in the current epoch, since the Staking
+// contract rejects closing an allocation in the epoch it was opened.
+func CheckCanCloseAllocation(epoch *EpochInfo, allocation *Allocation) error {
+	createdAtEpoch := allocation.CreatedAtEpoch.Uint64()
+	if epoch.CurrentEpoch > createdAtEpoch {
+		return nil
+	}
+
+	return fmt.Errorf("allocation was created in epoch %d which is still the current epoch. it can be closed from epoch %d, in about %s (%d blocks)", createdAtEpoch, createdAtEpoch+1, epoch.NextEpochETA(), epoch.BlocksUntilNextEpoch())
+}
+
+// WaitForEpoch blocks until the EpochManager reaches targetEpoch, polling at
+// most every pollInterval.
+func WaitForEpoch(ctx context.Context, cli *ethrpc.Client, targetEpoch uint64, pollInterval time.Duration) (*EpochInfo, error) {
+	for {
+		epoch, err := GetEpochInfoCall(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+
+		if epoch.CurrentEpoch >= targetEpoch {
+			return epoch, nil
+		}
+
+		wait := epoch.NextEpochETA()
+		if wait <= 0 || wait > pollInterval {
+			wait = pollInterval
+		}
+
+		fmt.Printf("Current epoch is %d, waiting for epoch %d (about %s left)\n", epoch.CurrentEpoch, targetEpoch, epoch.NextEpochETA())
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
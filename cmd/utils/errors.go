@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+)
+
+// Error categories of chain queries, match them with errors.Is.
+var (
+	ErrNetwork         = errors.New("network error")
+	ErrRateLimited     = errors.New("rate limited")
+	ErrChainMismatch   = errors.New("chain mismatch")
+	ErrReverted        = errors.New("transaction reverted")
+	ErrReceiptNotFound = errors.New("receipt not found")
+	ErrUsage           = errors.New("usage error")
+)
+
+// Process exit codes, stable so that scripts can tell the failures apart.
+const (
+	ExitCodeOK              = 0
+	ExitCodeError           = 1
+	ExitCodeUsage           = 2
+	ExitCodeNetwork         = 10
+	ExitCodeRateLimited     = 11
+	ExitCodeChainMismatch   = 12
+	ExitCodeReverted        = 13
+	ExitCodeReceiptNotFound = 14
+	ExitCodePanic           = 70
+)
+
+// ChainError is a failed chain query, Kind is one of the Err* categories.
+type ChainError struct {
+	Op   string
+	Kind error
+	Err  error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Op, e.Kind, e.Err)
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ChainError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// ChainMismatchError is returned when the RPC endpoint serves another chain
+// than the one the contract addresses are for.
+type ChainMismatchError struct {
+	Expected *big.Int
+	Actual   *big.Int
+}
+
+func (e *ChainMismatchError) Error() string {
+	return fmt.Sprintf("rpc endpoint is on chain %s (%s), expected %s (%s)", e.Actual, NetworkName(e.Actual), e.Expected, NetworkName(e.Expected))
+}
+
+func (e *ChainMismatchError) Is(target error) bool {
+	return target == ErrChainMismatch
+}
+
+// RevertedError is a transaction that was mined but reverted, the chain
+// state is unchanged apart from the gas paid.
+type RevertedError struct {
+	Trx         string
+	BlockNumber uint64
+}
+
+func (e *RevertedError) Error() string {
+	return fmt.Sprintf("transaction %s reverted in block %d", e.Trx, e.BlockNumber)
+}
+
+func (e *RevertedError) Is(target error) bool {
+	return target == ErrReverted
+}
+
+// ReceiptNotFoundError is a transaction that was sent but not mined within
+// Waited, it may still be pending: check Trx before sending it again.
+type ReceiptNotFoundError struct {
+	Trx    string
+	Waited time.Duration
+}
+
+func (e *ReceiptNotFoundError) Error() string {
+	return fmt.Sprintf("no receipt for transaction %s after %s, it may still be pending", e.Trx, e.Waited)
+}
+
+func (e *ReceiptNotFoundError) Is(target error) bool {
+	return target == ErrReceiptNotFound
+}
+
+// UsageError is invalid command input, such as a malformed flag value.
+type UsageError struct {
+	Err error
+}
+
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UsageError) Is(target error) bool {
+	return target == ErrUsage
+}
+
+// Usagef formats a UsageError.
+func Usagef(format string, args ...interface{}) error {
+	return &UsageError{Err: fmt.Errorf(format, args...)}
+}
+
+// ParseAddress parses the address given as flag, a malformed or missing
+// address is a UsageError.
+func ParseAddress(flag string, value string) (eth.Address, error) {
+	if value == "" {
+		return nil, Usagef("--%s is required", flag)
+	}
+
+	address, err := eth.NewAddress(value)
+	if err != nil {
+		return nil, Usagef("invalid --%s %q: %s", flag, value, err)
+	}
+
+	return address, nil
+}
+
+// ParseHash parses a transaction hash, a malformed hash is a UsageError.
+func ParseHash(value string) (eth.Hash, error) {
+	hash, err := eth.NewHash(value)
+	if err != nil || len(hash) != 32 {
+		return nil, Usagef("invalid transaction hash %q", value)
+	}
+
+	return hash, nil
+}
+
+// wrapChainError wraps err with the category it falls in, errors that are not
+// network related are only annotated with op.
+func wrapChainError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	kind := errorKind(err)
+	if kind == nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &ChainError{Op: op, Kind: kind, Err: err}
+}
+
+// errorKind finds the category of err, nil when it is not a chain failure.
+func errorKind(err error) error {
+	// the http client wraps replay mismatches in a *url.Error, they are not
+	// network failures
+	if errors.Is(err, ErrRPCReplayMismatch) {
+		return nil
+	}
+
+	for _, kind := range []error{ErrChainMismatch, ErrRateLimited, ErrNetwork} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	var statusErr *rpcStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.status == http.StatusTooManyRequests {
+			return ErrRateLimited
+		}
+		return ErrNetwork
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrNetwork
+	}
+
+	return nil
+}
+
+// ExitCode maps the error a command failed with to the process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeOK
+	}
+
+	switch {
+	case errors.Is(err, ErrUsage):
+		return ExitCodeUsage
+	case errors.Is(err, ErrReverted):
+		return ExitCodeReverted
+	case errors.Is(err, ErrReceiptNotFound):
+		return ExitCodeReceiptNotFound
+	}
+
+	switch errorKind(err) {
+	case ErrChainMismatch:
+		return ExitCodeChainMismatch
+	case ErrRateLimited:
+		return ExitCodeRateLimited
+	case ErrNetwork:
+		return ExitCodeNetwork
+	}
+
+	return ExitCodeError
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// EscrowAccount mirrors the PaymentsEscrow account a payer funds for a
+// (collector, receiver) pair, or the TAP v1 Escrow account of a sender for a
+// receiver, Collector being nil. ThawEndTimestamp is zero when nothing thaws.
+type EscrowAccount struct {
+	Payer            eth.Address
+	Collector        eth.Address
+	Receiver         eth.Address
+	Balance          *big.Int
+	TokensThawing    *big.Int
+	ThawEndTimestamp uint64
+}
+
+// Available is the balance the collector can still draw from, the thawing
+// tokens excluded.
+func (a *EscrowAccount) Available() *big.Int {
+	available := new(big.Int).Sub(a.Balance, a.TokensThawing)
+	if available.Sign() < 0 {
+		return big.NewInt(0)
+	}
+
+	return available
+}
+
+// Withdrawable is what `withdraw` would move back to the payer at now: the
+// thawing tokens once the thawing period is over, bounded by the balance.
+func (a *EscrowAccount) Withdrawable(now time.Time) *big.Int {
+	if a.ThawEndTimestamp == 0 || uint64(now.Unix()) < a.ThawEndTimestamp {
+		return big.NewInt(0)
+	}
+
+	if a.TokensThawing.Cmp(a.Balance) > 0 {
+		return new(big.Int).Set(a.Balance)
+	}
+
+	return new(big.Int).Set(a.TokensThawing)
+}
+
+func (a *EscrowAccount) ThawEnd() time.Time {
+	return time.Unix(int64(a.ThawEndTimestamp), 0).UTC()
+}
+
+// Describe renders the account as of now, the latest block time.
+func (a *EscrowAccount) Describe(now time.Time) string {
+	var out strings.Builder
+	if a.Collector == nil {
+		fmt.Fprintf(&out, "Escrow of payer %s for receiver %s:\n", a.Payer.Pretty(), a.Receiver.Pretty())
+	} else {
+		fmt.Fprintf(&out, "Escrow of payer %s for receiver %s (collector %s):\n", a.Payer.Pretty(), a.Receiver.Pretty(), a.Collector.Pretty())
+	}
+	fmt.Fprintf(&out, "  Deposited:         %s\n", FormatGRT(a.Balance))
+	fmt.Fprintf(&out, "  Thawing:           %s\n", FormatGRT(a.TokensThawing))
+	fmt.Fprintf(&out, "  Available:         %s\n", FormatGRT(a.Available()))
+	fmt.Fprintf(&out, "  Withdrawable:      %s", FormatGRT(a.Withdrawable(now)))
+	if a.ThawEndTimestamp != 0 {
+		if now.Before(a.ThawEnd()) {
+			fmt.Fprintf(&out, "\n  Thawing ends:      %s (in %s)", a.ThawEnd().Format(time.RFC3339), a.ThawEnd().Sub(now).Round(time.Second))
+		} else {
+			fmt.Fprintf(&out, "\n  Thawing ended:     %s", a.ThawEnd().Format(time.RFC3339))
+		}
+	}
+
+	return out.String()
+}
+
+func GetEscrowAccountCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, payer, collector, receiver eth.Address) (*EscrowAccount, error) {
+	out, err := contractCall(ctx, cli, profile.PaymentsEscrow, "escrowAccounts(address,address,address) (uint256,uint256,uint256)", payer, collector, receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EscrowAccount{
+		Payer:            payer,
+		Collector:        collector,
+		Receiver:         receiver,
+		Balance:          out[0].(*big.Int),
+		TokensThawing:    out[1].(*big.Int),
+		ThawEndTimestamp: out[2].(*big.Int).Uint64(),
+	}, nil
+}
+
+// GetEscrowThawingPeriodCall is how long thawed tokens wait before they can
+// be withdrawn.
+func GetEscrowThawingPeriodCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile) (time.Duration, error) {
+	out, err := contractCall(ctx, cli, profile.PaymentsEscrow, "WITHDRAW_ESCROW_THAWING_PERIOD() (uint256)")
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(out[0].(*big.Int).Uint64()) * time.Second, nil
+}
+
+// LatestBlockTime is the timestamp of the latest block, the clock thawing
+// periods are measured against.
+func LatestBlockTime(ctx context.Context, cli *ethrpc.Client) (time.Time, error) {
+	resp, err := cli.DoRequest(ctx, "eth_getBlockByNumber", []interface{}{ethrpc.LatestBlock, false})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fetching latest block: %w", err)
+	}
+
+	var block struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(resp), &block); err != nil {
+		return time.Time{}, fmt.Errorf("decoding latest block: %w", err)
+	}
+
+	timestamp, err := strconv.ParseUint(block.Timestamp, 0, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse block timestamp %q: %w", block.Timestamp, err)
+	}
+
+	return time.Unix(int64(timestamp), 0).UTC(), nil
+}
+
+// RequireEscrow checks that the profile has the Horizon payment contracts.
+func (p *NetworkProfile) RequireEscrow() error {
+	if !p.Horizon() || p.PaymentsEscrow == "" {
+		return fmt.Errorf("network profile %s has no PaymentsEscrow, escrow requires a horizon profile with payments_escrow", p.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,447 @@
+package fakechain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/proof"
+)
+
+var (
+	approvalEventTopic    = utils.EventTopic("Approval(address,address,uint256)")
+	setOperatorEventTopic = utils.EventTopic("SetOperator(address,address,bool)")
+)
+
+// revertError is a reverted call, reason is the require message of the
+// emulated contract.
+type revertError struct {
+	reason string
+}
+
+func (e *revertError) Error() string {
+	return "execution reverted: " + e.reason
+}
+
+func revert(reason string) error {
+	return &revertError{reason: reason}
+}
+
+// invocation is the context of an emulated contract function, trx is nil for
+// an eth_call, which must then not change the state.
+type invocation struct {
+	from eth.Address
+	trx  *transaction
+}
+
+type function struct {
+	name    string
+	inputs  *eth.MethodDef
+	outputs string
+	view    bool
+	handle  func(c *Chain, inv *invocation, args []interface{}) ([]interface{}, error)
+}
+
+// functions is keyed by contract address and selector.
+var functions = map[string]*function{}
+
+func register(contract string, signature string, outputs string, view bool, handle func(c *Chain, inv *invocation, args []interface{}) ([]interface{}, error)) {
+	// decoding the call data as the outputs of a method with the same inputs
+	// gives the arguments
+	inputs := signature[strings.Index(signature, "(")+1 : len(signature)-1]
+	def := eth.MustNewMethodDef(fmt.Sprintf("%s (%s)", signature, inputs))
+
+	functions[functionKey(eth.MustNewAddress(contract), def.MethodID())] = &function{
+		name:    def.Name,
+		inputs:  def,
+		outputs: outputs,
+		view:    view,
+		handle:  handle,
+	}
+}
+
+func functionKey(contract eth.Address, selector []byte) string {
+	return key(contract) + "/" + eth.Hex(selector).String()
+}
+
+func init() {
+	grt := utils.GRTTokenContractAddress
+	staking := utils.StakingContractAddress
+	curation := utils.L2CurationContractAddress
+	epochManager := utils.EpochManagerContractAddress
+	rewardsManager := utils.RewardsManagerContractAddress
+
+	register(grt, "balanceOf(address)", "uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{new(big.Int).Set(c.grtBalance(args[0].(eth.Address)))}, nil
+	})
+	register(grt, "allowance(address,address)", "uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{new(big.Int).Set(c.allowance(args[0].(eth.Address), args[1].(eth.Address)))}, nil
+	})
+	register(grt, "approve(address,uint256)", "bool", false, (*Chain).approve)
+	register(grt, "transfer(address,uint256)", "bool", false, (*Chain).transfer)
+
+	register(staking, "getAllocation(address)", "address,bytes32,uint256,uint256,uint256,uint256,uint256,uint256,uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		alloc, found := c.allocations[key(args[0].(eth.Address))]
+		if !found {
+			alloc = &allocation{indexer: make(eth.Address, 20), deploymentID: make([]byte, 32), tokens: big.NewInt(0), collectedFees: big.NewInt(0)}
+		}
+		a := alloc.toAllocation()
+		return []interface{}{a.Indexer, a.SubgraphDeploymentID, a.Tokens, a.CreatedAtEpoch, a.ClosedAtEpoch, a.CollectedFees, a.EffectiveAllocation, a.AccRewardsPerAllocatedToken, a.DistributedRebates}, nil
+	})
+	register(staking, "getAllocationState(address)", "uint8", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{uint8(c.allocationState(args[0].(eth.Address)))}, nil
+	})
+	register(staking, "isOperator(address,address)", "bool", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{c.operators[key(args[1].(eth.Address))][key(args[0].(eth.Address))]}, nil
+	})
+	register(staking, "stakes(address)", "uint256,uint256,uint256,uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		s := c.stake(args[0].(eth.Address))
+		return []interface{}{new(big.Int).Set(s.staked), new(big.Int).Set(s.allocated), new(big.Int).Set(s.locked), big.NewInt(0)}, nil
+	})
+	register(staking, "delegationPools(address)", "uint32,uint32,uint32,uint256,uint256,uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		pool := c.delegationPool(args[0].(eth.Address))
+		return []interface{}{uint32(0), uint32(0), pool.queryFeeCut, big.NewInt(0), new(big.Int).Set(pool.tokens), new(big.Int).Set(pool.tokens)}, nil
+	})
+	register(staking, "protocolPercentage()", "uint32", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{c.protocolPercentage}, nil
+	})
+	register(staking, "curationPercentage()", "uint32", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{c.curationPercentage}, nil
+	})
+	register(staking, "delegationRatio()", "uint32", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{c.delegationRatio}, nil
+	})
+	register(staking, "allocateFrom(address,bytes32,uint256,address,bytes32,bytes)", "", false, (*Chain).allocateFrom)
+	register(staking, "collect(uint256,address)", "", false, (*Chain).collect)
+	register(staking, "closeAllocation(address,bytes32)", "", false, (*Chain).closeAllocation)
+	register(staking, "setOperator(address,bool)", "", false, (*Chain).setOperatorCall)
+
+	register(curation, "isCurated(bytes32)", "bool", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{c.isCurated(args[0].([]byte))}, nil
+	})
+	register(curation, "getCurationPoolTokens(bytes32)", "uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{c.curationSignal(args[0].([]byte))}, nil
+	})
+
+	register(epochManager, "currentEpoch()", "uint256", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{new(big.Int).SetUint64(c.currentEpoch)}, nil
+	})
+	register(epochManager, "epochLength()", "uint256", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{new(big.Int).SetUint64(c.epochLength)}, nil
+	})
+	register(epochManager, "currentEpochBlockSinceStart()", "uint256", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{new(big.Int).SetUint64(c.blocksSinceStart)}, nil
+	})
+
+	register(rewardsManager, "isDenied(bytes32)", "bool", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{c.denied[key(args[0].([]byte))]}, nil
+	})
+}
+
+// invoke runs the function called by data on the contract `to`. Functions
+// changing the state revert when called without a transaction.
+func (c *Chain) invoke(inv *invocation, to eth.Address, data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, revert("no function selector")
+	}
+
+	fn, found := functions[functionKey(to, data[:4])]
+	if !found {
+		return nil, revert(fmt.Sprintf("unknown function %s on %s", eth.Hex(data[:4]).Pretty(), to.Pretty()))
+	}
+
+	if !fn.view && inv.trx == nil {
+		return nil, revert(fn.name + " changes the state, it must be sent in a transaction")
+	}
+	if reasons := c.reverts[fn.name]; !fn.view && len(reasons) > 0 {
+		c.reverts[fn.name] = reasons[1:]
+		return nil, revert(reasons[0])
+	}
+
+	var args []interface{}
+	if len(fn.inputs.ReturnParameters) > 0 {
+		var err error
+		if args, err = fn.inputs.DecodeOutput(data[4:]); err != nil {
+			return nil, revert(fmt.Sprintf("decoding %s arguments: %s", fn.name, err))
+		}
+	}
+
+	out, err := fn.handle(c, inv, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return encode(fn.outputs, out...)
+}
+
+// encode ABI encodes values of the comma-separated types.
+func encode(types string, values ...interface{}) ([]byte, error) {
+	if types == "" {
+		return nil, nil
+	}
+
+	data, err := eth.MustNewMethodDef(fmt.Sprintf("encode(%s)", types)).NewCall(values...).Encode()
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", types, err)
+	}
+
+	return data[4:], nil
+}
+
+func (c *Chain) emit(inv *invocation, contract string, topics []eth.Hash, dataTypes string, data ...interface{}) error {
+	encoded, err := encode(dataTypes, data...)
+	if err != nil {
+		return err
+	}
+
+	inv.trx.logs = append(inv.trx.logs, &logEntry{
+		address: eth.MustNewAddress(contract),
+		topics:  topics,
+		data:    encoded,
+	})
+	return nil
+}
+
+func (c *Chain) approve(inv *invocation, args []interface{}) ([]interface{}, error) {
+	spender, amount := args[0].(eth.Address), args[1].(*big.Int)
+
+	c.allowance(inv.from, spender).Set(amount)
+
+	return []interface{}{true}, c.emit(inv, utils.GRTTokenContractAddress, []eth.Hash{approvalEventTopic, addressTopic(inv.from), addressTopic(spender)}, "uint256", amount)
+}
+
+func (c *Chain) transfer(inv *invocation, args []interface{}) ([]interface{}, error) {
+	if err := c.moveGRT(inv, inv.from, args[0].(eth.Address), args[1].(*big.Int)); err != nil {
+		return nil, err
+	}
+
+	return []interface{}{true}, nil
+}
+
+func (c *Chain) moveGRT(inv *invocation, from, to eth.Address, amount *big.Int) error {
+	if c.grtBalance(from).Cmp(amount) < 0 {
+		return revert("ERC20: transfer amount exceeds balance")
+	}
+
+	c.grtBalance(from).Sub(c.grtBalance(from), amount)
+	c.grtBalance(to).Add(c.grtBalance(to), amount)
+
+	return c.emit(inv, utils.GRTTokenContractAddress, []eth.Hash{utils.TransferEventTopic, addressTopic(from), addressTopic(to)}, "uint256", amount)
+}
+
+func (c *Chain) allocateFrom(inv *invocation, args []interface{}) ([]interface{}, error) {
+	indexer := args[0].(eth.Address)
+	deploymentID := args[1].([]byte)
+	tokens := args[2].(*big.Int)
+	allocationID := args[3].(eth.Address)
+	metadata := args[4].([]byte)
+	allocationProof := args[5].([]byte)
+
+	if !c.isAuth(indexer, inv.from) {
+		return nil, revert("!auth")
+	}
+	if c.allocationState(allocationID) != utils.AllocationStateNull {
+		return nil, revert("!null")
+	}
+	if err := proof.Verify(indexer.Pretty(), allocationID.Pretty(), allocationProof); err != nil {
+		return nil, revert("!proof")
+	}
+	if c.indexerCapacity(indexer).Cmp(tokens) < 0 {
+		return nil, revert("!capacity")
+	}
+
+	s := c.stake(indexer)
+	s.allocated.Add(s.allocated, tokens)
+	c.allocations[key(allocationID)] = &allocation{
+		indexer:       indexer,
+		deploymentID:  deploymentID,
+		tokens:        new(big.Int).Set(tokens),
+		createdAt:     c.currentEpoch,
+		collectedFees: big.NewInt(0),
+	}
+
+	topics := []eth.Hash{utils.AllocationCreatedEventTopic, addressTopic(indexer), eth.Hash(deploymentID), addressTopic(allocationID)}
+	return nil, c.emit(inv, utils.StakingContractAddress, topics, "uint256,uint256,bytes32", new(big.Int).SetUint64(c.currentEpoch), tokens, metadata)
+}
+
+func (c *Chain) collect(inv *invocation, args []interface{}) ([]interface{}, error) {
+	tokens := args[0].(*big.Int)
+	allocationID := args[1].(eth.Address)
+
+	if c.allocationState(allocationID) == utils.AllocationStateNull {
+		return nil, revert("!collect")
+	}
+
+	allowance := c.allowance(inv.from, eth.MustNewAddress(utils.StakingContractAddress))
+	if allowance.Cmp(tokens) < 0 {
+		return nil, revert("ERC20: transfer amount exceeds allowance")
+	}
+	if err := c.moveGRT(inv, inv.from, eth.MustNewAddress(utils.StakingContractAddress), tokens); err != nil {
+		return nil, err
+	}
+	allowance.Sub(allowance, tokens)
+
+	alloc := c.allocations[key(allocationID)]
+	split := c.collectSplit(alloc, tokens)
+	alloc.collectedFees.Add(alloc.collectedFees, split.queryFees)
+	if pool, found := c.delegationPools[key(alloc.indexer)]; found {
+		pool.tokens.Add(pool.tokens, split.delegationRewards)
+	}
+
+	topics := []eth.Hash{utils.RebateCollectedEventTopic, addressTopic(alloc.indexer), eth.Hash(alloc.deploymentID), addressTopic(allocationID)}
+	return nil, c.emit(inv, utils.StakingContractAddress, topics, "address,uint256,uint256,uint256,uint256,uint256,uint256,uint256",
+		inv.from,
+		new(big.Int).SetUint64(c.currentEpoch),
+		tokens,
+		split.protocolTax,
+		split.curationFees,
+		split.queryFees,
+		split.indexerRebate,
+		split.delegationRewards,
+	)
+}
+
+type collectSplit struct {
+	protocolTax       *big.Int
+	curationFees      *big.Int
+	queryFees         *big.Int
+	indexerRebate     *big.Int
+	delegationRewards *big.Int
+}
+
+// collectSplit follows Staking `collect`: _collectTax burns the protocol
+// share of the tokens, _collectCurationFees takes the curation share of
+// what is left when the deployment is curated, then
+// _collectDelegationQueryRewards rounds the indexer cut down and gives the
+// rest to delegators. Rebates are paid in full, there is no rebate pool.
+func (c *Chain) collectSplit(alloc *allocation, tokens *big.Int) *collectSplit {
+	queryFees := new(big.Int).Set(tokens)
+
+	protocolTax := new(big.Int).Mul(queryFees, big.NewInt(int64(c.protocolPercentage)))
+	protocolTax.Div(protocolTax, big.NewInt(utils.MaxPPM))
+	queryFees.Sub(queryFees, protocolTax)
+
+	curationFees := big.NewInt(0)
+	if c.isCurated(alloc.deploymentID) && c.curationPercentage > 0 {
+		curationFees.Mul(queryFees, big.NewInt(int64(c.curationPercentage)))
+		curationFees.Div(curationFees, big.NewInt(utils.MaxPPM))
+		queryFees.Sub(queryFees, curationFees)
+	}
+
+	delegationRewards := big.NewInt(0)
+	pool := c.delegationPool(alloc.indexer)
+	if pool.tokens.Sign() > 0 && pool.queryFeeCut < utils.MaxPPM {
+		indexerCut := new(big.Int).Mul(big.NewInt(int64(pool.queryFeeCut)), queryFees)
+		indexerCut.Div(indexerCut, big.NewInt(utils.MaxPPM))
+		delegationRewards.Sub(queryFees, indexerCut)
+	}
+
+	return &collectSplit{
+		protocolTax:       protocolTax,
+		curationFees:      curationFees,
+		queryFees:         queryFees,
+		indexerRebate:     new(big.Int).Sub(queryFees, delegationRewards),
+		delegationRewards: delegationRewards,
+	}
+}
+
+func (c *Chain) closeAllocation(inv *invocation, args []interface{}) ([]interface{}, error) {
+	allocationID := args[0].(eth.Address)
+	poi := args[1].([]byte)
+
+	if c.allocationState(allocationID) != utils.AllocationStateActive {
+		return nil, revert("!active")
+	}
+
+	alloc := c.allocations[key(allocationID)]
+	if !c.isAuth(alloc.indexer, inv.from) {
+		return nil, revert("!auth")
+	}
+	if c.currentEpoch <= alloc.createdAt {
+		return nil, revert("<epochs")
+	}
+
+	s := c.stake(alloc.indexer)
+	s.allocated.Sub(s.allocated, alloc.tokens)
+	alloc.closedAt = c.currentEpoch
+
+	topics := []eth.Hash{utils.AllocationClosedEventTopic, addressTopic(alloc.indexer), eth.Hash(alloc.deploymentID), addressTopic(allocationID)}
+	isPublic := !bytes.Equal(alloc.indexer, inv.from)
+	return nil, c.emit(inv, utils.StakingContractAddress, topics, "uint256,uint256,address,bytes32,bool", new(big.Int).SetUint64(c.currentEpoch), alloc.tokens, inv.from, poi, isPublic)
+}
+
+func (c *Chain) setOperatorCall(inv *invocation, args []interface{}) ([]interface{}, error) {
+	operator, allowed := args[0].(eth.Address), args[1].(bool)
+
+	if bytes.Equal(operator, inv.from) {
+		return nil, revert("operator == sender")
+	}
+
+	c.setOperator(inv.from, operator, allowed)
+
+	return nil, c.emit(inv, utils.StakingContractAddress, []eth.Hash{setOperatorEventTopic, addressTopic(inv.from), addressTopic(operator)}, "bool", allowed)
+}
+
+func (c *Chain) allocationState(allocationID eth.Address) utils.AllocationState {
+	alloc, found := c.allocations[key(allocationID)]
+	switch {
+	case !found:
+		return utils.AllocationStateNull
+	case alloc.closedAt == 0:
+		return utils.AllocationStateActive
+	}
+
+	return utils.AllocationStateClosed
+}
+
+func (c *Chain) indexerStake(indexer eth.Address) *utils.IndexerStake {
+	s := c.stake(indexer)
+	return &utils.IndexerStake{
+		Indexer:         indexer,
+		TokensStaked:    s.staked,
+		TokensAllocated: s.allocated,
+		TokensLocked:    s.locked,
+		DelegatedTokens: c.delegationPool(indexer).tokens,
+		DelegationRatio: c.delegationRatio,
+	}
+}
+
+// indexerCapacity is Staking getIndexerCapacity, computed apart from
+// utils.IndexerStake so that the tests check the command against the
+// contract rather than against itself.
+func (c *Chain) indexerCapacity(indexer eth.Address) *big.Int {
+	s := c.stake(indexer)
+	tokensDelegatedMax := new(big.Int).Mul(s.staked, big.NewInt(int64(c.delegationRatio)))
+	tokensDelegated := c.delegationPool(indexer).tokens
+	if tokensDelegated.Cmp(tokensDelegatedMax) > 0 {
+		tokensDelegated = tokensDelegatedMax
+	}
+
+	tokensUsed := new(big.Int).Add(s.allocated, s.locked)
+	tokensCapacity := new(big.Int).Add(s.staked, tokensDelegated)
+	if tokensUsed.Cmp(tokensCapacity) > 0 {
+		return big.NewInt(0)
+	}
+
+	return tokensCapacity.Sub(tokensCapacity, tokensUsed)
+}
+
+func (c *Chain) curationSignal(deploymentID []byte) *big.Int {
+	signal, found := c.signal[key(deploymentID)]
+	if !found {
+		return big.NewInt(0)
+	}
+
+	return new(big.Int).Set(signal)
+}
+
+func (c *Chain) isCurated(deploymentID []byte) bool {
+	return c.curationSignal(deploymentID).Sign() > 0
+}
+
+func addressTopic(address eth.Address) eth.Hash {
+	return eth.Hash(append(make([]byte, 12), address...))
+}
@@ -0,0 +1,149 @@
+package fakechain
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+// PaymentsEscrowAddress holds the emulated escrow accounts, the emulated
+// GraphTallyCollector draws from them when SubgraphService collects a RAV.
+const (
+	PaymentsEscrowAddress      = "0xe5c0e5c0e5c0e5c0e5c0e5c0e5c0e5c0e5c0e5c0"
+	GraphTallyCollectorAddress = "0x7a117a117a117a117a117a117a117a117a117a11"
+)
+
+const DefaultEscrowThawingPeriod = 30 * 24 * time.Hour
+
+var (
+	escrowDepositEventTopic    = utils.EventTopic("Deposit(address,address,address,uint256)")
+	escrowThawEventTopic       = utils.EventTopic("Thaw(address,address,address,uint256,uint256)")
+	escrowCancelThawEventTopic = utils.EventTopic("CancelThaw(address,address,address,uint256,uint256)")
+	escrowWithdrawEventTopic   = utils.EventTopic("Withdraw(address,address,address,uint256)")
+)
+
+type escrowAccount struct {
+	balance          *big.Int
+	tokensThawing    *big.Int
+	thawEndTimestamp uint64
+}
+
+func init() {
+	escrow := PaymentsEscrowAddress
+
+	register(escrow, "escrowAccounts(address,address,address)", "uint256,uint256,uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		account := c.escrowAccount(args[0].(eth.Address), args[1].(eth.Address), args[2].(eth.Address))
+		return []interface{}{new(big.Int).Set(account.balance), new(big.Int).Set(account.tokensThawing), new(big.Int).SetUint64(account.thawEndTimestamp)}, nil
+	})
+	register(escrow, "getBalance(address,address,address)", "uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		account := c.escrowAccount(args[0].(eth.Address), args[1].(eth.Address), args[2].(eth.Address))
+		available := new(big.Int).Sub(account.balance, account.tokensThawing)
+		if available.Sign() < 0 {
+			available.SetInt64(0)
+		}
+		return []interface{}{available}, nil
+	})
+	register(escrow, "WITHDRAW_ESCROW_THAWING_PERIOD()", "uint256", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{big.NewInt(int64(c.escrowThawingPeriod / time.Second))}, nil
+	})
+	register(escrow, "deposit(address,address,uint256)", "", false, (*Chain).escrowDeposit)
+	register(escrow, "thaw(address,address,uint256)", "", false, (*Chain).escrowThaw)
+	register(escrow, "cancelThaw(address,address)", "", false, (*Chain).escrowCancelThaw)
+	register(escrow, "withdraw(address,address)", "", false, (*Chain).escrowWithdraw)
+}
+
+func (c *Chain) escrowAccount(payer, collector, receiver eth.Address) *escrowAccount {
+	accountKey := key(payer) + "/" + key(collector) + "/" + key(receiver)
+	account, found := c.escrowAccounts[accountKey]
+	if !found {
+		account = &escrowAccount{balance: big.NewInt(0), tokensThawing: big.NewInt(0)}
+		c.escrowAccounts[accountKey] = account
+	}
+
+	return account
+}
+
+func escrowTopics(event eth.Hash, payer, collector, receiver eth.Address) []eth.Hash {
+	return []eth.Hash{event, addressTopic(payer), addressTopic(collector), addressTopic(receiver)}
+}
+
+func (c *Chain) escrowDeposit(inv *invocation, args []interface{}) ([]interface{}, error) {
+	collector, receiver, tokens := args[0].(eth.Address), args[1].(eth.Address), args[2].(*big.Int)
+
+	escrow := eth.MustNewAddress(PaymentsEscrowAddress)
+	allowance := c.allowance(inv.from, escrow)
+	if allowance.Cmp(tokens) < 0 {
+		return nil, revert("ERC20: transfer amount exceeds allowance")
+	}
+	if err := c.moveGRT(inv, inv.from, escrow, tokens); err != nil {
+		return nil, err
+	}
+	allowance.Sub(allowance, tokens)
+
+	account := c.escrowAccount(inv.from, collector, receiver)
+	account.balance.Add(account.balance, tokens)
+
+	return nil, c.emit(inv, PaymentsEscrowAddress, escrowTopics(escrowDepositEventTopic, inv.from, collector, receiver), "uint256", tokens)
+}
+
+func (c *Chain) escrowThaw(inv *invocation, args []interface{}) ([]interface{}, error) {
+	collector, receiver, tokens := args[0].(eth.Address), args[1].(eth.Address), args[2].(*big.Int)
+
+	if tokens.Sign() == 0 {
+		return nil, revert("PaymentsEscrowInvalidZeroTokens")
+	}
+
+	account := c.escrowAccount(inv.from, collector, receiver)
+	if account.balance.Cmp(tokens) < 0 {
+		return nil, revert("PaymentsEscrowInsufficientBalance")
+	}
+
+	account.tokensThawing.Set(tokens)
+	account.thawEndTimestamp = c.timestamp() + uint64(c.escrowThawingPeriod/time.Second)
+
+	return nil, c.emit(inv, PaymentsEscrowAddress, escrowTopics(escrowThawEventTopic, inv.from, collector, receiver), "uint256,uint256", tokens, new(big.Int).SetUint64(account.thawEndTimestamp))
+}
+
+func (c *Chain) escrowCancelThaw(inv *invocation, args []interface{}) ([]interface{}, error) {
+	collector, receiver := args[0].(eth.Address), args[1].(eth.Address)
+
+	account := c.escrowAccount(inv.from, collector, receiver)
+	if account.tokensThawing.Sign() == 0 {
+		return nil, revert("PaymentsEscrowNotThawing")
+	}
+
+	tokensThawing, thawEndTimestamp := new(big.Int).Set(account.tokensThawing), account.thawEndTimestamp
+	account.tokensThawing.SetInt64(0)
+	account.thawEndTimestamp = 0
+
+	return nil, c.emit(inv, PaymentsEscrowAddress, escrowTopics(escrowCancelThawEventTopic, inv.from, collector, receiver), "uint256,uint256", tokensThawing, new(big.Int).SetUint64(thawEndTimestamp))
+}
+
+func (c *Chain) escrowWithdraw(inv *invocation, args []interface{}) ([]interface{}, error) {
+	collector, receiver := args[0].(eth.Address), args[1].(eth.Address)
+
+	account := c.escrowAccount(inv.from, collector, receiver)
+	if account.thawEndTimestamp == 0 {
+		return nil, revert("PaymentsEscrowNotThawing")
+	}
+	if c.timestamp() < account.thawEndTimestamp {
+		return nil, revert("PaymentsEscrowStillThawing")
+	}
+
+	tokens := new(big.Int).Set(account.tokensThawing)
+	if tokens.Cmp(account.balance) > 0 {
+		tokens.Set(account.balance)
+	}
+
+	account.balance.Sub(account.balance, tokens)
+	account.tokensThawing.SetInt64(0)
+	account.thawEndTimestamp = 0
+
+	if err := c.moveGRT(inv, eth.MustNewAddress(PaymentsEscrowAddress), inv.from, tokens); err != nil {
+		return nil, err
+	}
+
+	return nil, c.emit(inv, PaymentsEscrowAddress, escrowTopics(escrowWithdrawEventTopic, inv.from, collector, receiver), "uint256", tokens)
+}
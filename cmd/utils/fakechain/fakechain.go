@@ -0,0 +1,435 @@
+// Package fakechain is an in-process Arbitrum chain serving the JSON-RPC
+// methods the commands use. It emulates the GRT token, Staking, L2Curation,
+// EpochManager and RewardsManager contracts at their mainnet addresses, and
+// HorizonStaking with SubgraphService, PaymentsEscrow and GraphTallyCollector
+// for the horizon backend, and the TAP v1 Escrow, so that commands can be run
+// end to end, revert paths included, by pointing their --rpc-url to it.
+package fakechain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+)
+
+const (
+	DefaultProtocolPercentage = 10_000  // 1%
+	DefaultCurationPercentage = 100_000 // 10%
+	DefaultDelegationRatio    = 16
+	DefaultEpochLength        = 6646
+	DefaultCurrentEpoch       = 900
+	DefaultGasPrice           = 10_000_000 // 0.01 gwei
+
+	// gasUsed is what every transaction costs, reverted or not.
+	gasUsed = 100_000
+)
+
+type stake struct {
+	staked    *big.Int
+	allocated *big.Int
+	locked    *big.Int
+}
+
+type delegationPool struct {
+	queryFeeCut uint32
+	tokens      *big.Int
+}
+
+type allocation struct {
+	indexer       eth.Address
+	deploymentID  []byte
+	tokens        *big.Int
+	createdAt     uint64
+	closedAt      uint64
+	collectedFees *big.Int
+}
+
+type transaction struct {
+	hash     eth.Hash
+	from     eth.Address
+	to       eth.Address
+	nonce    uint64
+	gasPrice *big.Int
+	gas      uint64
+	value    *big.Int
+	data     []byte
+	block    uint64
+	status   uint64
+	logs     []*logEntry
+	revert   string
+}
+
+type logEntry struct {
+	address eth.Address
+	topics  []eth.Hash
+	data    []byte
+	block   uint64
+	trxHash eth.Hash
+	index   uint64
+}
+
+type injectedError struct {
+	code    int
+	message string
+}
+
+// Chain is the fake chain state. Its zero value is not usable, use New.
+type Chain struct {
+	mu sync.Mutex
+
+	chainID  uint64
+	gasPrice *big.Int
+	block    uint64
+
+	ethBalances map[string]*big.Int
+	nonces      map[string]uint64
+
+	grtBalances map[string]*big.Int
+	allowances  map[string]map[string]*big.Int
+
+	stakes          map[string]*stake
+	delegationPools map[string]*delegationPool
+	operators       map[string]map[string]bool
+	allocations     map[string]*allocation
+
+	provisions          map[string]*big.Int
+	provisionOperators  map[string]map[string]bool
+	allocatedProvisions map[string]*big.Int
+	serviceAllocations  map[string]*serviceAllocation
+
+	escrowAccounts      map[string]*escrowAccount
+	escrowThawingPeriod time.Duration
+
+	// tallySigners maps authorized signers to their payer
+	tallySigners    map[string]string
+	collectedTokens map[string]*big.Int
+
+	tapEscrowAccounts map[string]*escrowAccount
+	tapSigners        map[string]*tapSigner
+
+	protocolPercentage uint32
+	curationPercentage uint32
+	delegationRatio    uint32
+
+	signal map[string]*big.Int
+	denied map[string]bool
+
+	currentEpoch     uint64
+	epochLength      uint64
+	blocksSinceStart uint64
+
+	// timeShift moves the chain clock ahead of the wall clock
+	timeShift time.Duration
+
+	transactions map[string]*transaction
+	logs         []*logEntry
+
+	injected map[string][]*injectedError
+	reverts  map[string][]string
+}
+
+// New returns a chain on Arbitrum One's chain ID with the default protocol
+// parameters, no account is funded.
+func New() *Chain {
+	return &Chain{
+		chainID:             utils.ArbitrumOneChainID,
+		gasPrice:            big.NewInt(DefaultGasPrice),
+		block:               utils.StakingDeploymentBlock,
+		ethBalances:         map[string]*big.Int{},
+		nonces:              map[string]uint64{},
+		grtBalances:         map[string]*big.Int{},
+		allowances:          map[string]map[string]*big.Int{},
+		stakes:              map[string]*stake{},
+		delegationPools:     map[string]*delegationPool{},
+		operators:           map[string]map[string]bool{},
+		allocations:         map[string]*allocation{},
+		provisions:          map[string]*big.Int{},
+		provisionOperators:  map[string]map[string]bool{},
+		allocatedProvisions: map[string]*big.Int{},
+		serviceAllocations:  map[string]*serviceAllocation{},
+		escrowAccounts:      map[string]*escrowAccount{},
+		escrowThawingPeriod: DefaultEscrowThawingPeriod,
+		tallySigners:        map[string]string{},
+		collectedTokens:     map[string]*big.Int{},
+		tapEscrowAccounts:   map[string]*escrowAccount{},
+		tapSigners:          map[string]*tapSigner{},
+		protocolPercentage:  DefaultProtocolPercentage,
+		curationPercentage:  DefaultCurationPercentage,
+		delegationRatio:     DefaultDelegationRatio,
+		signal:              map[string]*big.Int{},
+		denied:              map[string]bool{},
+		currentEpoch:        DefaultCurrentEpoch,
+		epochLength:         DefaultEpochLength,
+		transactions:        map[string]*transaction{},
+		injected:            map[string][]*injectedError{},
+		reverts:             map[string][]string{},
+	}
+}
+
+// SetChainID changes the chain ID reported and expected in signed
+// transactions, to exercise chain mismatches.
+func (c *Chain) SetChainID(chainID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.chainID = chainID
+}
+
+// Fund credits account with ethWei and grtWei, either may be nil.
+func (c *Chain) Fund(account eth.Address, ethWei, grtWei *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ethWei != nil {
+		c.ethBalance(account).Add(c.ethBalance(account), ethWei)
+	}
+	if grtWei != nil {
+		c.grtBalance(account).Add(c.grtBalance(account), grtWei)
+	}
+}
+
+// Stake adds tokens to the indexer stake.
+func (c *Chain) Stake(indexer eth.Address, tokens *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stake(indexer)
+	s.staked.Add(s.staked, tokens)
+}
+
+// SetDelegation sets the indexer delegation pool, queryFeeCut is the PPM of
+// the query fees the indexer keeps.
+func (c *Chain) SetDelegation(indexer eth.Address, queryFeeCut uint32, delegatedTokens *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.delegationPools[key(indexer)] = &delegationPool{queryFeeCut: queryFeeCut, tokens: new(big.Int).Set(delegatedTokens)}
+}
+
+// SetOperator authorizes, or revokes, operator on behalf of indexer.
+func (c *Chain) SetOperator(indexer, operator eth.Address, allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setOperator(indexer, operator, allowed)
+}
+
+// Signal sets the curation signal of a deployment (32 bytes), a positive
+// signal makes it curated.
+func (c *Chain) Signal(deploymentID []byte, tokens *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.signal[key(deploymentID)] = new(big.Int).Set(tokens)
+}
+
+// Deny adds, or removes, a deployment (32 bytes) from the rewards deny list.
+func (c *Chain) Deny(deploymentID []byte, denied bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.denied[key(deploymentID)] = denied
+}
+
+// AdvanceEpochs moves the EpochManager n epochs forward.
+func (c *Chain) AdvanceEpochs(n uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.currentEpoch += n
+	c.blocksSinceStart = 0
+}
+
+// AdvanceTime moves the chain clock forward, to get past thawing periods.
+func (c *Chain) AdvanceTime(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timeShift += d
+}
+
+// FailNext makes the next request of method fail with the JSON-RPC error
+// code and message. Errors queue up when called repeatedly.
+func (c *Chain) FailNext(method string, code int, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.injected[method] = append(c.injected[method], &injectedError{code: code, message: message})
+}
+
+// RevertNext makes the next transaction calling the contract function name
+// (e.g. "collect") revert with reason, before it changes any state. Reverts
+// queue up when called repeatedly.
+func (c *Chain) RevertNext(name string, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reverts[name] = append(c.reverts[name], reason)
+}
+
+// Allocate opens an allocation of tokens for indexer on the deployment (32
+// bytes) in the current epoch, as if allocateFrom was sent, without checking
+// the stake.
+func (c *Chain) Allocate(indexer eth.Address, deploymentID []byte, allocationID eth.Address, tokens *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stake(indexer)
+	s.allocated.Add(s.allocated, tokens)
+	c.allocations[key(allocationID)] = &allocation{
+		indexer:       indexer,
+		deploymentID:  deploymentID,
+		tokens:        new(big.Int).Set(tokens),
+		createdAt:     c.currentEpoch,
+		collectedFees: big.NewInt(0),
+	}
+}
+
+// GRTBalance is the GRT balance of account, in wei.
+func (c *Chain) GRTBalance(account eth.Address) *big.Int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return new(big.Int).Set(c.grtBalance(account))
+}
+
+// Allocation returns the allocation allocationID, nil when it does not exist.
+func (c *Chain) Allocation(allocationID eth.Address) *utils.Allocation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	alloc, found := c.allocations[key(allocationID)]
+	if !found {
+		return nil
+	}
+
+	return alloc.toAllocation()
+}
+
+// Revert returns the revert reason of the transaction trxHash, empty when it
+// succeeded or is unknown.
+func (c *Chain) Revert(trxHash string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	trx, found := c.transactions[strings.ToLower(strings.TrimPrefix(trxHash, "0x"))]
+	if !found {
+		return ""
+	}
+
+	return trx.revert
+}
+
+// Start serves the chain over HTTP on addr (e.g. "127.0.0.1:0") and returns
+// its url along with a function stopping the server.
+func (c *Chain) Start(addr string) (string, func() error, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, fmt.Errorf("listening on %s: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: c}
+	go server.Serve(listener)
+
+	return "http://" + listener.Addr().String(), server.Close, nil
+}
+
+// timestamp is the chain clock, in seconds, the time of the latest block.
+func (c *Chain) timestamp() uint64 {
+	return uint64(time.Now().Add(c.timeShift).Unix())
+}
+
+func (c *Chain) ethBalance(account eth.Address) *big.Int {
+	balance, found := c.ethBalances[key(account)]
+	if !found {
+		balance = big.NewInt(0)
+		c.ethBalances[key(account)] = balance
+	}
+
+	return balance
+}
+
+func (c *Chain) grtBalance(account eth.Address) *big.Int {
+	balance, found := c.grtBalances[key(account)]
+	if !found {
+		balance = big.NewInt(0)
+		c.grtBalances[key(account)] = balance
+	}
+
+	return balance
+}
+
+func (c *Chain) allowance(owner, spender eth.Address) *big.Int {
+	allowances, found := c.allowances[key(owner)]
+	if !found {
+		allowances = map[string]*big.Int{}
+		c.allowances[key(owner)] = allowances
+	}
+
+	amount, found := allowances[key(spender)]
+	if !found {
+		amount = big.NewInt(0)
+		allowances[key(spender)] = amount
+	}
+
+	return amount
+}
+
+func (c *Chain) stake(indexer eth.Address) *stake {
+	s, found := c.stakes[key(indexer)]
+	if !found {
+		s = &stake{staked: big.NewInt(0), allocated: big.NewInt(0), locked: big.NewInt(0)}
+		c.stakes[key(indexer)] = s
+	}
+
+	return s
+}
+
+func (c *Chain) delegationPool(indexer eth.Address) *delegationPool {
+	pool, found := c.delegationPools[key(indexer)]
+	if !found {
+		return &delegationPool{tokens: big.NewInt(0)}
+	}
+
+	return pool
+}
+
+func (c *Chain) setOperator(indexer, operator eth.Address, allowed bool) {
+	operators, found := c.operators[key(indexer)]
+	if !found {
+		operators = map[string]bool{}
+		c.operators[key(indexer)] = operators
+	}
+
+	operators[key(operator)] = allowed
+}
+
+func (c *Chain) isAuth(indexer, sender eth.Address) bool {
+	return bytes.Equal(indexer, sender) || c.operators[key(indexer)][key(sender)]
+}
+
+func (a *allocation) toAllocation() *utils.Allocation {
+	return &utils.Allocation{
+		Indexer:                     a.indexer,
+		SubgraphDeploymentID:        a.deploymentID,
+		Tokens:                      new(big.Int).Set(a.tokens),
+		CreatedAtEpoch:              new(big.Int).SetUint64(a.createdAt),
+		ClosedAtEpoch:               new(big.Int).SetUint64(a.closedAt),
+		CollectedFees:               new(big.Int).Set(a.collectedFees),
+		EffectiveAllocation:         big.NewInt(0),
+		AccRewardsPerAllocatedToken: big.NewInt(0),
+		DistributedRebates:          big.NewInt(0),
+	}
+}
+
+func key(b []byte) string {
+	return eth.Hex(b).String()
+}
@@ -0,0 +1,216 @@
+package fakechain
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/proof"
+)
+
+// SubgraphServiceAddress is where the emulated SubgraphService lives, there
+// is no mainnet address to mirror. HorizonStaking is emulated on the Staking
+// address, like the upgraded proxy.
+const SubgraphServiceAddress = "0x5e4b5e4b5e4b5e4b5e4b5e4b5e4b5e4b5e4b5e4b"
+
+var (
+	serviceStartedEventTopic = utils.EventTopic("ServiceStarted(address,bytes)")
+	serviceStoppedEventTopic = utils.EventTopic("ServiceStopped(address,bytes)")
+	operatorSetEventTopic    = utils.EventTopic("OperatorSet(address,address,address,bool)")
+)
+
+type serviceAllocation struct {
+	indexer      eth.Address
+	deploymentID []byte
+	tokens       *big.Int
+	createdAt    uint64
+	closedAt     uint64
+}
+
+func init() {
+	staking := utils.StakingContractAddress
+	subgraphService := SubgraphServiceAddress
+
+	register(staking, "getProvision(address,address)", "uint256,uint256,uint256,uint32,uint64,uint64", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		tokens := big.NewInt(0)
+		if bytes.Equal(args[1].(eth.Address), eth.MustNewAddress(subgraphService)) {
+			tokens.Set(c.provision(args[0].(eth.Address)))
+		}
+		return []interface{}{tokens, big.NewInt(0), big.NewInt(0), uint32(0), uint64(0), uint64(0)}, nil
+	})
+	register(staking, "isAuthorized(address,address,address)", "bool", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		if !bytes.Equal(args[1].(eth.Address), eth.MustNewAddress(subgraphService)) {
+			return []interface{}{false}, nil
+		}
+		return []interface{}{c.isProvisionAuth(args[0].(eth.Address), args[2].(eth.Address))}, nil
+	})
+	register(staking, "setOperator(address,address,bool)", "", false, (*Chain).setProvisionOperatorCall)
+
+	register(subgraphService, "allocationProvisionTracker(address)", "uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{new(big.Int).Set(c.provisionTracker(args[0].(eth.Address)))}, nil
+	})
+	register(subgraphService, "getAllocation(address)", "address,bytes32,uint256,uint256,uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		alloc, found := c.serviceAllocations[key(args[0].(eth.Address))]
+		if !found {
+			alloc = &serviceAllocation{indexer: make(eth.Address, 20), deploymentID: make([]byte, 32), tokens: big.NewInt(0)}
+		}
+		return []interface{}{alloc.indexer, alloc.deploymentID, new(big.Int).Set(alloc.tokens), new(big.Int).SetUint64(alloc.createdAt), new(big.Int).SetUint64(alloc.closedAt)}, nil
+	})
+	register(subgraphService, "startService(address,bytes)", "", false, (*Chain).startService)
+	register(subgraphService, "stopService(address,bytes)", "", false, (*Chain).stopService)
+}
+
+// Provision sets the tokens indexer provisioned to the emulated
+// SubgraphService.
+func (c *Chain) Provision(indexer eth.Address, tokens *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.provisions[key(indexer)] = new(big.Int).Set(tokens)
+}
+
+// SetProvisionOperator authorizes, or revokes, operator on the indexer
+// provision to the emulated SubgraphService.
+func (c *Chain) SetProvisionOperator(indexer, operator eth.Address, allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setProvisionOperator(indexer, operator, allowed)
+}
+
+// HorizonProfile is the network profile of the chain with the horizon
+// backend, to be written to a file passed to --network.
+func (c *Chain) HorizonProfile() *utils.NetworkProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &utils.NetworkProfile{
+		Name:                "fakechain-horizon",
+		ChainID:             c.chainID,
+		Backend:             utils.BackendHorizon,
+		HorizonStaking:      utils.StakingContractAddress,
+		SubgraphService:     SubgraphServiceAddress,
+		PaymentsEscrow:      PaymentsEscrowAddress,
+		GraphTallyCollector: GraphTallyCollectorAddress,
+		TapEscrow:           TapEscrowAddress,
+	}
+}
+
+func (c *Chain) provision(indexer eth.Address) *big.Int {
+	tokens, found := c.provisions[key(indexer)]
+	if !found {
+		return big.NewInt(0)
+	}
+
+	return tokens
+}
+
+func (c *Chain) provisionTracker(indexer eth.Address) *big.Int {
+	tokens, found := c.allocatedProvisions[key(indexer)]
+	if !found {
+		tokens = big.NewInt(0)
+		c.allocatedProvisions[key(indexer)] = tokens
+	}
+
+	return tokens
+}
+
+func (c *Chain) setProvisionOperator(indexer, operator eth.Address, allowed bool) {
+	operators, found := c.provisionOperators[key(indexer)]
+	if !found {
+		operators = map[string]bool{}
+		c.provisionOperators[key(indexer)] = operators
+	}
+
+	operators[key(operator)] = allowed
+}
+
+func (c *Chain) isProvisionAuth(indexer, sender eth.Address) bool {
+	return bytes.Equal(indexer, sender) || c.provisionOperators[key(indexer)][key(sender)]
+}
+
+func (c *Chain) setProvisionOperatorCall(inv *invocation, args []interface{}) ([]interface{}, error) {
+	verifier, operator, allowed := args[0].(eth.Address), args[1].(eth.Address), args[2].(bool)
+
+	if bytes.Equal(operator, inv.from) {
+		return nil, revert("HorizonStakingCallerIsServiceProvider")
+	}
+
+	// only the provisions to SubgraphService are emulated, other verifiers
+	// accept the call without effect
+	if bytes.Equal(verifier, eth.MustNewAddress(SubgraphServiceAddress)) {
+		c.setProvisionOperator(inv.from, operator, allowed)
+	}
+
+	return nil, c.emit(inv, utils.StakingContractAddress, []eth.Hash{operatorSetEventTopic, addressTopic(inv.from), addressTopic(verifier), addressTopic(operator)}, "bool", allowed)
+}
+
+func (c *Chain) startService(inv *invocation, args []interface{}) ([]interface{}, error) {
+	indexer, data := args[0].(eth.Address), args[1].([]byte)
+
+	decoded, err := eth.MustNewMethodDef("decode() (bytes32,uint256,address,bytes)").DecodeOutput(data)
+	if err != nil {
+		return nil, revert("invalid data")
+	}
+	deploymentID := decoded[0].([]byte)
+	tokens := decoded[1].(*big.Int)
+	allocationID := decoded[2].(eth.Address)
+	allocationProof := decoded[3].([]byte)
+
+	if !c.isProvisionAuth(indexer, inv.from) {
+		return nil, revert("ProvisionManagerNotAuthorized")
+	}
+	if c.provision(indexer).Sign() == 0 {
+		return nil, revert("ProvisionManagerProvisionNotFound")
+	}
+	if _, found := c.serviceAllocations[key(allocationID)]; found {
+		return nil, revert("AllocationAlreadyExists")
+	}
+	if err := proof.VerifyHorizon(indexer.Pretty(), allocationID.Pretty(), SubgraphServiceAddress, new(big.Int).SetUint64(c.chainID), allocationProof); err != nil {
+		return nil, revert("AllocationManagerInvalidAllocationProof")
+	}
+
+	tracker := c.provisionTracker(indexer)
+	if new(big.Int).Add(tracker, tokens).Cmp(c.provision(indexer)) > 0 {
+		return nil, revert("ProvisionTrackerInsufficientTokens")
+	}
+
+	tracker.Add(tracker, tokens)
+	c.serviceAllocations[key(allocationID)] = &serviceAllocation{
+		indexer:      indexer,
+		deploymentID: deploymentID,
+		tokens:       new(big.Int).Set(tokens),
+		createdAt:    c.timestamp(),
+	}
+
+	return nil, c.emit(inv, SubgraphServiceAddress, []eth.Hash{serviceStartedEventTopic, addressTopic(indexer)}, "bytes", data)
+}
+
+func (c *Chain) stopService(inv *invocation, args []interface{}) ([]interface{}, error) {
+	indexer, data := args[0].(eth.Address), args[1].([]byte)
+
+	decoded, err := eth.MustNewMethodDef("decode() (address)").DecodeOutput(data)
+	if err != nil {
+		return nil, revert("invalid data")
+	}
+	allocationID := decoded[0].(eth.Address)
+
+	if !c.isProvisionAuth(indexer, inv.from) {
+		return nil, revert("ProvisionManagerNotAuthorized")
+	}
+
+	alloc, found := c.serviceAllocations[key(allocationID)]
+	if !found || !bytes.Equal(alloc.indexer, indexer) {
+		return nil, revert("SubgraphServiceInvalidIndexer")
+	}
+	if alloc.closedAt != 0 {
+		return nil, revert("AllocationClosed")
+	}
+
+	tracker := c.provisionTracker(indexer)
+	tracker.Sub(tracker, alloc.tokens)
+	alloc.closedAt = c.timestamp()
+
+	return nil, c.emit(inv, SubgraphServiceAddress, []eth.Hash{serviceStoppedEventTopic, addressTopic(indexer)}, "bytes", data)
+}
@@ -0,0 +1,562 @@
+package fakechain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/streamingfast/eth-go"
+)
+
+// JSON-RPC error codes answered by the chain.
+const (
+	errCodeInvalidRequest = -32600
+	errCodeMethodNotFound = -32601
+	errCodeInvalidParams  = -32602
+	errCodeServer         = -32000
+	errCodeReverted       = 3
+)
+
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error (code %d): %s", e.Code, e.Message)
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// ServeHTTP answers single and batch JSON-RPC requests. On top of the eth_
+// methods, `fakechain_advanceEpochs` [n] moves the EpochManager n epochs
+// forward, so that allocations can be closed from a shell.
+func (c *Chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var out interface{}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var requests []*rpcRequest
+		if err := json.Unmarshal(trimmed, &requests); err != nil {
+			out = &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: errCodeInvalidRequest, Message: err.Error()}}
+		} else {
+			responses := make([]*rpcResponse, len(requests))
+			for i, request := range requests {
+				responses[i] = c.handle(request)
+			}
+			out = responses
+		}
+	} else {
+		request := &rpcRequest{}
+		if err := json.Unmarshal(trimmed, request); err != nil {
+			out = &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: errCodeInvalidRequest, Message: err.Error()}}
+		} else {
+			out = c.handle(request)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (c *Chain) handle(request *rpcRequest) *rpcResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	response := &rpcResponse{JSONRPC: "2.0", ID: request.ID}
+
+	if injected := c.injected[request.Method]; len(injected) > 0 {
+		c.injected[request.Method] = injected[1:]
+		response.Error = &rpcError{Code: injected[0].code, Message: injected[0].message}
+		return response
+	}
+
+	result, err := c.dispatch(request.Method, request.Params)
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{Code: errCodeInvalidParams, Message: err.Error()}
+		}
+		response.Error = rpcErr
+		return response
+	}
+
+	response.Result = result
+	return response
+}
+
+func (c *Chain) dispatch(method string, params []json.RawMessage) (interface{}, error) {
+	switch method {
+	case "eth_chainId":
+		return hexUint64(c.chainID), nil
+	case "net_version":
+		return strconv.FormatUint(c.chainID, 10), nil
+	case "eth_blockNumber":
+		return hexUint64(c.block), nil
+	case "eth_getBlockByNumber":
+		return map[string]interface{}{
+			"number":    hexUint64(c.block),
+			"hash":      blockHash(c.block).Pretty(),
+			"timestamp": hexUint64(c.timestamp()),
+		}, nil
+	case "eth_gasPrice":
+		return hexBig(c.gasPrice), nil
+	case "eth_feeHistory":
+		return c.feeHistory(params)
+	case "eth_getBalance":
+		account, err := addressParam(params, 0)
+		if err != nil {
+			return nil, err
+		}
+		return hexBig(c.ethBalance(account)), nil
+	case "eth_getTransactionCount":
+		account, err := addressParam(params, 0)
+		if err != nil {
+			return nil, err
+		}
+		return hexUint64(c.nonces[key(account)]), nil
+	case "eth_call":
+		return c.ethCall(params)
+	case "eth_estimateGas":
+		return hexUint64(gasUsed), nil
+	case "eth_sendRawTransaction":
+		return c.sendRawTransaction(params)
+	case "eth_getTransactionReceipt":
+		trx, err := c.transactionParam(params)
+		if err != nil || trx == nil {
+			return nil, err
+		}
+		return trx.receipt(), nil
+	case "eth_getTransactionByHash":
+		trx, err := c.transactionParam(params)
+		if err != nil || trx == nil {
+			return nil, err
+		}
+		return trx.object(), nil
+	case "eth_getLogs":
+		return c.getLogs(params)
+	case "fakechain_advanceEpochs":
+		var epochs uint64
+		if len(params) == 0 || json.Unmarshal(params[0], &epochs) != nil {
+			return nil, fmt.Errorf("expected the number of epochs as first param")
+		}
+		c.currentEpoch += epochs
+		c.blocksSinceStart = 0
+		return hexUint64(c.currentEpoch), nil
+	case "fakechain_advanceTime":
+		var seconds uint64
+		if len(params) == 0 || json.Unmarshal(params[0], &seconds) != nil {
+			return nil, fmt.Errorf("expected the number of seconds as first param")
+		}
+		c.timeShift += time.Duration(seconds) * time.Second
+		return hexUint64(c.timestamp()), nil
+	}
+
+	return nil, &rpcError{Code: errCodeMethodNotFound, Message: fmt.Sprintf("the method %s does not exist/is not available", method)}
+}
+
+type callParams struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Data  string `json:"data"`
+	Input string `json:"input"`
+}
+
+func (c *Chain) ethCall(params []json.RawMessage) (interface{}, error) {
+	if len(params) == 0 {
+		return nil, fmt.Errorf("missing call object")
+	}
+
+	call := &callParams{}
+	if err := json.Unmarshal(params[0], call); err != nil {
+		return nil, fmt.Errorf("invalid call object: %w", err)
+	}
+
+	to, err := eth.NewAddress(call.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to address: %w", err)
+	}
+
+	input := call.Data
+	if input == "" {
+		input = call.Input
+	}
+	data, err := eth.NewHex(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid call data: %w", err)
+	}
+
+	inv := &invocation{from: make(eth.Address, 20)}
+	if call.From != "" {
+		if inv.from, err = eth.NewAddress(call.From); err != nil {
+			return nil, fmt.Errorf("invalid from address: %w", err)
+		}
+	}
+
+	out, err := c.invoke(inv, to, data)
+	if err != nil {
+		if revertErr, ok := err.(*revertError); ok {
+			return nil, &rpcError{Code: errCodeReverted, Message: revertErr.Error()}
+		}
+		return nil, err
+	}
+
+	return eth.Hex(out).Pretty(), nil
+}
+
+// legacyTransaction is an EIP-155 signed transaction, as produced by the
+// eth-go native signer.
+type legacyTransaction struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       []byte
+	Value    *big.Int
+	Data     []byte
+	V        *big.Int
+	R        *big.Int
+	S        *big.Int
+}
+
+func (c *Chain) sendRawTransaction(params []json.RawMessage) (interface{}, error) {
+	var rawHex string
+	if len(params) == 0 || json.Unmarshal(params[0], &rawHex) != nil {
+		return nil, fmt.Errorf("expected the raw transaction as first param")
+	}
+
+	raw, err := eth.NewHex(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw transaction: %w", err)
+	}
+
+	signed := &legacyTransaction{}
+	if err := rlp.DecodeBytes(raw, signed); err != nil {
+		return nil, &rpcError{Code: errCodeServer, Message: fmt.Sprintf("rlp: %s", err)}
+	}
+
+	from, err := c.sender(signed)
+	if err != nil {
+		return nil, &rpcError{Code: errCodeServer, Message: err.Error()}
+	}
+
+	hash := eth.Hash(eth.Keccak256(raw))
+	if _, known := c.transactions[key(hash)]; known {
+		return nil, &rpcError{Code: errCodeServer, Message: "already known"}
+	}
+
+	if expected := c.nonces[key(from)]; signed.Nonce != expected {
+		if signed.Nonce < expected {
+			return nil, &rpcError{Code: errCodeServer, Message: fmt.Sprintf("nonce too low: next nonce %d, tx nonce %d", expected, signed.Nonce)}
+		}
+		return nil, &rpcError{Code: errCodeServer, Message: fmt.Sprintf("nonce too high: next nonce %d, tx nonce %d", expected, signed.Nonce)}
+	}
+
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), signed.GasPrice)
+	if c.ethBalance(from).Cmp(new(big.Int).Add(fee, signed.Value)) < 0 {
+		return nil, &rpcError{Code: errCodeServer, Message: fmt.Sprintf("insufficient funds for gas * price + value: address %s have %s want %s", from.Pretty(), c.ethBalance(from), fee)}
+	}
+
+	c.block++
+	c.blocksSinceStart++
+	if c.blocksSinceStart >= c.epochLength {
+		c.currentEpoch++
+		c.blocksSinceStart = 0
+	}
+
+	trx := &transaction{
+		hash:     hash,
+		from:     from,
+		to:       eth.Address(signed.To),
+		nonce:    signed.Nonce,
+		gasPrice: signed.GasPrice,
+		gas:      signed.Gas,
+		value:    signed.Value,
+		data:     signed.Data,
+		block:    c.block,
+		status:   1,
+	}
+
+	c.nonces[key(from)]++
+	c.ethBalance(from).Sub(c.ethBalance(from), fee)
+
+	if _, err := c.invoke(&invocation{from: from, trx: trx}, trx.to, trx.data); err != nil {
+		trx.status = 0
+		trx.logs = nil
+		trx.revert = err.Error()
+	}
+
+	for _, log := range trx.logs {
+		log.block = trx.block
+		log.trxHash = trx.hash
+		log.index = uint64(len(c.logs))
+		c.logs = append(c.logs, log)
+	}
+	c.transactions[key(hash)] = trx
+
+	return hash.Pretty(), nil
+}
+
+// sender recovers the signer of an EIP-155 transaction on this chain.
+func (c *Chain) sender(signed *legacyTransaction) (eth.Address, error) {
+	chainID := new(big.Int).SetUint64(c.chainID)
+	recoveryID := new(big.Int).Sub(signed.V, new(big.Int).Add(new(big.Int).Mul(chainID, big.NewInt(2)), big.NewInt(35)))
+	if recoveryID.Sign() < 0 || recoveryID.Cmp(big.NewInt(1)) > 0 {
+		return nil, fmt.Errorf("invalid chain id for signer: have v %s, chain id %d", signed.V, c.chainID)
+	}
+
+	sigHash, err := rlp.EncodeToBytes([]interface{}{signed.Nonce, signed.GasPrice, signed.Gas, signed.To, signed.Value, signed.Data, chainID, uint(0), uint(0)})
+	if err != nil {
+		return nil, fmt.Errorf("encoding signature hash: %w", err)
+	}
+
+	signature := make([]byte, 65)
+	signed.R.FillBytes(signature[0:32])
+	signed.S.FillBytes(signature[32:64])
+	signature[64] = byte(recoveryID.Uint64())
+
+	publicKey, err := crypto.SigToPub(crypto.Keccak256(sigHash), signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	return eth.Address(crypto.PubkeyToAddress(*publicKey).Bytes()), nil
+}
+
+func (c *Chain) transactionParam(params []json.RawMessage) (*transaction, error) {
+	var hashHex string
+	if len(params) == 0 || json.Unmarshal(params[0], &hashHex) != nil {
+		return nil, fmt.Errorf("expected the transaction hash as first param")
+	}
+
+	hash, err := eth.NewHash(hashHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hash: %w", err)
+	}
+
+	return c.transactions[key(hash)], nil
+}
+
+type logsParams struct {
+	FromBlock string            `json:"fromBlock"`
+	ToBlock   string            `json:"toBlock"`
+	Address   string            `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+func (c *Chain) getLogs(params []json.RawMessage) (interface{}, error) {
+	if len(params) == 0 {
+		return nil, fmt.Errorf("missing filter object")
+	}
+
+	filter := &logsParams{}
+	if err := json.Unmarshal(params[0], filter); err != nil {
+		return nil, fmt.Errorf("invalid filter object: %w", err)
+	}
+
+	fromBlock, err := c.blockParam(filter.FromBlock, 0)
+	if err != nil {
+		return nil, err
+	}
+	toBlock, err := c.blockParam(filter.ToBlock, c.block)
+	if err != nil {
+		return nil, err
+	}
+
+	// each position is nil (any), or the set of topics accepted
+	topics := make([]map[string]bool, len(filter.Topics))
+	for i, raw := range filter.Topics {
+		var one string
+		var oneOf []string
+		switch {
+		case string(raw) == "null":
+		case json.Unmarshal(raw, &one) == nil:
+			topics[i] = map[string]bool{strings.ToLower(one): true}
+		case json.Unmarshal(raw, &oneOf) == nil:
+			topics[i] = map[string]bool{}
+			for _, topic := range oneOf {
+				topics[i][strings.ToLower(topic)] = true
+			}
+		default:
+			return nil, fmt.Errorf("invalid topic filter %s", raw)
+		}
+	}
+
+	out := []interface{}{}
+	for _, log := range c.logs {
+		if log.block < fromBlock || log.block > toBlock {
+			continue
+		}
+		if filter.Address != "" && !strings.EqualFold(log.address.Pretty(), filter.Address) {
+			continue
+		}
+		if !log.matches(topics) {
+			continue
+		}
+		out = append(out, log.object())
+	}
+
+	return out, nil
+}
+
+func (c *Chain) blockParam(value string, defaultBlock uint64) (uint64, error) {
+	switch value {
+	case "":
+		return defaultBlock, nil
+	case "latest", "pending", "safe", "finalized":
+		return c.block, nil
+	case "earliest":
+		return 0, nil
+	}
+
+	block, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block %q: %w", value, err)
+	}
+
+	return block, nil
+}
+
+func (c *Chain) feeHistory(params []json.RawMessage) (interface{}, error) {
+	var countHex string
+	if len(params) == 0 || json.Unmarshal(params[0], &countHex) != nil {
+		return nil, fmt.Errorf("expected the block count as first param")
+	}
+
+	count, err := strconv.ParseUint(countHex, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block count %q: %w", countHex, err)
+	}
+	if count > c.block {
+		count = c.block
+	}
+
+	baseFees := make([]string, count+1)
+	ratios := make([]float64, count)
+	for i := range baseFees {
+		baseFees[i] = hexBig(c.gasPrice)
+	}
+
+	return map[string]interface{}{
+		"oldestBlock":   hexUint64(c.block - count + 1),
+		"baseFeePerGas": baseFees,
+		"gasUsedRatio":  ratios,
+	}, nil
+}
+
+func (l *logEntry) matches(topics []map[string]bool) bool {
+	for i, accepted := range topics {
+		if accepted == nil {
+			continue
+		}
+		if i >= len(l.topics) || !accepted[strings.ToLower(l.topics[i].Pretty())] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *logEntry) object() map[string]interface{} {
+	topics := make([]string, len(l.topics))
+	for i, topic := range l.topics {
+		topics[i] = topic.Pretty()
+	}
+
+	return map[string]interface{}{
+		"address":          l.address.Pretty(),
+		"topics":           topics,
+		"data":             eth.Hex(l.data).Pretty(),
+		"blockNumber":      hexUint64(l.block),
+		"blockHash":        blockHash(l.block).Pretty(),
+		"transactionHash":  l.trxHash.Pretty(),
+		"transactionIndex": "0x0",
+		"logIndex":         hexUint64(l.index),
+		"removed":          false,
+	}
+}
+
+func (t *transaction) receipt() map[string]interface{} {
+	logs := make([]interface{}, len(t.logs))
+	for i, log := range t.logs {
+		logs[i] = log.object()
+	}
+
+	return map[string]interface{}{
+		"transactionHash":   t.hash.Pretty(),
+		"transactionIndex":  "0x0",
+		"blockHash":         blockHash(t.block).Pretty(),
+		"blockNumber":       hexUint64(t.block),
+		"from":              t.from.Pretty(),
+		"to":                t.to.Pretty(),
+		"cumulativeGasUsed": hexUint64(gasUsed),
+		"gasUsed":           hexUint64(gasUsed),
+		"effectiveGasPrice": hexBig(t.gasPrice),
+		"logs":              logs,
+		"logsBloom":         eth.Hex(make([]byte, 256)).Pretty(),
+		"type":              "0x0",
+		"status":            hexUint64(t.status),
+	}
+}
+
+func (t *transaction) object() map[string]interface{} {
+	return map[string]interface{}{
+		"hash":             t.hash.Pretty(),
+		"nonce":            hexUint64(t.nonce),
+		"blockHash":        blockHash(t.block).Pretty(),
+		"blockNumber":      hexUint64(t.block),
+		"transactionIndex": "0x0",
+		"from":             t.from.Pretty(),
+		"to":               t.to.Pretty(),
+		"value":            hexBig(t.value),
+		"gas":              hexUint64(t.gas),
+		"gasPrice":         hexBig(t.gasPrice),
+		"input":            eth.Hex(t.data).Pretty(),
+		"type":             "0x0",
+	}
+}
+
+func addressParam(params []json.RawMessage, index int) (eth.Address, error) {
+	var value string
+	if len(params) <= index || json.Unmarshal(params[index], &value) != nil {
+		return nil, fmt.Errorf("expected an address as param %d", index)
+	}
+
+	return eth.NewAddress(value)
+}
+
+func blockHash(block uint64) eth.Hash {
+	return eth.Hash(eth.Keccak256([]byte(strconv.FormatUint(block, 10))))
+}
+
+func hexUint64(value uint64) string {
+	return fmt.Sprintf("0x%x", value)
+}
+
+func hexBig(value *big.Int) string {
+	return fmt.Sprintf("0x%x", value)
+}
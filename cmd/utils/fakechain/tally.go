@@ -0,0 +1,119 @@
+package fakechain
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/tap"
+)
+
+var paymentCollectedEventTopic = utils.EventTopic("PaymentCollected(uint8,bytes32,address,address,address,uint256)")
+
+func init() {
+	collector := GraphTallyCollectorAddress
+
+	register(collector, "isAuthorized(address,address)", "bool", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{c.tallySigners[key(args[1].(eth.Address))] == key(args[0].(eth.Address))}, nil
+	})
+	register(collector, "tokensCollected(address,bytes32,address,address)", "uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		return []interface{}{new(big.Int).Set(c.tokensCollected(args[0].(eth.Address), args[1].([]byte), args[2].(eth.Address), args[3].(eth.Address)))}, nil
+	})
+
+	register(SubgraphServiceAddress, "collect(address,uint8,bytes)", "uint256", false, (*Chain).collectQueryFees)
+}
+
+// AuthorizeTallySigner authorizes signer to sign receipts and RAVs on behalf
+// of payer on the emulated GraphTallyCollector.
+func (c *Chain) AuthorizeTallySigner(payer, signer eth.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tallySigners[key(signer)] = key(payer)
+}
+
+func (c *Chain) tokensCollected(dataService eth.Address, collectionID []byte, receiver, payer eth.Address) *big.Int {
+	collectedKey := key(dataService) + "/" + key(collectionID) + "/" + key(receiver) + "/" + key(payer)
+	tokens, found := c.collectedTokens[collectedKey]
+	if !found {
+		tokens = big.NewInt(0)
+		c.collectedTokens[collectedKey] = tokens
+	}
+
+	return tokens
+}
+
+// collectQueryFees redeems a RAV the way SubgraphService and
+// GraphTallyCollector do, except that the whole amount goes to the indexer,
+// with no protocol tax nor delegator cut.
+func (c *Chain) collectQueryFees(inv *invocation, args []interface{}) ([]interface{}, error) {
+	indexer, paymentType, data := args[0].(eth.Address), args[1].(uint8), args[2].([]byte)
+
+	if paymentType != tap.QueryFeePaymentType {
+		return nil, revert("SubgraphServiceInvalidPaymentType")
+	}
+	if !c.isProvisionAuth(indexer, inv.from) {
+		return nil, revert("ProvisionManagerNotAuthorized")
+	}
+
+	rav, tokens, err := tap.DecodeCollectData(data)
+	if err != nil {
+		return nil, revert("invalid data")
+	}
+	message := rav.Message
+
+	domain := &tap.Domain{ChainID: new(big.Int).SetUint64(c.chainID), VerifyingContract: common.HexToAddress(GraphTallyCollectorAddress)}
+	signer, err := rav.Recover(domain)
+	if err != nil {
+		return nil, revert("GraphTallyCollectorInvalidRAVSigner")
+	}
+	payer := eth.Address(message.Payer.Bytes())
+	if c.tallySigners[key(signer.Bytes())] != key(payer) {
+		return nil, revert("GraphTallyCollectorInvalidRAVSigner")
+	}
+
+	if message.DataService != common.HexToAddress(SubgraphServiceAddress) {
+		return nil, revert("GraphTallyCollectorCallerNotDataService")
+	}
+	if !bytes.Equal(message.ServiceProvider.Bytes(), indexer) {
+		return nil, revert("SubgraphServiceIndexerMismatch")
+	}
+	alloc, found := c.serviceAllocations[key(message.AllocationID().Bytes())]
+	if !found || !bytes.Equal(alloc.indexer, indexer) {
+		return nil, revert("SubgraphServiceInvalidRAV")
+	}
+
+	dataService := eth.MustNewAddress(SubgraphServiceAddress)
+	collected := c.tokensCollected(dataService, message.CollectionID.Bytes(), indexer, payer)
+	due := new(big.Int).Sub(message.ValueAggregate, collected)
+	if due.Sign() <= 0 {
+		return nil, revert("GraphTallyCollectorInconsistentRAVTokens")
+	}
+	if tokens.Sign() == 0 {
+		tokens = due
+	}
+	if tokens.Cmp(due) > 0 {
+		return nil, revert("GraphTallyCollectorInvalidTokensToCollectAmount")
+	}
+
+	account := c.escrowAccount(payer, eth.MustNewAddress(GraphTallyCollectorAddress), indexer)
+	available := new(big.Int).Sub(account.balance, account.tokensThawing)
+	if available.Cmp(tokens) < 0 {
+		return nil, revert("PaymentsEscrowInsufficientBalance")
+	}
+
+	account.balance.Sub(account.balance, tokens)
+	collected.Add(collected, tokens)
+	if err := c.moveGRT(inv, eth.MustNewAddress(PaymentsEscrowAddress), indexer, tokens); err != nil {
+		return nil, err
+	}
+
+	topics := []eth.Hash{paymentCollectedEventTopic, eth.Hash(common.BigToHash(big.NewInt(int64(paymentType))).Bytes()), eth.Hash(message.CollectionID.Bytes()), addressTopic(payer)}
+	if err := c.emit(inv, GraphTallyCollectorAddress, topics, "address,address,uint256", indexer, dataService, tokens); err != nil {
+		return nil, err
+	}
+
+	return []interface{}{tokens}, nil
+}
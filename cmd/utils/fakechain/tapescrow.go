@@ -0,0 +1,224 @@
+package fakechain
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/tap"
+)
+
+// TapEscrowAddress is where the emulated TAP v1 Escrow lives.
+const TapEscrowAddress = "0x7a0e7a0e7a0e7a0e7a0e7a0e7a0e7a0e7a0e7a0e"
+
+const (
+	DefaultTapEscrowThawingPeriod       = 30 * 24 * time.Hour
+	DefaultTapRevokeSignerThawingPeriod = 30 * 24 * time.Hour
+)
+
+var (
+	tapDepositEventTopic        = utils.EventTopic("Deposit(address,address,uint256)")
+	tapThawEventTopic           = utils.EventTopic("Thaw(address,address,uint256,uint256,uint256)")
+	tapCancelThawEventTopic     = utils.EventTopic("CancelThaw(address,address)")
+	tapWithdrawEventTopic       = utils.EventTopic("Withdraw(address,address,uint256)")
+	authorizeSignerEventTopic   = utils.EventTopic("AuthorizeSigner(address,address)")
+	thawSignerEventTopic        = utils.EventTopic("ThawSigner(address,address,uint256)")
+	revokeAuthorizedSignerTopic = utils.EventTopic("RevokeAuthorizedSigner(address,address)")
+	cancelThawSignerEventTopic  = utils.EventTopic("CancelThawSigner(address,address,uint256)")
+)
+
+type tapSigner struct {
+	sender           eth.Address
+	thawEndTimestamp uint64
+}
+
+func init() {
+	escrow := TapEscrowAddress
+
+	register(escrow, "escrowAccounts(address,address)", "uint256,uint256,uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		account := c.tapEscrowAccount(args[0].(eth.Address), args[1].(eth.Address))
+		return []interface{}{new(big.Int).Set(account.balance), new(big.Int).Set(account.tokensThawing), new(big.Int).SetUint64(account.thawEndTimestamp)}, nil
+	})
+	register(escrow, "withdrawEscrowThawingPeriod()", "uint256", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{big.NewInt(int64(DefaultTapEscrowThawingPeriod / time.Second))}, nil
+	})
+	register(escrow, "revokeSignerThawingPeriod()", "uint256", true, func(c *Chain, _ *invocation, _ []interface{}) ([]interface{}, error) {
+		return []interface{}{big.NewInt(int64(DefaultTapRevokeSignerThawingPeriod / time.Second))}, nil
+	})
+	register(escrow, "authorizedSigners(address)", "address,uint256", true, func(c *Chain, _ *invocation, args []interface{}) ([]interface{}, error) {
+		signer, found := c.tapSigners[key(args[0].(eth.Address))]
+		if !found {
+			return []interface{}{make(eth.Address, 20), big.NewInt(0)}, nil
+		}
+		return []interface{}{signer.sender, new(big.Int).SetUint64(signer.thawEndTimestamp)}, nil
+	})
+	register(escrow, "deposit(address,uint256)", "", false, (*Chain).tapEscrowDeposit)
+	register(escrow, "thaw(address,uint256)", "", false, (*Chain).tapEscrowThaw)
+	register(escrow, "withdraw(address)", "", false, (*Chain).tapEscrowWithdraw)
+	register(escrow, "authorizeSigner(address,uint256,bytes)", "", false, (*Chain).tapAuthorizeSigner)
+	register(escrow, "thawSigner(address)", "", false, (*Chain).tapThawSigner)
+	register(escrow, "cancelThawSigner(address)", "", false, (*Chain).tapCancelThawSigner)
+	register(escrow, "revokeAuthorizedSigner(address)", "", false, (*Chain).tapRevokeAuthorizedSigner)
+}
+
+func (c *Chain) tapEscrowAccount(sender, receiver eth.Address) *escrowAccount {
+	accountKey := key(sender) + "/" + key(receiver)
+	account, found := c.tapEscrowAccounts[accountKey]
+	if !found {
+		account = &escrowAccount{balance: big.NewInt(0), tokensThawing: big.NewInt(0)}
+		c.tapEscrowAccounts[accountKey] = account
+	}
+
+	return account
+}
+
+func (c *Chain) tapEscrowDeposit(inv *invocation, args []interface{}) ([]interface{}, error) {
+	receiver, amount := args[0].(eth.Address), args[1].(*big.Int)
+
+	escrow := eth.MustNewAddress(TapEscrowAddress)
+	allowance := c.allowance(inv.from, escrow)
+	if allowance.Cmp(amount) < 0 {
+		return nil, revert("ERC20: transfer amount exceeds allowance")
+	}
+	if err := c.moveGRT(inv, inv.from, escrow, amount); err != nil {
+		return nil, err
+	}
+	allowance.Sub(allowance, amount)
+
+	account := c.tapEscrowAccount(inv.from, receiver)
+	account.balance.Add(account.balance, amount)
+
+	return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{tapDepositEventTopic, addressTopic(inv.from), addressTopic(receiver)}, "uint256", amount)
+}
+
+// tapEscrowThaw adds to the thawing tokens, or cancels the thaw when amount
+// is zero.
+func (c *Chain) tapEscrowThaw(inv *invocation, args []interface{}) ([]interface{}, error) {
+	receiver, amount := args[0].(eth.Address), args[1].(*big.Int)
+
+	account := c.tapEscrowAccount(inv.from, receiver)
+	if amount.Sign() == 0 {
+		if account.tokensThawing.Sign() == 0 {
+			return nil, revert("InsufficientThawAmount")
+		}
+		account.tokensThawing.SetInt64(0)
+		account.thawEndTimestamp = 0
+		return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{tapCancelThawEventTopic, addressTopic(inv.from), addressTopic(receiver)}, "")
+	}
+
+	available := new(big.Int).Sub(account.balance, account.tokensThawing)
+	if amount.Cmp(available) > 0 {
+		return nil, revert("InsufficientEscrow")
+	}
+
+	account.tokensThawing.Add(account.tokensThawing, amount)
+	account.thawEndTimestamp = c.timestamp() + uint64(DefaultTapEscrowThawingPeriod/time.Second)
+
+	return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{tapThawEventTopic, addressTopic(inv.from), addressTopic(receiver)}, "uint256,uint256,uint256", amount, new(big.Int).Set(account.tokensThawing), new(big.Int).SetUint64(account.thawEndTimestamp))
+}
+
+func (c *Chain) tapEscrowWithdraw(inv *invocation, args []interface{}) ([]interface{}, error) {
+	receiver := args[0].(eth.Address)
+
+	account := c.tapEscrowAccount(inv.from, receiver)
+	if account.thawEndTimestamp == 0 {
+		return nil, revert("EscrowNotThawing")
+	}
+	if c.timestamp() < account.thawEndTimestamp {
+		return nil, revert("EscrowStillThawing")
+	}
+
+	amount := new(big.Int).Set(account.tokensThawing)
+	if amount.Cmp(account.balance) > 0 {
+		amount.Set(account.balance)
+	}
+
+	account.balance.Sub(account.balance, amount)
+	account.tokensThawing.SetInt64(0)
+	account.thawEndTimestamp = 0
+
+	if err := c.moveGRT(inv, eth.MustNewAddress(TapEscrowAddress), inv.from, amount); err != nil {
+		return nil, err
+	}
+
+	return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{tapWithdrawEventTopic, addressTopic(inv.from), addressTopic(receiver)}, "uint256", amount)
+}
+
+func (c *Chain) tapAuthorizeSigner(inv *invocation, args []interface{}) ([]interface{}, error) {
+	signer, proofDeadline, proof := args[0].(eth.Address), args[1].(*big.Int), args[2].([]byte)
+
+	if _, found := c.tapSigners[key(signer)]; found {
+		return nil, revert("SignerAlreadyAuthorized")
+	}
+	if !proofDeadline.IsUint64() || proofDeadline.Uint64() < c.timestamp() {
+		return nil, revert("InvalidSignerProof")
+	}
+
+	recovered, err := tap.RecoverSignerProof(c.chainID, proofDeadline.Uint64(), common.BytesToAddress(inv.from), proof)
+	if err != nil || !bytes.Equal(recovered.Bytes(), signer) {
+		return nil, revert("InvalidSignerProof")
+	}
+
+	c.tapSigners[key(signer)] = &tapSigner{sender: inv.from}
+
+	return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{authorizeSignerEventTopic, addressTopic(signer), addressTopic(inv.from)}, "")
+}
+
+func (c *Chain) senderSigner(inv *invocation, signer eth.Address) (*tapSigner, error) {
+	authorized, found := c.tapSigners[key(signer)]
+	if !found || !bytes.Equal(authorized.sender, inv.from) {
+		return nil, revert("SignerNotAuthorizedBySender")
+	}
+
+	return authorized, nil
+}
+
+func (c *Chain) tapThawSigner(inv *invocation, args []interface{}) ([]interface{}, error) {
+	signer := args[0].(eth.Address)
+
+	authorized, err := c.senderSigner(inv, signer)
+	if err != nil {
+		return nil, err
+	}
+	authorized.thawEndTimestamp = c.timestamp() + uint64(DefaultTapRevokeSignerThawingPeriod/time.Second)
+
+	return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{thawSignerEventTopic, addressTopic(inv.from), addressTopic(signer)}, "uint256", new(big.Int).SetUint64(authorized.thawEndTimestamp))
+}
+
+func (c *Chain) tapCancelThawSigner(inv *invocation, args []interface{}) ([]interface{}, error) {
+	signer := args[0].(eth.Address)
+
+	authorized, err := c.senderSigner(inv, signer)
+	if err != nil {
+		return nil, err
+	}
+	if authorized.thawEndTimestamp == 0 {
+		return nil, revert("SignerNotThawing")
+	}
+	thawEndTimestamp := authorized.thawEndTimestamp
+	authorized.thawEndTimestamp = 0
+
+	return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{cancelThawSignerEventTopic, addressTopic(inv.from), addressTopic(signer)}, "uint256", new(big.Int).SetUint64(thawEndTimestamp))
+}
+
+func (c *Chain) tapRevokeAuthorizedSigner(inv *invocation, args []interface{}) ([]interface{}, error) {
+	signer := args[0].(eth.Address)
+
+	authorized, err := c.senderSigner(inv, signer)
+	if err != nil {
+		return nil, err
+	}
+	if authorized.thawEndTimestamp == 0 {
+		return nil, revert("SignerNotThawing")
+	}
+	if c.timestamp() < authorized.thawEndTimestamp {
+		return nil, revert("SignerStillThawing")
+	}
+
+	delete(c.tapSigners, key(signer))
+
+	return nil, c.emit(inv, TapEscrowAddress, []eth.Hash{revokeAuthorizedSignerTopic, addressTopic(inv.from), addressTopic(signer)}, "")
+}
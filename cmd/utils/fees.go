@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// MaxPPM is the parts-per-million denominator used by the Staking contract
+// percentages.
+const MaxPPM = 1_000_000
+
+// FeeParameters are the protocol and indexer settings that decide how a
+// payment collected on an allocation is split.
+type FeeParameters struct {
+	ProtocolPercentage uint32
+	CurationPercentage uint32
+	QueryFeeCut        uint32
+	Curated            bool
+	HasDelegation      bool
+}
+
+// PaymentBreakdown is how a gross payment is split by `collect`.
+type PaymentBreakdown struct {
+	Gross          *big.Int
+	ProtocolTax    *big.Int
+	CurationFees   *big.Int
+	DelegatorShare *big.Int
+	IndexerShare   *big.Int
+}
+
+func (b *PaymentBreakdown) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Payment breakdown (before the rebate cap):\n")
+	fmt.Fprintf(&out, "  Gross amount:        %s\n", FormatGRT(b.Gross))
+	fmt.Fprintf(&out, "  Protocol tax burned: %s\n", FormatGRT(b.ProtocolTax))
+	fmt.Fprintf(&out, "  Curation share:      %s\n", FormatGRT(b.CurationFees))
+	fmt.Fprintf(&out, "  Delegator share:     %s\n", FormatGRT(b.DelegatorShare))
+	fmt.Fprintf(&out, "  Indexer share:       %s\n", FormatGRT(b.IndexerShare))
+	fmt.Fprintf(&out, "  The exponential rebate cap (lambda/alpha) of the Staking contract is not modeled: once the allocation\n")
+	fmt.Fprintf(&out, "  is closed, the indexer and delegators may receive less than their share, the rest staying in the rebate pool")
+
+	return out.String()
+}
+
+func GetFeeParametersCall(ctx context.Context, cli *ethrpc.Client, indexer string, deploymentID string) (*FeeParameters, error) {
+	parameters := &FeeParameters{}
+	batch := NewBatch(cli)
+	batch.FeeParameters(eth.MustNewAddress(indexer), deploymentID, parameters)
+	if err := batch.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	return parameters, nil
+}
+
+// Breakdown splits gross the same way the Staking contract does, before any
+// rebate cap is applied: the protocol tax is taken first, curation fees from
+// what is left, then the indexer cut is rounded down and the delegators get
+// the rest.
+func (p *FeeParameters) Breakdown(gross *big.Int) *PaymentBreakdown {
+	protocolTax := ppm(gross, p.ProtocolPercentage)
+	queryFees := new(big.Int).Sub(gross, protocolTax)
+
+	curationFees := big.NewInt(0)
+	if p.Curated {
+		curationFees = ppm(queryFees, p.CurationPercentage)
+	}
+	queryFees.Sub(queryFees, curationFees)
+
+	delegatorShare := big.NewInt(0)
+	if p.HasDelegation && p.QueryFeeCut < MaxPPM {
+		delegatorShare = new(big.Int).Sub(queryFees, ppm(queryFees, p.QueryFeeCut))
+	}
+
+	return &PaymentBreakdown{
+		Gross:          new(big.Int).Set(gross),
+		ProtocolTax:    protocolTax,
+		CurationFees:   curationFees,
+		DelegatorShare: delegatorShare,
+		IndexerShare:   new(big.Int).Sub(queryFees, delegatorShare),
+	}
+}
+
+// GrossForNet returns the smallest gross amount for which the indexer share
+// is at least net.
+func (p *FeeParameters) GrossForNet(net *big.Int) (*big.Int, error) {
+	if net.Sign() <= 0 {
+		return big.NewInt(0), nil
+	}
+
+	// Each cut keeps a PPM fraction of what the previous one left
+	kept := []int64{int64(MaxPPM) - int64(p.ProtocolPercentage), MaxPPM, MaxPPM}
+	if p.Curated {
+		kept[1] = int64(MaxPPM) - int64(p.CurationPercentage)
+	}
+	if p.HasDelegation && p.QueryFeeCut < MaxPPM {
+		kept[2] = int64(p.QueryFeeCut)
+	}
+
+	numerator := new(big.Int).Mul(net, new(big.Int).Exp(big.NewInt(MaxPPM), big.NewInt(3), nil))
+	denominator := big.NewInt(1)
+	for _, fraction := range kept {
+		if fraction <= 0 {
+			return nil, fmt.Errorf("no part of the payment reaches the indexer with the current fee parameters")
+		}
+		denominator.Mul(denominator, big.NewInt(fraction))
+	}
+	gross := new(big.Int).Div(new(big.Int).Add(numerator, new(big.Int).Sub(denominator, big.NewInt(1))), denominator)
+
+	// The contract rounds each cut down, the exact answer is a few wei away
+	for p.Breakdown(gross).IndexerShare.Cmp(net) < 0 {
+		gross.Add(gross, big.NewInt(1))
+	}
+	for less := new(big.Int).Sub(gross, big.NewInt(1)); less.Sign() > 0 && p.Breakdown(less).IndexerShare.Cmp(net) >= 0; less.Sub(less, big.NewInt(1)) {
+		gross.Set(less)
+	}
+
+	return gross, nil
+}
+
+func ppm(amount *big.Int, percentage uint32) *big.Int {
+	out := new(big.Int).Mul(amount, big.NewInt(int64(percentage)))
+	return out.Div(out, big.NewInt(MaxPPM))
+}
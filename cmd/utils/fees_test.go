@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBreakdown(t *testing.T) {
+	params := &FeeParameters{ProtocolPercentage: 10_000, CurationPercentage: 100_000, QueryFeeCut: 333_333, Curated: true, HasDelegation: true}
+
+	// tax 1% of gross, curation 10% of what is left after the tax, indexer
+	// cut rounded down, delegators get the remainder
+	breakdown := params.Breakdown(big.NewInt(1_000_003))
+	for name, got := range map[string]*big.Int{
+		"protocol tax":    breakdown.ProtocolTax,
+		"curation fees":   breakdown.CurationFees,
+		"delegator share": breakdown.DelegatorShare,
+		"indexer share":   breakdown.IndexerShare,
+	} {
+		want := map[string]int64{"protocol tax": 10_000, "curation fees": 99_000, "delegator share": 594_003, "indexer share": 297_000}[name]
+		if got.Int64() != want {
+			t.Errorf("%s = %s, want %d", name, got, want)
+		}
+	}
+}
+
+func TestBreakdownFullQueryFeeCut(t *testing.T) {
+	params := &FeeParameters{ProtocolPercentage: 10_000, QueryFeeCut: MaxPPM, HasDelegation: true}
+
+	breakdown := params.Breakdown(big.NewInt(1_000_000))
+	if breakdown.DelegatorShare.Sign() != 0 || breakdown.IndexerShare.Int64() != 990_000 {
+		t.Errorf("delegator share %s, indexer share %s, want 0 and 990000", breakdown.DelegatorShare, breakdown.IndexerShare)
+	}
+}
+
+func TestGrossForNet(t *testing.T) {
+	for _, params := range []*FeeParameters{
+		{ProtocolPercentage: 10_000},
+		{ProtocolPercentage: 10_000, CurationPercentage: 100_000, Curated: true},
+		{ProtocolPercentage: 10_000, QueryFeeCut: 333_333, HasDelegation: true},
+		{ProtocolPercentage: 10_000, CurationPercentage: 100_000, QueryFeeCut: 777_777, Curated: true, HasDelegation: true},
+	} {
+		for _, net := range []int64{1, 7, 999_999, 123_456_789_012_345_678} {
+			gross, err := params.GrossForNet(big.NewInt(net))
+			if err != nil {
+				t.Fatalf("%+v: %s", params, err)
+			}
+
+			if got := params.Breakdown(gross).IndexerShare; got.Cmp(big.NewInt(net)) < 0 {
+				t.Errorf("%+v: gross %s leaves %s to the indexer, want at least %d", params, gross, got, net)
+			}
+			less := new(big.Int).Sub(gross, big.NewInt(1))
+			if got := params.Breakdown(less).IndexerShare; got.Cmp(big.NewInt(net)) >= 0 {
+				t.Errorf("%+v: gross %s is not the smallest, %s already leaves %s", params, gross, less, got)
+			}
+		}
+	}
+}
+
+func TestGrossForNetNothingReachesIndexer(t *testing.T) {
+	params := &FeeParameters{ProtocolPercentage: MaxPPM}
+	if _, err := params.GrossForNet(big.NewInt(1)); err == nil {
+		t.Fatal("expected an error when the protocol tax takes everything")
+	}
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// Provision mirrors the leading fields of the HorizonStaking `Provision`
+// struct, the tokens a service provider committed to a verifier (data
+// service) such as SubgraphService.
+type Provision struct {
+	Tokens         *big.Int
+	TokensThawing  *big.Int
+	SharesThawing  *big.Int
+	MaxVerifierCut uint32
+	ThawingPeriod  uint64
+	CreatedAt      uint64
+}
+
+// ProvisionCapacity holds the figures needed to compute how many tokens an
+// indexer can still allocate on SubgraphService.
+type ProvisionCapacity struct {
+	Indexer         eth.Address
+	SubgraphService eth.Address
+	Provision       *Provision
+	Allocated       *big.Int
+}
+
+// Available is the provisioned tokens not thawing nor already allocated.
+func (c *ProvisionCapacity) Available() *big.Int {
+	available := new(big.Int).Sub(c.Provision.Tokens, c.Provision.TokensThawing)
+	available.Sub(available, c.Allocated)
+	if available.Sign() < 0 {
+		return big.NewInt(0)
+	}
+
+	return available
+}
+
+func (c *ProvisionCapacity) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Indexer %s provision to SubgraphService:\n", c.Indexer.Pretty())
+	fmt.Fprintf(&out, "  Provisioned:       %s\n", FormatGRT(c.Provision.Tokens))
+	fmt.Fprintf(&out, "  Thawing:           %s\n", FormatGRT(c.Provision.TokensThawing))
+	fmt.Fprintf(&out, "  Allocated:         %s\n", FormatGRT(c.Allocated))
+	fmt.Fprintf(&out, "  Available:         %s", FormatGRT(c.Available()))
+
+	return out.String()
+}
+
+func GetProvisionCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, indexer string) (*Provision, error) {
+	out, err := contractCall(ctx, cli, profile.HorizonStaking, "getProvision(address,address) (uint256,uint256,uint256,uint32,uint64,uint64)", eth.MustNewAddress(indexer), eth.MustNewAddress(profile.SubgraphService))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provision{
+		Tokens:         out[0].(*big.Int),
+		TokensThawing:  out[1].(*big.Int),
+		SharesThawing:  out[2].(*big.Int),
+		MaxVerifierCut: out[3].(uint32),
+		ThawingPeriod:  out[4].(uint64),
+		CreatedAt:      out[5].(uint64),
+	}, nil
+}
+
+// CheckProvisionCapacity is the Horizon counterpart of CheckStakeCapacity,
+// checking amount against the indexer provision to SubgraphService.
+func CheckProvisionCapacity(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, indexer string, amount *big.Int) (*ProvisionCapacity, error) {
+	capacity := &ProvisionCapacity{}
+	batch := NewBatch(cli)
+	batch.ProvisionCapacity(profile, eth.MustNewAddress(indexer), capacity)
+	if err := batch.Do(ctx); err != nil {
+		return nil, fmt.Errorf("fetching provision: %w", err)
+	}
+
+	return capacity, capacity.CheckCapacity(amount)
+}
+
+// CheckCapacity returns an error when the indexer has no provision or when
+// amount exceeds what is still available to allocate.
+func (c *ProvisionCapacity) CheckCapacity(amount *big.Int) error {
+	if c.Provision.Tokens.Sign() == 0 {
+		return fmt.Errorf("indexer %s has no provision to SubgraphService %s", c.Indexer.Pretty(), c.SubgraphService.Pretty())
+	}
+
+	if amount.Cmp(c.Available()) > 0 {
+		maxGRT := new(big.Int).Div(c.Available(), ConvertToWei(1))
+		return fmt.Errorf("allocation amount %s exceeds indexer %s available provision %s. maximum possible allocation amount is %s GRT", FormatGRT(amount), c.Indexer.Pretty(), FormatGRT(c.Available()), maxGRT)
+	}
+
+	return nil
+}
+
+// IsProvisionOperatorCall tells whether operator is authorized on the indexer
+// provision to SubgraphService, the Horizon counterpart of IsOperatorCall.
+func IsProvisionOperatorCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, operator eth.Address, indexer eth.Address) (bool, error) {
+	out, err := contractCall(ctx, cli, profile.HorizonStaking, "isAuthorized(address,address,address) (bool)", indexer, eth.MustNewAddress(profile.SubgraphService), operator)
+	if err != nil {
+		return false, err
+	}
+
+	return out[0].(bool), nil
+}
+
+// CheckProvisionOperator is the Horizon counterpart of CheckOperator: the
+// operator must be authorized on the indexer provision to SubgraphService.
+func CheckProvisionOperator(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, operator string, indexer string) error {
+	if bytes.Equal(eth.MustNewAddress(operator), eth.MustNewAddress(indexer)) {
+		return nil
+	}
+
+	isOperator, err := IsProvisionOperatorCall(ctx, cli, profile, eth.MustNewAddress(operator), eth.MustNewAddress(indexer))
+	if err != nil {
+		return fmt.Errorf("failed to check operator authorization: %w", err)
+	}
+
+	if !isOperator {
+		return NotProvisionOperatorError(eth.MustNewAddress(operator), eth.MustNewAddress(indexer))
+	}
+
+	return nil
+}
+
+// NotProvisionOperatorError is the CheckProvisionOperator error, for callers
+// reading the operator authorization in a Batch.
+func NotProvisionOperatorError(operator eth.Address, indexer eth.Address) error {
+	return fmt.Errorf("signer %s is not an authorized operator of indexer %s provision to SubgraphService. the indexer must first run `receivepayment set-operator --operator %s` with this network profile", operator.Pretty(), indexer.Pretty(), operator.Pretty())
+}
+
+// ServiceAllocation mirrors the leading fields of the SubgraphService
+// allocation state. CreatedAt and ClosedAt are timestamps, not epochs.
+type ServiceAllocation struct {
+	Indexer              eth.Address
+	SubgraphDeploymentID []byte
+	Tokens               *big.Int
+	CreatedAt            *big.Int
+	ClosedAt             *big.Int
+}
+
+func (a *ServiceAllocation) Exists() bool {
+	return !bytes.Equal(a.Indexer, make([]byte, 20))
+}
+
+func (a *ServiceAllocation) IsOpen() bool {
+	return a.Exists() && a.ClosedAt.Sign() == 0
+}
+
+func GetServiceAllocationCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, allocationID string) (*ServiceAllocation, error) {
+	out, err := contractCall(ctx, cli, profile.SubgraphService, "getAllocation(address) (address,bytes32,uint256,uint256,uint256)", eth.MustNewAddress(allocationID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceAllocation{
+		Indexer:              out[0].(eth.Address),
+		SubgraphDeploymentID: out[1].([]byte),
+		Tokens:               out[2].(*big.Int),
+		CreatedAt:            out[3].(*big.Int),
+		ClosedAt:             out[4].(*big.Int),
+	}, nil
+}
+
+// EncodeStartServiceData is the `data` of SubgraphService
+// `startService(indexer, data)`: abi.encode(deploymentID, tokens,
+// allocationID, proof).
+func EncodeStartServiceData(deploymentID []byte, tokens *big.Int, allocationID eth.Address, proof []byte) ([]byte, error) {
+	return abiEncode("bytes32,uint256,address,bytes", deploymentID, tokens, allocationID, proof)
+}
+
+// EncodeStopServiceData is the `data` of SubgraphService
+// `stopService(indexer, data)`: abi.encode(allocationID).
+func EncodeStopServiceData(allocationID eth.Address) ([]byte, error) {
+	return abiEncode("address", allocationID)
+}
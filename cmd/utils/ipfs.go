@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	"github.com/multiformats/go-multihash"
+)
+
+// deploymentDigestLength is the size of a sha2-256 digest, stored on chain as
+// the bytes32 subgraph deployment ID.
+const deploymentDigestLength = 32
+
+// cidv1 is the only CID version besides the implicit v0 of Qm hashes.
+const cidv1 = 1
+
+var cidBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ConvertIPFSHashToByteString returns the bytes32 sha2-256 digest of a
+// deployment ID, given as a base58 Qm hash (CIDv0), a CIDv1 (multibase
+// base32, base58btc or base16) or a 0x-prefixed 32 bytes hex digest. Any other
+// hash function or digest length is rejected.
+func ConvertIPFSHashToByteString(hash string) ([]byte, error) {
+	hash = strings.TrimSpace(hash)
+
+	switch {
+	case hash == "":
+		return nil, fmt.Errorf("empty IPFS hash")
+
+	case strings.HasPrefix(hash, "0x") || strings.HasPrefix(hash, "0X"):
+		digest, err := hex.DecodeString(hash[2:])
+		if err != nil {
+			return nil, fmt.Errorf("decoding hex digest: %w", err)
+		}
+		if len(digest) != deploymentDigestLength {
+			return nil, fmt.Errorf("expected a %d bytes hex digest, got %d byte(s)", deploymentDigestLength, len(digest))
+		}
+		return digest, nil
+
+	case strings.HasPrefix(hash, "Qm"):
+		decoded, err := multihash.FromB58String(hash)
+		if err != nil {
+			return nil, fmt.Errorf("decoding base58 string: %w", err)
+		}
+		return sha256Digest(decoded)
+	}
+
+	return cidv1Digest(hash)
+}
+
+// ConvertByteStringToIPFSHash is the reverse of ConvertIPFSHashToByteString,
+// turning a bytes32 sha2-256 digest back into its base58 Qm form.
+func ConvertByteStringToIPFSHash(digest []byte) (string, error) {
+	if len(digest) != deploymentDigestLength {
+		return "", fmt.Errorf("expected a %d bytes digest, got %d byte(s)", deploymentDigestLength, len(digest))
+	}
+
+	encoded, err := multihash.Encode(digest, multihash.SHA2_256)
+	if err != nil {
+		return "", fmt.Errorf("encoding multihash: %w", err)
+	}
+
+	return multihash.Multihash(encoded).B58String(), nil
+}
+
+// cidv1Digest decodes a multibase CIDv1: <version><content codec><multihash>,
+// the version and codec being unsigned varints.
+func cidv1Digest(cid string) ([]byte, error) {
+	var decoded []byte
+	var err error
+	switch cid[0] {
+	case 'b':
+		decoded, err = cidBase32.DecodeString(strings.ToUpper(cid[1:]))
+	case 'B':
+		decoded, err = cidBase32.DecodeString(cid[1:])
+	case 'z':
+		decoded, err = base58.Decode(cid[1:])
+	case 'f', 'F':
+		decoded, err = hex.DecodeString(cid[1:])
+	default:
+		return nil, fmt.Errorf("unsupported IPFS hash %q, expected a Qm hash, a CIDv1 or a 0x-prefixed hex digest", cid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding CID multibase: %w", err)
+	}
+
+	version, n := binary.Uvarint(decoded)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid CID version")
+	}
+	if version != cidv1 {
+		return nil, fmt.Errorf("unsupported CID version %d", version)
+	}
+	decoded = decoded[n:]
+
+	if _, n = binary.Uvarint(decoded); n <= 0 {
+		return nil, fmt.Errorf("invalid CID content codec")
+	}
+
+	return sha256Digest(decoded[n:])
+}
+
+// sha256Digest checks that encoded is a complete sha2-256 multihash and
+// returns its digest.
+func sha256Digest(encoded []byte) ([]byte, error) {
+	decoded, err := multihash.Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding multihash: %w", err)
+	}
+
+	if decoded.Code != multihash.SHA2_256 {
+		return nil, fmt.Errorf("unsupported hash function %s (0x%x), expected sha2-256", decoded.Name, decoded.Code)
+	}
+	if len(decoded.Digest) != deploymentDigestLength {
+		return nil, fmt.Errorf("expected a %d bytes sha2-256 digest, got %d byte(s)", deploymentDigestLength, len(decoded.Digest))
+	}
+
+	return decoded.Digest, nil
+}
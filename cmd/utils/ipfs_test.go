@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/mr-tron/base58"
+	"github.com/multiformats/go-multihash"
+)
+
+// cidForms returns digest as a Qm hash, as a CIDv1 in each supported
+// multibase, and as a 0x-prefixed hex digest.
+func cidForms(t testing.TB, digest []byte) []string {
+	t.Helper()
+
+	qm, err := ConvertByteStringToIPFSHash(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := multihash.Encode(digest, multihash.SHA2_256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cid := binary.AppendUvarint(binary.AppendUvarint(nil, cidv1), 0x70) // dag-pb
+	cid = append(cid, encoded...)
+
+	return []string{
+		qm,
+		"b" + strings.ToLower(cidBase32.EncodeToString(cid)),
+		"B" + cidBase32.EncodeToString(cid),
+		"z" + base58.Encode(cid),
+		"f" + hex.EncodeToString(cid),
+		"0x" + hex.EncodeToString(digest),
+	}
+}
+
+func FuzzConvertIPFSHashToByteString(f *testing.F) {
+	for _, form := range cidForms(f, bytes.Repeat([]byte{0xab}, deploymentDigestLength)) {
+		f.Add(form)
+	}
+	for _, seed := range []string{"", "Qm", "0x", "0xabcd", "b", "z1", "f01", "bafy", "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, hash string) {
+		digest, err := ConvertIPFSHashToByteString(hash)
+		if err != nil {
+			return
+		}
+		if len(digest) != deploymentDigestLength {
+			t.Fatalf("%q decoded to a %d bytes digest", hash, len(digest))
+		}
+
+		qm, err := ConvertByteStringToIPFSHash(digest)
+		if err != nil {
+			t.Fatalf("%q decoded to %x which does not encode back: %s", hash, digest, err)
+		}
+		again, err := ConvertIPFSHashToByteString(qm)
+		if err != nil || !bytes.Equal(again, digest) {
+			t.Fatalf("%q decoded to %x, its Qm hash %s decodes to %x (%v)", hash, digest, qm, again, err)
+		}
+	})
+}
+
+func FuzzConvertByteStringToIPFSHashRoundTrip(f *testing.F) {
+	f.Add(make([]byte, deploymentDigestLength))
+	f.Add(bytes.Repeat([]byte{0xff}, deploymentDigestLength))
+	f.Add([]byte("short"))
+
+	f.Fuzz(func(t *testing.T, digest []byte) {
+		if len(digest) != deploymentDigestLength {
+			if _, err := ConvertByteStringToIPFSHash(digest); err == nil {
+				t.Fatalf("%d bytes digest accepted", len(digest))
+			}
+			return
+		}
+
+		for _, form := range cidForms(t, digest) {
+			out, err := ConvertIPFSHashToByteString(form)
+			if err != nil {
+				t.Fatalf("%s: %s", form, err)
+			}
+			if !bytes.Equal(out, digest) {
+				t.Fatalf("%s decoded to %x, want %x", form, out, digest)
+			}
+		}
+	})
+}
@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+)
+
+const (
+	LedgerActionOpenAllocation  = "open-allocation"
+	LedgerActionCloseAllocation = "close-allocation"
+	LedgerActionApprove         = "approve"
+	LedgerActionCollect         = "collect"
+
+	LedgerActionEscrowDeposit    = "escrow-deposit"
+	LedgerActionEscrowThaw       = "escrow-thaw"
+	LedgerActionEscrowCancelThaw = "escrow-cancel-thaw"
+	LedgerActionEscrowWithdraw   = "escrow-withdraw"
+
+	LedgerActionTapRedeem = "tap-redeem"
+
+	LedgerActionTapEscrowDeposit    = "tap-escrow-deposit"
+	LedgerActionTapEscrowThaw       = "tap-escrow-thaw"
+	LedgerActionTapEscrowCancelThaw = "tap-escrow-cancel-thaw"
+	LedgerActionTapEscrowWithdraw   = "tap-escrow-withdraw"
+	LedgerActionTapAuthorizeSigner  = "tap-authorize-signer"
+	LedgerActionTapThawSigner       = "tap-thaw-signer"
+	LedgerActionTapCancelThawSigner = "tap-cancel-thaw-signer"
+	LedgerActionTapRevokeSigner     = "tap-revoke-signer"
+)
+
+const (
+	LedgerStatusSuccess  = "success"
+	LedgerStatusReverted = "reverted"
+	LedgerStatusFailed   = "failed"
+)
+
+// LedgerEntry is one action recorded in the local ledger. Amounts are in wei.
+type LedgerEntry struct {
+	Time         time.Time `json:"time"`
+	Network      string    `json:"network"`
+	Action       string    `json:"action"`
+	Sender       string    `json:"sender"`
+	Indexer      string    `json:"indexer,omitempty"`
+	AllocationID string    `json:"allocationId,omitempty"`
+	DeploymentID string    `json:"deploymentId,omitempty"`
+	Amount       string    `json:"amount,omitempty"`
+	Reference    string    `json:"reference,omitempty"`
+	Trx          string    `json:"trx,omitempty"`
+	GasUsed      uint64    `json:"gasUsed,omitempty"`
+	FeeWei       string    `json:"feeWei,omitempty"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Ledger is an append-only JSONL file of LedgerEntry. A nil *Ledger records
+// nothing, which is what NewLedger returns for an empty path.
+type Ledger struct {
+	path string
+}
+
+func NewLedger(path string) *Ledger {
+	if path == "" {
+		return nil
+	}
+
+	return &Ledger{path: path}
+}
+
+// DefaultLedgerFile is where actions are recorded when no ledger file is given.
+func DefaultLedgerFile() string {
+	return filepath.Join(DefaultDataDir(), "ledger.jsonl")
+}
+
+func (l *Ledger) Append(entry *LedgerEntry) error {
+	if l == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Record completes entry and appends it. When trx is set, its receipt gives
+// the gas used, the fee and the status; callErr marks the entry as failed.
+// Callers should only warn on error, the action itself already happened.
+func (l *Ledger) Record(ctx context.Context, chain *Chain, entry *LedgerEntry, trx string, callErr error) error {
+	if l == nil {
+		return nil
+	}
+
+	entry.Time = time.Now().UTC()
+	entry.Trx = trx
+	entry.Status = LedgerStatusSuccess
+	if callErr != nil {
+		entry.Status = LedgerStatusFailed
+		entry.Error = callErr.Error()
+	}
+
+	if chainID, err := chain.ChainID(ctx); err == nil {
+		entry.Network = NetworkName(chainID)
+	}
+
+	var recordErr error
+	if trx != "" {
+		receipt, err := chain.Client().TransactionReceipt(ctx, eth.MustNewHash(trx))
+		switch {
+		case err != nil:
+			recordErr = fmt.Errorf("fetching receipt of %s: %w", trx, err)
+		case receipt != nil:
+			fee := new(big.Int).Mul(new(big.Int).SetUint64(uint64(receipt.GasUsed)), new(big.Int).SetUint64(uint64(receipt.EffectiveGasPrice)))
+			entry.GasUsed = uint64(receipt.GasUsed)
+			entry.FeeWei = fee.String()
+			if receipt.Status == nil || *receipt.Status != 1 {
+				entry.Status = LedgerStatusReverted
+			}
+		}
+	}
+
+	if err := l.Append(entry); err != nil {
+		return errors.Join(recordErr, fmt.Errorf("writing ledger %s: %w", l.path, err))
+	}
+
+	return recordErr
+}
+
+// Entries returns the recorded entries with from <= Time < to, a zero bound
+// is open.
+func (l *Ledger) Entries(from, to time.Time) ([]*LedgerEntry, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []*LedgerEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := &LedgerEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("decoding %s line %d: %w", l.path, line, err)
+		}
+
+		if !from.IsZero() && entry.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !entry.Time.Before(to) {
+			continue
+		}
+		out = append(out, entry)
+	}
+
+	return out, scanner.Err()
+}
+
+// NetworkName maps the chain IDs this tool runs against to a readable name.
+func NetworkName(chainID *big.Int) string {
+	switch chainID.Uint64() {
+	case 42161:
+		return "arbitrum-one"
+	case 421614:
+		return "arbitrum-sepolia"
+	}
+
+	return chainID.String()
+}
+
+const (
+	LedgerGroupByIndexer = "indexer"
+	LedgerGroupByMonth   = "month"
+)
+
+// LedgerReportRow aggregates the ledger entries of one group. Payments and
+// Paid only count successful collects, Failed counts the failed or reverted
+// actions and Fees covers every recorded transaction.
+type LedgerReportRow struct {
+	Group             string
+	Payments          int
+	Paid              *big.Int
+	AllocationsOpened int
+	AllocationsClosed int
+	Transactions      int
+	Failed            int
+	GasUsed           uint64
+	Fees              *big.Int
+}
+
+// BuildLedgerReport groups entries by indexer or by month (UTC), rows are
+// sorted by group.
+func BuildLedgerReport(entries []*LedgerEntry, groupBy string) ([]*LedgerReportRow, error) {
+	var groupOf func(entry *LedgerEntry) string
+	switch groupBy {
+	case LedgerGroupByIndexer:
+		groupOf = func(entry *LedgerEntry) string {
+			if entry.Indexer == "" {
+				return "-"
+			}
+			return strings.ToLower(entry.Indexer)
+		}
+	case LedgerGroupByMonth:
+		groupOf = func(entry *LedgerEntry) string { return entry.Time.UTC().Format("2006-01") }
+	default:
+		return nil, fmt.Errorf("invalid group by %q, must be one of: %s, %s", groupBy, LedgerGroupByIndexer, LedgerGroupByMonth)
+	}
+
+	rows := map[string]*LedgerReportRow{}
+	for _, entry := range entries {
+		group := groupOf(entry)
+		row, found := rows[group]
+		if !found {
+			row = &LedgerReportRow{Group: group, Paid: big.NewInt(0), Fees: big.NewInt(0)}
+			rows[group] = row
+		}
+
+		if entry.Trx != "" {
+			row.Transactions++
+		}
+		row.GasUsed += entry.GasUsed
+		if fee, ok := new(big.Int).SetString(entry.FeeWei, 10); ok {
+			row.Fees.Add(row.Fees, fee)
+		}
+
+		if entry.Status != LedgerStatusSuccess {
+			row.Failed++
+			continue
+		}
+
+		switch entry.Action {
+		case LedgerActionCollect:
+			row.Payments++
+			if amount, ok := new(big.Int).SetString(entry.Amount, 10); ok {
+				row.Paid.Add(row.Paid, amount)
+			}
+		case LedgerActionOpenAllocation:
+			row.AllocationsOpened++
+		case LedgerActionCloseAllocation:
+			row.AllocationsClosed++
+		}
+	}
+
+	out := make([]*LedgerReportRow, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Group < out[j].Group })
+
+	return out, nil
+}
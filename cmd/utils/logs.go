@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// EventTopic returns the topic0 of an event given its canonical signature.
+func EventTopic(signature string) eth.Hash {
+	return eth.Hash(eth.Keccak256([]byte(signature)))
+}
+
+// logRangeErrors are fragments of the messages providers reject an
+// eth_getLogs range with when it spans too many blocks or matches too many
+// logs.
+var logRangeErrors = []string{
+	"block range",
+	"range too large",
+	"range is too large",
+	"too many blocks",
+	"exceed maximum block range",
+	"query returned more than",
+	"response size",
+	"too many results",
+}
+
+// isLogRangeError tells whether err is the endpoint rejecting the size of an
+// eth_getLogs range, as opposed to a failure that a smaller range would not
+// fix.
+func isLogRangeError(err error) bool {
+	var rpcErr *ethrpc.ErrResponse
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+
+	return isLogRangeMessage(rpcErr.Message)
+}
+
+func isLogRangeMessage(message string) bool {
+	message = strings.ToLower(message)
+	for _, fragment := range logRangeErrors {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ScanLogs pages through eth_getLogs from fromBlock to toBlock (inclusive) in
+// ranges of at most chunkSize blocks. When the endpoint rejects a range as too
+// large, it is halved and retried so that provider log limits are respected,
+// then doubled back towards chunkSize after each successful range. Any other
+// error is returned. onChunk is called in block order with the logs of each
+// range and the last block it covered.
+func ScanLogs(ctx context.Context, cli *ethrpc.Client, address string, topics *ethrpc.TopicFilter, fromBlock, toBlock, chunkSize uint64, onChunk func(logs []*ethrpc.LogEntry, scannedTo uint64) error) error {
+	if chunkSize == 0 {
+		return fmt.Errorf("chunk size must be greater than 0")
+	}
+
+	rangeSize := chunkSize
+	for start := fromBlock; start <= toBlock; {
+		end := start + rangeSize - 1
+		if end > toBlock {
+			end = toBlock
+		}
+
+		logs, err := cli.Logs(ctx, ethrpc.LogsParams{
+			FromBlock: ethrpc.BlockNumber(start),
+			ToBlock:   ethrpc.BlockNumber(end),
+			Address:   eth.MustNewAddress(address),
+			Topics:    topics,
+		})
+		if err != nil {
+			if ctx.Err() != nil || end == start || !isLogRangeError(err) {
+				return fmt.Errorf("fetching logs for blocks %d-%d: %w", start, end, err)
+			}
+
+			rangeSize = (end - start + 1) / 2
+			if logger, loggerErr := GetLogger(ctx); loggerErr == nil {
+				logger.Debug("log range rejected, retrying with a smaller range", "from_block", start, "to_block", end, "range_size", rangeSize, "err", err)
+			}
+			continue
+		}
+
+		if err := onChunk(logs, end); err != nil {
+			return err
+		}
+
+		start = end + 1
+		if rangeSize < chunkSize {
+			rangeSize = min(rangeSize*2, chunkSize)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// logsServer answers eth_getLogs with no logs, rejecting ranges wider than
+// maxRange with message, and records the ranges requested.
+type logsServer struct {
+	maxRange uint64
+	code     int
+	message  string
+	ranges   [][2]uint64
+}
+
+func (s *logsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ID     json.RawMessage `json:"id"`
+		Params []struct {
+			FromBlock string `json:"fromBlock"`
+			ToBlock   string `json:"toBlock"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, _ := strconv.ParseUint(request.Params[0].FromBlock[2:], 16, 64)
+	to, _ := strconv.ParseUint(request.Params[0].ToBlock[2:], 16, 64)
+	s.ranges = append(s.ranges, [2]uint64{from, to})
+
+	w.Header().Set("Content-Type", "application/json")
+	if to-from+1 > s.maxRange {
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":%d,"message":%q}}`, request.ID, s.code, s.message)
+		return
+	}
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":[]}`, request.ID)
+}
+
+func scanTestLogs(t *testing.T, server *logsServer, fromBlock, toBlock, chunkSize uint64) ([]uint64, error) {
+	t.Helper()
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	var scannedTo []uint64
+	err := ScanLogs(context.Background(), ethrpc.NewClient(httpServer.URL), StakingContractAddress, ethrpc.NewTopicFilter(eth.Hash(make([]byte, 32))), fromBlock, toBlock, chunkSize, func(_ []*ethrpc.LogEntry, to uint64) error {
+		scannedTo = append(scannedTo, to)
+		return nil
+	})
+
+	return scannedTo, err
+}
+
+func TestScanLogsShrinksAndGrowsBack(t *testing.T) {
+	for name, server := range map[string]*logsServer{
+		"range message":  {maxRange: 25, code: -32602, message: "eth_getLogs block range is too large, max is 25"},
+		"limit exceeded": {maxRange: 25, code: -32005, message: "query returned more than 10000 results"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			scannedTo, err := scanTestLogs(t, server, 1, 200, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last := scannedTo[len(scannedTo)-1]; last != 200 {
+				t.Fatalf("scanned to %d, want 200", last)
+			}
+
+			// 100 and 50 are rejected, then each successful range doubles
+			// back: 25 succeeds, 50 is rejected again, and so on
+			want := [][2]uint64{{1, 100}, {1, 50}, {1, 25}, {26, 75}, {26, 50}, {51, 100}, {51, 75}}
+			for i, r := range want {
+				if server.ranges[i] != r {
+					t.Fatalf("request %d for blocks %d-%d, want %d-%d (all: %v)", i, server.ranges[i][0], server.ranges[i][1], r[0], r[1], server.ranges)
+				}
+			}
+		})
+	}
+}
+
+func TestScanLogsGrowsBackToChunkSize(t *testing.T) {
+	server := &logsServer{maxRange: 100, code: -32005, message: "query returned more than 10000 results"}
+
+	// only the first request is capped to 10 blocks, the scan must recover
+	// the full chunk size once ranges succeed again
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(server.ranges) == 0 {
+			server.maxRange = 10
+		} else {
+			server.maxRange = 100
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+
+	err := ScanLogs(context.Background(), ethrpc.NewClient(httpServer.URL), StakingContractAddress, ethrpc.NewTopicFilter(eth.Hash(make([]byte, 32))), 1, 400, 100, func(_ []*ethrpc.LogEntry, _ uint64) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][2]uint64{{1, 100}, {1, 50}, {51, 150}, {151, 250}, {251, 350}, {351, 400}}
+	if len(server.ranges) != len(want) {
+		t.Fatalf("requested %v, want %v", server.ranges, want)
+	}
+	for i, r := range want {
+		if server.ranges[i] != r {
+			t.Fatalf("requested %v, want %v", server.ranges, want)
+		}
+	}
+}
+
+func TestScanLogsOtherErrorsFail(t *testing.T) {
+	server := &logsServer{maxRange: 25, code: -32000, message: "header not found"}
+
+	_, err := scanTestLogs(t, server, 1, 200, 100)
+	if err == nil {
+		t.Fatal("scan succeeded, want the endpoint error")
+	}
+	if len(server.ranges) != 1 {
+		t.Errorf("%d requests, want the range not to be shrunk on an unrelated error", len(server.ranges))
+	}
+}
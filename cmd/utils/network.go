@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+)
+
+// Payment backends a network profile selects. Legacy allocates through the
+// Staking `allocateFrom`/`closeAllocation`, Horizon through the provision of
+// the indexer to SubgraphService and `startService`/`stopService`.
+const (
+	BackendLegacy  = "legacy"
+	BackendHorizon = "horizon"
+)
+
+// DefaultNetwork is the built-in profile used when none is selected.
+const DefaultNetwork = "arbitrum-one"
+
+// NetworkProfile is the chain and contracts the commands run against. The
+// legacy contracts are the *ContractAddress constants, the Horizon ones have
+// no built-in default beside HorizonStaking, which upgraded the Staking
+// proxy: a Horizon profile is loaded from a JSON file, e.g.
+//
+//	{
+//	  "name": "arbitrum-one-horizon",
+//	  "chain_id": 42161,
+//	  "backend": "horizon",
+//	  "subgraph_service": "0x...",
+//	  "payments_escrow": "0x...",
+//	  "graph_tally_collector": "0x..."
+//	}
+type NetworkProfile struct {
+	Name    string `json:"name"`
+	ChainID uint64 `json:"chain_id"`
+	Backend string `json:"backend"`
+
+	HorizonStaking      string `json:"horizon_staking,omitempty"`
+	SubgraphService     string `json:"subgraph_service,omitempty"`
+	PaymentsEscrow      string `json:"payments_escrow,omitempty"`
+	GraphTallyCollector string `json:"graph_tally_collector,omitempty"`
+
+	// TapEscrow is the TAP v1 Escrow indexer-service checks senders funded,
+	// it predates Horizon and works with either backend.
+	TapEscrow string `json:"tap_escrow,omitempty"`
+	// TapVerifier is the TAPVerifier TAP v1 receipts and RAVs are signed
+	// for, the TAP v1 Escrow redeems RAVs through it.
+	TapVerifier string `json:"tap_verifier,omitempty"`
+}
+
+var builtinNetworks = map[string]*NetworkProfile{
+	DefaultNetwork: {Name: DefaultNetwork, ChainID: ArbitrumOneChainID, Backend: BackendLegacy},
+}
+
+// DefaultNetworkProfile is the value of the NETWORK_PAYMENT_NETWORK env var,
+// or DefaultNetwork.
+func DefaultNetworkProfile() string {
+	if network := os.Getenv("NETWORK_PAYMENT_NETWORK"); network != "" {
+		return network
+	}
+
+	return DefaultNetwork
+}
+
+// LoadNetworkProfile returns the built-in profile named nameOrFile, or reads
+// it as a JSON profile file. Empty selects DefaultNetwork.
+func LoadNetworkProfile(nameOrFile string) (*NetworkProfile, error) {
+	if nameOrFile == "" {
+		nameOrFile = DefaultNetwork
+	}
+
+	if profile, found := builtinNetworks[nameOrFile]; found {
+		copied := *profile
+		return &copied, nil
+	}
+
+	content, err := os.ReadFile(nameOrFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown network %q, expected %s or a network profile file", nameOrFile, strings.Join(builtinNetworkNames(), ", "))
+		}
+		return nil, fmt.Errorf("reading network profile: %w", err)
+	}
+
+	profile := &NetworkProfile{}
+	if err := json.Unmarshal(content, profile); err != nil {
+		return nil, fmt.Errorf("decoding network profile %s: %w", nameOrFile, err)
+	}
+	if profile.Name == "" {
+		profile.Name = nameOrFile
+	}
+	if profile.ChainID == 0 {
+		profile.ChainID = ArbitrumOneChainID
+	}
+	if profile.Backend == "" {
+		profile.Backend = BackendLegacy
+	}
+	if profile.HorizonStaking == "" {
+		profile.HorizonStaking = StakingContractAddress
+	}
+
+	if err := profile.validate(); err != nil {
+		return nil, fmt.Errorf("network profile %s: %w", nameOrFile, err)
+	}
+
+	return profile, nil
+}
+
+func (p *NetworkProfile) validate() error {
+	switch p.Backend {
+	case BackendLegacy:
+	case BackendHorizon:
+		if p.SubgraphService == "" {
+			return fmt.Errorf("the horizon backend requires subgraph_service")
+		}
+	default:
+		return fmt.Errorf("unknown backend %q, expected %s or %s", p.Backend, BackendLegacy, BackendHorizon)
+	}
+
+	for field, address := range map[string]string{
+		"horizon_staking":       p.HorizonStaking,
+		"subgraph_service":      p.SubgraphService,
+		"payments_escrow":       p.PaymentsEscrow,
+		"graph_tally_collector": p.GraphTallyCollector,
+		"tap_escrow":            p.TapEscrow,
+		"tap_verifier":          p.TapVerifier,
+	} {
+		if address == "" {
+			continue
+		}
+		if _, err := eth.NewAddress(address); err != nil {
+			return fmt.Errorf("invalid %s address %q: %w", field, address, err)
+		}
+	}
+
+	return nil
+}
+
+// Horizon tells whether the profile allocates through SubgraphService.
+func (p *NetworkProfile) Horizon() bool {
+	return p.Backend == BackendHorizon
+}
+
+func builtinNetworkNames() []string {
+	names := make([]string, 0, len(builtinNetworks))
+	for name := range builtinNetworks {
+		names = append(names, name)
+	}
+
+	return names
+}
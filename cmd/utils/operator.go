@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+func IsOperatorCall(ctx context.Context, cli *ethrpc.Client, operator eth.Address, indexer eth.Address) (bool, error) {
+	out, err := contractCall(ctx, cli, StakingContractAddress, "isOperator(address,address) (bool)", operator, indexer)
+	if err != nil {
+		return false, err
+	}
+
+	return out[0].(bool), nil
+}
+
+// CheckOperator returns an error naming both addresses when operator is
+// neither the indexer itself nor one of its authorized operators on the
+// Staking contract.
+func CheckOperator(ctx context.Context, cli *ethrpc.Client, operator eth.Address, indexer eth.Address) error {
+	if bytes.Equal(operator, indexer) {
+		return nil
+	}
+
+	isOperator, err := IsOperatorCall(ctx, cli, operator, indexer)
+	if err != nil {
+		return fmt.Errorf("failed to check operator authorization: %w", err)
+	}
+
+	if !isOperator {
+		return NotOperatorError(operator, indexer)
+	}
+
+	return nil
+}
+
+// NotOperatorError is the CheckOperator error, for callers reading the
+// operator authorization in a Batch.
+func NotOperatorError(operator eth.Address, indexer eth.Address) error {
+	return fmt.Errorf("signer %s is not an authorized operator of indexer %s. the indexer must first run `receivepayment set-operator --operator %s`", operator.Pretty(), indexer.Pretty(), operator.Pretty())
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+var (
+	TransferEventTopic        = EventTopic("Transfer(address,address,uint256)")
+	RebateCollectedEventTopic = EventTopic("RebateCollected(address,address,bytes32,address,uint256,uint256,uint256,uint256,uint256,uint256,uint256)")
+)
+
+type TransferEvent struct {
+	From            eth.Address
+	To              eth.Address
+	Value           *big.Int
+	BlockNumber     uint64
+	TransactionHash eth.Hash
+}
+
+func DecodeTransferEvent(log *ethrpc.LogEntry) (*TransferEvent, error) {
+	if len(log.Topics) != 3 || !eventTopicIs(log, TransferEventTopic) {
+		return nil, fmt.Errorf("log is not a Transfer event")
+	}
+
+	data, err := decodeLogData(log, "uint256")
+	if err != nil {
+		return nil, fmt.Errorf("decoding Transfer data: %w", err)
+	}
+
+	return &TransferEvent{
+		From:            eth.Address(log.Topics[1][12:]),
+		To:              eth.Address(log.Topics[2][12:]),
+		Value:           data[0].(*big.Int),
+		BlockNumber:     uint64(log.BlockNumber),
+		TransactionHash: log.TransactionHash,
+	}, nil
+}
+
+// RebateCollectedEvent is emitted by the Staking contract on `collect` and
+// splits the collected tokens between the protocol, curators, delegators and
+// the indexer.
+type RebateCollectedEvent struct {
+	AssetHolder          eth.Address
+	Indexer              eth.Address
+	SubgraphDeploymentID []byte
+	AllocationID         eth.Address
+	Epoch                *big.Int
+	Tokens               *big.Int
+	ProtocolTax          *big.Int
+	CurationFees         *big.Int
+	QueryFees            *big.Int
+	QueryRebates         *big.Int
+	DelegationRewards    *big.Int
+	BlockNumber          uint64
+	TransactionHash      eth.Hash
+}
+
+// Retained is the part of the query fees neither rebated to the indexer nor
+// given to delegators, it stays in the allocation.
+func (e *RebateCollectedEvent) Retained() *big.Int {
+	retained := new(big.Int).Sub(e.QueryFees, e.QueryRebates)
+	return retained.Sub(retained, e.DelegationRewards)
+}
+
+func DecodeRebateCollectedEvent(log *ethrpc.LogEntry) (*RebateCollectedEvent, error) {
+	if len(log.Topics) != 4 || !eventTopicIs(log, RebateCollectedEventTopic) {
+		return nil, fmt.Errorf("log is not a RebateCollected event")
+	}
+
+	data, err := decodeLogData(log, "address", "uint256", "uint256", "uint256", "uint256", "uint256", "uint256", "uint256")
+	if err != nil {
+		return nil, fmt.Errorf("decoding RebateCollected data: %w", err)
+	}
+
+	return &RebateCollectedEvent{
+		AssetHolder:          data[0].(eth.Address),
+		Indexer:              eth.Address(log.Topics[1][12:]),
+		SubgraphDeploymentID: log.Topics[2],
+		AllocationID:         eth.Address(log.Topics[3][12:]),
+		Epoch:                data[1].(*big.Int),
+		Tokens:               data[2].(*big.Int),
+		ProtocolTax:          data[3].(*big.Int),
+		CurationFees:         data[4].(*big.Int),
+		QueryFees:            data[5].(*big.Int),
+		QueryRebates:         data[6].(*big.Int),
+		DelegationRewards:    data[7].(*big.Int),
+		BlockNumber:          uint64(log.BlockNumber),
+		TransactionHash:      log.TransactionHash,
+	}, nil
+}
+
+// PaymentLogs holds the GRT transfers, Staking rebates and allocations
+// created (by a batched payment) found in a receipt.
+type PaymentLogs struct {
+	Transfers   []*TransferEvent
+	Rebates     []*RebateCollectedEvent
+	Allocations []*AllocationCreatedEvent
+}
+
+func DecodePaymentLogs(receipt *ethrpc.TransactionReceipt) (*PaymentLogs, error) {
+	out := &PaymentLogs{}
+	for _, log := range receipt.Logs {
+		switch {
+		case addressIs(log.Address, GRTTokenContractAddress) && eventTopicIs(log, TransferEventTopic):
+			event, err := DecodeTransferEvent(log)
+			if err != nil {
+				return nil, err
+			}
+			out.Transfers = append(out.Transfers, event)
+		case addressIs(log.Address, StakingContractAddress) && eventTopicIs(log, RebateCollectedEventTopic):
+			event, err := DecodeRebateCollectedEvent(log)
+			if err != nil {
+				return nil, err
+			}
+			out.Rebates = append(out.Rebates, event)
+		case addressIs(log.Address, StakingContractAddress) && eventTopicIs(log, AllocationCreatedEventTopic):
+			event, err := DecodeAllocationCreatedEvent(log)
+			if err != nil {
+				return nil, err
+			}
+			out.Allocations = append(out.Allocations, event)
+		}
+	}
+
+	return out, nil
+}
+
+func addressIs(address eth.Address, expected string) bool {
+	return address.Pretty() == eth.MustNewAddress(expected).Pretty()
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+)
+
+// ReadPrivateKey loads the signing key from privateKeyFile, or from the
+// NETWORK_PAYMENT_PRIVATE_KEY env var when no file is given.
+func ReadPrivateKey(privateKeyFile string) (*eth.PrivateKey, error) {
+	pkHex := os.Getenv("NETWORK_PAYMENT_PRIVATE_KEY")
+	if privateKeyFile != "" {
+		pkBytes, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read private key file: %s", err)
+		}
+		pkHex = string(pkBytes)
+	}
+
+	pkHex = strings.TrimSpace(pkHex)
+	if pkHex == "" {
+		return nil, fmt.Errorf("private key is required, either through the NETWORK_PAYMENT_PRIVATE_KEY environment variable or --private-key-file flag")
+	}
+
+	privateKey, err := eth.NewPrivateKey(pkHex)
+	if err != nil {
+		return nil, fmt.Errorf("import private key: %s", err)
+	}
+
+	return privateKey, nil
+}
+
+// NewAllocationKey draws the key of a new allocation. RPC fixtures record the
+// keys, so that the replay of a recording opens the same allocations: a
+// recording directory of a real network holds the allocation private keys.
+func NewAllocationKey() (*eth.PrivateKey, error) {
+	pkHex, err := fixtureRandom("allocation-key", func() (string, error) {
+		key, err := eth.NewRandomPrivateKey()
+		if err != nil {
+			return "", err
+		}
+		return key.String(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generating allocation key: %w", err)
+	}
+
+	return eth.NewPrivateKey(pkHex)
+}
@@ -0,0 +1,126 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/streamingfast/eth-go"
+)
+
+var (
+	eip712DomainTypeHash      = crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	allocationIDProofTypeHash = crypto.Keccak256([]byte("AllocationIdProof(address indexer,address allocationId)"))
+
+	subgraphServiceName    = crypto.Keccak256([]byte("SubgraphService"))
+	subgraphServiceVersion = crypto.Keccak256([]byte("1.0"))
+)
+
+// GenerateHorizon creates a fresh allocation key and returns the allocation
+// ID derived from it along with its Horizon proof, see CreateHorizon.
+func GenerateHorizon(indexer string, subgraphService string, chainID *big.Int) ([]byte, []byte, error) { //returns allocationID, proof, err
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating key: %w", err)
+	}
+
+	pk, err := eth.NewPrivateKey(hex.EncodeToString(crypto.FromECDSA(key)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating private key: %w", err)
+	}
+
+	return CreateHorizon(indexer, subgraphService, chainID, pk)
+}
+
+// CreateHorizon builds the proof SubgraphService `startService` expects: the
+// EIP-712 signature, by the allocation key, of AllocationIdProof(indexer,
+// allocationId) in the SubgraphService domain, as r ++ s ++ v.
+func CreateHorizon(indexer string, subgraphService string, chainID *big.Int, allocationKey *eth.PrivateKey) ([]byte, []byte, error) { //returns allocationID, proof, err
+	if allocationKey == nil {
+		return nil, nil, fmt.Errorf("allocation key is required")
+	}
+
+	digest, err := horizonDigest(indexer, allocationKey.PublicKey().Address().Pretty(), subgraphService, chainID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signature, err := allocationKey.Sign(digest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error signing message: %w", err)
+	}
+	invertedSignature := signature.ToInverted()
+
+	allocationID := allocationKey.PublicKey().Address()
+	if err := VerifyHorizon(indexer, allocationID.Pretty(), subgraphService, chainID, invertedSignature[:]); err != nil {
+		return nil, nil, err
+	}
+
+	return allocationID.Bytes(), invertedSignature[:], nil
+}
+
+// VerifyHorizon checks that proof was signed by the allocation ID key for
+// indexer, in the domain of subgraphService on chainID.
+func VerifyHorizon(indexer string, allocationID string, subgraphService string, chainID *big.Int, proof []byte) error {
+	digest, err := horizonDigest(indexer, allocationID, subgraphService, chainID)
+	if err != nil {
+		return err
+	}
+
+	signature, err := eth.NewInvertedSignatureFromBytes(proof)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %w", err)
+	}
+
+	recoveredAddress, err := signature.Recover(digest)
+	if err != nil {
+		return fmt.Errorf("error recovering address: %w", err)
+	}
+
+	allocationIDAddress, err := parseAddress(allocationID)
+	if err != nil {
+		return fmt.Errorf("invalid allocation ID: %w", err)
+	}
+	if !bytes.Equal(recoveredAddress.Bytes(), allocationIDAddress.Bytes()) {
+		return fmt.Errorf("recovered address %s does not match allocation ID %s for indexer %s", recoveredAddress.Pretty(), allocationIDAddress.Hex(), indexer)
+	}
+
+	return nil
+}
+
+// horizonDigest is keccak256(0x1901 ++ domainSeparator ++ structHash).
+func horizonDigest(indexer string, allocationID string, subgraphService string, chainID *big.Int) (eth.Hash, error) {
+	indexerAddress, err := parseAddress(indexer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid indexer address: %w", err)
+	}
+
+	allocationIDAddress, err := parseAddress(allocationID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allocation ID: %w", err)
+	}
+
+	verifyingContract, err := parseAddress(subgraphService)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subgraph service address: %w", err)
+	}
+
+	domainSeparator := crypto.Keccak256(
+		eip712DomainTypeHash,
+		subgraphServiceName,
+		subgraphServiceVersion,
+		common.BigToHash(chainID).Bytes(),
+		common.BytesToHash(verifyingContract.Bytes()).Bytes(),
+	)
+
+	structHash := crypto.Keccak256(
+		allocationIDProofTypeHash,
+		common.BytesToHash(indexerAddress.Bytes()).Bytes(),
+		common.BytesToHash(allocationIDAddress.Bytes()).Bytes(),
+	)
+
+	return eth.Hash(crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, structHash)), nil
+}
@@ -0,0 +1,37 @@
+package proof
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+)
+
+const testSubgraphService = "0x5e4b5e4b5e4b5e4b5e4b5e4b5e4b5e4b5e4b5e4b"
+
+func TestCreateHorizonVerify(t *testing.T) {
+	chainID := big.NewInt(42161)
+
+	allocationID, proof, err := CreateHorizon(testIndexer, testSubgraphService, chainID, testAllocationKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocation := eth.Address(allocationID).Pretty()
+
+	if err := VerifyHorizon(testIndexer, allocation, testSubgraphService, chainID, proof); err != nil {
+		t.Fatal(err)
+	}
+
+	// the proof is bound to the indexer and to the SubgraphService domain
+	for name, err := range map[string]error{
+		"other indexer":          VerifyHorizon(testOtherIndexer, allocation, testSubgraphService, chainID, proof),
+		"other subgraph service": VerifyHorizon(testIndexer, allocation, testOtherIndexer, chainID, proof),
+		"other chain":            VerifyHorizon(testIndexer, allocation, testSubgraphService, big.NewInt(1), proof),
+		"legacy proof":           Verify(testIndexer, allocation, proof),
+		"malformed allocation":   VerifyHorizon(testIndexer, "nope", testSubgraphService, chainID, proof),
+	} {
+		if err == nil {
+			t.Errorf("%s: proof accepted", name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/streamingfast/eth-go"
+)
+
+// Generate creates a fresh allocation key and returns the allocation ID
+// derived from it along with the proof binding it to the indexer.
+func Generate(indexer string) ([]byte, []byte, error) { //returns allocationID, proof, err
+	// Create a new ECDSA key, to generate a new allocation ID.
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating key: %w", err)
+	}
+
+	pk, err := eth.NewPrivateKey(hex.EncodeToString(crypto.FromECDSA(key)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating private key: %w", err)
+	}
+
+	return Create(indexer, pk)
+}
+
+// Create builds the allocation proof for an existing allocation key. The
+// allocation ID is the address of the key, and the proof is the inverted
+// personal signature of keccak256(indexer ++ allocationID).
+func Create(indexer string, allocationKey *eth.PrivateKey) ([]byte, []byte, error) { //returns allocationID, proof, err
+	if allocationKey == nil {
+		return nil, nil, fmt.Errorf("allocation key is required")
+	}
+
+	indexerAddress, err := parseAddress(indexer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid indexer address: %w", err)
+	}
+	allocationIDAddress := common.BytesToAddress(allocationKey.PublicKey().Address())
+
+	messageHash := messageHash(indexerAddress, allocationIDAddress)
+
+	// Sign the message hash
+	signature, err := allocationKey.SignPersonal(messageHash.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error signing message: %w", err)
+	}
+
+	invertedSignature := signature.ToInverted()
+
+	// Verify signature
+	if err := Verify(indexerAddress.Hex(), allocationIDAddress.Hex(), invertedSignature[:]); err != nil {
+		return nil, nil, err
+	}
+
+	return allocationIDAddress.Bytes(), invertedSignature[:], nil
+}
+
+// Recover returns the address that signed the proof for the given indexer and
+// allocation ID. A valid proof recovers to the allocation ID itself.
+func Recover(indexer string, allocationID string, proof []byte) (eth.Address, error) {
+	indexerAddress, err := parseAddress(indexer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid indexer address: %w", err)
+	}
+
+	allocationIDAddress, err := parseAddress(allocationID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allocation ID: %w", err)
+	}
+
+	signature, err := eth.NewInvertedSignatureFromBytes(proof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proof: %w", err)
+	}
+
+	recoveredAddress, err := signature.RecoverPersonal(messageHash(indexerAddress, allocationIDAddress).Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error recovering address: %w", err)
+	}
+
+	return recoveredAddress, nil
+}
+
+// Verify checks that the proof was signed by the allocation ID key for the
+// given indexer. A proof created for another indexer recovers to an unrelated
+// address and is rejected.
+func Verify(indexer string, allocationID string, proof []byte) error {
+	recoveredAddress, err := Recover(indexer, allocationID, proof)
+	if err != nil {
+		return err
+	}
+
+	allocationIDAddress, err := parseAddress(allocationID)
+	if err != nil {
+		return fmt.Errorf("invalid allocation ID: %w", err)
+	}
+	if !bytes.Equal(recoveredAddress.Bytes(), allocationIDAddress.Bytes()) {
+		return fmt.Errorf("recovered address %s does not match allocation ID %s for indexer %s", recoveredAddress.Pretty(), allocationIDAddress.Hex(), indexer)
+	}
+
+	return nil
+}
+
+// DecodeHex decodes a 0x-prefixed or bare hex proof string.
+func DecodeHex(in string) ([]byte, error) {
+	out, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(in), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("decoding proof hex: %w", err)
+	}
+
+	return out, nil
+}
+
+func messageHash(indexer common.Address, allocationID common.Address) common.Hash {
+	return crypto.Keccak256Hash(bytes.Join([][]byte{indexer.Bytes(), allocationID.Bytes()}, nil))
+}
+
+func parseAddress(in string) (common.Address, error) {
+	if !common.IsHexAddress(in) {
+		return common.Address{}, fmt.Errorf("%q is not a valid address", in)
+	}
+
+	return common.HexToAddress(in), nil
+}
@@ -0,0 +1,133 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/streamingfast/eth-go"
+)
+
+const (
+	testIndexer      = "0x0658b87e4826cc9072d4cb3ec82b6c2762cb6ab2"
+	testOtherIndexer = "0x1111111111111111111111111111111111111111"
+)
+
+func testAllocationKey(t *testing.T) *eth.PrivateKey {
+	t.Helper()
+
+	key, err := eth.NewPrivateKey(strings.Repeat("42", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestCreateVerify(t *testing.T) {
+	key := testAllocationKey(t)
+
+	allocationID, proof, err := Create(testIndexer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eth.Address(allocationID).Pretty(), key.PublicKey().Address().Pretty(); got != want {
+		t.Fatalf("allocation ID %s, want the key address %s", got, want)
+	}
+	if len(proof) != 65 {
+		t.Fatalf("proof of %d bytes, want 65", len(proof))
+	}
+
+	if err := Verify(testIndexer, eth.Address(allocationID).Pretty(), proof); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	allocationID, proof, err := Create(testIndexer, testAllocationKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocation := eth.Address(allocationID).Pretty()
+
+	tampered := append([]byte(nil), proof...)
+	tampered[10] ^= 0xff
+
+	for name, c := range map[string]struct {
+		indexer      string
+		allocationID string
+		proof        []byte
+	}{
+		"other indexer":        {testOtherIndexer, allocation, proof},
+		"other allocation":     {testIndexer, testOtherIndexer, proof},
+		"tampered signature":   {testIndexer, allocation, tampered},
+		"short signature":      {testIndexer, allocation, proof[:64]},
+		"empty signature":      {testIndexer, allocation, nil},
+		"malformed indexer":    {"0x1234", allocation, proof},
+		"malformed allocation": {testIndexer, "nope", proof},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := Verify(c.indexer, c.allocationID, c.proof); err == nil {
+				t.Error("proof accepted")
+			}
+		})
+	}
+}
+
+func FuzzProofCreateRecover(f *testing.F) {
+	f.Add([]byte("allocation key"), []byte{}, []byte{})
+	f.Add(bytes.Repeat([]byte{0x42}, 32), []byte(testOtherIndexer), make([]byte, 65))
+	f.Add([]byte{0x01}, bytes.Repeat([]byte{0xff}, 20), bytes.Repeat([]byte{0xff}, 65))
+
+	f.Fuzz(func(t *testing.T, seed []byte, indexerBytes []byte, garbage []byte) {
+		// any seed hashes to a valid secp256k1 key but for a negligible few
+		key, err := eth.NewPrivateKey(hex.EncodeToString(crypto.Keccak256(seed)))
+		if err != nil {
+			return
+		}
+		indexer := common.BytesToAddress(indexerBytes).Hex()
+
+		allocationID, proof, err := Create(indexer, key)
+		if err != nil {
+			t.Fatalf("creating a proof for indexer %s: %s", indexer, err)
+		}
+		allocation := eth.Address(allocationID).Pretty()
+
+		recovered, err := Recover(indexer, allocation, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := recovered.Pretty(), key.PublicKey().Address().Pretty(); got != want {
+			t.Fatalf("recovered %s, want the allocation key %s", got, want)
+		}
+		if err := Verify(indexer, allocation, proof); err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes.Equal(garbage, proof) {
+			return
+		}
+		if err := Verify(indexer, allocation, garbage); err == nil {
+			t.Fatalf("proof %x accepted for allocation %s of indexer %s", garbage, allocation, indexer)
+		}
+		if err := Verify(string(garbage), string(garbage), garbage); err == nil {
+			t.Fatalf("proof %x accepted for arbitrary addresses", garbage)
+		}
+	})
+}
+
+func TestDecodeHex(t *testing.T) {
+	for _, in := range []string{"0xabcd", "abcd", " 0xabcd\n"} {
+		out, err := DecodeHex(in)
+		if err != nil || len(out) != 2 || out[0] != 0xab || out[1] != 0xcd {
+			t.Errorf("DecodeHex(%q) = %x, %v, want abcd", in, out, err)
+		}
+	}
+
+	if _, err := DecodeHex("0xzz"); err == nil {
+		t.Error("DecodeHex accepted non hex input")
+	}
+}
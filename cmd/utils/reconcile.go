@@ -0,0 +1,364 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// ExpectedPayment is a payment our own records say was made. Trx is optional,
+// without it the payment is matched on allocation and amount.
+type ExpectedPayment struct {
+	Time         time.Time
+	Indexer      string
+	AllocationID string
+	Amount       *big.Int
+	Trx          string
+}
+
+// ReadExpectedPayments loads expected payments from a CSV file with a
+// `date,indexer,allocation,amount,tx` header (amount in wei) or from a JSONL
+// file such as the local ledger, of which only the collect entries are kept.
+func ReadExpectedPayments(path string) ([]*ExpectedPayment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readExpectedPaymentsCSV(f)
+	}
+
+	return readExpectedPaymentsJSONL(f)
+}
+
+func readExpectedPaymentsCSV(r io.Reader) ([]*ExpectedPayment, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "indexer", "allocation", "amount", "tx"} {
+		if _, found := columns[name]; !found {
+			return nil, fmt.Errorf("missing %q column, the header must be: date,indexer,allocation,amount,tx", name)
+		}
+	}
+
+	var out []*ExpectedPayment
+	for i, record := range records[1:] {
+		line := i + 2
+		get := func(name string) string { return strings.TrimSpace(record[columns[name]]) }
+
+		payment, err := newExpectedPayment(get("date"), get("indexer"), get("allocation"), get("amount"), get("tx"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, payment)
+	}
+
+	return out, nil
+}
+
+func readExpectedPaymentsJSONL(r io.Reader) ([]*ExpectedPayment, error) {
+	var out []*ExpectedPayment
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := &LedgerEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if entry.Action != "" && entry.Action != LedgerActionCollect {
+			continue
+		}
+		if entry.Status == LedgerStatusFailed && entry.Trx == "" {
+			// never broadcast, nothing to find on chain
+			continue
+		}
+
+		payment, err := newExpectedPayment("", entry.Indexer, entry.AllocationID, entry.Amount, entry.Trx)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		payment.Time = entry.Time
+		out = append(out, payment)
+	}
+
+	return out, scanner.Err()
+}
+
+func newExpectedPayment(date, indexer, allocationID, amount, trx string) (*ExpectedPayment, error) {
+	payment := &ExpectedPayment{}
+
+	if trx != "" {
+		hash, err := eth.NewHash(trx)
+		if err != nil || len(hash) != 32 {
+			return nil, fmt.Errorf("invalid tx %q, it must be a 32 bytes transaction hash", trx)
+		}
+		payment.Trx = hash.Pretty()
+	}
+
+	if date != "" {
+		t, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, date); err != nil {
+				return nil, fmt.Errorf("invalid date %q", date)
+			}
+		}
+		payment.Time = t
+	}
+
+	if indexer != "" {
+		address, err := eth.NewAddress(indexer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid indexer %q: %w", indexer, err)
+		}
+		payment.Indexer = address.Pretty()
+	}
+
+	address, err := eth.NewAddress(allocationID)
+	if err != nil || len(address) == 0 {
+		return nil, fmt.Errorf("invalid allocation %q", allocationID)
+	}
+	payment.AllocationID = address.Pretty()
+
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q, it must be in wei", amount)
+	}
+	payment.Amount = value
+
+	return payment, nil
+}
+
+// OnChainPayment is a collect found on chain.
+type OnChainPayment struct {
+	Trx          string
+	BlockNumber  uint64
+	Payer        string
+	Indexer      string
+	AllocationID string
+	Amount       *big.Int
+}
+
+// ScanPayments finds the collects paid by payers between fromBlock and
+// toBlock: the GRT transfers from a payer to the Staking contract give the
+// transactions, whose receipts give the RebateCollected events.
+func ScanPayments(ctx context.Context, cli *ethrpc.Client, payers []eth.Address, fromBlock, toBlock, chunkSize uint64) ([]*OnChainPayment, error) {
+	if len(payers) == 0 {
+		return nil, fmt.Errorf("at least one payer address is required")
+	}
+
+	from := make([]interface{}, len(payers))
+	for i, payer := range payers {
+		from[i] = payer
+	}
+	topics := ethrpc.NewTopicFilter(TransferEventTopic, ethrpc.OneOfTopic(from...), eth.MustNewAddress(StakingContractAddress))
+
+	seen := map[string]bool{}
+	var trxs []eth.Hash
+	err := ScanLogs(ctx, cli, GRTTokenContractAddress, topics, fromBlock, toBlock, chunkSize, func(logs []*ethrpc.LogEntry, _ uint64) error {
+		for _, log := range logs {
+			if log.Removed || seen[log.TransactionHash.Pretty()] {
+				continue
+			}
+			seen[log.TransactionHash.Pretty()] = true
+			trxs = append(trxs, log.TransactionHash)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*OnChainPayment
+	for _, trx := range trxs {
+		receipt, err := cli.TransactionReceipt(ctx, trx)
+		if err != nil {
+			return nil, fmt.Errorf("fetching receipt of %s: %w", trx.Pretty(), err)
+		}
+		if receipt == nil || receipt.Status == nil || *receipt.Status != 1 {
+			continue
+		}
+
+		paymentLogs, err := DecodePaymentLogs(receipt)
+		if err != nil {
+			return nil, fmt.Errorf("decoding logs of %s: %w", trx.Pretty(), err)
+		}
+		for _, rebate := range paymentLogs.Rebates {
+			out = append(out, &OnChainPayment{
+				Trx:          trx.Pretty(),
+				BlockNumber:  uint64(receipt.BlockNumber),
+				Payer:        receipt.From.Pretty(),
+				Indexer:      rebate.Indexer.Pretty(),
+				AllocationID: rebate.AllocationID.Pretty(),
+				Amount:       rebate.Tokens,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+const (
+	ReconcileMatched         = "matched"
+	ReconcileAmountMismatch  = "amount-mismatch"
+	ReconcileIndexerMismatch = "indexer-mismatch"
+	ReconcileReverted        = "reverted"
+	ReconcileMissing         = "missing"
+	ReconcileNotFound        = "not-found"
+	ReconcileUnrecorded      = "unrecorded"
+)
+
+// ReconcileItem is the outcome for one expected or on-chain payment. Status
+// is one of the Reconcile* constants:
+//   - missing: the expected transaction has no receipt, it was never mined or
+//     was reorged out;
+//   - not-found: an expected payment without transaction has no on-chain
+//     counterpart in the scanned range;
+//   - unrecorded: an on-chain payment has no expected counterpart.
+type ReconcileItem struct {
+	Status   string
+	Expected *ExpectedPayment
+	OnChain  *OnChainPayment
+	Detail   string
+}
+
+// Reconcile matches expected payments to on-chain ones, first by transaction
+// then, for expected payments without one, by allocation and amount.
+// Expected transactions that are not among onChain (e.g. outside the scanned
+// range) are looked up by receipt.
+func Reconcile(ctx context.Context, cli *ethrpc.Client, expected []*ExpectedPayment, onChain []*OnChainPayment) ([]*ReconcileItem, error) {
+	used := make([]bool, len(onChain))
+	claim := func(match func(payment *OnChainPayment) bool) *OnChainPayment {
+		for i, payment := range onChain {
+			if !used[i] && match(payment) {
+				used[i] = true
+				return payment
+			}
+		}
+		return nil
+	}
+
+	var out []*ReconcileItem
+	var withoutTrx []*ExpectedPayment
+	for _, exp := range expected {
+		if exp.Trx == "" {
+			withoutTrx = append(withoutTrx, exp)
+			continue
+		}
+
+		payment := claim(func(payment *OnChainPayment) bool {
+			return strings.EqualFold(payment.Trx, exp.Trx) && strings.EqualFold(payment.AllocationID, exp.AllocationID)
+		})
+		if payment == nil {
+			item, err := reconcileByReceipt(ctx, cli, exp)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, item)
+			continue
+		}
+
+		out = append(out, compareAmounts(exp, payment))
+	}
+
+	for _, exp := range withoutTrx {
+		payment := claim(func(payment *OnChainPayment) bool {
+			return strings.EqualFold(payment.AllocationID, exp.AllocationID) && payment.Amount.Cmp(exp.Amount) == 0
+		})
+		if payment == nil {
+			payment = claim(func(payment *OnChainPayment) bool {
+				return strings.EqualFold(payment.AllocationID, exp.AllocationID)
+			})
+		}
+		if payment == nil {
+			out = append(out, &ReconcileItem{Status: ReconcileNotFound, Expected: exp, Detail: "no payment to this allocation in the scanned range"})
+			continue
+		}
+
+		out = append(out, compareAmounts(exp, payment))
+	}
+
+	for i, payment := range onChain {
+		if !used[i] {
+			out = append(out, &ReconcileItem{Status: ReconcileUnrecorded, OnChain: payment, Detail: "on-chain payment missing from our records"})
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Status < out[j].Status })
+
+	return out, nil
+}
+
+func reconcileByReceipt(ctx context.Context, cli *ethrpc.Client, exp *ExpectedPayment) (*ReconcileItem, error) {
+	hash, err := ParseHash(exp.Trx)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := cli.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("fetching receipt of %s: %w", exp.Trx, err)
+	}
+	if receipt == nil {
+		return &ReconcileItem{Status: ReconcileMissing, Expected: exp, Detail: "transaction not found on chain, never mined or reorged out"}, nil
+	}
+	if receipt.Status == nil || *receipt.Status != 1 {
+		return &ReconcileItem{Status: ReconcileReverted, Expected: exp, Detail: fmt.Sprintf("transaction reverted in block %d", uint64(receipt.BlockNumber))}, nil
+	}
+
+	paymentLogs, err := DecodePaymentLogs(receipt)
+	if err != nil {
+		return nil, fmt.Errorf("decoding logs of %s: %w", exp.Trx, err)
+	}
+	for _, rebate := range paymentLogs.Rebates {
+		if strings.EqualFold(rebate.AllocationID.Pretty(), exp.AllocationID) {
+			return compareAmounts(exp, &OnChainPayment{
+				Trx:          receipt.TransactionHash.Pretty(),
+				BlockNumber:  uint64(receipt.BlockNumber),
+				Payer:        receipt.From.Pretty(),
+				Indexer:      rebate.Indexer.Pretty(),
+				AllocationID: rebate.AllocationID.Pretty(),
+				Amount:       rebate.Tokens,
+			}), nil
+		}
+	}
+
+	return &ReconcileItem{Status: ReconcileNotFound, Expected: exp, Detail: "transaction did not collect on this allocation"}, nil
+}
+
+func compareAmounts(exp *ExpectedPayment, payment *OnChainPayment) *ReconcileItem {
+	if payment.Amount.Cmp(exp.Amount) != 0 {
+		return &ReconcileItem{Status: ReconcileAmountMismatch, Expected: exp, OnChain: payment, Detail: fmt.Sprintf("expected %s, collected %s", FormatGRT(exp.Amount), FormatGRT(payment.Amount))}
+	}
+	if exp.Indexer != "" && !strings.EqualFold(exp.Indexer, payment.Indexer) {
+		return &ReconcileItem{Status: ReconcileIndexerMismatch, Expected: exp, OnChain: payment, Detail: fmt.Sprintf("expected indexer %s, paid %s", exp.Indexer, payment.Indexer)}
+	}
+
+	return &ReconcileItem{Status: ReconcileMatched, Expected: exp, OnChain: payment}
+}
@@ -0,0 +1,198 @@
+package utils_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/fakechain"
+)
+
+type reconcileTest struct {
+	chain   *fakechain.Chain
+	ctx     context.Context
+	rpc     *utils.Chain
+	payer   eth.Address
+	indexer eth.Address
+}
+
+func newReconcileTest(t *testing.T, allocations ...eth.Address) *reconcileTest {
+	t.Helper()
+
+	chain := fakechain.New()
+	url, stop, err := chain.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stop() })
+
+	payerKey, err := eth.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := &reconcileTest{
+		chain:   chain,
+		ctx:     utils.WithPrivateKey(context.Background(), payerKey),
+		rpc:     utils.NewChain(utils.NewRPCClient(url), utils.ArbitrumOneChainID),
+		payer:   payerKey.PublicKey().Address(),
+		indexer: eth.MustNewAddress("0x0658b87e4826cc9072d4cb3ec82b6c2762cb6ab2"),
+	}
+
+	chain.Fund(test.payer, utils.ConvertToWei(1), utils.ConvertToWei(1000))
+	chain.Stake(test.indexer, utils.ConvertToWei(100_000))
+	for i, allocationID := range allocations {
+		deploymentID := make([]byte, 32)
+		deploymentID[31] = byte(i + 1)
+		chain.Allocate(test.indexer, deploymentID, allocationID, utils.ConvertToWei(1_000))
+	}
+
+	return test
+}
+
+// pay approves and collects amount GRT to allocationID, returning the
+// collect transaction even when it reverted.
+func (r *reconcileTest) pay(t *testing.T, allocationID eth.Address, amount uint64) string {
+	t.Helper()
+
+	if _, err := utils.ApproveCall(r.ctx, eth.MustNewAddress(utils.GRTTokenContractAddress), r.payer, r.rpc, eth.MustNewAddress(utils.StakingContractAddress), amount, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := eth.MustNewMethodDef("collect(uint256,address)").NewCall(utils.ConvertToWei(amount), allocationID).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := r.rpc.Signer(r.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasPrice, nonce, err := r.rpc.TransactionParams(r.ctx, r.payer, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedTx, err := signer.SignTransaction(nonce, eth.MustNewAddress(utils.StakingContractAddress), big.NewInt(0), 5_000_000, gasPrice, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trx, _, err := r.rpc.SendRaw(r.ctx, signedTx)
+	if err != nil && !errors.Is(err, utils.ErrReverted) {
+		t.Fatal(err)
+	}
+
+	return trx
+}
+
+func TestReconcile(t *testing.T) {
+	paid := eth.MustNewAddress("0xa110ca7e0000000000000000000000000000a001")
+	underpaid := eth.MustNewAddress("0xa110ca7e0000000000000000000000000000a002")
+	unpaid := eth.MustNewAddress("0xa110ca7e0000000000000000000000000000a003")
+	test := newReconcileTest(t, paid, underpaid, unpaid)
+
+	paidTrx := test.pay(t, paid, 100)
+	underpaidTrx := test.pay(t, underpaid, 50)
+	test.pay(t, paid, 10)
+	test.chain.RevertNext("collect", "!collect")
+	revertedTrx := test.pay(t, paid, 20)
+
+	expected := []*utils.ExpectedPayment{
+		{AllocationID: paid.Pretty(), Amount: utils.ConvertToWei(100), Trx: paidTrx},
+		{AllocationID: underpaid.Pretty(), Amount: utils.ConvertToWei(60), Trx: underpaidTrx},
+		{AllocationID: paid.Pretty(), Amount: utils.ConvertToWei(20), Trx: revertedTrx},
+		{AllocationID: paid.Pretty(), Amount: utils.ConvertToWei(30), Trx: "0x" + strings.Repeat("ab", 32)},
+		{AllocationID: unpaid.Pretty(), Amount: utils.ConvertToWei(40)},
+	}
+
+	toBlock, err := test.rpc.Client().LatestBlockNum(test.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onChain, err := utils.ScanPayments(test.ctx, test.rpc.Client(), []eth.Address{test.payer}, utils.StakingDeploymentBlock, toBlock, 1_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onChain) != 3 {
+		t.Fatalf("%d on-chain payments, want the 3 that did not revert", len(onChain))
+	}
+
+	items, err := utils.Reconcile(test.ctx, test.rpc.Client(), expected, onChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := map[string]int{}
+	for _, item := range items {
+		statuses[item.Status]++
+
+		switch item.Status {
+		case utils.ReconcileMatched:
+			if item.OnChain.Trx != paidTrx {
+				t.Errorf("matched %s, want %s", item.OnChain.Trx, paidTrx)
+			}
+		case utils.ReconcileAmountMismatch:
+			if item.OnChain.Amount.Cmp(utils.ConvertToWei(50)) != 0 {
+				t.Errorf("mismatch collected %s, want 50 GRT", item.OnChain.Amount)
+			}
+		case utils.ReconcileReverted:
+			if item.Expected.Trx != revertedTrx {
+				t.Errorf("reverted %s, want %s", item.Expected.Trx, revertedTrx)
+			}
+		case utils.ReconcileUnrecorded:
+			if item.OnChain.Amount.Cmp(utils.ConvertToWei(10)) != 0 {
+				t.Errorf("unrecorded payment of %s, want 10 GRT", item.OnChain.Amount)
+			}
+		case utils.ReconcileNotFound:
+			if item.Expected.AllocationID != unpaid.Pretty() {
+				t.Errorf("not found %s, want %s", item.Expected.AllocationID, unpaid.Pretty())
+			}
+		}
+	}
+
+	for _, status := range []string{utils.ReconcileMatched, utils.ReconcileAmountMismatch, utils.ReconcileReverted, utils.ReconcileMissing, utils.ReconcileUnrecorded, utils.ReconcileNotFound} {
+		if statuses[status] != 1 {
+			t.Errorf("%d %s items, want 1 (got %v)", statuses[status], status, statuses)
+		}
+	}
+}
+
+func TestReadExpectedPaymentsCSV(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "expected.csv")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	trx := "0x" + strings.Repeat("AB", 32)
+	payments, err := utils.ReadExpectedPayments(write(t, "date,indexer,allocation,amount,tx\n"+
+		"2025-07-01,,0xa110ca7e0000000000000000000000000000a001,100,"+trx+"\n"+
+		"2025-07-02,,0xa110ca7e0000000000000000000000000000a001,100,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payments[0].Trx != strings.ToLower(trx) || payments[1].Trx != "" {
+		t.Errorf("transactions %q and %q, want %q and none", payments[0].Trx, payments[1].Trx, strings.ToLower(trx))
+	}
+
+	for name, tx := range map[string]string{
+		"not hex":   "nope",
+		"too short": "0xabcd",
+		"address":   "0xa110ca7e0000000000000000000000000000a001",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := utils.ReadExpectedPayments(write(t, "date,indexer,allocation,amount,tx\n2025-07-01,,0xa110ca7e0000000000000000000000000000a001,100,"+tx+"\n"))
+			if err == nil || !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("error %v, want the invalid tx reported on line 2", err)
+			}
+		})
+	}
+}
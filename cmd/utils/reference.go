@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/streamingfast/eth-go"
+)
+
+// EncodeReference packs a payment reference into the bytes32 `_metadata`
+// argument of allocateFrom:
+//   - an empty reference gives 32 zero bytes;
+//   - a 0x-prefixed 32 bytes hex string (e.g. the hash of an invoice
+//     document) is used as is;
+//   - a printable reference of at most 32 bytes is stored as a bytes32
+//     string, left aligned and zero padded like Solidity does;
+//   - anything longer is stored as its keccak256 hash.
+func EncodeReference(reference string) ([]byte, error) {
+	metadata := make([]byte, 32)
+	if reference == "" {
+		return metadata, nil
+	}
+
+	if strings.HasPrefix(reference, "0x") && len(reference) == 66 {
+		raw, err := hex.DecodeString(reference[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex reference %q: %w", reference, err)
+		}
+		return raw, nil
+	}
+
+	if !isPrintable(reference) {
+		return nil, fmt.Errorf("reference %q must be printable text or a 0x-prefixed 32 bytes hex string", reference)
+	}
+
+	if len(reference) <= 32 {
+		copy(metadata, reference)
+		return metadata, nil
+	}
+
+	return eth.Keccak256([]byte(reference)), nil
+}
+
+// DecodeReference is the inverse of EncodeReference as far as it can go: a
+// bytes32 string is returned as text, anything else as 0x-prefixed hex, and
+// zero metadata as an empty string. Hashed references can only be checked
+// with ReferenceMatches.
+func DecodeReference(metadata []byte) string {
+	trimmed := bytes.TrimRight(metadata, "\x00")
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	if isPrintable(string(trimmed)) {
+		return string(trimmed)
+	}
+
+	return "0x" + hex.EncodeToString(metadata)
+}
+
+// ReferenceMatches tells whether metadata is the encoding of reference.
+func ReferenceMatches(metadata []byte, reference string) bool {
+	encoded, err := EncodeReference(reference)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(encoded, metadata)
+}
+
+func isPrintable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+
+	return true
+}
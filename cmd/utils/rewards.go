@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+const (
+	RewardsPolicyWarn = "warn"
+	RewardsPolicyFail = "fail"
+)
+
+// RewardsCheck tells whether an allocation on a deployment would accrue
+// indexing rewards, which payment allocations must not.
+type RewardsCheck struct {
+	DeploymentID string
+	Denied       bool
+	SignalTokens *big.Int
+}
+
+// EarnsRewards is true when the deployment is not on the RewardsManager
+// deny-list and has curation signal.
+func (c *RewardsCheck) EarnsRewards() bool {
+	return !c.Denied && c.SignalTokens.Sign() > 0
+}
+
+func (c *RewardsCheck) String() string {
+	out := fmt.Sprintf("Rewards check for deployment %s: denied=%t, signal=%s", c.DeploymentID, c.Denied, FormatGRT(c.SignalTokens))
+	if c.EarnsRewards() {
+		out += " (WARNING: an allocation on this deployment would earn indexing rewards)"
+	}
+
+	return out
+}
+
+func GetRewardsCheckCall(ctx context.Context, cli *ethrpc.Client, deploymentID string) (*RewardsCheck, error) {
+	check := &RewardsCheck{}
+	batch := NewBatch(cli)
+	batch.RewardsCheck(deploymentID, check)
+	if err := batch.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	return check, nil
+}
+
+// CheckRewardsPolicy fetches the rewards check for the deployment and applies
+// policy to it.
+func CheckRewardsPolicy(ctx context.Context, cli *ethrpc.Client, deploymentID string, policy string) (*RewardsCheck, error) {
+	if err := ValidateRewardsPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	check, err := GetRewardsCheckCall(ctx, cli, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return check, check.ApplyPolicy(policy)
+}
+
+func ValidateRewardsPolicy(policy string) error {
+	if policy != RewardsPolicyWarn && policy != RewardsPolicyFail {
+		return fmt.Errorf("invalid rewards policy %q, must be one of: %s, %s", policy, RewardsPolicyWarn, RewardsPolicyFail)
+	}
+
+	return nil
+}
+
+// ApplyPolicy applies policy when the deployment would earn indexing rewards:
+// RewardsPolicyFail returns an error, RewardsPolicyWarn leaves it to the
+// caller to report the check.
+func (c *RewardsCheck) ApplyPolicy(policy string) error {
+	if err := ValidateRewardsPolicy(policy); err != nil {
+		return err
+	}
+
+	if c.EarnsRewards() && policy == RewardsPolicyFail {
+		return fmt.Errorf("deployment %s is not on the rewards deny-list and has %s of signal, an allocation on it would earn indexing rewards", c.DeploymentID, FormatGRT(c.SignalTokens))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package utils_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/network-payments-cli/cmd/utils"
+	"github.com/streamingfast/network-payments-cli/cmd/utils/fakechain"
+)
+
+func TestCheckRewardsPolicy(t *testing.T) {
+	chain := fakechain.New()
+	url, stop, err := chain.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stop() })
+	cli := utils.NewRPCClient(url)
+
+	deployment := func(t *testing.T, b byte, signal uint64, denied bool) string {
+		t.Helper()
+
+		deploymentID := make([]byte, 32)
+		deploymentID[31] = b
+		if signal > 0 {
+			chain.Signal(deploymentID, utils.ConvertToWei(signal))
+		}
+		chain.Deny(deploymentID, denied)
+
+		out, err := utils.ConvertByteStringToIPFSHash(deploymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	for name, c := range map[string]struct {
+		deploymentID string
+		earns        bool
+	}{
+		"denied with signal":    {deployment(t, 1, 1_000, true), false},
+		"zero signal":           {deployment(t, 2, 0, false), false},
+		"denied with no signal": {deployment(t, 3, 0, true), false},
+		"signalled, not denied": {deployment(t, 4, 1_000, false), true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			check, err := utils.CheckRewardsPolicy(context.Background(), cli, c.deploymentID, utils.RewardsPolicyWarn)
+			if err != nil {
+				t.Fatalf("warn policy: %s", err)
+			}
+			if check.EarnsRewards() != c.earns {
+				t.Fatalf("earns rewards %t, want %t (%s)", check.EarnsRewards(), c.earns, check)
+			}
+
+			check, err = utils.CheckRewardsPolicy(context.Background(), cli, c.deploymentID, utils.RewardsPolicyFail)
+			if c.earns != (err != nil) {
+				t.Fatalf("fail policy error %v, want one only when the deployment earns rewards", err)
+			}
+			if check == nil {
+				t.Fatal("fail policy returned no check to report")
+			}
+		})
+	}
+
+	if _, err := utils.CheckRewardsPolicy(context.Background(), cli, deployment(t, 5, 0, false), "ignore"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
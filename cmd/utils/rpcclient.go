@@ -0,0 +1,615 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// idempotentMethods can be retried, on any endpoint, without side effects.
+var idempotentMethods = map[string]bool{
+	"eth_blockNumber":           true,
+	"eth_call":                  true,
+	"eth_chainId":               true,
+	"eth_estimateGas":           true,
+	"eth_feeHistory":            true,
+	"eth_gasPrice":              true,
+	"eth_getBalance":            true,
+	"eth_getBlockByNumber":      true,
+	"eth_getBlockByHash":        true,
+	"eth_getCode":               true,
+	"eth_getLogs":               true,
+	"eth_getTransactionByHash":  true,
+	"eth_getTransactionCount":   true,
+	"eth_getTransactionReceipt": true,
+	"net_version":               true,
+}
+
+// RPCOptions tune the transport built by NewRPCClient.
+type RPCOptions struct {
+	// MaxAttempts bounds the tries of a single request across all endpoints.
+	MaxAttempts int
+	// Backoff is the initial delay between retries, doubled on each retry,
+	// capped at MaxBackoff and jittered by up to 50%.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// RateLimit is the sustained requests per second allowed per endpoint,
+	// with bursts of up to RateBurst requests. 0 disables rate limiting.
+	RateLimit float64
+	RateBurst int
+	// Timeout bounds each attempt, not the request as a whole.
+	Timeout time.Duration
+}
+
+// DefaultRPCOptions can be tuned with the NETWORK_PAYMENT_RPC_RATE_LIMIT
+// (requests per second per endpoint) env var.
+func DefaultRPCOptions() RPCOptions {
+	opts := RPCOptions{
+		MaxAttempts: 5,
+		Backoff:     250 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+		RateLimit:   25,
+		RateBurst:   25,
+		Timeout:     30 * time.Second,
+	}
+
+	if value := os.Getenv("NETWORK_PAYMENT_RPC_RATE_LIMIT"); value != "" {
+		if limit, err := strconv.ParseFloat(value, 64); err == nil && limit >= 0 {
+			opts.RateLimit = limit
+			opts.RateBurst = max(1, int(limit))
+		}
+	}
+
+	return opts
+}
+
+// NewRPCClient returns an eth-go client for rpcURLs, a comma-separated list of
+// endpoints. Requests go to the healthiest endpoint, idempotent ones are
+// retried with backoff on another endpoint when one fails or rate limits us.
+// Raw transactions are never sent to another endpoint before checking that
+// the first broadcast did not land. See SetRPCFixtures to record or replay
+// the exchanges.
+func NewRPCClient(rpcURLs string) *ethrpc.Client {
+	return NewRPCClientWithOptions(rpcURLs, DefaultRPCOptions())
+}
+
+func NewRPCClientWithOptions(rpcURLs string, opts RPCOptions) *ethrpc.Client {
+	var urls []string
+	for _, rpcURL := range strings.Split(rpcURLs, ",") {
+		if rpcURL = strings.TrimSpace(rpcURL); rpcURL != "" {
+			urls = append(urls, rpcURL)
+		}
+	}
+
+	if rpcFixtures.replayer != nil {
+		// the url is never dialed, fixtures answer every request
+		replayURL := "http://rpc-replay"
+		if len(urls) > 0 {
+			replayURL = urls[0]
+		}
+		return ethrpc.NewClient(replayURL, ethrpc.WithHttpClient(&http.Client{Transport: rpcFixtures.replayer}))
+	}
+
+	if len(urls) == 0 {
+		// keep eth-go's own error for a missing endpoint
+		return ethrpc.NewClient(rpcURLs)
+	}
+
+	var transport http.RoundTripper = NewFailoverTransport(urls, opts, http.DefaultTransport)
+	if rpcFixtures.recorder != nil {
+		transport = &recordingTransport{recorder: rpcFixtures.recorder, base: transport}
+	}
+
+	return ethrpc.NewClient(urls[0], ethrpc.WithHttpClient(&http.Client{Transport: transport}))
+}
+
+type rpcEndpoint struct {
+	url    *url.URL
+	order  int
+	score  float64
+	bucket *tokenBucket
+}
+
+// FailoverTransport is an http.RoundTripper spreading JSON-RPC requests over
+// several endpoints, see NewRPCClient.
+type FailoverTransport struct {
+	base      http.RoundTripper
+	opts      RPCOptions
+	endpoints []*rpcEndpoint
+
+	mu     sync.Mutex
+	jitter func() float64
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func NewFailoverTransport(urls []string, opts RPCOptions, base http.RoundTripper) *FailoverTransport {
+	t := &FailoverTransport{
+		base:   base,
+		opts:   opts,
+		jitter: rand.Float64,
+		sleep:  sleepContext,
+	}
+	if t.opts.MaxAttempts < 1 {
+		t.opts.MaxAttempts = 1
+	}
+
+	for i, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			// the request will fail on this endpoint and move on to the next
+			parsed = &url.URL{Opaque: rawURL}
+		}
+		t.endpoints = append(t.endpoints, &rpcEndpoint{
+			url:    parsed,
+			order:  i,
+			score:  1,
+			bucket: newTokenBucket(opts.RateLimit, opts.RateBurst),
+		})
+	}
+
+	return t
+}
+
+type rpcRequestEnvelope struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func (t *FailoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := parseRPCRequests(body)
+	if err != nil || len(requests) == 0 {
+		// not something we understand, forward it once
+		return t.send(req, t.ranked(nil)[0], body)
+	}
+
+	if len(requests) == 1 && requests[0].Method == "eth_sendRawTransaction" {
+		return t.sendRawTransaction(req, body, requests[0])
+	}
+
+	idempotent := true
+	for _, request := range requests {
+		idempotent = idempotent && idempotentMethods[request.Method]
+	}
+	if !idempotent {
+		return t.send(req, t.ranked(nil)[0], body)
+	}
+
+	return t.retry(req, body)
+}
+
+// retry sends body to the healthiest endpoints in turn until one answers
+// without a retryable failure.
+func (t *FailoverTransport) retry(req *http.Request, body []byte) (*http.Response, error) {
+	tried := map[*rpcEndpoint]bool{}
+	var lastErr error
+	for attempt := 0; attempt < t.opts.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := t.sleep(req.Context(), t.backoff(attempt, lastErr)); err != nil {
+				return nil, errors.Join(lastErr, err)
+			}
+		}
+
+		endpoint := t.next(tried)
+
+		resp, err := t.send(req, endpoint, body)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// sendRawTransaction broadcasts to one endpoint at a time. Before moving to
+// another endpoint, it asks the endpoints that may have accepted the
+// transaction (those that failed without rejecting it outright), then the
+// next endpoint, whether the transaction is already known, in which case the
+// broadcast is considered successful.
+func (t *FailoverTransport) sendRawTransaction(req *http.Request, body []byte, request *rpcRequestEnvelope) (*http.Response, error) {
+	trxHash, err := rawTransactionHash(request)
+	if err != nil {
+		return t.send(req, t.ranked(nil)[0], body)
+	}
+
+	tried := map[*rpcEndpoint]bool{}
+	var maybeAccepted []*rpcEndpoint
+	var lastErr error
+	for attempt := 0; attempt < t.opts.MaxAttempts; attempt++ {
+		endpoint := t.next(tried)
+
+		if attempt > 0 {
+			if err := t.sleep(req.Context(), t.backoff(attempt, lastErr)); err != nil {
+				return nil, errors.Join(lastErr, err)
+			}
+
+			candidates := slices.Clone(maybeAccepted)
+			if !slices.Contains(candidates, endpoint) {
+				candidates = append(candidates, endpoint)
+			}
+
+			landed, err := t.transactionLanded(req, candidates, trxHash)
+			if err != nil {
+				// without an answer we cannot rule out a double broadcast
+				return nil, errors.Join(lastErr, fmt.Errorf("checking whether %s landed: %w", trxHash.Pretty(), err))
+			}
+			if landed {
+				return jsonRPCResultResponse(req, request.ID, trxHash.Pretty()), nil
+			}
+		}
+
+		resp, err := t.send(req, endpoint, body)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+
+		// a rate limited endpoint rejected the broadcast before looking at it
+		var statusErr *rpcStatusError
+		if !(errors.As(err, &statusErr) && statusErr.status == http.StatusTooManyRequests) && !slices.Contains(maybeAccepted, endpoint) {
+			maybeAccepted = append(maybeAccepted, endpoint)
+		}
+	}
+
+	return nil, lastErr
+}
+
+// transactionLanded asks endpoints in turn whether trxHash is known. It only
+// fails when none of them answered.
+func (t *FailoverTransport) transactionLanded(req *http.Request, endpoints []*rpcEndpoint, trxHash eth.Hash) (bool, error) {
+	var errs []error
+	for _, endpoint := range endpoints {
+		known, err := t.transactionKnown(req, endpoint, trxHash)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if known {
+			return true, nil
+		}
+	}
+
+	if len(errs) == len(endpoints) {
+		return false, errors.Join(errs...)
+	}
+
+	return false, nil
+}
+
+func (t *FailoverTransport) transactionKnown(req *http.Request, endpoint *rpcEndpoint, trxHash eth.Hash) (bool, error) {
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["%s"]}`, trxHash.Pretty())
+	resp, err := t.send(req, endpoint, []byte(body))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return false, err
+	}
+	if len(out.Error) > 0 {
+		return false, fmt.Errorf("json_rpc error: %s", string(out.Error))
+	}
+
+	return len(out.Result) > 0 && string(out.Result) != "null", nil
+}
+
+// send performs one attempt on endpoint. Transport errors, HTTP 429/5xx and
+// JSON-RPC rate limit errors are returned as errors and lower the endpoint
+// score; anything else is returned as is.
+func (t *FailoverTransport) send(req *http.Request, endpoint *rpcEndpoint, body []byte) (*http.Response, error) {
+	if err := endpoint.bucket.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	ctx := req.Context()
+	if t.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.opts.Timeout)
+		// the body is fully read below, before cancel runs
+		defer cancel()
+	}
+
+	attempt := req.Clone(ctx)
+	attempt.URL = endpoint.url
+	attempt.Host = endpoint.url.Host
+	attempt.Body = io.NopCloser(bytes.NewReader(body))
+	attempt.ContentLength = int64(len(body))
+
+	resp, err := t.base.RoundTrip(attempt)
+	if err != nil {
+		t.record(endpoint, false)
+		return nil, fmt.Errorf("%s: %w", endpoint.url.Redacted(), err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		resp.Body.Close()
+		t.record(endpoint, false)
+		return nil, &rpcStatusError{endpoint: endpoint.url.Redacted(), status: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.record(endpoint, false)
+		return nil, fmt.Errorf("%s: reading response: %w", endpoint.url.Redacted(), err)
+	}
+	if isRateLimitedPayload(payload) {
+		t.record(endpoint, false)
+		return nil, &rpcStatusError{endpoint: endpoint.url.Redacted(), status: http.StatusTooManyRequests}
+	}
+
+	t.record(endpoint, true)
+	resp.Body = io.NopCloser(bytes.NewReader(payload))
+	return resp, nil
+}
+
+// record updates the endpoint health: failures halve the score, successes
+// slowly restore it.
+func (t *FailoverTransport) record(endpoint *rpcEndpoint, success bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if success {
+		endpoint.score = min(1, endpoint.score+0.1)
+	} else {
+		endpoint.score /= 2
+	}
+}
+
+// ranked returns the endpoints not in exclude ordered by score then by
+// configuration order, or all of them when every endpoint is excluded.
+func (t *FailoverTransport) ranked(exclude map[*rpcEndpoint]bool) []*rpcEndpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []*rpcEndpoint
+	for _, endpoint := range t.endpoints {
+		if !exclude[endpoint] {
+			out = append(out, endpoint)
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, t.endpoints...)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].score == out[j].score {
+			return out[i].order < out[j].order
+		}
+		return out[i].score > out[j].score
+	})
+
+	return out
+}
+
+// next picks the healthiest endpoint not tried yet for the current request
+// and marks it as tried. Once every endpoint had its chance, it starts over.
+func (t *FailoverTransport) next(tried map[*rpcEndpoint]bool) *rpcEndpoint {
+	if len(tried) == len(t.endpoints) {
+		clear(tried)
+	}
+
+	endpoint := t.ranked(tried)[0]
+	tried[endpoint] = true
+
+	return endpoint
+}
+
+func (t *FailoverTransport) backoff(attempt int, lastErr error) time.Duration {
+	var statusErr *rpcStatusError
+	if errors.As(lastErr, &statusErr) && statusErr.retryAfter > 0 {
+		return min(statusErr.retryAfter, t.opts.MaxBackoff)
+	}
+
+	backoff := t.opts.Backoff
+	for i := 1; i < attempt && backoff < t.opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, t.opts.MaxBackoff)
+
+	t.mu.Lock()
+	jitter := t.jitter()
+	t.mu.Unlock()
+
+	return backoff/2 + time.Duration(float64(backoff/2)*jitter)
+}
+
+type rpcStatusError struct {
+	endpoint   string
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *rpcStatusError) Error() string {
+	if e.status == http.StatusTooManyRequests {
+		return fmt.Sprintf("%s: rate limited", e.endpoint)
+	}
+	return fmt.Sprintf("%s: error in response: %d", e.endpoint, e.status)
+}
+
+func parseRPCRequests(body []byte) ([]*rpcRequestEnvelope, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var requests []*rpcRequestEnvelope
+		err := json.Unmarshal(trimmed, &requests)
+		return requests, err
+	}
+
+	request := &rpcRequestEnvelope{}
+	if err := json.Unmarshal(trimmed, request); err != nil {
+		return nil, err
+	}
+	return []*rpcRequestEnvelope{request}, nil
+}
+
+func rawTransactionHash(request *rpcRequestEnvelope) (eth.Hash, error) {
+	if len(request.Params) != 1 {
+		return nil, fmt.Errorf("expected a single raw transaction param")
+	}
+
+	var raw string
+	if err := json.Unmarshal(request.Params[0], &raw); err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(raw, "0x"))
+	if err != nil {
+		return nil, err
+	}
+
+	return eth.Hash(eth.Keccak256(data)), nil
+}
+
+// isRateLimitedPayload detects providers answering 200 with a JSON-RPC
+// "limit exceeded" (-32005) rate limit error, for a single request or for any
+// of the requests of a batch.
+func isRateLimitedPayload(payload []byte) bool {
+	type response struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	var responses []*response
+	if trimmed := bytes.TrimSpace(payload); len(trimmed) > 0 && trimmed[0] == '[' {
+		if json.Unmarshal(trimmed, &responses) != nil {
+			return false
+		}
+	} else {
+		single := &response{}
+		if json.Unmarshal(trimmed, single) != nil {
+			return false
+		}
+		responses = append(responses, single)
+	}
+
+	for _, response := range responses {
+		// -32005 is also how some providers reject a too large eth_getLogs
+		// query, which retrying as is would not fix, see ScanLogs
+		if response != nil && response.Error != nil && response.Error.Code == -32005 && !isLogRangeMessage(response.Error.Message) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func jsonRPCResultResponse(req *http.Request, id json.RawMessage, result string) *http.Response {
+	if len(id) == 0 {
+		id = json.RawMessage("1")
+	}
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":%q}`, string(id), result)
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// tokenBucket allows rate events per second with bursts of up to burst. A
+// nil bucket never waits.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rpcTestEndpoint answers JSON-RPC requests with handle and records the
+// methods it was called with.
+type rpcTestEndpoint struct {
+	mu      sync.Mutex
+	methods []string
+	handle  func(method string, call int) (status int, payload string)
+}
+
+func (e *rpcTestEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	requests, err := parseRPCRequests(body)
+	if err != nil || len(requests) == 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	e.mu.Lock()
+	e.methods = append(e.methods, requests[0].Method)
+	call := 0
+	for _, method := range e.methods {
+		if method == requests[0].Method {
+			call++
+		}
+	}
+	e.mu.Unlock()
+
+	status, payload := e.handle(requests[0].Method, call)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, payload)
+}
+
+func (e *rpcTestEndpoint) calls(method string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	count := 0
+	for _, called := range e.methods {
+		if called == method {
+			count++
+		}
+	}
+	return count
+}
+
+func rpcResult(result string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":%s}`, result)
+}
+
+func rpcError(code int, message string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"error":{"code":%d,"message":%q}}`, code, message)
+}
+
+// newTestTransport serves each endpoint and returns a transport over them
+// that records its backoffs instead of sleeping.
+func newTestTransport(t *testing.T, endpoints ...*rpcTestEndpoint) (*FailoverTransport, *[]time.Duration) {
+	t.Helper()
+
+	var urls []string
+	for _, endpoint := range endpoints {
+		server := httptest.NewServer(endpoint)
+		t.Cleanup(server.Close)
+		urls = append(urls, server.URL)
+	}
+
+	transport := NewFailoverTransport(urls, RPCOptions{MaxAttempts: 4, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Timeout: 5 * time.Second}, http.DefaultTransport)
+	transport.jitter = func() float64 { return 1 }
+
+	var sleeps []time.Duration
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+
+	return transport, &sleeps
+}
+
+func rpcCall(t *testing.T, transport *FailoverTransport, body string) (string, error) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "http://rpc", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	return string(payload), err
+}
+
+const (
+	blockNumberRequest = `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+	sendRawRequest     = `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0xf86c0185"]}`
+)
+
+func TestFailoverTransportFailsOver(t *testing.T) {
+	down := &rpcTestEndpoint{handle: func(string, int) (int, string) { return http.StatusBadGateway, "bad gateway" }}
+	up := &rpcTestEndpoint{handle: func(string, int) (int, string) { return http.StatusOK, rpcResult(`"0x10"`) }}
+	transport, _ := newTestTransport(t, down, up)
+
+	payload, err := rpcCall(t, transport, blockNumberRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != rpcResult(`"0x10"`) {
+		t.Fatalf("payload %s, want the answer of the healthy endpoint", payload)
+	}
+
+	// the failed endpoint is ranked last for the next request
+	if _, err := rpcCall(t, transport, blockNumberRequest); err != nil {
+		t.Fatal(err)
+	}
+	if down.calls("eth_blockNumber") != 1 || up.calls("eth_blockNumber") != 2 {
+		t.Errorf("down called %d times, up %d times, want 1 and 2", down.calls("eth_blockNumber"), up.calls("eth_blockNumber"))
+	}
+}
+
+func TestFailoverTransportRetriesWithBackoff(t *testing.T) {
+	flaky := &rpcTestEndpoint{handle: func(_ string, call int) (int, string) {
+		if call < 3 {
+			return http.StatusServiceUnavailable, "unavailable"
+		}
+		return http.StatusOK, rpcResult(`"0x10"`)
+	}}
+	transport, sleeps := newTestTransport(t, flaky)
+
+	if _, err := rpcCall(t, transport, blockNumberRequest); err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}; fmt.Sprint(*sleeps) != fmt.Sprint(want) {
+		t.Errorf("backoffs %v, want %v", *sleeps, want)
+	}
+
+	down := &rpcTestEndpoint{handle: func(string, int) (int, string) { return http.StatusInternalServerError, "boom" }}
+	transport, _ = newTestTransport(t, down)
+	_, err := rpcCall(t, transport, blockNumberRequest)
+	if err == nil {
+		t.Fatal("request succeeded against an endpoint that always fails")
+	}
+	if down.calls("eth_blockNumber") != 4 {
+		t.Errorf("%d attempts, want MaxAttempts", down.calls("eth_blockNumber"))
+	}
+}
+
+func TestFailoverTransportRateLimited(t *testing.T) {
+	for name, limited := range map[string]func() (int, string){
+		"http 429": func() (int, string) { return http.StatusTooManyRequests, "slow down" },
+		"json-rpc": func() (int, string) { return http.StatusOK, rpcError(-32005, "daily request count exceeded") },
+		"json-rpc batch": func() (int, string) {
+			return http.StatusOK, `[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"error":{"code":-32005,"message":"rate limit"}}]`
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			endpoint := &rpcTestEndpoint{handle: func(_ string, call int) (int, string) {
+				if call == 1 {
+					return limited()
+				}
+				return http.StatusOK, rpcResult(`"0x10"`)
+			}}
+			transport, _ := newTestTransport(t, endpoint)
+
+			payload, err := rpcCall(t, transport, blockNumberRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload != rpcResult(`"0x10"`) || endpoint.calls("eth_blockNumber") != 2 {
+				t.Errorf("payload %s after %d calls, want the retried answer", payload, endpoint.calls("eth_blockNumber"))
+			}
+		})
+	}
+
+	t.Run("retry after", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			io.WriteString(w, rpcResult(`"0x10"`))
+		}))
+		t.Cleanup(server.Close)
+
+		transport := NewFailoverTransport([]string{server.URL}, RPCOptions{MaxAttempts: 2, Backoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second}, http.DefaultTransport)
+		var sleeps []time.Duration
+		transport.sleep = func(ctx context.Context, d time.Duration) error {
+			sleeps = append(sleeps, d)
+			return nil
+		}
+
+		if _, err := rpcCall(t, transport, blockNumberRequest); err != nil {
+			t.Fatal(err)
+		}
+		if len(sleeps) != 1 || sleeps[0] != 7*time.Second {
+			t.Errorf("backoffs %v, want the 7s Retry-After", sleeps)
+		}
+	})
+}
+
+func TestIsRateLimitedPayload(t *testing.T) {
+	for payload, want := range map[string]bool{
+		rpcResult(`"0x1"`):                                                           false,
+		rpcError(-32000, "execution reverted"):                                       false,
+		rpcError(-32005, "rate limit exceeded"):                                      true,
+		rpcError(-32005, "query returned more than 10000 results"):                   false,
+		`[` + rpcResult(`"0x1"`) + `,` + rpcError(-32005, "too many requests") + `]`: true,
+		`[` + rpcResult(`"0x1"`) + `,` + rpcResult(`"0x2"`) + `]`:                    false,
+		`not json`: false,
+	} {
+		if got := isRateLimitedPayload([]byte(payload)); got != want {
+			t.Errorf("isRateLimitedPayload(%s) = %t, want %t", payload, got, want)
+		}
+	}
+}
+
+func TestFailoverTransportSendRawLanded(t *testing.T) {
+	// the first endpoint accepts the transaction but the answer is lost
+	accepting := &rpcTestEndpoint{handle: func(method string, _ int) (int, string) {
+		if method == "eth_sendRawTransaction" {
+			return http.StatusBadGateway, "bad gateway"
+		}
+		return http.StatusOK, rpcResult(`{"hash":"0x1"}`)
+	}}
+	other := &rpcTestEndpoint{handle: func(method string, _ int) (int, string) {
+		if method == "eth_getTransactionByHash" {
+			return http.StatusOK, rpcResult("null")
+		}
+		return http.StatusOK, rpcResult(`"0xother"`)
+	}}
+	transport, _ := newTestTransport(t, accepting, other)
+
+	payload, err := rpcCall(t, transport, sendRawRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(payload), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.Result, "0x") || out.Result == "0xother" {
+		t.Fatalf("result %q, want the hash of the transaction that landed", out.Result)
+	}
+	if accepting.calls("eth_getTransactionByHash") != 1 {
+		t.Errorf("accepting endpoint asked %d times, want once", accepting.calls("eth_getTransactionByHash"))
+	}
+	if other.calls("eth_sendRawTransaction") != 0 {
+		t.Errorf("transaction broadcast again to another endpoint")
+	}
+}
+
+func TestFailoverTransportSendRawRateLimited(t *testing.T) {
+	// a rate limited endpoint rejected the transaction, only the next one is
+	// asked before broadcasting there
+	limited := &rpcTestEndpoint{handle: func(string, int) (int, string) { return http.StatusTooManyRequests, "slow down" }}
+	other := &rpcTestEndpoint{handle: func(method string, _ int) (int, string) {
+		if method == "eth_getTransactionByHash" {
+			return http.StatusOK, rpcResult("null")
+		}
+		return http.StatusOK, rpcResult(`"0xsent"`)
+	}}
+	transport, _ := newTestTransport(t, limited, other)
+
+	payload, err := rpcCall(t, transport, sendRawRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != rpcResult(`"0xsent"`) {
+		t.Fatalf("payload %s, want the broadcast answer of the second endpoint", payload)
+	}
+	if limited.calls("eth_getTransactionByHash") != 0 || other.calls("eth_getTransactionByHash") != 1 {
+		t.Errorf("landed check asked the limited endpoint %d times and the other %d times, want 0 and 1", limited.calls("eth_getTransactionByHash"), other.calls("eth_getTransactionByHash"))
+	}
+}
+
+func TestFailoverTransportSendRawUnknownOutcome(t *testing.T) {
+	// nobody can tell whether the transaction landed, it must not be sent
+	// again
+	down := &rpcTestEndpoint{handle: func(string, int) (int, string) { return http.StatusBadGateway, "bad gateway" }}
+	transport, _ := newTestTransport(t, down)
+
+	if _, err := rpcCall(t, transport, sendRawRequest); err == nil {
+		t.Fatal("broadcast succeeded")
+	}
+	if down.calls("eth_sendRawTransaction") != 1 {
+		t.Errorf("%d broadcasts, want 1", down.calls("eth_sendRawTransaction"))
+	}
+}
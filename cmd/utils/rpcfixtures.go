@@ -0,0 +1,510 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/streamingfast/eth-go"
+)
+
+// ErrRPCReplayMismatch is returned in replay mode for a request that no
+// recorded fixture answers.
+var ErrRPCReplayMismatch = errors.New("unexpected rpc request in replay")
+
+// rpcFixtures is set by SetRPCFixtures, every client created afterwards by
+// NewRPCClient records to, or replays from, it.
+var rpcFixtures struct {
+	recorder *rpcRecorder
+	replayer *rpcReplayer
+}
+
+// rpcFixtureRandomFile lists, next to the fixtures, the random values drawn
+// while recording, one "<kind> <value>" line each. Replay hands them back in
+// order, so that the requests built from them match the recorded ones.
+const rpcFixtureRandomFile = "random.txt"
+
+// SetRPCFixtures makes the RPC clients record their JSON-RPC exchanges as
+// fixture files in recordDir, or answer them strictly from the fixtures of
+// replayDir without any network access. Both empty disables fixtures.
+func SetRPCFixtures(recordDir, replayDir string) error {
+	if recordDir != "" && replayDir != "" {
+		return fmt.Errorf("--rpc-record and --rpc-replay are mutually exclusive")
+	}
+
+	rpcFixtures.recorder = nil
+	rpcFixtures.replayer = nil
+
+	if recordDir != "" {
+		if err := os.MkdirAll(recordDir, 0o755); err != nil {
+			return fmt.Errorf("creating rpc record dir: %w", err)
+		}
+		rpcFixtures.recorder = &rpcRecorder{dir: recordDir}
+	}
+
+	if replayDir != "" {
+		replayer, err := loadRPCReplayer(replayDir)
+		if err != nil {
+			return err
+		}
+		rpcFixtures.replayer = replayer
+	}
+
+	return nil
+}
+
+// rpcFixture is a recorded HTTP exchange. Request is normalized (see
+// normalizeRPCRequests), the response ids are replaced by the position of the
+// request they answer so that they can be given back the replayed ids.
+type rpcFixture struct {
+	Request  json.RawMessage `json:"request"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+
+	file string
+	used bool
+}
+
+type rpcRecorder struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// recordingTransport saves every exchange going through base.
+type recordingTransport struct {
+	recorder *rpcRecorder
+	base     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(payload))
+
+	requests, err := parseRPCRequests(body)
+	if err != nil {
+		return nil, fmt.Errorf("recording rpc request: %w", err)
+	}
+
+	fixture := &rpcFixture{Status: resp.StatusCode}
+	if fixture.Request, err = normalizeRPCRequests(body); err != nil {
+		return nil, fmt.Errorf("recording rpc request: %w", err)
+	}
+	if fixture.Response, err = replaceRPCResponseIDs(payload, requestIDPositions(requests)); err != nil {
+		return nil, fmt.Errorf("recording rpc response: %w", err)
+	}
+
+	if err := t.recorder.save(fixture); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (r *rpcRecorder) save(fixture *rpcFixture) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	content, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding rpc fixture: %w", err)
+	}
+
+	file := filepath.Join(r.dir, fmt.Sprintf("%04d.json", r.seq))
+	if err := os.WriteFile(file, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing rpc fixture: %w", err)
+	}
+
+	return nil
+}
+
+func (r *rpcRecorder) saveRandom(kind, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(r.dir, rpcFixtureRandomFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("recording random value: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s %s\n", kind, value); err != nil {
+		return fmt.Errorf("recording random value: %w", err)
+	}
+
+	return nil
+}
+
+// fixtureRandom returns the next recorded value of kind in replay mode. It
+// draws the value with generate otherwise, recording it in record mode.
+func fixtureRandom(kind string, generate func() (string, error)) (string, error) {
+	if replayer := rpcFixtures.replayer; replayer != nil {
+		return replayer.nextRandom(kind)
+	}
+
+	value, err := generate()
+	if err != nil {
+		return "", err
+	}
+
+	if recorder := rpcFixtures.recorder; recorder != nil {
+		if err := recorder.saveRandom(kind, value); err != nil {
+			return "", err
+		}
+	}
+
+	return value, nil
+}
+
+// rpcReplayer answers requests with the first unused fixture recorded for the
+// same normalized request, so that repeated polls get the answers in the
+// order they were recorded.
+type rpcReplayer struct {
+	mu       sync.Mutex
+	fixtures []*rpcFixture
+	random   map[string][]string
+}
+
+func loadRPCReplayer(dir string) (*rpcReplayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("listing rpc fixtures: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no rpc fixtures found in %s", dir)
+	}
+	sort.Strings(files)
+
+	replayer := &rpcReplayer{}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading rpc fixture: %w", err)
+		}
+
+		fixture := &rpcFixture{file: filepath.Base(file)}
+		if err := json.Unmarshal(content, fixture); err != nil {
+			return nil, fmt.Errorf("decoding rpc fixture %s: %w", file, err)
+		}
+		if fixture.Request, err = canonicalJSON(fixture.Request); err != nil {
+			return nil, fmt.Errorf("decoding rpc fixture %s request: %w", file, err)
+		}
+
+		replayer.fixtures = append(replayer.fixtures, fixture)
+	}
+
+	if replayer.random, err = loadFixtureRandom(filepath.Join(dir, rpcFixtureRandomFile)); err != nil {
+		return nil, err
+	}
+
+	return replayer, nil
+}
+
+// loadFixtureRandom reads the random values of file by kind, a recording
+// that drew none has no file.
+func loadFixtureRandom(file string) (map[string][]string, error) {
+	random := map[string][]string{}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return random, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading recorded random values: %w", err)
+	}
+
+	for i, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if line == "" {
+			continue
+		}
+		kind, value, found := strings.Cut(line, " ")
+		if !found {
+			return nil, fmt.Errorf("%s line %d: want \"<kind> <value>\", got %q", rpcFixtureRandomFile, i+1, line)
+		}
+		random[kind] = append(random[kind], value)
+	}
+
+	return random, nil
+}
+
+func (r *rpcReplayer) nextRandom(kind string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values := r.random[kind]
+	if len(values) == 0 {
+		return "", fmt.Errorf("%w: no recorded %s left", ErrRPCReplayMismatch, kind)
+	}
+	r.random[kind] = values[1:]
+
+	return values[0], nil
+}
+
+func (r *rpcReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := parseRPCRequests(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRPCReplayMismatch, err)
+	}
+
+	normalized, err := normalizeRPCRequests(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRPCReplayMismatch, err)
+	}
+
+	fixture := r.take(normalized)
+	if fixture == nil {
+		return nil, fmt.Errorf("%w: no unused fixture for %s", ErrRPCReplayMismatch, normalized)
+	}
+
+	ids := make(map[int]json.RawMessage, len(requests))
+	for i, request := range requests {
+		ids[i] = request.ID
+	}
+
+	payload, err := restoreRPCResponseIDs(fixture.Response, ids)
+	if err != nil {
+		return nil, fmt.Errorf("rpc fixture %s: %w", fixture.file, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(payload)),
+		ContentLength: int64(len(payload)),
+		Request:       req,
+	}, nil
+}
+
+func (r *rpcReplayer) take(normalized []byte) *rpcFixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, fixture := range r.fixtures {
+		if !fixture.used && bytes.Equal(fixture.Request, normalized) {
+			fixture.used = true
+			return fixture
+		}
+	}
+
+	return nil
+}
+
+// normalizeRPCRequests drops the ids and jsonrpc version of body, and replaces
+// signed raw transactions by their decoded fields without nonce and
+// signature. The result is canonical JSON, comparable byte for byte.
+func normalizeRPCRequests(body []byte) ([]byte, error) {
+	requests, err := parseRPCRequests(body)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := make([]interface{}, len(requests))
+	for i, request := range requests {
+		params := make([]interface{}, len(request.Params))
+		for j, param := range request.Params {
+			params[j] = param
+		}
+
+		if request.Method == "eth_sendRawTransaction" && len(request.Params) == 1 {
+			if trx, err := normalizeRawTransaction(request.Params[0]); err == nil {
+				params[0] = trx
+			}
+		}
+
+		normalized[i] = map[string]interface{}{"method": request.Method, "params": params}
+	}
+
+	var out interface{} = normalized
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] != '[' {
+		out = normalized[0]
+	}
+
+	content, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return canonicalJSON(content)
+}
+
+type rawLegacyTransaction struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       []byte
+	Value    *big.Int
+	Data     []byte
+	V        *big.Int
+	R        *big.Int
+	S        *big.Int
+}
+
+func normalizeRawTransaction(param json.RawMessage) (map[string]string, error) {
+	var raw string
+	if err := json.Unmarshal(param, &raw); err != nil {
+		return nil, err
+	}
+
+	data, err := eth.NewHex(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	trx := &rawLegacyTransaction{}
+	if err := rlp.DecodeBytes(data, trx); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"gasPrice": fmt.Sprintf("0x%x", trx.GasPrice),
+		"gas":      fmt.Sprintf("0x%x", trx.Gas),
+		"to":       eth.Hex(trx.To).Pretty(),
+		"value":    fmt.Sprintf("0x%x", trx.Value),
+		"data":     eth.Hex(trx.Data).Pretty(),
+	}, nil
+}
+
+func requestIDPositions(requests []*rpcRequestEnvelope) map[string]int {
+	positions := make(map[string]int, len(requests))
+	for i, request := range requests {
+		positions[string(request.ID)] = i
+	}
+
+	return positions
+}
+
+// replaceRPCResponseIDs replaces the ids of payload, a single or batch
+// JSON-RPC response, by the position of the request they answer.
+func replaceRPCResponseIDs(payload []byte, positions map[string]int) (json.RawMessage, error) {
+	return mapRPCResponseIDs(payload, func(id json.RawMessage) (json.RawMessage, error) {
+		position, found := positions[string(id)]
+		if !found {
+			// an error response to an unparsable request, keep it as is
+			return id, nil
+		}
+		return json.RawMessage(fmt.Sprintf("%d", position)), nil
+	})
+}
+
+// restoreRPCResponseIDs is the reverse of replaceRPCResponseIDs, with the ids
+// of the replayed requests.
+func restoreRPCResponseIDs(payload []byte, ids map[int]json.RawMessage) ([]byte, error) {
+	return mapRPCResponseIDs(payload, func(id json.RawMessage) (json.RawMessage, error) {
+		var position int
+		if err := json.Unmarshal(id, &position); err != nil {
+			return nil, fmt.Errorf("invalid response id %s", id)
+		}
+		replayed, found := ids[position]
+		if !found {
+			return nil, fmt.Errorf("response id %d matches no request", position)
+		}
+		return replayed, nil
+	})
+}
+
+func mapRPCResponseIDs(payload []byte, mapID func(id json.RawMessage) (json.RawMessage, error)) ([]byte, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 || (trimmed[0] != '[' && trimmed[0] != '{') {
+		// not JSON-RPC, e.g. an HTTP error page
+		return trimmed, nil
+	}
+
+	batch := trimmed[0] == '['
+	var responses []map[string]json.RawMessage
+	if batch {
+		if err := json.Unmarshal(trimmed, &responses); err != nil {
+			return nil, err
+		}
+	} else {
+		response := map[string]json.RawMessage{}
+		if err := json.Unmarshal(trimmed, &response); err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+
+	for _, response := range responses {
+		id, found := response["id"]
+		if !found || string(id) == "null" {
+			continue
+		}
+		mapped, err := mapID(id)
+		if err != nil {
+			return nil, err
+		}
+		response["id"] = mapped
+	}
+
+	if batch {
+		return json.Marshal(responses)
+	}
+	return json.Marshal(responses[0])
+}
+
+// canonicalJSON re-encodes content with sorted object keys and lowercase
+// hex strings, so that equal requests compare equal.
+func canonicalJSON(content []byte) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(lowercaseHex(value))
+}
+
+func lowercaseHex(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			return strings.ToLower(v)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = lowercaseHex(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = lowercaseHex(v[k])
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// SafeBatch is a Safe Transaction Builder batch, the JSON file treasury
+// wallets import to run several transactions at once.
+type SafeBatch struct {
+	Version      string             `json:"version"`
+	ChainID      string             `json:"chainId"`
+	CreatedAt    int64              `json:"createdAt"`
+	Meta         SafeBatchMeta      `json:"meta"`
+	Transactions []*SafeTransaction `json:"transactions"`
+}
+
+type SafeBatchMeta struct {
+	Name                    string `json:"name"`
+	Description             string `json:"description"`
+	TxBuilderVersion        string `json:"txBuilderVersion"`
+	CreatedFromSafeAddress  string `json:"createdFromSafeAddress"`
+	CreatedFromOwnerAddress string `json:"createdFromOwnerAddress"`
+}
+
+type SafeTransaction struct {
+	To                   string             `json:"to"`
+	Value                string             `json:"value"`
+	Data                 *string            `json:"data"`
+	ContractMethod       SafeContractMethod `json:"contractMethod"`
+	ContractInputsValues map[string]string  `json:"contractInputsValues"`
+}
+
+type SafeContractMethod struct {
+	Inputs  []SafeMethodInput `json:"inputs"`
+	Name    string            `json:"name"`
+	Payable bool              `json:"payable"`
+}
+
+type SafeMethodInput struct {
+	InternalType string `json:"internalType"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+}
+
+func NewSafeBatch(chainID uint64, description string) *SafeBatch {
+	return &SafeBatch{
+		Version:   "1.0",
+		ChainID:   strconv.FormatUint(chainID, 10),
+		CreatedAt: time.Now().UnixMilli(),
+		Meta: SafeBatchMeta{
+			Name:             "Transactions Batch",
+			Description:      description,
+			TxBuilderVersion: "1.18.0",
+		},
+	}
+}
+
+// SafeArg is a named contract method argument, Value is rendered the way the
+// Safe Transaction Builder expects: decimal numbers, 0x-prefixed hex.
+type SafeArg struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// Add appends a call of method on the contract `to`.
+func (b *SafeBatch) Add(to string, method string, args ...SafeArg) {
+	trx := &SafeTransaction{
+		To:                   to,
+		Value:                "0",
+		ContractMethod:       SafeContractMethod{Name: method, Inputs: []SafeMethodInput{}},
+		ContractInputsValues: map[string]string{},
+	}
+	for _, arg := range args {
+		trx.ContractMethod.Inputs = append(trx.ContractMethod.Inputs, SafeMethodInput{InternalType: arg.Type, Name: arg.Name, Type: arg.Type})
+		trx.ContractInputsValues[arg.Name] = arg.Value
+	}
+
+	b.Transactions = append(b.Transactions, trx)
+}
+
+func (b *SafeBatch) JSON() (string, error) {
+	out, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
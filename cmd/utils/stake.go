@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// IndexerStake holds the Staking contract figures needed to compute how many
+// tokens an indexer can still allocate.
+type IndexerStake struct {
+	Indexer         eth.Address
+	TokensStaked    *big.Int
+	TokensAllocated *big.Int
+	TokensLocked    *big.Int
+	DelegatedTokens *big.Int
+	DelegationRatio uint32
+}
+
+// Capacity is the indexer's own stake plus the delegated tokens it may use,
+// capped at `delegationRatio` times its own stake.
+func (s *IndexerStake) Capacity() *big.Int {
+	delegatedMax := new(big.Int).Mul(s.TokensStaked, big.NewInt(int64(s.DelegationRatio)))
+	delegated := s.DelegatedTokens
+	if delegated.Cmp(delegatedMax) > 0 {
+		delegated = delegatedMax
+	}
+
+	return new(big.Int).Add(s.TokensStaked, delegated)
+}
+
+// Used is the amount of tokens already allocated or locked while thawing.
+func (s *IndexerStake) Used() *big.Int {
+	return new(big.Int).Add(s.TokensAllocated, s.TokensLocked)
+}
+
+// Available is the amount of tokens the indexer can still allocate.
+func (s *IndexerStake) Available() *big.Int {
+	available := new(big.Int).Sub(s.Capacity(), s.Used())
+	if available.Sign() < 0 {
+		return big.NewInt(0)
+	}
+
+	return available
+}
+
+func (s *IndexerStake) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Indexer %s stake:\n", s.Indexer.Pretty())
+	fmt.Fprintf(&out, "  Staked:            %s\n", FormatGRT(s.TokensStaked))
+	fmt.Fprintf(&out, "  Delegated:         %s (ratio %d)\n", FormatGRT(s.DelegatedTokens), s.DelegationRatio)
+	fmt.Fprintf(&out, "  Capacity:          %s\n", FormatGRT(s.Capacity()))
+	fmt.Fprintf(&out, "  Allocated:         %s\n", FormatGRT(s.TokensAllocated))
+	fmt.Fprintf(&out, "  Locked (thawing):  %s\n", FormatGRT(s.TokensLocked))
+	fmt.Fprintf(&out, "  Available:         %s", FormatGRT(s.Available()))
+
+	return out.String()
+}
+
+func GetIndexerStakeCall(ctx context.Context, cli *ethrpc.Client, indexer string) (*IndexerStake, error) {
+	stake := &IndexerStake{}
+	batch := NewBatch(cli)
+	batch.IndexerStake(eth.MustNewAddress(indexer), stake)
+	if err := batch.Do(ctx); err != nil {
+		return nil, fmt.Errorf("fetching indexer stake: %w", err)
+	}
+
+	return stake, nil
+}
+
+// CheckStakeCapacity fetches the indexer stake and returns an error
+// suggesting the maximum possible amount when amount exceeds what is
+// still available to allocate.
+func CheckStakeCapacity(ctx context.Context, cli *ethrpc.Client, indexer string, amount *big.Int) (*IndexerStake, error) {
+	stake, err := GetIndexerStakeCall(ctx, cli, indexer)
+	if err != nil {
+		return nil, err
+	}
+
+	return stake, stake.CheckCapacity(amount)
+}
+
+// CheckCapacity returns an error suggesting the maximum possible amount when
+// amount exceeds what is still available to allocate.
+func (s *IndexerStake) CheckCapacity(amount *big.Int) error {
+	if amount.Cmp(s.Available()) > 0 {
+		maxGRT := new(big.Int).Div(s.Available(), ConvertToWei(1))
+		return fmt.Errorf("allocation amount %s exceeds indexer %s available stake %s. maximum possible allocation amount is %s GRT", FormatGRT(amount), s.Indexer.Pretty(), FormatGRT(s.Available()), maxGRT)
+	}
+
+	return nil
+}
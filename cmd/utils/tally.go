@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// RequireTally checks that the profile has the contracts TAP receipts are
+// signed for and redeemed through.
+func (p *NetworkProfile) RequireTally() error {
+	if err := p.RequireEscrow(); err != nil {
+		return err
+	}
+	if p.GraphTallyCollector == "" {
+		return fmt.Errorf("network profile %s has no graph_tally_collector, TAP requires a horizon profile with graph_tally_collector", p.Name)
+	}
+
+	return nil
+}
+
+// RequireTapVerifier checks that the profile has the contracts TAP v1
+// receipts are signed for and redeemed through.
+func (p *NetworkProfile) RequireTapVerifier() error {
+	if err := p.RequireTapEscrow(); err != nil {
+		return err
+	}
+	if p.TapVerifier == "" {
+		return fmt.Errorf("network profile %s has no tap_verifier, TAP v1 receipts require a network profile file with tap_verifier", p.Name)
+	}
+
+	return nil
+}
+
+// IsTallySignerAuthorizedCall tells whether signer may sign receipts and RAVs
+// on behalf of payer, as authorized on GraphTallyCollector.
+func IsTallySignerAuthorizedCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, payer, signer eth.Address) (bool, error) {
+	out, err := contractCall(ctx, cli, profile.GraphTallyCollector, "isAuthorized(address,address) (bool)", payer, signer)
+	if err != nil {
+		return false, err
+	}
+
+	return out[0].(bool), nil
+}
+
+// GetTokensCollectedCall is how much of the RAVs of a collection
+// GraphTallyCollector already paid to receiver, a RAV only pays the rest of
+// its aggregate value.
+func GetTokensCollectedCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, dataService eth.Address, collectionID []byte, receiver, payer eth.Address) (*big.Int, error) {
+	out, err := contractCall(ctx, cli, profile.GraphTallyCollector, "tokensCollected(address,bytes32,address,address) (uint256)", dataService, collectionID, receiver, payer)
+	if err != nil {
+		return nil, err
+	}
+
+	return out[0].(*big.Int), nil
+}
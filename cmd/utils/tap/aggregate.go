@@ -0,0 +1,135 @@
+package tap
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/streamingfast/eth-go"
+)
+
+// NewReceipt is a receipt of value for the allocation, timestamped now with
+// a random nonce.
+func NewReceipt(allocationID, payer, dataService, serviceProvider common.Address, value *big.Int) (*Receipt, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Receipt{
+		CollectionID:    CollectionID(allocationID),
+		Payer:           payer,
+		DataService:     dataService,
+		ServiceProvider: serviceProvider,
+		TimestampNs:     uint64(time.Now().UnixNano()),
+		Nonce:           nonce,
+		Value:           value,
+	}, nil
+}
+
+func newNonce() (uint64, error) {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return 0, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	return binary.BigEndian.Uint64(nonce[:]), nil
+}
+
+// Aggregate checks the receipts and sums them, on top of the previous RAV of
+// the collection when not nil, into a RAV signed by key. The receipts, and
+// the previous RAV, must all be signed by key in domain, be for the same
+// collection, payer, data service and service provider, and be newer than
+// the previous RAV. Duplicated receipts are rejected.
+func Aggregate(domain *Domain, receipts []*SignedReceipt, previous *SignedRAV, key *eth.PrivateKey) (*SignedRAV, error) {
+	if len(receipts) == 0 {
+		return nil, fmt.Errorf("no receipts to aggregate")
+	}
+
+	signer := common.BytesToAddress(key.PublicKey().Address().Bytes())
+	first := receipts[0].Message
+	if first == nil {
+		return nil, fmt.Errorf("receipt 0 has no message")
+	}
+
+	rav := &ReceiptAggregateVoucher{
+		CollectionID:    first.CollectionID,
+		Payer:           first.Payer,
+		ServiceProvider: first.ServiceProvider,
+		DataService:     first.DataService,
+		ValueAggregate:  big.NewInt(0),
+		Metadata:        Bytes{},
+	}
+
+	if previous != nil {
+		if err := previous.Verify(domain, signer); err != nil {
+			return nil, fmt.Errorf("previous RAV: %w", err)
+		}
+		if err := rav.sameCollection(previous.Message); err != nil {
+			return nil, fmt.Errorf("previous RAV: %w", err)
+		}
+		rav.TimestampNs = previous.Message.TimestampNs
+		rav.ValueAggregate.Set(previous.Message.ValueAggregate)
+	}
+
+	seen := map[string]bool{}
+	for i, receipt := range receipts {
+		if receipt.Message == nil {
+			return nil, fmt.Errorf("receipt %d has no message", i)
+		}
+
+		recovered, err := receipt.Recover(domain)
+		if err != nil {
+			return nil, fmt.Errorf("receipt %d: %w", i, err)
+		}
+		if recovered != signer {
+			return nil, fmt.Errorf("receipt %d was signed by %s, expected %s", i, recovered.Hex(), signer.Hex())
+		}
+
+		if seen[string(receipt.Signature)] {
+			return nil, fmt.Errorf("receipt %d is a duplicate", i)
+		}
+		seen[string(receipt.Signature)] = true
+
+		message := receipt.Message
+		if message.CollectionID != rav.CollectionID || message.Payer != rav.Payer || message.DataService != rav.DataService || message.ServiceProvider != rav.ServiceProvider {
+			return nil, fmt.Errorf("receipt %d is for collection %s of payer %s, expected collection %s of payer %s", i, message.CollectionID.Hex(), message.Payer.Hex(), rav.CollectionID.Hex(), rav.Payer.Hex())
+		}
+		if previous != nil && message.TimestampNs <= previous.Message.TimestampNs {
+			return nil, fmt.Errorf("receipt %d is not newer than the previous RAV, it was already aggregated", i)
+		}
+		if err := checkValue(message.Value); err != nil {
+			return nil, fmt.Errorf("receipt %d: %w", i, err)
+		}
+
+		rav.ValueAggregate.Add(rav.ValueAggregate, message.Value)
+		if message.TimestampNs > rav.TimestampNs {
+			rav.TimestampNs = message.TimestampNs
+		}
+	}
+
+	return SignRAV(domain, rav, key)
+}
+
+func (r *ReceiptAggregateVoucher) sameCollection(other *ReceiptAggregateVoucher) error {
+	if other == nil {
+		return fmt.Errorf("no message")
+	}
+
+	if other.CollectionID != r.CollectionID || other.Payer != r.Payer || other.DataService != r.DataService || other.ServiceProvider != r.ServiceProvider {
+		return fmt.Errorf("is for collection %s of payer %s, expected collection %s of payer %s", other.CollectionID.Hex(), other.Payer.Hex(), r.CollectionID.Hex(), r.Payer.Hex())
+	}
+
+	return nil
+}
+
+// SortReceipts orders receipts by timestamp, the order they were issued in.
+func SortReceipts(receipts []*SignedReceipt) {
+	sort.SliceStable(receipts, func(i, j int) bool {
+		return receipts[i].Message.TimestampNs < receipts[j].Message.TimestampNs
+	})
+}
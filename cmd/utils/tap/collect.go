@@ -0,0 +1,180 @@
+package tap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// QueryFeePaymentType is the PaymentTypes.QueryFee of SubgraphService
+// `collect(indexer, paymentType, data)`.
+const QueryFeePaymentType uint8 = 0
+
+// collectArguments is (SignedRAV, uint256 tokensToCollect), the `data` of a
+// query fee collection. Nested tuples are beyond eth-go method definitions.
+var collectArguments = func() abi.Arguments {
+	signedRAV, err := abi.NewType("tuple", "", []abi.ArgumentMarshaling{
+		{Name: "rav", Type: "tuple", Components: []abi.ArgumentMarshaling{
+			{Name: "collectionId", Type: "bytes32"},
+			{Name: "payer", Type: "address"},
+			{Name: "serviceProvider", Type: "address"},
+			{Name: "dataService", Type: "address"},
+			{Name: "timestampNs", Type: "uint64"},
+			{Name: "valueAggregate", Type: "uint128"},
+			{Name: "metadata", Type: "bytes"},
+		}},
+		{Name: "signature", Type: "bytes"},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	uint256, err := abi.NewType("uint256", "", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return abi.Arguments{{Name: "signedRav", Type: signedRAV}, {Name: "tokensToCollect", Type: uint256}}
+}()
+
+type abiRAV struct {
+	CollectionId    [32]byte
+	Payer           common.Address
+	ServiceProvider common.Address
+	DataService     common.Address
+	TimestampNs     uint64
+	ValueAggregate  *big.Int
+	Metadata        []byte
+}
+
+type abiSignedRAV struct {
+	Rav       abiRAV
+	Signature []byte
+}
+
+// EncodeCollectData is the `data` of SubgraphService `collect` redeeming
+// the RAV: abi.encode(signedRav, tokensToCollect).
+func EncodeCollectData(rav *SignedRAV, tokensToCollect *big.Int) ([]byte, error) {
+	message := rav.Message
+	encoded, err := collectArguments.Pack(abiSignedRAV{
+		Rav: abiRAV{
+			CollectionId:    message.CollectionID,
+			Payer:           message.Payer,
+			ServiceProvider: message.ServiceProvider,
+			DataService:     message.DataService,
+			TimestampNs:     message.TimestampNs,
+			ValueAggregate:  message.ValueAggregate,
+			Metadata:        message.Metadata,
+		},
+		Signature: rav.Signature,
+	}, tokensToCollect)
+	if err != nil {
+		return nil, fmt.Errorf("encoding collect data: %w", err)
+	}
+
+	return encoded, nil
+}
+
+// DecodeCollectData is the reverse of EncodeCollectData.
+func DecodeCollectData(data []byte) (*SignedRAV, *big.Int, error) {
+	values, err := collectArguments.Unpack(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding collect data: %w", err)
+	}
+
+	var decoded struct {
+		SignedRav       abiSignedRAV
+		TokensToCollect *big.Int
+	}
+	if err := collectArguments.Copy(&decoded, values); err != nil {
+		return nil, nil, fmt.Errorf("decoding collect data: %w", err)
+	}
+
+	rav := decoded.SignedRav.Rav
+	return &SignedRAV{
+		Message: &ReceiptAggregateVoucher{
+			CollectionID:    rav.CollectionId,
+			Payer:           rav.Payer,
+			ServiceProvider: rav.ServiceProvider,
+			DataService:     rav.DataService,
+			TimestampNs:     rav.TimestampNs,
+			ValueAggregate:  rav.ValueAggregate,
+			Metadata:        rav.Metadata,
+		},
+		Signature: decoded.SignedRav.Signature,
+	}, decoded.TokensToCollect, nil
+}
+
+// ReadReceipts reads signed receipts from a JSON array, or a stream of JSON
+// objects such as JSON lines.
+func ReadReceipts(path string) ([]*SignedReceipt, error) {
+	return readStream[SignedReceipt](path, "receipts")
+}
+
+func ReadRAV(path string) (*SignedRAV, error) {
+	rav := &SignedRAV{}
+	if err := readJSON(path, "RAV", rav); err != nil {
+		return nil, err
+	}
+	if rav.Message == nil {
+		return nil, fmt.Errorf("RAV %s has no message", path)
+	}
+
+	return rav, nil
+}
+
+func readStream[T any](path string, what string) ([]*T, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", what, err)
+	}
+	defer file.Close()
+
+	var out []*T
+	decoder := json.NewDecoder(file)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decoding %s %s: %w", what, path, err)
+		}
+
+		if len(raw) > 0 && raw[0] == '[' {
+			var batch []*T
+			if err := json.Unmarshal(raw, &batch); err != nil {
+				return nil, fmt.Errorf("decoding %s %s: %w", what, path, err)
+			}
+			out = append(out, batch...)
+			continue
+		}
+
+		item := new(T)
+		if err := json.Unmarshal(raw, item); err != nil {
+			return nil, fmt.Errorf("decoding %s %s: %w", what, path, err)
+		}
+		out = append(out, item)
+	}
+
+	return out, nil
+}
+
+func readJSON(path string, what string, dst any) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", what, err)
+	}
+
+	if err := json.Unmarshal(content, dst); err != nil {
+		return fmt.Errorf("decoding %s %s: %w", what, path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package tap
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/streamingfast/eth-go"
+)
+
+// signerProofMessage is keccak256(chainID ++ proofDeadline ++ sender), the
+// chain ID and deadline as uint256, what the TAP v1 Escrow `authorizeSigner`
+// expects the signer to have signed.
+func signerProofMessage(chainID uint64, proofDeadline uint64, sender common.Address) []byte {
+	return crypto.Keccak256(
+		common.BigToHash(new(big.Int).SetUint64(chainID)).Bytes(),
+		uint64Word(proofDeadline),
+		sender.Bytes(),
+	)
+}
+
+// signedMessageDigest is the digest personal_sign signs for a 32 bytes
+// message.
+func signedMessageDigest(message []byte) []byte {
+	return crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n32"), message)
+}
+
+// SignerProof is the proof by signer, valid until proofDeadline (a unix
+// timestamp), that sender may authorize it on the TAP v1 Escrow.
+func SignerProof(chainID uint64, proofDeadline uint64, sender common.Address, signer *eth.PrivateKey) (Bytes, error) {
+	return sign(signedMessageDigest(signerProofMessage(chainID, proofDeadline, sender)), signer)
+}
+
+// RecoverSignerProof returns the signer of a SignerProof.
+func RecoverSignerProof(chainID uint64, proofDeadline uint64, sender common.Address, proof []byte) (common.Address, error) {
+	return recoverSigner(signedMessageDigest(signerProofMessage(chainID, proofDeadline, sender)), proof)
+}
@@ -0,0 +1,298 @@
+// Package tap signs and verifies TAP (Timeline Aggregation Protocol)
+// receipts and Receipt Aggregate Vouchers (RAVs). A payer signs a receipt per
+// query fee, then aggregates them into a RAV the indexer redeems.
+//
+// Both TAP versions are supported, the Domain telling which one a message is
+// signed for. V2 messages are for a collection ID, signed in the Horizon
+// GraphTallyCollector domain, and redeemed through SubgraphService `collect`
+// from the payer PaymentsEscrow account. V1 messages (the V1 suffixed types)
+// are for an allocation ID, signed in the "TAP" domain of the TAPVerifier,
+// and redeemed by indexer-agent through the TAP v1 Escrow the sender funded.
+package tap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/streamingfast/eth-go"
+)
+
+var (
+	eip712DomainTypeHash = crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	receiptTypeHash      = crypto.Keccak256([]byte("Receipt(bytes32 collection_id,address payer,address data_service,address service_provider,uint64 timestamp_ns,uint64 nonce,uint128 value)"))
+	ravTypeHash          = crypto.Keccak256([]byte("ReceiptAggregateVoucher(bytes32 collectionId,address payer,address serviceProvider,address dataService,uint64 timestampNs,uint128 valueAggregate,bytes metadata)"))
+
+	domainName    = crypto.Keccak256([]byte("GraphTallyCollector"))
+	domainV1Name  = crypto.Keccak256([]byte("TAP"))
+	domainVersion = crypto.Keccak256([]byte("1"))
+
+	// maxValue is the largest uint128, the type of receipt and RAV values
+	maxValue = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+)
+
+// Version is the TAP version of the messages a Domain signs.
+type Version int
+
+const (
+	V1 Version = 1
+	V2 Version = 2
+)
+
+// Domain is the EIP-712 domain receipts and RAVs are signed in: the
+// GraphTallyCollector of a chain for V2, its TAPVerifier for V1.
+type Domain struct {
+	Version           Version
+	ChainID           *big.Int
+	VerifyingContract common.Address
+}
+
+// NewDomain is the V2 domain of the GraphTallyCollector at collector.
+func NewDomain(chainID uint64, collector string) (*Domain, error) {
+	if !common.IsHexAddress(collector) {
+		return nil, fmt.Errorf("invalid collector address %q", collector)
+	}
+
+	return &Domain{Version: V2, ChainID: new(big.Int).SetUint64(chainID), VerifyingContract: common.HexToAddress(collector)}, nil
+}
+
+// NewV1Domain is the V1 domain of the TAPVerifier at verifier.
+func NewV1Domain(chainID uint64, verifier string) (*Domain, error) {
+	if !common.IsHexAddress(verifier) {
+		return nil, fmt.Errorf("invalid verifier address %q", verifier)
+	}
+
+	return &Domain{Version: V1, ChainID: new(big.Int).SetUint64(chainID), VerifyingContract: common.HexToAddress(verifier)}, nil
+}
+
+func (d *Domain) separator() []byte {
+	name := domainName
+	if d.Version == V1 {
+		name = domainV1Name
+	}
+
+	return crypto.Keccak256(
+		eip712DomainTypeHash,
+		name,
+		domainVersion,
+		common.BigToHash(d.ChainID).Bytes(),
+		common.BytesToHash(d.VerifyingContract.Bytes()).Bytes(),
+	)
+}
+
+// require fails when the domain does not sign messages of version, the same
+// message signed in the other version's domain would recover another signer.
+func (d *Domain) require(version Version) error {
+	if d.Version != version {
+		return fmt.Errorf("TAP v%d message in a TAP v%d domain", version, d.Version)
+	}
+
+	return nil
+}
+
+func (d *Domain) digest(structHash []byte) []byte {
+	return crypto.Keccak256([]byte{0x19, 0x01}, d.separator(), structHash)
+}
+
+// CollectionID is the collection of an allocation: its ID left-padded to 32
+// bytes.
+func CollectionID(allocationID common.Address) common.Hash {
+	return common.BytesToHash(allocationID.Bytes())
+}
+
+// Receipt is the fee of one query, signed by the payer or a signer it
+// authorized on GraphTallyCollector.
+type Receipt struct {
+	CollectionID    common.Hash    `json:"collection_id"`
+	Payer           common.Address `json:"payer"`
+	DataService     common.Address `json:"data_service"`
+	ServiceProvider common.Address `json:"service_provider"`
+	TimestampNs     uint64         `json:"timestamp_ns"`
+	Nonce           uint64         `json:"nonce"`
+	Value           *big.Int       `json:"value"`
+}
+
+func (r *Receipt) structHash() []byte {
+	return crypto.Keccak256(
+		receiptTypeHash,
+		r.CollectionID.Bytes(),
+		common.BytesToHash(r.Payer.Bytes()).Bytes(),
+		common.BytesToHash(r.DataService.Bytes()).Bytes(),
+		common.BytesToHash(r.ServiceProvider.Bytes()).Bytes(),
+		uint64Word(r.TimestampNs),
+		uint64Word(r.Nonce),
+		common.BigToHash(r.Value).Bytes(),
+	)
+}
+
+// ReceiptAggregateVoucher is the sum of the receipts of a collection up to
+// TimestampNs, what GraphTallyCollector pays out.
+type ReceiptAggregateVoucher struct {
+	CollectionID    common.Hash    `json:"collectionId"`
+	Payer           common.Address `json:"payer"`
+	ServiceProvider common.Address `json:"serviceProvider"`
+	DataService     common.Address `json:"dataService"`
+	TimestampNs     uint64         `json:"timestampNs"`
+	ValueAggregate  *big.Int       `json:"valueAggregate"`
+	Metadata        Bytes          `json:"metadata"`
+}
+
+func (r *ReceiptAggregateVoucher) structHash() []byte {
+	return crypto.Keccak256(
+		ravTypeHash,
+		r.CollectionID.Bytes(),
+		common.BytesToHash(r.Payer.Bytes()).Bytes(),
+		common.BytesToHash(r.ServiceProvider.Bytes()).Bytes(),
+		common.BytesToHash(r.DataService.Bytes()).Bytes(),
+		uint64Word(r.TimestampNs),
+		common.BigToHash(r.ValueAggregate).Bytes(),
+		crypto.Keccak256(r.Metadata),
+	)
+}
+
+// AllocationID is the allocation the RAV collection is for.
+func (r *ReceiptAggregateVoucher) AllocationID() common.Address {
+	return common.BytesToAddress(r.CollectionID.Bytes())
+}
+
+type SignedReceipt struct {
+	Message   *Receipt `json:"message"`
+	Signature Bytes    `json:"signature"`
+}
+
+type SignedRAV struct {
+	Message   *ReceiptAggregateVoucher `json:"message"`
+	Signature Bytes                    `json:"signature"`
+}
+
+// SignReceipt signs the receipt in domain with key, the signature being
+// r ++ s ++ v.
+func SignReceipt(domain *Domain, receipt *Receipt, key *eth.PrivateKey) (*SignedReceipt, error) {
+	if err := domain.require(V2); err != nil {
+		return nil, err
+	}
+	if err := checkValue(receipt.Value); err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(domain.digest(receipt.structHash()), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedReceipt{Message: receipt, Signature: signature}, nil
+}
+
+// Recover returns the address that signed the receipt in domain.
+func (r *SignedReceipt) Recover(domain *Domain) (common.Address, error) {
+	if r.Message == nil {
+		return common.Address{}, fmt.Errorf("receipt has no message")
+	}
+	if err := domain.require(V2); err != nil {
+		return common.Address{}, err
+	}
+
+	return recoverSigner(domain.digest(r.Message.structHash()), r.Signature)
+}
+
+// SignRAV signs the RAV in domain with key, the signature being r ++ s ++ v.
+func SignRAV(domain *Domain, rav *ReceiptAggregateVoucher, key *eth.PrivateKey) (*SignedRAV, error) {
+	if err := domain.require(V2); err != nil {
+		return nil, err
+	}
+	if err := checkValue(rav.ValueAggregate); err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(domain.digest(rav.structHash()), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedRAV{Message: rav, Signature: signature}, nil
+}
+
+// Recover returns the address that signed the RAV in domain.
+func (r *SignedRAV) Recover(domain *Domain) (common.Address, error) {
+	if r.Message == nil {
+		return common.Address{}, fmt.Errorf("RAV has no message")
+	}
+	if err := domain.require(V2); err != nil {
+		return common.Address{}, err
+	}
+
+	return recoverSigner(domain.digest(r.Message.structHash()), r.Signature)
+}
+
+// Verify checks that the RAV was signed in domain by signer.
+func (r *SignedRAV) Verify(domain *Domain, signer common.Address) error {
+	recovered, err := r.Recover(domain)
+	if err != nil {
+		return err
+	}
+
+	if recovered != signer {
+		return fmt.Errorf("RAV was signed by %s, expected %s", eth.Address(recovered.Bytes()).Pretty(), eth.Address(signer.Bytes()).Pretty())
+	}
+
+	return nil
+}
+
+func sign(digest []byte, key *eth.PrivateKey) (Bytes, error) {
+	signature, err := key.Sign(digest)
+	if err != nil {
+		return nil, fmt.Errorf("error signing message: %w", err)
+	}
+	inverted := signature.ToInverted()
+
+	return Bytes(inverted[:]), nil
+}
+
+func recoverSigner(digest []byte, signature []byte) (common.Address, error) {
+	inverted, err := eth.NewInvertedSignatureFromBytes(signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	recovered, err := inverted.Recover(digest)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("error recovering address: %w", err)
+	}
+
+	return common.BytesToAddress(recovered.Bytes()), nil
+}
+
+func checkValue(value *big.Int) error {
+	if value == nil || value.Sign() < 0 {
+		return fmt.Errorf("value must not be negative")
+	}
+	if value.Cmp(maxValue) > 0 {
+		return fmt.Errorf("value %s overflows uint128", value)
+	}
+
+	return nil
+}
+
+func uint64Word(value uint64) []byte {
+	return common.BigToHash(new(big.Int).SetUint64(value)).Bytes()
+}
+
+// Bytes is 0x-prefixed hex in JSON.
+type Bytes []byte
+
+func (b Bytes) MarshalText() ([]byte, error) {
+	return []byte("0x" + hex.EncodeToString(b)), nil
+}
+
+func (b *Bytes) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(strings.TrimPrefix(string(text), "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid hex bytes: %w", err)
+	}
+
+	*b = decoded
+	return nil
+}
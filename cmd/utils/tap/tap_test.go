@@ -0,0 +1,344 @@
+package tap
+
+import (
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/streamingfast/eth-go"
+)
+
+// The vectors below are signed by the 0x42.. key in the domains of
+// testCollector (V2) and testVerifier (V1) on chain 42161. They were computed
+// with an EIP-712 encoder and RFC 6979 signer written apart from this
+// package.
+const (
+	testSigner    = "0x17c5185167401ed00cf5f5b2fc97d9bbfdb7d025"
+	testCollector = "0x1111111111111111111111111111111111111111"
+	testVerifier  = "0x2222222222222222222222222222222222222222"
+
+	receiptV2Digest    = "b3ed5e6534f1cec67410d91a9f8c661a718b2fb4c3ce38864eacdf1aa71f94b2"
+	receiptV2Signature = "3f7740c504b23690f2f1aa3e55bce35152c03f031683fb879ef668b4dd27130103d338436155aa3cd4af73cd6ac52ce0b3015dc2eaa597febd9580b59896dd021b"
+	ravV2Digest        = "c67f7597d9b2faf22a6089c55adee921ea19dd268e2e8cf9367708402465a41a"
+	ravV2Signature     = "ab85854a50891baf63280cc79a8add45afb9f5cb7e33a17c3f4bc1f9c1b761a97356a7bf971ca1aebc44570500cf4c83fa8d4526593f66def46d34dc7db553771b"
+	receiptV1Digest    = "9b742398cce3f477e2d8d155693c73f583d8a8d2d841aa96328fdba3a4c0e4de"
+	receiptV1Signature = "2b7da27115c29149bd7b2d064d813d79c48f783e45d1fd3da69005d3a9cef7d61fe9faf9f2f7c82df3447691ee416ac1239c86a629e9b8d55df3c567f0dd6d491c"
+	ravV1Digest        = "b467349b1d40289fe4113825063c3be407c3e5c7a909f06a51ed7c24e324fa33"
+	ravV1Signature     = "7a8f0e93c3f2efd92604e9d5418a4c0668ca1059e592d84be0d7180a6416d1491a64aea6299c72d9a52fb350172802f65e57023a3a534fad7a757d546b37233a1c"
+)
+
+var (
+	testAllocation      = common.HexToAddress("0x3333333333333333333333333333333333333333")
+	testPayer           = common.HexToAddress("0x4444444444444444444444444444444444444444")
+	testDataService     = common.HexToAddress("0x5555555555555555555555555555555555555555")
+	testServiceProvider = common.HexToAddress("0x6666666666666666666666666666666666666666")
+)
+
+const (
+	testTimestampNs uint64 = 1_700_000_000_000_000_000
+	testNonce       uint64 = 0x0102030405060708
+)
+
+func testKey(t *testing.T) *eth.PrivateKey {
+	t.Helper()
+
+	key, err := eth.NewPrivateKey(strings.Repeat("42", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func testDomains(t *testing.T) (v1, v2 *Domain) {
+	t.Helper()
+
+	v2, err := NewDomain(42161, testCollector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, err = NewV1Domain(42161, testVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v1, v2
+}
+
+func grt(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1_000_000_000_000_000_000))
+}
+
+func testReceipt() *Receipt {
+	return &Receipt{
+		CollectionID:    CollectionID(testAllocation),
+		Payer:           testPayer,
+		DataService:     testDataService,
+		ServiceProvider: testServiceProvider,
+		TimestampNs:     testTimestampNs,
+		Nonce:           testNonce,
+		Value:           grt(1),
+	}
+}
+
+func checkVector(t *testing.T, digest []byte, signature Bytes, wantDigest, wantSignature string) {
+	t.Helper()
+
+	if got := hex.EncodeToString(digest); got != wantDigest {
+		t.Errorf("digest %s, want %s", got, wantDigest)
+	}
+	if got := hex.EncodeToString(signature); got != wantSignature {
+		t.Errorf("signature %s, want %s", got, wantSignature)
+	}
+}
+
+func TestV2Vectors(t *testing.T) {
+	_, domain := testDomains(t)
+	key := testKey(t)
+
+	receipt, err := SignReceipt(domain, testReceipt(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVector(t, domain.digest(receipt.Message.structHash()), receipt.Signature, receiptV2Digest, receiptV2Signature)
+
+	rav, err := SignRAV(domain, &ReceiptAggregateVoucher{
+		CollectionID:    CollectionID(testAllocation),
+		Payer:           testPayer,
+		ServiceProvider: testServiceProvider,
+		DataService:     testDataService,
+		TimestampNs:     testTimestampNs,
+		ValueAggregate:  grt(3),
+		Metadata:        Bytes{},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVector(t, domain.digest(rav.Message.structHash()), rav.Signature, ravV2Digest, ravV2Signature)
+
+	if err := rav.Verify(domain, common.HexToAddress(testSigner)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestV1Vectors(t *testing.T) {
+	domain, _ := testDomains(t)
+	key := testKey(t)
+
+	receipt, err := SignReceiptV1(domain, &ReceiptV1{AllocationID: testAllocation, TimestampNs: testTimestampNs, Nonce: testNonce, Value: grt(1)}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVector(t, domain.digest(receipt.Message.structHash()), receipt.Signature, receiptV1Digest, receiptV1Signature)
+
+	rav, err := SignRAVV1(domain, &ReceiptAggregateVoucherV1{AllocationID: testAllocation, TimestampNs: testTimestampNs, ValueAggregate: grt(3)}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVector(t, domain.digest(rav.Message.structHash()), rav.Signature, ravV1Digest, ravV1Signature)
+
+	if err := rav.Verify(domain, common.HexToAddress(testSigner)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDomainVersionMismatch(t *testing.T) {
+	v1, v2 := testDomains(t)
+	key := testKey(t)
+
+	if _, err := SignReceipt(v1, testReceipt(), key); err == nil {
+		t.Error("V2 receipt signed in a V1 domain")
+	}
+	if _, err := SignReceiptV1(v2, &ReceiptV1{AllocationID: testAllocation, Value: grt(1)}, key); err == nil {
+		t.Error("V1 receipt signed in a V2 domain")
+	}
+
+	receipt, err := SignReceipt(v2, testReceipt(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receipt.Recover(v1); err == nil {
+		t.Error("V2 receipt recovered in a V1 domain")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	_, domain := testDomains(t)
+	key := testKey(t)
+
+	var receipts []*SignedReceipt
+	for i := uint64(1); i <= 3; i++ {
+		receipt := testReceipt()
+		receipt.TimestampNs += i
+		receipt.Nonce += i
+		signed, err := SignReceipt(domain, receipt, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipts = append(receipts, signed)
+	}
+
+	first, err := Aggregate(domain, receipts[:2], nil, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Message.ValueAggregate.Cmp(grt(2)) != 0 || first.Message.TimestampNs != testTimestampNs+2 {
+		t.Fatalf("RAV of %s at %d, want 2 GRT at the last receipt", first.Message.ValueAggregate, first.Message.TimestampNs)
+	}
+	if first.Message.AllocationID() != testAllocation {
+		t.Errorf("RAV allocation %s, want %s", first.Message.AllocationID().Hex(), testAllocation.Hex())
+	}
+
+	second, err := Aggregate(domain, receipts[2:], first, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Message.ValueAggregate.Cmp(grt(3)) != 0 {
+		t.Fatalf("RAV of %s, want the previous RAV plus the new receipt", second.Message.ValueAggregate)
+	}
+
+	otherKey, err := eth.NewPrivateKey(strings.Repeat("43", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCollection := testReceipt()
+	otherCollection.CollectionID = CollectionID(testPayer)
+	otherReceipt, err := SignReceipt(domain, otherCollection, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]struct {
+		receipts []*SignedReceipt
+		previous *SignedRAV
+		key      *eth.PrivateKey
+	}{
+		"no receipts":         {nil, nil, key},
+		"duplicate":           {[]*SignedReceipt{receipts[0], receipts[0]}, nil, key},
+		"other signer":        {receipts, nil, otherKey},
+		"other collection":    {[]*SignedReceipt{receipts[0], otherReceipt}, nil, key},
+		"already in previous": {receipts[1:], first, key},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Aggregate(domain, c.receipts, c.previous, c.key); err == nil {
+				t.Error("receipts aggregated")
+			}
+		})
+	}
+}
+
+func TestAggregateV1(t *testing.T) {
+	domain, _ := testDomains(t)
+	key := testKey(t)
+
+	var receipts []*SignedReceiptV1
+	for i := uint64(1); i <= 3; i++ {
+		signed, err := SignReceiptV1(domain, &ReceiptV1{AllocationID: testAllocation, TimestampNs: testTimestampNs + i, Nonce: testNonce + i, Value: grt(1)}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipts = append(receipts, signed)
+	}
+
+	first, err := AggregateV1(domain, receipts[:2], nil, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := AggregateV1(domain, receipts[2:], first, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Message.ValueAggregate.Cmp(grt(3)) != 0 || second.Message.TimestampNs != testTimestampNs+3 {
+		t.Fatalf("RAV of %s at %d, want 3 GRT at the last receipt", second.Message.ValueAggregate, second.Message.TimestampNs)
+	}
+
+	otherAllocation, err := SignReceiptV1(domain, &ReceiptV1{AllocationID: testPayer, TimestampNs: testTimestampNs + 4, Value: grt(1)}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AggregateV1(domain, []*SignedReceiptV1{receipts[2], otherAllocation}, nil, key); err == nil {
+		t.Error("receipts of two allocations aggregated")
+	}
+	if _, err := AggregateV1(domain, receipts[1:], first, key); err == nil {
+		t.Error("receipts already in the previous RAV aggregated")
+	}
+}
+
+func TestReadReceiptsAndRAV(t *testing.T) {
+	domain, _ := testDomains(t)
+	key := testKey(t)
+
+	receipt, err := SignReceiptV1(domain, &ReceiptV1{AllocationID: testAllocation, TimestampNs: testTimestampNs, Nonce: testNonce, Value: grt(1)}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a JSON line then a JSON array, as appended by `sendpayment tap receipt`
+	// and written by hand
+	line := `{"message":{"allocation_id":"` + testAllocation.Hex() + `","timestamp_ns":1700000000000000000,"nonce":72623859790382856,"value":1000000000000000000},"signature":"0x` + receiptV1Signature + `"}`
+	path := filepath.Join(t.TempDir(), "receipts.jsonl")
+	if err := os.WriteFile(path, []byte(line+"\n["+line+"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	receipts, err := ReadReceiptsV1(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("read %d receipts, want 2", len(receipts))
+	}
+	for _, read := range receipts {
+		message := read.Message
+		if string(read.Signature) != string(receipt.Signature) || message.AllocationID != testAllocation || message.TimestampNs != testTimestampNs || message.Nonce != testNonce || message.Value.Cmp(grt(1)) != 0 {
+			t.Fatalf("read %+v, want %+v", read.Message, receipt.Message)
+		}
+		if signer, err := read.Recover(domain); err != nil || signer != common.HexToAddress(testSigner) {
+			t.Fatalf("read receipt recovered to %s (%v), want %s", signer.Hex(), err, testSigner)
+		}
+	}
+
+	ravPath := filepath.Join(t.TempDir(), "rav.json")
+	if err := os.WriteFile(ravPath, []byte(`{"signature":"0x00"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRAVV1(ravPath); err == nil {
+		t.Error("RAV without message read")
+	}
+}
+
+func TestCollectDataRoundTrip(t *testing.T) {
+	_, domain := testDomains(t)
+
+	rav, err := SignRAV(domain, &ReceiptAggregateVoucher{
+		CollectionID:    CollectionID(testAllocation),
+		Payer:           testPayer,
+		ServiceProvider: testServiceProvider,
+		DataService:     testDataService,
+		TimestampNs:     testTimestampNs,
+		ValueAggregate:  grt(3),
+		Metadata:        Bytes{0xca, 0xfe},
+	}, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := EncodeCollectData(rav, grt(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, tokens, err := DecodeCollectData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.Cmp(grt(2)) != 0 {
+		t.Errorf("tokens to collect %s, want 2 GRT", tokens)
+	}
+	if err := decoded.Verify(domain, common.HexToAddress(testSigner)); err != nil {
+		t.Fatalf("decoded RAV: %s", err)
+	}
+}
@@ -0,0 +1,245 @@
+package tap
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/streamingfast/eth-go"
+)
+
+var (
+	receiptV1TypeHash = crypto.Keccak256([]byte("Receipt(address allocation_id,uint64 timestamp_ns,uint64 nonce,uint128 value)"))
+	ravV1TypeHash     = crypto.Keccak256([]byte("ReceiptAggregateVoucher(address allocationId,uint64 timestampNs,uint128 valueAggregate)"))
+)
+
+// ReceiptV1 is the fee of one query for an allocation, signed by a signer the
+// sender authorized on the TAP v1 Escrow.
+type ReceiptV1 struct {
+	AllocationID common.Address `json:"allocation_id"`
+	TimestampNs  uint64         `json:"timestamp_ns"`
+	Nonce        uint64         `json:"nonce"`
+	Value        *big.Int       `json:"value"`
+}
+
+func (r *ReceiptV1) structHash() []byte {
+	return crypto.Keccak256(
+		receiptV1TypeHash,
+		common.BytesToHash(r.AllocationID.Bytes()).Bytes(),
+		uint64Word(r.TimestampNs),
+		uint64Word(r.Nonce),
+		common.BigToHash(r.Value).Bytes(),
+	)
+}
+
+// ReceiptAggregateVoucherV1 is the sum of the receipts of an allocation up
+// to TimestampNs, what the TAP v1 Escrow pays out.
+type ReceiptAggregateVoucherV1 struct {
+	AllocationID   common.Address `json:"allocationId"`
+	TimestampNs    uint64         `json:"timestampNs"`
+	ValueAggregate *big.Int       `json:"valueAggregate"`
+}
+
+func (r *ReceiptAggregateVoucherV1) structHash() []byte {
+	return crypto.Keccak256(
+		ravV1TypeHash,
+		common.BytesToHash(r.AllocationID.Bytes()).Bytes(),
+		uint64Word(r.TimestampNs),
+		common.BigToHash(r.ValueAggregate).Bytes(),
+	)
+}
+
+type SignedReceiptV1 struct {
+	Message   *ReceiptV1 `json:"message"`
+	Signature Bytes      `json:"signature"`
+}
+
+type SignedRAVV1 struct {
+	Message   *ReceiptAggregateVoucherV1 `json:"message"`
+	Signature Bytes                      `json:"signature"`
+}
+
+// NewReceiptV1 is a receipt of value for the allocation, timestamped now
+// with a random nonce.
+func NewReceiptV1(allocationID common.Address, value *big.Int) (*ReceiptV1, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReceiptV1{
+		AllocationID: allocationID,
+		TimestampNs:  uint64(time.Now().UnixNano()),
+		Nonce:        nonce,
+		Value:        value,
+	}, nil
+}
+
+// SignReceiptV1 signs the receipt in the V1 domain with key, the signature
+// being r ++ s ++ v.
+func SignReceiptV1(domain *Domain, receipt *ReceiptV1, key *eth.PrivateKey) (*SignedReceiptV1, error) {
+	if err := domain.require(V1); err != nil {
+		return nil, err
+	}
+	if err := checkValue(receipt.Value); err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(domain.digest(receipt.structHash()), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedReceiptV1{Message: receipt, Signature: signature}, nil
+}
+
+// Recover returns the address that signed the receipt in domain.
+func (r *SignedReceiptV1) Recover(domain *Domain) (common.Address, error) {
+	if r.Message == nil {
+		return common.Address{}, fmt.Errorf("receipt has no message")
+	}
+	if err := domain.require(V1); err != nil {
+		return common.Address{}, err
+	}
+
+	return recoverSigner(domain.digest(r.Message.structHash()), r.Signature)
+}
+
+// SignRAVV1 signs the RAV in the V1 domain with key, the signature being
+// r ++ s ++ v.
+func SignRAVV1(domain *Domain, rav *ReceiptAggregateVoucherV1, key *eth.PrivateKey) (*SignedRAVV1, error) {
+	if err := domain.require(V1); err != nil {
+		return nil, err
+	}
+	if err := checkValue(rav.ValueAggregate); err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(domain.digest(rav.structHash()), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedRAVV1{Message: rav, Signature: signature}, nil
+}
+
+// Recover returns the address that signed the RAV in domain.
+func (r *SignedRAVV1) Recover(domain *Domain) (common.Address, error) {
+	if r.Message == nil {
+		return common.Address{}, fmt.Errorf("RAV has no message")
+	}
+	if err := domain.require(V1); err != nil {
+		return common.Address{}, err
+	}
+
+	return recoverSigner(domain.digest(r.Message.structHash()), r.Signature)
+}
+
+// Verify checks that the RAV was signed in domain by signer.
+func (r *SignedRAVV1) Verify(domain *Domain, signer common.Address) error {
+	recovered, err := r.Recover(domain)
+	if err != nil {
+		return err
+	}
+
+	if recovered != signer {
+		return fmt.Errorf("RAV was signed by %s, expected %s", eth.Address(recovered.Bytes()).Pretty(), eth.Address(signer.Bytes()).Pretty())
+	}
+
+	return nil
+}
+
+// AggregateV1 is Aggregate for V1 receipts, which must all be for the same
+// allocation.
+func AggregateV1(domain *Domain, receipts []*SignedReceiptV1, previous *SignedRAVV1, key *eth.PrivateKey) (*SignedRAVV1, error) {
+	if len(receipts) == 0 {
+		return nil, fmt.Errorf("no receipts to aggregate")
+	}
+
+	signer := common.BytesToAddress(key.PublicKey().Address().Bytes())
+	first := receipts[0].Message
+	if first == nil {
+		return nil, fmt.Errorf("receipt 0 has no message")
+	}
+
+	rav := &ReceiptAggregateVoucherV1{
+		AllocationID:   first.AllocationID,
+		ValueAggregate: big.NewInt(0),
+	}
+
+	if previous != nil {
+		if err := previous.Verify(domain, signer); err != nil {
+			return nil, fmt.Errorf("previous RAV: %w", err)
+		}
+		if previous.Message.AllocationID != rav.AllocationID {
+			return nil, fmt.Errorf("previous RAV is for allocation %s, expected %s", previous.Message.AllocationID.Hex(), rav.AllocationID.Hex())
+		}
+		rav.TimestampNs = previous.Message.TimestampNs
+		rav.ValueAggregate.Set(previous.Message.ValueAggregate)
+	}
+
+	seen := map[string]bool{}
+	for i, receipt := range receipts {
+		if receipt.Message == nil {
+			return nil, fmt.Errorf("receipt %d has no message", i)
+		}
+
+		recovered, err := receipt.Recover(domain)
+		if err != nil {
+			return nil, fmt.Errorf("receipt %d: %w", i, err)
+		}
+		if recovered != signer {
+			return nil, fmt.Errorf("receipt %d was signed by %s, expected %s", i, recovered.Hex(), signer.Hex())
+		}
+
+		if seen[string(receipt.Signature)] {
+			return nil, fmt.Errorf("receipt %d is a duplicate", i)
+		}
+		seen[string(receipt.Signature)] = true
+
+		message := receipt.Message
+		if message.AllocationID != rav.AllocationID {
+			return nil, fmt.Errorf("receipt %d is for allocation %s, expected %s", i, message.AllocationID.Hex(), rav.AllocationID.Hex())
+		}
+		if previous != nil && message.TimestampNs <= previous.Message.TimestampNs {
+			return nil, fmt.Errorf("receipt %d is not newer than the previous RAV, it was already aggregated", i)
+		}
+		if err := checkValue(message.Value); err != nil {
+			return nil, fmt.Errorf("receipt %d: %w", i, err)
+		}
+
+		rav.ValueAggregate.Add(rav.ValueAggregate, message.Value)
+		if message.TimestampNs > rav.TimestampNs {
+			rav.TimestampNs = message.TimestampNs
+		}
+	}
+
+	return SignRAVV1(domain, rav, key)
+}
+
+// SortReceiptsV1 orders receipts by timestamp, the order they were issued in.
+func SortReceiptsV1(receipts []*SignedReceiptV1) {
+	sort.SliceStable(receipts, func(i, j int) bool {
+		return receipts[i].Message.TimestampNs < receipts[j].Message.TimestampNs
+	})
+}
+
+// ReadReceiptsV1 is ReadReceipts for V1 receipts.
+func ReadReceiptsV1(path string) ([]*SignedReceiptV1, error) {
+	return readStream[SignedReceiptV1](path, "receipts")
+}
+
+func ReadRAVV1(path string) (*SignedRAVV1, error) {
+	rav := &SignedRAVV1{}
+	if err := readJSON(path, "RAV", rav); err != nil {
+		return nil, err
+	}
+	if rav.Message == nil {
+		return nil, fmt.Errorf("RAV %s has no message", path)
+	}
+
+	return rav, nil
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	ethrpc "github.com/streamingfast/eth-go/rpc"
+)
+
+// RequireTapEscrow checks that the profile has the TAP v1 Escrow contract.
+func (p *NetworkProfile) RequireTapEscrow() error {
+	if p.TapEscrow == "" {
+		return fmt.Errorf("network profile %s has no tap_escrow, the TAP escrow requires a network profile file with tap_escrow", p.Name)
+	}
+
+	return nil
+}
+
+// GetTapEscrowAccountCall reads the TAP v1 Escrow account of sender for
+// receiver, there is no collector.
+func GetTapEscrowAccountCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, sender, receiver eth.Address) (*EscrowAccount, error) {
+	out, err := contractCall(ctx, cli, profile.TapEscrow, "escrowAccounts(address,address) (uint256,uint256,uint256)", sender, receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EscrowAccount{
+		Payer:            sender,
+		Receiver:         receiver,
+		Balance:          out[0].(*big.Int),
+		TokensThawing:    out[1].(*big.Int),
+		ThawEndTimestamp: out[2].(*big.Int).Uint64(),
+	}, nil
+}
+
+// GetTapEscrowThawingPeriodCall is how long thawed tokens wait before they
+// can be withdrawn from the TAP v1 Escrow.
+func GetTapEscrowThawingPeriodCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile) (time.Duration, error) {
+	out, err := contractCall(ctx, cli, profile.TapEscrow, "withdrawEscrowThawingPeriod() (uint256)")
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(out[0].(*big.Int).Uint64()) * time.Second, nil
+}
+
+// GetTapRevokeSignerThawingPeriodCall is how long a signer keeps thawing
+// before its sender can revoke it.
+func GetTapRevokeSignerThawingPeriodCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile) (time.Duration, error) {
+	out, err := contractCall(ctx, cli, profile.TapEscrow, "revokeSignerThawingPeriod() (uint256)")
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(out[0].(*big.Int).Uint64()) * time.Second, nil
+}
+
+// TapSigner is the sender a signer is authorized for on the TAP v1 Escrow.
+// ThawEndTimestamp is zero when the signer is not thawing.
+type TapSigner struct {
+	Signer           eth.Address
+	Sender           eth.Address
+	ThawEndTimestamp uint64
+}
+
+func (s *TapSigner) Authorized() bool {
+	return !bytes.Equal(s.Sender, make([]byte, 20))
+}
+
+func (s *TapSigner) ThawEnd() time.Time {
+	return time.Unix(int64(s.ThawEndTimestamp), 0).UTC()
+}
+
+func GetTapSignerCall(ctx context.Context, cli *ethrpc.Client, profile *NetworkProfile, signer eth.Address) (*TapSigner, error) {
+	out, err := contractCall(ctx, cli, profile.TapEscrow, "authorizedSigners(address) (address,uint256)", signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TapSigner{
+		Signer:           signer,
+		Sender:           out[0].(eth.Address),
+		ThawEndTimestamp: out[1].(*big.Int).Uint64(),
+	}, nil
+}
@@ -4,103 +4,50 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 
-	"github.com/multiformats/go-multihash"
-
 	"github.com/streamingfast/eth-go"
 	"github.com/streamingfast/eth-go/rpc"
 )
 
-func getAccountNonce(ctx context.Context, fromAddr eth.Address, cli *rpc.Client) (uint64, error) {
-	nonce, err := cli.Nonce(ctx, fromAddr, rpc.LatestBlock)
-
-	if err != nil {
-		return 0, fmt.Errorf("unable to retrieve nonce for account %q: %w", fromAddr, err)
-	}
-
-	return nonce, nil
-}
-
-func MustGetAccountNonce(ctx context.Context, fromAddr eth.Address, cli *rpc.Client) uint64 {
-	nonce, err := getAccountNonce(ctx, fromAddr, cli)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return nonce
-
-}
-
-func getGasPrice(ctx context.Context, cli *rpc.Client) (*big.Int, error) {
-	gasPrice, err := cli.GasPrice(ctx)
-
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve gas price: %w", err)
-	}
-
-	return gasPrice, nil
-}
-
-func MustGetGasPrice(ctx context.Context, cli *rpc.Client) *big.Int {
-	gasPrice, err := getGasPrice(ctx, cli)
-
-	if err != nil {
-		panic(err)
-	}
-
-	gasPrice = gasPrice.Add(gasPrice, big.NewInt(300000))
-
-	return gasPrice
-}
-
-func getChainID(ctx context.Context, cli *rpc.Client) (*big.Int, error) {
-	chainId, err := cli.ChainID(ctx)
-
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve chain id: %w", err)
-	}
-
-	return chainId, nil
-}
-
-func MustGetChainID(ctx context.Context, cli *rpc.Client) *big.Int {
-	chainID, err := getChainID(ctx, cli)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return chainID
-}
+// receiptWaitTimeout is how long FetchReceiptWithProgress waits for a
+// transaction to be mined.
+var receiptWaitTimeout = 5 * time.Minute
 
+// FetchReceiptWithProgress waits for the receipt of trxHash, backing off
+// between attempts. It stops when ctx is done, and fails with a
+// *ReceiptNotFoundError when the transaction is still not mined after
+// receiptWaitTimeout.
 func FetchReceiptWithProgress(ctx context.Context, rpcClient *rpc.Client, trxHash eth.Hash) (*rpc.TransactionReceipt, error) {
 	backoff := 500 * time.Millisecond
-	maxWaitTime := 5 * time.Minute
 
-	startTime := time.Now()
+	deadline := time.NewTimer(receiptWaitTimeout)
+	defer deadline.Stop()
+
 	for {
 		receipt, err := rpcClient.TransactionReceipt(ctx, trxHash)
 		if err != nil {
 			return nil, err
 		}
+		if receipt != nil {
+			return receipt, nil
+		}
 
-		if receipt == nil {
-			if time.Since(startTime) > maxWaitTime {
-				fmt.Printf("Unable to find transaction receipt after %s, stopping here\n", maxWaitTime)
-				return nil, nil
-			}
-
-			time.Sleep(backoff)
-			if backoff < 12*time.Second {
-				backoff = backoff * 2
-			}
-
-			continue
+		wait := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return nil, ctx.Err()
+		case <-deadline.C:
+			wait.Stop()
+			return nil, &ReceiptNotFoundError{Trx: trxHash.Pretty(), Waited: receiptWaitTimeout}
+		case <-wait.C:
 		}
 
-		return receipt, nil
+		if backoff < 12*time.Second {
+			backoff = backoff * 2
+		}
 	}
 }
 
@@ -112,17 +59,49 @@ func ConvertToWei(amount uint64) *big.Int {
 	return tokenAmount
 }
 
-func ConvertIPFSHashToByteString(hash string) ([]byte, error) {
-	// Decode the base58 encoded hash
-	decoded, err := multihash.FromB58String(hash)
-	if err != nil {
-		return nil, fmt.Errorf("decoding base58 string: %w", err)
+// ParseGRT converts a decimal GRT amount, with up to 18 decimals, to wei.
+func ParseGRT(amount string) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if whole == "" && fraction == "" {
+		return nil, fmt.Errorf("empty GRT amount")
+	}
+	if len(fraction) > 18 {
+		return nil, fmt.Errorf("invalid GRT amount %q, at most 18 decimals are allowed", amount)
 	}
 
-	if len(decoded) == 34 {
-		// Remove the first two bytes (multicodec and multihash length)
-		decoded = decoded[2:]
+	wei, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", 18-len(fraction)), 10)
+	if !ok || wei.Sign() < 0 || strings.ContainsAny(whole+fraction, "+-") {
+		return nil, fmt.Errorf("invalid GRT amount %q", amount)
+	}
+
+	return wei, nil
+}
+
+// FormatGRT renders a wei amount as a decimal GRT amount, trimming trailing zeros.
+func FormatGRT(wei *big.Int) string {
+	return formatWei(wei) + " GRT"
+}
+
+// FormatETH renders a wei amount as a decimal ETH amount, trimming trailing zeros.
+func FormatETH(wei *big.Int) string {
+	return formatWei(wei) + " ETH"
+}
+
+func formatWei(wei *big.Int) string {
+	if wei == nil {
+		return "0"
+	}
+
+	unit := ConvertToWei(1)
+	whole, fraction := new(big.Int).QuoRem(new(big.Int).Abs(wei), unit, new(big.Int))
+
+	out := whole.String()
+	if fraction.Sign() != 0 {
+		out += "." + strings.TrimRight(fmt.Sprintf("%018s", fraction.String()), "0")
+	}
+	if wei.Sign() < 0 {
+		out = "-" + out
 	}
 
-	return decoded, nil
+	return out
 }